@@ -1,3 +1,5 @@
+// Lively Langs must be built with the sqlite_fts5 tag (go build -tags
+// sqlite_fts5), which search needs; without it, opening a database fails.
 package main
 
 import (
@@ -14,7 +16,14 @@ func main() {
 		Use:                   "lively-langs",
 		DisableFlagsInUseLine: true,
 	}
-	cmd.AddCommand(server.MakeCmd())
+	cmd.AddCommand(
+		server.MakeCmd(),
+		server.MakeDbCmd(),
+		server.MakeImportCmd(),
+		server.MakeExportCmd(),
+		server.MakeAnkiCmd(),
+		server.MakeTokenCmd(),
+	)
 	if err := cmd.Execute(); err != nil {
 		log.Fatal(err)
 	}
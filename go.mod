@@ -3,13 +3,15 @@ module github.com/johnietre/lively-langs
 go 1.19
 
 require (
+	github.com/johnietre/go-jmux v0.0.0-20241025204001-6d4d2d6ba455
+	github.com/johnietre/utils/go v0.0.0-20241115121718-801ae8cd3b5b
 	github.com/mattn/go-sqlite3 v1.14.24
 	github.com/spf13/cobra v1.8.1
+	golang.org/x/crypto v0.17.0
+	golang.org/x/text v0.14.0
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/johnietre/go-jmux v0.0.0-20241025204001-6d4d2d6ba455 // indirect
-	github.com/johnietre/utils/go v0.0.0-20241115121718-801ae8cd3b5b // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 )
@@ -0,0 +1,1020 @@
+package server
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// The max size of an uploaded .apkg (including media, which is ignored).
+	maxAnkiImportSize = 256 << 20
+	// The max size of the collection extracted from an .apkg.
+	maxAnkiCollectionSize = 1 << 30
+
+	defaultAnkiNoteType = "lively-langs"
+	defaultAnkiFields   = "Word=word,Definition=definition,Notes=notes,Audio=audio"
+)
+
+// AnkiField maps a field of an Anki note type to a field of a word (one of
+// wordColumns, or "audio" for the word's audio, which is only exported).
+type AnkiField struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// ParseAnkiFields parses a comma-separated list of fields in the form
+// NAME=SOURCE (e.g., "Front=word,Back=definition").
+func ParseAnkiFields(s string) ([]AnkiField, error) {
+	fields, seen := []AnkiField{}, map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		name, source, _ := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		source = strings.ToLower(strings.TrimSpace(source))
+		if name == "" || seen[strings.ToLower(name)] {
+			return nil, fmt.Errorf("%w: invalid field name %q", ErrInvalidAnkiFields, name)
+		}
+		seen[strings.ToLower(name)] = true
+		valid := source == "audio"
+		for _, col := range wordColumns {
+			valid = valid || source == col
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: invalid source %q", ErrInvalidAnkiFields, source)
+		}
+		fields = append(fields, AnkiField{Name: name, Source: source})
+	}
+	return fields, nil
+}
+
+// AnkiNoteType is the note type (model) that words are exported as.
+type AnkiNoteType struct {
+	Name string
+	// Fields must contain a field with the word as its source, which is used
+	// as the front of the card.
+	Fields []AnkiField
+}
+
+func (nt AnkiNoteType) validate() error {
+	if nt.Name == "" {
+		return fmt.Errorf("%w: missing note type name", ErrInvalidAnkiFields)
+	} else if nt.wordField() == -1 {
+		return fmt.Errorf("%w: missing word field", ErrInvalidAnkiFields)
+	}
+	return nil
+}
+
+func (nt AnkiNoteType) hasAudio() bool {
+	for _, field := range nt.Fields {
+		if field.Source == "audio" {
+			return true
+		}
+	}
+	return false
+}
+
+func (nt AnkiNoteType) wordField() int {
+	for i, field := range nt.Fields {
+		if field.Source == "word" {
+			return i
+		}
+	}
+	return -1
+}
+
+type AnkiImportOptions struct {
+	// Fields maps note fields to words by name (case-insensitive). Fields not
+	// in the map are ignored. If empty, fields are mapped by guessing from
+	// their names, falling back to the first 2 fields being the word and
+	// definition.
+	Fields []AnkiField
+	// Create creates the language if it doesn't exist.
+	Create bool
+	DryRun bool
+}
+
+// Handles exports of a language's words as an Anki deck (.apkg). The note type
+// can be set using the "noteType" and "fields" query params.
+func (s *Server) ankiExportHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	nt, err := ankiNoteTypeFromQuery(c)
+	if err != nil {
+		c.BadRequest(errRespJson(err.Error()))
+		return
+	}
+	// Get the language first so that errors can be reported before the
+	// response is started.
+	l, err := s.userDb(c).getLang(lang)
+	if err != nil {
+		if isUserError(err) {
+			c.BadRequest(errRespJson(err.Error()))
+		} else {
+			log.Printf("error getting lang %s: %v", lang, err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	hdr := c.RespHeader()
+	hdr.Set("Content-Type", "application/apkg")
+	hdr.Set(
+		"Content-Disposition",
+		mime.FormatMediaType(
+			"attachment", map[string]string{"filename": l.Name + ".apkg"},
+		),
+	)
+	err = s.userDb(c).exportAnki(lang, c.Writer, nt, s.media, time.Now())
+	if err != nil {
+		// The response has already been started so the error can't be sent.
+		log.Printf("error exporting anki deck for lang %s: %v", lang, err)
+	}
+}
+
+// Handles imports of Anki decks (.apkg). If "create" is true, the language is
+// created if it doesn't exist (which fails with 403 Forbidden for tokens
+// restricted to languages). The note fields can be mapped using the "fields"
+// query param.
+func (s *Server) ankiImportHandler(c *jmux.Context) {
+	lang, opts := c.Params["lang"], AnkiImportOptions{}
+	var err error
+	if opts.DryRun, err = queryBool(c, "dryRun"); err != nil {
+		c.WriteError(http.StatusBadRequest, "invalid value for 'dryRun'")
+		return
+	}
+	if opts.Create, err = queryBool(c, "create"); err != nil {
+		c.WriteError(http.StatusBadRequest, "invalid value for 'create'")
+		return
+	}
+	if opts.Fields, err = ParseAnkiFields(c.Query().Get("fields")); err != nil {
+		c.BadRequest(errRespJson(err.Error()))
+		return
+	}
+
+	// The package is a zip, which needs to be read from a file.
+	f, err := os.CreateTemp("", "lively-langs-*.apkg")
+	if err != nil {
+		log.Print("error creating temp file: ", err)
+		c.InternalServerError(errRespJson("internal server error"))
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxAnkiImportSize)
+	if _, err := io.Copy(f, body); err != nil {
+		if _, ok := errAs[*http.MaxBytesError](err); ok {
+			c.WriteError(http.StatusRequestEntityTooLarge, "file too large")
+		} else {
+			log.Print("error saving apkg: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	report, err := s.userDb(c).importAnki(lang, f.Name(), opts, time.Now())
+	code, resp := http.StatusOK, Response[ImportReport]{}
+	if err != nil {
+		if errors.Is(err, ErrForbidden) {
+			code, resp.Error = http.StatusForbidden, err.Error()
+		} else if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error importing anki deck to lang %s: %v", lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = report
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+func ankiNoteTypeFromQuery(c *jmux.Context) (AnkiNoteType, error) {
+	nt := AnkiNoteType{Name: c.Query().Get("noteType")}
+	if nt.Name == "" {
+		nt.Name = defaultAnkiNoteType
+	}
+	fieldsStr := c.Query().Get("fields")
+	if fieldsStr == "" {
+		fieldsStr = defaultAnkiFields
+	}
+	fields, err := ParseAnkiFields(fieldsStr)
+	if err != nil {
+		return nt, err
+	}
+	nt.Fields = fields
+	return nt, nt.validate()
+}
+
+const ankiSchema = `
+CREATE TABLE col (
+  id INTEGER PRIMARY KEY, crt INTEGER NOT NULL, mod INTEGER NOT NULL,
+  scm INTEGER NOT NULL, ver INTEGER NOT NULL, dty INTEGER NOT NULL,
+  usn INTEGER NOT NULL, ls INTEGER NOT NULL, conf TEXT NOT NULL,
+  models TEXT NOT NULL, decks TEXT NOT NULL, dconf TEXT NOT NULL,
+  tags TEXT NOT NULL
+);
+CREATE TABLE notes (
+  id INTEGER PRIMARY KEY, guid TEXT NOT NULL, mid INTEGER NOT NULL,
+  mod INTEGER NOT NULL, usn INTEGER NOT NULL, tags TEXT NOT NULL,
+  flds TEXT NOT NULL, sfld INTEGER NOT NULL, csum INTEGER NOT NULL,
+  flags INTEGER NOT NULL, data TEXT NOT NULL
+);
+CREATE TABLE cards (
+  id INTEGER PRIMARY KEY, nid INTEGER NOT NULL, did INTEGER NOT NULL,
+  ord INTEGER NOT NULL, mod INTEGER NOT NULL, usn INTEGER NOT NULL,
+  type INTEGER NOT NULL, queue INTEGER NOT NULL, due INTEGER NOT NULL,
+  ivl INTEGER NOT NULL, factor INTEGER NOT NULL, reps INTEGER NOT NULL,
+  lapses INTEGER NOT NULL, left INTEGER NOT NULL, odue INTEGER NOT NULL,
+  odid INTEGER NOT NULL, flags INTEGER NOT NULL, data TEXT NOT NULL
+);
+CREATE TABLE revlog (
+  id INTEGER PRIMARY KEY, cid INTEGER NOT NULL, usn INTEGER NOT NULL,
+  ease INTEGER NOT NULL, ivl INTEGER NOT NULL, lastIvl INTEGER NOT NULL,
+  factor INTEGER NOT NULL, time INTEGER NOT NULL, type INTEGER NOT NULL
+);
+CREATE TABLE graves (
+  usn INTEGER NOT NULL, oid INTEGER NOT NULL, type INTEGER NOT NULL
+);
+CREATE INDEX ix_notes_usn ON notes (usn);
+CREATE INDEX ix_cards_usn ON cards (usn);
+CREATE INDEX ix_revlog_usn ON revlog (usn);
+CREATE INDEX ix_cards_nid ON cards (nid);
+CREATE INDEX ix_cards_sched ON cards (did, queue, due);
+CREATE INDEX ix_revlog_cid ON revlog (cid);
+CREATE INDEX ix_notes_csum ON notes (csum);
+`
+
+// Anki card types and queues.
+const (
+	ankiCardNew        = 0
+	ankiCardLearning   = 1
+	ankiCardReview     = 2
+	ankiCardRelearning = 3
+
+	ankiQueueLearning    = 1
+	ankiQueueDayLearning = 3
+
+	ankiDefaultFactor = 2500
+)
+
+// Writes the language's words to w as an Anki package. Reviewed words are
+// exported as review cards with their due dates, intervals, and ease. The
+// words' audio is read from media and included if the note type has an audio
+// field.
+func (db *DB) exportAnki(
+	lang string,
+	w io.Writer,
+	nt AnkiNoteType,
+	media mediaStore,
+	now time.Time,
+) error {
+	if err := nt.validate(); err != nil {
+		return err
+	}
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return err
+	}
+	l, err := db.getLangById(langId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(
+		`SELECT `+reviewItemCols+`
+FROM words LEFT JOIN review_states ON review_states.word_id=words.id
+WHERE words.lang_id=? AND words.deleted_at IS NULL
+ORDER BY words.word`+collateClause(l.tag())+`,words.id`,
+		langId,
+	)
+	if err != nil {
+		return err
+	}
+	items := []ReviewItem{}
+	for rows.Next() {
+		item, err := scanReviewItem(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "lively-langs-anki-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	colPath := filepath.Join(dir, "collection.anki2")
+	if err := writeAnkiCollection(colPath, l, items, nt, now); err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name: "collection.anki2", Method: zip.Deflate, Modified: now,
+	})
+	if err != nil {
+		return err
+	}
+	colFile, err := os.Open(colPath)
+	if err != nil {
+		return err
+	}
+	defer colFile.Close()
+	if _, err := io.Copy(fw, colFile); err != nil {
+		return err
+	}
+	// Media files are numbered, with the "media" file mapping them to the
+	// names used in fields.
+	mediaNames := map[string]string{}
+	if nt.hasAudio() {
+		seen := map[string]bool{}
+		for _, item := range items {
+			audio := item.Word.Audio
+			if audio == nil || seen[audio.Hash] {
+				continue
+			}
+			seen[audio.Hash] = true
+			num := fmt.Sprint(len(mediaNames))
+			if err := writeAnkiMedia(zw, num, media, audio.Hash, now); err != nil {
+				return err
+			}
+			mediaNames[num] = audio.fileName()
+		}
+	}
+	fw, err = zw.CreateHeader(&zip.FileHeader{
+		Name: "media", Method: zip.Deflate, Modified: now,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, jsonStr(mediaNames)); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Copies the media file with the hash to the package as the given name.
+func writeAnkiMedia(
+	zw *zip.Writer,
+	name string,
+	media mediaStore,
+	hash string,
+	now time.Time,
+) error {
+	f, err := media.open(hash)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Audio is already compressed.
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name: name, Method: zip.Store, Modified: now,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, f)
+	return err
+}
+
+func writeAnkiCollection(
+	path string,
+	lang Lang,
+	items []ReviewItem,
+	nt AnkiNoteType,
+	now time.Time,
+) error {
+	col, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer col.Close()
+	if _, err := col.Exec(ankiSchema); err != nil {
+		return err
+	}
+
+	// Card due dates are days since the collection's creation, so it's set to
+	// the start of the day of the earliest review to keep them positive.
+	crtTime := now
+	for _, item := range items {
+		if item.Review != nil && item.Review.LastReview < crtTime.Unix() {
+			crtTime = time.Unix(item.Review.LastReview, 0)
+		}
+	}
+	y, m, d := crtTime.Date()
+	crt := time.Date(y, m, d, 0, 0, 0, 0, crtTime.Location()).Unix()
+	nowSecs, nowMs := now.Unix(), now.UnixMilli()
+	modelId, deckId := ankiId("model:"+nt.Name), ankiId("deck:"+lang.Name)
+	wordField := nt.wordField()
+
+	tx, err := col.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	conf := map[string]any{
+		"nextPos": len(items) + 1, "estTimes": true, "activeDecks": []int64{1},
+		"sortType": "noteFld", "timeLim": 0, "sortBackwards": false,
+		"addToCur": true, "curDeck": 1, "newBury": true, "newSpread": 0,
+		"dueCounts": true, "curModel": modelId, "collapseTime": 1200,
+	}
+	_, err = tx.Exec(
+		`INSERT INTO col VALUES (1,?,?,?,11,0,0,0,?,?,?,?,'{}')`,
+		crt, nowMs, nowMs,
+		jsonStr(conf),
+		jsonStr(map[string]any{fmt.Sprint(modelId): ankiModel(nt, modelId, deckId, nowSecs)}),
+		jsonStr(map[string]any{
+			"1":                ankiDeck(1, "Default", nowSecs),
+			fmt.Sprint(deckId): ankiDeck(deckId, lang.Name, nowSecs),
+		}),
+		jsonStr(map[string]any{"1": ankiDeckConf()}),
+	)
+	if err != nil {
+		return err
+	}
+
+	for i, item := range items {
+		word, id := item.Word, nowMs+int64(i)
+		flds := make([]string, len(nt.Fields))
+		for j, field := range nt.Fields {
+			if field.Source != "audio" {
+				flds[j] = textToHtml(wordFieldValue(word, field.Source))
+			} else if word.Audio != nil {
+				flds[j] = "[sound:" + word.Audio.fileName() + "]"
+			}
+		}
+		_, err = tx.Exec(
+			`INSERT INTO notes VALUES (?,?,?,?,-1,?,?,?,?,0,'')`,
+			id, fmt.Sprintf("ll-%d-%d", lang.Id, word.Id), modelId, nowSecs,
+			ankiTags(word.Tags), strings.Join(flds, "\x1f"), word.Word,
+			ankiChecksum(flds[wordField]),
+		)
+		if err != nil {
+			return err
+		}
+
+		typ, due, ivl, factor, reps, lapses := ankiCardNew, int64(i+1), 0, 0, 0, 0
+		if rs := item.Review; rs != nil {
+			typ = ankiCardReview
+			due = (rs.Due - crt) / (24 * 60 * 60)
+			ivl = int(math.Max(1, math.Round(rs.Interval)))
+			factor = int(math.Round(rs.Ease * 1000))
+			if factor == 0 {
+				factor = ankiDefaultFactor
+			}
+			reps, lapses = int(rs.Repetitions), int(rs.Lapses)
+		}
+		_, err = tx.Exec(
+			`INSERT INTO cards VALUES (?,?,?,0,?,-1,?,?,?,?,?,?,?,0,0,0,0,'')`,
+			id, id, deckId, nowSecs, typ, typ, due, ivl, factor, reps, lapses,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func ankiModel(nt AnkiNoteType, id, deckId, mod int64) map[string]any {
+	wordField := nt.wordField()
+	flds := make([]map[string]any, len(nt.Fields))
+	afmt := "{{FrontSide}}\n\n<hr id=answer>\n\n"
+	for i, field := range nt.Fields {
+		flds[i] = map[string]any{
+			"name": field.Name, "ord": i, "sticky": false, "rtl": false,
+			"font": "Arial", "size": 20, "media": []any{},
+		}
+		if i != wordField {
+			afmt += fmt.Sprintf(
+				"{{#%[1]s}}<div>{{%[1]s}}</div>{{/%[1]s}}\n", field.Name,
+			)
+		}
+	}
+	return map[string]any{
+		"id": id, "name": nt.Name, "type": 0, "mod": mod, "usn": -1,
+		"sortf": wordField, "did": deckId, "flds": flds,
+		"tmpls": []map[string]any{{
+			"name": "Card 1", "ord": 0, "did": nil, "bqfmt": "", "bafmt": "",
+			"qfmt": "{{" + nt.Fields[wordField].Name + "}}", "afmt": afmt,
+		}},
+		"css": ".card { font-family: arial; font-size: 20px; text-align: center; }",
+		"latexPre": "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n" +
+			"\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n" +
+			"\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+		"tags":      []any{}, "vers": []any{},
+		"req": []any{[]any{0, "all", []int{wordField}}},
+	}
+}
+
+func ankiDeck(id int64, name string, mod int64) map[string]any {
+	return map[string]any{
+		"id": id, "name": name, "mod": mod, "usn": -1, "conf": 1, "desc": "",
+		"dyn": 0, "collapsed": false, "extendNew": 10, "extendRev": 50,
+		"newToday": []int{0, 0}, "revToday": []int{0, 0},
+		"lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+	}
+}
+
+func ankiDeckConf() map[string]any {
+	return map[string]any{
+		"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60,
+		"autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+		"new": map[string]any{
+			"delays": []float64{1, 10}, "ints": []int{1, 4, 7},
+			"initialFactor": ankiDefaultFactor, "order": 1, "perDay": 20,
+			"bury": false, "separate": true,
+		},
+		"rev": map[string]any{
+			"perDay": 200, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1,
+			"maxIvl": 36500, "bury": false, "minSpace": 1,
+		},
+		"lapse": map[string]any{
+			"delays": []float64{10}, "mult": 0, "minInt": 1, "leechFails": 8,
+			"leechAction": 0,
+		},
+	}
+}
+
+// Generates a stable ID for models and decks so that re-imported decks update
+// the existing ones in Anki.
+func ankiId(s string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return 1<<40 | int64(h.Sum32())
+}
+
+// The checksum Anki uses to find duplicate notes: the first 8 hex digits of
+// the SHA-1 of the field with HTML stripped.
+func ankiChecksum(field string) int64 {
+	sum := sha1.Sum([]byte(htmlToText(field)))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
+
+func jsonStr(v any) string {
+	return string(jtutils.Must(json.Marshal(v)))
+}
+
+var (
+	htmlBreakRegex = regexp.MustCompile(`(?i)<br\s*/?>|</?(div|p)\b[^>]*>`)
+	htmlTagRegex   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Converts an Anki field to plain text.
+func htmlToText(s string) string {
+	s = htmlBreakRegex.ReplaceAllString(s, "\n")
+	s = htmlTagRegex.ReplaceAllString(s, "")
+	lines := strings.Split(html.UnescapeString(s), "\n")
+	lines = jtutils.FilterSliceInPlace(lines, func(line string) bool {
+		return strings.TrimSpace(line) != ""
+	})
+	return normalizeText(strings.Join(lines, "\n"))
+}
+
+// Converts plain text to an Anki field.
+func textToHtml(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+// Imports the notes of the Anki package at the given path as words. The first
+// card of each note that is in review has its interval, ease, and due date
+// imported as the word's review state.
+func (db *DB) importAnki(
+	lang, path string,
+	opts AnkiImportOptions,
+	now time.Time,
+) (ImportReport, error) {
+	report := ImportReport{
+		DryRun:     opts.DryRun,
+		Duplicates: []ImportRowIssue{},
+		Invalid:    []ImportRowIssue{},
+	}
+
+	dir, err := os.MkdirTemp("", "lively-langs-anki-")
+	if err != nil {
+		return report, err
+	}
+	defer os.RemoveAll(dir)
+	colPath, err := extractAnkiCollection(path, dir)
+	if err != nil {
+		return report, err
+	}
+	col, err := sql.Open("sqlite3", "file:"+colPath+"?mode=ro")
+	if err != nil {
+		return report, err
+	}
+	defer col.Close()
+
+	crt, modelsStr := int64(0), ""
+	err = col.QueryRow(`SELECT crt,models FROM col`).Scan(&crt, &modelsStr)
+	if err != nil {
+		if _, ok := errAs[sqlite3.Error](err); ok || errors.Is(err, sql.ErrNoRows) {
+			return report, fmt.Errorf("%w: invalid collection", ErrInvalidAnkiPackage)
+		}
+		return report, err
+	}
+	models := map[string]struct {
+		Flds []struct {
+			Name string `json:"name"`
+			Ord  int    `json:"ord"`
+		} `json:"flds"`
+	}{}
+	if err := json.Unmarshal([]byte(modelsStr), &models); err != nil {
+		return report, fmt.Errorf("%w: invalid note types", ErrInvalidAnkiPackage)
+	}
+	// Maps each model's fields (by ord) to word fields.
+	sources := map[string][]string{}
+	for mid, model := range models {
+		names := make([]string, len(model.Flds))
+		for _, fld := range model.Flds {
+			if fld.Ord >= 0 && fld.Ord < len(names) {
+				names[fld.Ord] = fld.Name
+			}
+		}
+		sources[mid] = ankiFieldSources(names, opts.Fields)
+	}
+
+	langId, err := db.getLangId(lang)
+	create := errors.Is(err, ErrNoLangFound) && opts.Create
+	l := Lang{}
+	if err != nil && !create {
+		return report, err
+	} else if !create {
+		if l, err = db.getLangById(langId); err != nil {
+			return report, err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	if create {
+		l = Lang{Name: lang}
+		if err := db.insertLang(tx, &l); err != nil {
+			return report, err
+		}
+		err := db.recordRevision(tx, Revision{
+			Kind: RevisionLang, ItemId: l.Id, LangId: l.Id,
+			Action: RevisionInsert, CreatedAt: now.Unix(),
+		}, nil, l)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	rows, err := col.Query(`SELECT notes.mid,notes.flds,notes.tags,
+  IFNULL(cards.type,0),IFNULL(cards.queue,0),IFNULL(cards.due,0),
+  IFNULL(cards.ivl,0),IFNULL(cards.factor,0),IFNULL(cards.reps,0),
+  IFNULL(cards.lapses,0),
+  IFNULL((SELECT MAX(id) FROM revlog WHERE cid=cards.id),0)
+FROM notes LEFT JOIN cards ON cards.id=(
+  SELECT id FROM cards WHERE nid=notes.id ORDER BY ord LIMIT 1
+)
+ORDER BY notes.id`)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	wi := db.newWordImporter(tx, l, &report, now)
+	for row := 1; rows.Next(); row++ {
+		var mid, flds, tags string
+		var card ankiCard
+		err := rows.Scan(
+			&mid, &flds, &tags, &card.typ, &card.queue, &card.due, &card.ivl,
+			&card.factor, &card.reps, &card.lapses, &card.lastReview,
+		)
+		if err != nil {
+			return report, err
+		}
+		report.Total++
+
+		word, srcs := Word{}, sources[mid]
+		for i, field := range strings.Split(flds, "\x1f") {
+			if i >= len(srcs) {
+				break
+			}
+			setWordField(&word, srcs[i], htmlToText(field))
+		}
+		word.Tags = append(word.Tags, strings.Fields(tags)...)
+		word = word.normalized()
+		added, err := wi.add(row, &word)
+		if err != nil {
+			return report, err
+		} else if !added {
+			continue
+		}
+		if rs, ok := card.reviewState(word.Id, crt); ok {
+			if err := saveReviewState(tx, rs); err != nil {
+				return report, err
+			}
+			report.Scheduled++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+	return report, tx.Commit()
+}
+
+type ankiCard struct {
+	typ, queue                     int
+	due, ivl, factor, reps, lapses int64
+	lastReview                     int64
+}
+
+// Converts the card's scheduling to a review state, if the card is in review.
+func (c ankiCard) reviewState(wordId, crt int64) (ReviewState, bool) {
+	if c.typ != ankiCardReview && c.typ != ankiCardRelearning {
+		return ReviewState{}, false
+	}
+	const day = 24 * 60 * 60
+	rs := ReviewState{
+		WordId:      wordId,
+		Algorithm:   SchedulerSM2,
+		Ease:        math.Max(float64(c.factor)/1000, sm2MinEase),
+		Interval:    math.Max(float64(c.ivl), 1),
+		Repetitions: c.reps - c.lapses,
+		Lapses:      c.lapses,
+	}
+	// SM-2 only multiplies the interval by the ease after 2 repetitions.
+	if rs.Repetitions < 2 {
+		rs.Repetitions = 2
+	}
+	if c.queue == ankiQueueLearning {
+		// Due is a timestamp for cards being (re)learned within a day.
+		rs.Due = c.due
+	} else {
+		rs.Due = crt + c.due*day
+	}
+	// Revlog IDs are the review times in milliseconds.
+	rs.LastReview = c.lastReview / 1000
+	if rs.LastReview == 0 {
+		rs.LastReview = rs.Due - int64(rs.Interval*day)
+	}
+	return rs, true
+}
+
+// Extracts the collection from the package into dir, returning its path.
+func extractAnkiCollection(path, dir string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		if errors.Is(err, zip.ErrFormat) {
+			return "", fmt.Errorf("%w: not a zip file", ErrInvalidAnkiPackage)
+		}
+		return "", err
+	}
+	defer zr.Close()
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	// Newer versions include a legacy collection.anki2 that only contains a
+	// note asking to update Anki, so the newer collection is preferred.
+	f := files["collection.anki21"]
+	if f == nil {
+		if files["collection.anki21b"] != nil {
+			return "", fmt.Errorf(
+				"%w: unsupported collection version "+
+					"(export with \"Support older Anki versions\" checked)",
+				ErrInvalidAnkiPackage,
+			)
+		}
+		f = files["collection.anki2"]
+	}
+	if f == nil {
+		return "", fmt.Errorf("%w: missing collection", ErrInvalidAnkiPackage)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAnkiPackage, err)
+	}
+	defer rc.Close()
+	colPath := filepath.Join(dir, "collection.anki2")
+	out, err := os.Create(colPath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	n, err := io.Copy(out, io.LimitReader(rc, maxAnkiCollectionSize+1))
+	if err != nil {
+		if errors.Is(err, zip.ErrChecksum) || errors.Is(err, zip.ErrFormat) {
+			err = fmt.Errorf("%w: %v", ErrInvalidAnkiPackage, err)
+		}
+		return "", err
+	} else if n > maxAnkiCollectionSize {
+		return "", fmt.Errorf("%w: collection too large", ErrInvalidAnkiPackage)
+	}
+	return colPath, out.Close()
+}
+
+// Formats the tags as Anki note tags, which are separated (and surrounded) by
+// spaces.
+func ankiTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return " " + strings.Join(
+		jtutils.MapSlice(tags, func(tag string) string {
+			return strings.Join(strings.Fields(tag), "_")
+		}),
+		" ",
+	) + " "
+}
+
+// Names of note fields (lowercase) that are guessed to map to word fields.
+var ankiFieldGuesses = map[string]string{
+	"word": "word", "front": "word", "expression": "word",
+	"vocabulary": "word", "definition": "definition", "back": "definition",
+	"meaning": "definition", "aliases": "aliases", "notes": "notes",
+	"extra": "notes", "example": "notes", "pos": "pos", "part of speech": "pos",
+	"gender": "gender", "plural": "plural", "register": "register",
+	"cefr": "cefr", "level": "cefr", "tags": "tags",
+}
+
+// Returns the word field for each of the note fields (empty if ignored).
+func ankiFieldSources(names []string, fields []AnkiField) []string {
+	sources := make([]string, len(names))
+	if len(fields) != 0 {
+		for i, name := range names {
+			for _, field := range fields {
+				if strings.EqualFold(name, field.Name) {
+					sources[i] = field.Source
+				}
+			}
+		}
+		return sources
+	}
+
+	hasWord, hasDef := false, false
+	for i, name := range names {
+		source := ankiFieldGuesses[strings.ToLower(strings.TrimSpace(name))]
+		if (source == "word" && hasWord) || (source == "definition" && hasDef) {
+			continue
+		}
+		sources[i] = source
+		hasWord, hasDef = hasWord || source == "word", hasDef || source == "definition"
+	}
+	if !hasWord && len(sources) > 0 {
+		sources[0], hasDef = "word", hasDef && sources[0] != "definition"
+	}
+	if !hasDef && len(sources) > 1 && sources[1] == "" {
+		sources[1] = "definition"
+	}
+	return sources
+}
+
+func MakeAnkiCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "anki",
+		Short:                 "Import and export Anki decks (.apkg)",
+		DisableFlagsInUseLine: true,
+	}
+	cmd.PersistentFlags().String("db", "lively-langs.db", "Path to database")
+	cmd.PersistentFlags().String("user", "", "User whose languages to use")
+	cmd.PersistentFlags().String("lang", "", "Language (name or ID)")
+	cmd.MarkPersistentFlagRequired("lang")
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export a language's words as an Anki deck",
+		Args:  cobra.NoArgs,
+		Run:   runAnkiExport,
+	}
+	flags := exportCmd.Flags()
+	flags.StringP("out", "o", "", "File to write to (default LANG.apkg)")
+	flags.String("note-type", defaultAnkiNoteType, "Name of the note type")
+	flags.String(
+		"fields", defaultAnkiFields,
+		"Fields of the note type and their sources (word, definition, aliases, notes, audio, ...)",
+	)
+	flags.String("media", "./media", "Path to the media dir (for audio)")
+	cmd.AddCommand(exportCmd)
+
+	importCmd := &cobra.Command{
+		Use:   "import [flags] FILE",
+		Short: "Import an Anki deck into a language",
+		Args:  cobra.ExactArgs(1),
+		Run:   runAnkiImport,
+	}
+	flags = importCmd.Flags()
+	flags.Bool("create", false, "Create the language if it doesn't exist")
+	flags.Bool("dry-run", false, "Report what would be imported without importing")
+	flags.String(
+		"fields", "",
+		"Note fields to import and their destinations, e.g., Front=word,Back=definition "+
+			"(guessed from the field names by default)",
+	)
+	cmd.AddCommand(importCmd)
+
+	return cmd
+}
+
+func runAnkiExport(cmd *cobra.Command, _ []string) {
+	log.SetFlags(0)
+
+	flags := cmd.Flags()
+	lang, _ := flags.GetString("lang")
+	path, _ := flags.GetString("out")
+	nt := AnkiNoteType{Name: jtutils.First(flags.GetString("note-type"))}
+	fields, err := ParseAnkiFields(jtutils.First(flags.GetString("fields")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	nt.Fields = fields
+	if err := nt.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := openCmdDb(cmd)
+	if err != nil {
+		log.Fatal("error opening database: ", err)
+	}
+	defer db.Close()
+	l, err := db.getLang(lang)
+	if err != nil {
+		log.Fatal("error getting language: ", err)
+	}
+	if path == "" {
+		path = l.Name + ".apkg"
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal("error creating file: ", err)
+	}
+	defer f.Close()
+	media := mediaStore{dir: jtutils.First(flags.GetString("media"))}
+	if err := db.exportAnki(lang, f, nt, media, time.Now()); err != nil {
+		log.Fatal("error exporting: ", err)
+	}
+	fmt.Println("exported to", path)
+}
+
+func runAnkiImport(cmd *cobra.Command, args []string) {
+	log.SetFlags(0)
+
+	flags := cmd.Flags()
+	lang, _ := flags.GetString("lang")
+	opts := AnkiImportOptions{
+		Create: jtutils.First(flags.GetBool("create")),
+		DryRun: jtutils.First(flags.GetBool("dry-run")),
+	}
+	fields, err := ParseAnkiFields(jtutils.First(flags.GetString("fields")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts.Fields = fields
+
+	db, err := openCmdDb(cmd)
+	if err != nil {
+		log.Fatal("error opening database: ", err)
+	}
+	defer db.Close()
+
+	report, err := db.importAnki(lang, args[0], opts, time.Now())
+	if err != nil {
+		log.Fatal("error importing: ", err)
+	}
+	printImportReport(report)
+}
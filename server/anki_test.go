@@ -0,0 +1,264 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseAnkiFields(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []AnkiField
+		ok   bool
+	}{
+		{"", []AnkiField{}, true},
+		{
+			"Front=word, Back = Definition,",
+			[]AnkiField{{"Front", "word"}, {"Back", "definition"}},
+			true,
+		},
+		{"Sound=audio", []AnkiField{{"Sound", "audio"}}, true},
+		{"Front=word,front=definition", nil, false},
+		{"=word", nil, false},
+		{"Front=meaning", nil, false},
+		{"Front", nil, false},
+	}
+	for _, test := range tests {
+		fields, err := ParseAnkiFields(test.s)
+		if !test.ok {
+			if !errors.Is(err, ErrInvalidAnkiFields) {
+				t.Errorf("ParseAnkiFields(%q): expected ErrInvalidAnkiFields, got %v", test.s, err)
+			}
+		} else if err != nil || fmt.Sprint(fields) != fmt.Sprint(test.want) {
+			t.Errorf("ParseAnkiFields(%q): expected %v, got %v (%v)", test.s, test.want, fields, err)
+		}
+	}
+}
+
+func TestAnkiFieldSources(t *testing.T) {
+	tests := []struct {
+		names  []string
+		fields []AnkiField
+		want   []string
+	}{
+		{[]string{"Front", "Back"}, nil, []string{"word", "definition"}},
+		{[]string{"Expression", "Meaning", "Extra"}, nil, []string{"word", "definition", "notes"}},
+		// Unknown fields fall back to the first 2 being the word and definition.
+		{[]string{"A", "B", "C"}, nil, []string{"word", "definition", ""}},
+		{[]string{"Notes", "Word"}, nil, []string{"notes", "word"}},
+		{[]string{"Back", "Front"}, nil, []string{"definition", "word"}},
+		// Only the first word field is used, so the second is the definition.
+		{[]string{"Word", "Front", "X"}, nil, []string{"word", "definition", ""}},
+		{
+			[]string{"Front", "Back", "Other"},
+			[]AnkiField{{"back", "word"}, {"other", "notes"}},
+			[]string{"", "word", "notes"},
+		},
+		{[]string{}, nil, []string{}},
+	}
+	for _, test := range tests {
+		got := ankiFieldSources(test.names, test.fields)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf(
+				"ankiFieldSources(%v, %v): expected %q, got %q",
+				test.names, test.fields, test.want, got,
+			)
+		}
+	}
+}
+
+func TestHtmlToText(t *testing.T) {
+	tests := []struct {
+		html, want string
+	}{
+		{"perro", "perro"},
+		{"<b>el</b> perro", "el perro"},
+		{"line 1<br>line 2<BR />line 3", "line 1\nline 2\nline 3"},
+		{"<div>a</div><div>b</div>", "a\nb"},
+		{"fish &amp; chips &lt;3", "fish & chips <3"},
+		{"<div><br></div> x ", "x"},
+	}
+	for _, test := range tests {
+		if got := htmlToText(test.html); got != test.want {
+			t.Errorf("htmlToText(%q): expected %q, got %q", test.html, test.want, got)
+		}
+	}
+	if got := htmlToText(textToHtml("a < b\nc & d")); got != "a < b\nc & d" {
+		t.Errorf("expected textToHtml to round trip, got %q", got)
+	}
+}
+
+func TestAnkiTags(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"animals"}, " animals "},
+		{[]string{"animals", "house pets"}, " animals house_pets "},
+	}
+	for _, test := range tests {
+		if got := ankiTags(test.tags); got != test.want {
+			t.Errorf("ankiTags(%q): expected %q, got %q", test.tags, test.want, got)
+		}
+	}
+}
+
+func TestAnkiCardReviewState(t *testing.T) {
+	const day = 24 * 60 * 60
+	crt := int64(1_700_000_000)
+	tests := []struct {
+		name string
+		card ankiCard
+		ok   bool
+		want ReviewState
+	}{
+		{"new", ankiCard{typ: ankiCardNew}, false, ReviewState{}},
+		{"learning", ankiCard{typ: ankiCardLearning}, false, ReviewState{}},
+		{
+			"review",
+			ankiCard{
+				typ: ankiCardReview, due: 10, ivl: 5, factor: 2300, reps: 6,
+				lapses: 1, lastReview: (crt + 5*day) * 1000,
+			},
+			true,
+			ReviewState{
+				Ease: 2.3, Interval: 5, Repetitions: 5, Lapses: 1,
+				Due: crt + 10*day, LastReview: crt + 5*day,
+			},
+		},
+		{
+			"relearning without revlog",
+			ankiCard{
+				typ: ankiCardRelearning, queue: ankiQueueLearning, due: crt + 600,
+				ivl: 0, factor: 1000, reps: 2, lapses: 1,
+			},
+			true,
+			ReviewState{
+				Ease: sm2MinEase, Interval: 1, Repetitions: 2, Lapses: 1,
+				Due: crt + 600, LastReview: crt + 600 - day,
+			},
+		},
+	}
+	for _, test := range tests {
+		rs, ok := test.card.reviewState(1, crt)
+		if ok != test.ok {
+			t.Errorf("%s: expected ok=%v", test.name, test.ok)
+			continue
+		} else if !ok {
+			continue
+		}
+		test.want.WordId, test.want.Algorithm = 1, SchedulerSM2
+		if rs != test.want {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.want, rs)
+		}
+	}
+}
+
+// Words exported to Anki are imported the same, with their review states.
+func TestAnkiRoundTrip(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	now := time.Now()
+	perro := Word{
+		Word: "perro", Definition: "dog\nhound", Notes: "<b>not bold</b>",
+		Tags: []string{"animals", "pets"},
+	}
+	if err := db.addWord("spanish", &perro, now); err != nil {
+		t.Fatal(err)
+	}
+	gato := addTestWord(t, db, "spanish", "gato", "cat")
+	for _, grade := range []Grade{GradeGood, GradeGood, GradeGood} {
+		if _, err := db.reviewWord("spanish", gato.Id, grade, SM2{}, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gatoState, err := db.getReviewState("spanish", gato.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "spanish.apkg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nt := AnkiNoteType{Name: "test", Fields: []AnkiField{
+		{"Front", "word"}, {"Back", "definition"}, {"Extra", "notes"},
+	}}
+	if err := db.exportAnki("spanish", f, nt, mediaStore{}, now); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := db.importAnki("copy", path, AnkiImportOptions{}, now); err != ErrNoLangFound {
+		t.Errorf("expected ErrNoLangFound without create, got %v", err)
+	}
+	report, err := db.importAnki("copy", path, AnkiImportOptions{DryRun: true, Create: true}, now)
+	if err != nil || report.Added != 2 || report.Scheduled != 1 {
+		t.Fatalf("unexpected dry run report: %+v (%v)", report, err)
+	}
+	if _, err := db.getLang("copy"); err != ErrNoLangFound {
+		t.Errorf("expected dry run not to create language, got %v", err)
+	}
+	report, err = db.importAnki("copy", path, AnkiImportOptions{Create: true}, now)
+	if err != nil || report.Total != 2 || report.Added != 2 || report.Scheduled != 1 {
+		t.Fatalf("unexpected report: %+v (%v)", report, err)
+	}
+
+	got, err := db.getWord("copy", "perro", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The created language and imported words have their inserts recorded.
+	revs, err := db.getLangHistory("copy")
+	if err != nil || len(revs) != 1 || revs[0].Action != RevisionInsert {
+		t.Errorf("unexpected history of created language: %+v (%v)", revs, err)
+	}
+	revs, err = db.getWordHistory("copy", got.Id)
+	if got := revisionStrs(t, revs); err != nil || fmt.Sprint(got) != "[insert - dog\nhound]" {
+		t.Errorf("unexpected history of imported word: %q (%v)", got, err)
+	}
+	if got.Definition != perro.Definition || got.Notes != perro.Notes ||
+		fmt.Sprint(got.Tags) != fmt.Sprint(perro.Tags) {
+		t.Errorf("expected %+v, got %+v", perro, got)
+	}
+	got, err = db.getWord("copy", "gato", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := db.getReviewState("copy", got.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Due dates are exported as days, so they're only kept to the day.
+	if rs.Interval != gatoState.Interval || rs.Ease != gatoState.Ease ||
+		rs.Repetitions != gatoState.Repetitions ||
+		rs.Due/(24*60*60) != gatoState.Due/(24*60*60) {
+		t.Errorf("expected review state %+v, got %+v", gatoState, rs)
+	}
+
+	// Importing again only finds duplicates.
+	report, err = db.importAnki("copy", path, AnkiImportOptions{}, now)
+	if err != nil || report.Added != 0 || len(report.Duplicates) != 2 {
+		t.Errorf("unexpected report for reimport: %+v (%v)", report, err)
+	}
+}
+
+func TestImportAnkiInvalid(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	dir := t.TempDir()
+	notZip := filepath.Join(dir, "not-zip.apkg")
+	if err := os.WriteFile(notZip, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.importAnki("spanish", notZip, AnkiImportOptions{}, time.Now())
+	if !errors.Is(err, ErrInvalidAnkiPackage) {
+		t.Errorf("expected ErrInvalidAnkiPackage, got %v", err)
+	}
+}
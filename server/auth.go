@@ -0,0 +1,423 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookieName = "session"
+	sessionDuration   = 30 * 24 * time.Hour
+
+	minPasswordLen = 8
+	// bcrypt only uses the first 72 bytes.
+	maxPasswordLen = 72
+	minUsernameLen = 3
+	maxUsernameLen = 32
+)
+
+type ctxKey string
+
+const (
+	userCtxKey  ctxKey = "user"
+	tokenCtxKey ctxKey = "token"
+)
+
+type User struct {
+	Id        int64  `json:"id"`
+	Username  string `json:"username"`
+	IsAdmin   bool   `json:"isAdmin,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// authMiddleware gets the user from the request's bearer token or, if there
+// isn't one, the session cookie, storing it (and the token) in the request's
+// context. Requests to non-public paths without a user are rejected, as are
+// requests not allowed by the token's scope.
+func (s *Server) authMiddleware(next jmux.Handler) http.Handler {
+	return jmux.HandlerFunc(func(c *jmux.Context) {
+		var user User
+		var err error
+		if secret, ok := c.BearerAuth(); ok {
+			var token APIToken
+			user, token, err = s.db.getTokenUser(secret, time.Now())
+			if err == nil {
+				if !token.Scope.Allows(c.Request.Method) {
+					c.WriteError(
+						http.StatusForbidden,
+						errRespJson("token scope doesn't allow "+c.Request.Method),
+					)
+					return
+				}
+				c.WithContextValue(tokenCtxKey, token)
+			}
+		} else {
+			user, err = s.sessionUser(c)
+		}
+		if err != nil {
+			if !errors.Is(err, ErrUnauthorized) {
+				log.Print("error getting user: ", err)
+				c.InternalServerError(errRespJson("internal server error"))
+				return
+			}
+			if !isPublicPath(c.Path()) {
+				c.WriteError(http.StatusUnauthorized, errRespJson(err.Error()))
+				return
+			}
+		} else {
+			c.WithContextValue(userCtxKey, user)
+		}
+		next.ServeC(c)
+	})
+}
+
+// Paths that can be accessed without logging in.
+func isPublicPath(path string) bool {
+	return path == "/" ||
+		strings.HasPrefix(path, "/static/") ||
+		strings.HasPrefix(path, "/auth/")
+}
+
+func (s *Server) sessionUser(c *jmux.Context) (User, error) {
+	cookie, err := c.Cookie(sessionCookieName)
+	if err != nil {
+		return User{}, ErrUnauthorized
+	}
+	return s.db.getSessionUser(cookie.Value, time.Now())
+}
+
+// Returns the user stored in the request's context by authMiddleware.
+func userFromContext(c *jmux.Context) (User, bool) {
+	user, ok := c.Context().Value(userCtxKey).(User)
+	return user, ok
+}
+
+// Returns the DB scoped to the request's user (and the token's languages, if
+// the request used a restricted token).
+func (s *Server) userDb(c *jmux.Context) *DB {
+	return s.db.asUser(userScope(c)).withLangs(tokenLangIds(c))
+}
+
+// Returns the store scoped to the request's user (and token's languages),
+// like userDb.
+func (s *Server) userStore(c *jmux.Context) Store {
+	return s.store.scoped(userScope(c), tokenLangIds(c))
+}
+
+// Returns the ID of the request's user.
+func userScope(c *jmux.Context) int64 {
+	user, ok := userFromContext(c)
+	if !ok {
+		// Shouldn't happen since authMiddleware rejects requests without users.
+		// Use a user that can't exist rather than an unscoped DB.
+		return -1
+	}
+	return user.Id
+}
+
+// Returns the languages the request's token is restricted to (nil if it
+// isn't).
+func tokenLangIds(c *jmux.Context) []int64 {
+	if token, ok := tokenFromContext(c); ok {
+		return token.LangIds
+	}
+	return nil
+}
+
+func (s *Server) registerHandler(c *jmux.Context) {
+	creds := Credentials{}
+	if err := c.ReadBodyJSON(&creds); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+	user, err := s.db.newUser(creds.Username, creds.Password, time.Now())
+	if err != nil {
+		if isUserError(err) {
+			c.BadRequest(errRespJson(err.Error()))
+		} else {
+			log.Printf("error registering user %s: %v", creds.Username, err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+	s.startSession(c, user)
+}
+
+func (s *Server) loginHandler(c *jmux.Context) {
+	creds := Credentials{}
+	if err := c.ReadBodyJSON(&creds); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+	user, err := s.db.authenticate(creds.Username, creds.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			c.WriteError(http.StatusUnauthorized, errRespJson(err.Error()))
+		} else {
+			log.Printf("error logging in user %s: %v", creds.Username, err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+	s.startSession(c, user)
+}
+
+// Creates a session for the user, setting the cookie and responding with the
+// user.
+func (s *Server) startSession(c *jmux.Context, user User) {
+	token, expires, err := s.db.newSession(user.Id, time.Now())
+	if err != nil {
+		log.Printf("error creating session for user %d: %v", user.Id, err)
+		c.InternalServerError(errRespJson("internal server error"))
+		return
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.WriteJSON(Response[User]{Content: user})
+}
+
+func (s *Server) logoutHandler(c *jmux.Context) {
+	if cookie, err := c.Cookie(sessionCookieName); err == nil {
+		if err := s.db.delSession(cookie.Value); err != nil {
+			log.Print("error deleting session: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+			return
+		}
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.WriteJSON(Response[any]{})
+}
+
+func (s *Server) meHandler(c *jmux.Context) {
+	user, ok := userFromContext(c)
+	if !ok {
+		c.WriteError(http.StatusUnauthorized, errRespJson(ErrUnauthorized.Error()))
+		return
+	}
+	c.WriteJSON(Response[User]{Content: user})
+}
+
+const userCols = `id,username,is_admin,created_at`
+
+func scanUser(dbs DBScanner) (user User, err error) {
+	err = dbs.Scan(&user.Id, &user.Username, &user.IsAdmin, &user.CreatedAt)
+	return
+}
+
+// Creates a user. The first user is made an admin and given all existing
+// languages that don't have an owner.
+func (db *DB) newUser(username, password string, now time.Time) (User, error) {
+	username = normalizeUsername(username)
+	if !usernameIsValid(username) {
+		return User{}, ErrInvalidUsername
+	}
+	if len(password) < minPasswordLen || len(password) > maxPasswordLen {
+		return User{}, ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	user := User{Username: username, CreatedAt: now.Unix()}
+	err = tx.QueryRow(`SELECT NOT EXISTS(SELECT 1 FROM users)`).Scan(&user.IsAdmin)
+	if err != nil {
+		return User{}, err
+	}
+	res, err := tx.Exec(
+		`INSERT INTO users(username,password_hash,is_admin,created_at)
+    VALUES (?,?,?,?)`,
+		user.Username, string(hash), user.IsAdmin, user.CreatedAt,
+	)
+	if err != nil {
+		if isUniqueError(err) {
+			err = ErrUserExists
+		}
+		return User{}, err
+	}
+	if user.Id, err = res.LastInsertId(); err != nil {
+		return User{}, err
+	}
+	if user.IsAdmin {
+		_, err := tx.Exec(
+			`UPDATE languages SET owner_id=? WHERE owner_id IS NULL`, user.Id,
+		)
+		if err != nil {
+			return User{}, err
+		}
+	}
+	return user, tx.Commit()
+}
+
+// A bcrypt hash (of "dummy password") compared against when the user doesn't
+// exist so that logins take the same time whether or not the user exists.
+var dummyPasswordHash = []byte(
+	"$2a$10$XGxlmyOn4.bHTYC.heh5A.kxs5LeQ0vFq.KenyoU0YYS6QEXo3OIK",
+)
+
+// Checks the user's password, returning ErrInvalidCredentials if the user
+// doesn't exist or the password is wrong.
+func (db *DB) authenticate(username, password string) (User, error) {
+	hash := ""
+	row := db.QueryRow(
+		`SELECT `+userCols+`,password_hash FROM users WHERE username=?`,
+		normalizeUsername(username),
+	)
+	user, err := scanUser(scannerFunc(func(dest ...any) error {
+		return row.Scan(append(dest, &hash)...)
+	}))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return User{}, err
+		}
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (db *DB) getUserByName(username string) (User, error) {
+	row := db.QueryRow(
+		`SELECT `+userCols+` FROM users WHERE username=?`,
+		normalizeUsername(username),
+	)
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNoUserFound
+	}
+	return user, err
+}
+
+// Creates a session for the user, returning the session's token and when it
+// expires. Expired sessions are deleted.
+func (db *DB) newSession(userId int64, now time.Time) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token, expires := base64.RawURLEncoding.EncodeToString(b), now.Add(sessionDuration)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`DELETE FROM sessions WHERE expires_at<=?`, now.Unix())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO sessions(token_hash,user_id,created_at,expires_at)
+    VALUES (?,?,?,?)`,
+		hashToken(token), userId, now.Unix(), expires.Unix(),
+	)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, tx.Commit()
+}
+
+// Gets the user the session belongs to, returning ErrUnauthorized if the
+// session doesn't exist or has expired.
+func (db *DB) getSessionUser(token string, now time.Time) (User, error) {
+	row := db.QueryRow(
+		`SELECT `+prefixCols("users", userCols)+` FROM sessions
+    JOIN users ON users.id=sessions.user_id
+    WHERE sessions.token_hash=? AND sessions.expires_at>?`,
+		hashToken(token), now.Unix(),
+	)
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrUnauthorized
+	}
+	return user, err
+}
+
+func (db *DB) delSession(token string) error {
+	_, err := db.Exec(`DELETE FROM sessions WHERE token_hash=?`, hashToken(token))
+	return err
+}
+
+// Tokens are stored hashed so that a leaked database can't be used to log in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Qualifies each of the comma-separated columns with the table.
+func prefixCols(table, cols string) string {
+	parts := strings.Split(cols, ",")
+	for i, col := range parts {
+		parts[i] = table + "." + strings.TrimSpace(col)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Usernames are case-insensitive.
+func normalizeUsername(username string) string {
+	return strings.ToLower(normalizeText(username))
+}
+
+// Usernames must be 3-32 letters, numbers, underscores, dashes, or dots.
+func usernameIsValid(username string) bool {
+	n := 0
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) &&
+			r != '_' && r != '-' && r != '.' {
+			return false
+		}
+		n++
+	}
+	return n >= minUsernameLen && n <= maxUsernameLen
+}
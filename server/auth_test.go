@@ -0,0 +1,220 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUsernameIsValid(t *testing.T) {
+	tests := []struct {
+		username string
+		want     bool
+	}{
+		{"bob", true},
+		{"bob_1.x-y", true},
+		{"jos\u00e9", true},
+		{"bo", false},
+		// Lengths are counted in (composed) characters, not bytes.
+		{"jo\u0301", false},
+		{"ne\u0301e", true},
+		{"bob smith", false},
+		{"bob@example", false},
+		{"abcdefghijklmnopqrstuvwxyz012345", true},
+		{"abcdefghijklmnopqrstuvwxyz0123456", false},
+	}
+	for _, test := range tests {
+		if got := usernameIsValid(normalizeUsername(test.username)); got != test.want {
+			t.Errorf("usernameIsValid(%q): expected %v, got %v", test.username, test.want, got)
+		}
+	}
+}
+
+func TestPrefixCols(t *testing.T) {
+	if got := prefixCols("users", userCols); got !=
+		"users.id,users.username,users.is_admin,users.created_at" {
+		t.Errorf("unexpected prefixed columns: %q", got)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	db := newTestDb(t)
+	// Languages without owners are given to the first user.
+	spanish := addTestLang(t, db, "spanish")
+	now := time.Now()
+	alice, err := db.newUser(" Alice ", "password123", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Username != "alice" || !alice.IsAdmin {
+		t.Errorf("expected the first user to be an admin, got %+v", alice)
+	}
+	if _, err := db.asUser(alice.Id).getLangById(spanish.Id); err != nil {
+		t.Errorf("expected alice to own the existing language, got %v", err)
+	}
+	bob, err := db.newUser("bob", "password123", now)
+	if err != nil || bob.IsAdmin {
+		t.Fatalf("unexpected second user: %+v (%v)", bob, err)
+	}
+
+	newTests := []struct {
+		username, password string
+		err                error
+	}{
+		{"ALICE", "password123", ErrUserExists},
+		{"a", "password123", ErrInvalidUsername},
+		{"carol", "short", ErrInvalidPassword},
+		{"carol", string(make([]byte, maxPasswordLen+1)), ErrInvalidPassword},
+	}
+	for _, test := range newTests {
+		if _, err := db.newUser(test.username, test.password, now); err != test.err {
+			t.Errorf("newUser(%q): expected %v, got %v", test.username, test.err, err)
+		}
+	}
+
+	authTests := []struct {
+		username, password string
+		id                 int64
+		err                error
+	}{
+		{"alice", "password123", alice.Id, nil},
+		{"ALICE", "password123", alice.Id, nil},
+		{"alice", "password12", 0, ErrInvalidCredentials},
+		{"nobody", "password123", 0, ErrInvalidCredentials},
+	}
+	for _, test := range authTests {
+		user, err := db.authenticate(test.username, test.password)
+		if err != test.err || user.Id != test.id {
+			t.Errorf(
+				"authenticate(%q, %q): expected %d (%v), got %d (%v)",
+				test.username, test.password, test.id, test.err, user.Id, err,
+			)
+		}
+	}
+	if user, err := db.getUserByName("Bob"); err != nil || user.Id != bob.Id {
+		t.Errorf("expected bob, got %+v (%v)", user, err)
+	}
+	if _, err := db.getUserByName("nobody"); err != ErrNoUserFound {
+		t.Errorf("expected ErrNoUserFound, got %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	db := newTestDb(t)
+	now := time.Now()
+	user, err := db.newUser("alice", "password123", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, expires, err := db.newSession(user.Id, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expires.Equal(now.Add(sessionDuration)) {
+		t.Errorf("unexpected expiry: %v", expires)
+	}
+
+	tests := []struct {
+		token string
+		at    time.Time
+		err   error
+	}{
+		{token, now, nil},
+		{token, expires.Add(-time.Second), nil},
+		{token, expires, ErrUnauthorized},
+		{"not a token", now, ErrUnauthorized},
+	}
+	for _, test := range tests {
+		got, err := db.getSessionUser(test.token, test.at)
+		if err != test.err || (err == nil && got.Id != user.Id) {
+			t.Errorf(
+				"getSessionUser(%q, %v): expected %v, got %+v (%v)",
+				test.token, test.at, test.err, got, err,
+			)
+		}
+	}
+
+	if err := db.delSession(token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.getSessionUser(token, now); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized after logout, got %v", err)
+	}
+}
+
+// Users can only see their own languages.
+func TestUserLangs(t *testing.T) {
+	srvr := newTestServer(t, newTestDb(t))
+	alice, bob := newTestClient(t, srvr), newTestClient(t, srvr)
+	alice.register("alice")
+	bob.register("bob")
+
+	for _, tc := range []*testClient{alice, bob} {
+		if code := tc.do(http.MethodPost, "/langs", Lang{Name: "spanish"}, nil); code != http.StatusOK {
+			t.Fatalf("error creating language: %d", code)
+		}
+	}
+	resp := Response[Lang]{}
+	if code := alice.do(http.MethodGet, "/langs/spanish", nil, &resp); code != http.StatusOK {
+		t.Fatalf("error getting language: %d %s", code, resp.Error)
+	}
+	aliceSpanish := resp.Content
+	if code := bob.do(http.MethodGet, "/langs/spanish", nil, &resp); code != http.StatusOK ||
+		resp.Content.Id == aliceSpanish.Id {
+		t.Errorf("expected bob to get his own language, got %+v (%d)", resp.Content, code)
+	}
+	path := "/langs/" + jsonStr(aliceSpanish.Id)
+	if code := bob.do(http.MethodGet, path, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("expected bob not to get alice's language, got %d", code)
+	}
+}
+
+func TestAuthHandlers(t *testing.T) {
+	srvr := newTestServer(t, newTestDb(t))
+	tc := newTestClient(t, srvr)
+
+	if code := tc.do(http.MethodGet, "/langs", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 before logging in, got %d", code)
+	}
+	if code := tc.do(http.MethodGet, "/auth/me", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 from /auth/me before logging in, got %d", code)
+	}
+	user := tc.register("alice")
+
+	resp := Response[User]{}
+	if code := tc.do(http.MethodGet, "/auth/me", nil, &resp); code != http.StatusOK ||
+		resp.Content.Id != user.Id {
+		t.Errorf("expected alice, got %+v (%d)", resp.Content, code)
+	}
+	if code := tc.do(http.MethodPost, "/auth/logout", nil, nil); code != http.StatusOK {
+		t.Fatalf("error logging out: %d", code)
+	}
+	if code := tc.do(http.MethodGet, "/auth/me", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 after logging out, got %d", code)
+	}
+
+	tests := []struct {
+		path     string
+		username string
+		password string
+		code     int
+	}{
+		{"/auth/login", "alice", "wrong password", http.StatusUnauthorized},
+		{"/auth/login", "nobody", "password123", http.StatusUnauthorized},
+		{"/auth/register", "alice", "password123", http.StatusBadRequest},
+		{"/auth/register", "x", "password123", http.StatusBadRequest},
+		{"/auth/login", "Alice", "password123", http.StatusOK},
+	}
+	for _, test := range tests {
+		code := tc.do(
+			http.MethodPost, test.path,
+			Credentials{Username: test.username, Password: test.password}, nil,
+		)
+		if code != test.code {
+			t.Errorf("%s as %q: expected %d, got %d", test.path, test.username, test.code, code)
+		}
+	}
+	if code := tc.do(http.MethodGet, "/langs", nil, nil); code != http.StatusOK {
+		t.Errorf("expected to be logged in, got %d", code)
+	}
+}
@@ -0,0 +1,461 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/spf13/cobra"
+)
+
+// Snapshots made by the server are named with this prefix and the UTC time
+// they were made (in backupTimeFormat), so sorting them by name sorts them by
+// time.
+const (
+	backupPrefix     = "lively-langs-"
+	backupExt        = ".db"
+	backupTimeFormat = "20060102-150405"
+)
+
+// Backup is a snapshot of the database made by the server.
+type Backup struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// Makes a snapshot of the database (and media) in the backup dir, returning
+// it. Old snapshots beyond the number to keep are deleted.
+func (s *Server) backup(now time.Time) (Backup, error) {
+	s.backupMtx.Lock()
+	defer s.backupMtx.Unlock()
+
+	name := backupPrefix + now.UTC().Format(backupTimeFormat) + backupExt
+	path := filepath.Join(s.BackupDir, name)
+	if err := s.db.backupTo(path); err != nil {
+		return Backup{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Backup{}, err
+	}
+	if err := backupMedia(path, s.media); err != nil {
+		return Backup{}, err
+	}
+	if err := pruneBackups(s.BackupDir, s.BackupKeep); err != nil {
+		return Backup{}, err
+	}
+	return Backup{Name: name, Size: info.Size(), CreatedAt: now.Unix()}, nil
+}
+
+// Makes a backup every BackupInterval until the server is closed. Errors are
+// logged.
+func (s *Server) runBackups() {
+	ticker := time.NewTicker(s.BackupInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if b, err := s.backup(now); err != nil {
+			log.Print("error making backup: ", err)
+		} else {
+			log.Printf("made backup %s", b.Name)
+		}
+	}
+}
+
+// Makes a backup of the database (see backup).
+func (s *Server) backupHandler(c *jmux.Context) {
+	if _, ok := requireAdmin(c); !ok {
+		return
+	} else if s.demoMode() {
+		c.BadRequest(errRespJson(ErrDemoMode.Error()))
+		return
+	}
+	b, err := s.backup(time.Now())
+	code, resp := http.StatusOK, Response[Backup]{}
+	if err != nil {
+		log.Print("error making backup: ", err)
+		code, resp.Error = http.StatusInternalServerError, "internal server error"
+	} else {
+		resp.Content = b
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Copies the database to the file at path using SQLite's online backup API,
+// which makes a consistent snapshot even while the database is being written
+// to. The backup is written to a temp file first so that path is only ever a
+// complete backup.
+func (db *DB) backupTo(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".backup-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	destDb, err := sql.Open(sqliteDriver, tmpPath)
+	if err != nil {
+		return err
+	}
+	defer destDb.Close()
+
+	ctx := context.Background()
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	destConn, err := destDb.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	err = destConn.Raw(func(destRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			dest, ok := destRaw.(*sqlite3.SQLiteConn)
+			src, ok2 := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("unexpected connection type")
+			}
+			b, err := dest.Backup("main", src, "main")
+			if err != nil {
+				return err
+			}
+			// Copies all pages in one step.
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err := destConn.Close(); err != nil {
+		return err
+	}
+	if err := destDb.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Returns the media dir used by backups in the same dir as the backup at path
+// (media is shared by backups since it's content-addressed).
+func backupMediaStore(path string) mediaStore {
+	return mediaStore{dir: filepath.Join(filepath.Dir(path), "media")}
+}
+
+// Copies the media used by the backup at path from media to the backup's
+// media dir, skipping files that are already there.
+func backupMedia(path string, media mediaStore) error {
+	hashes, err := backupMediaHashes(path)
+	if err != nil {
+		return err
+	}
+	return copyMedia(media, backupMediaStore(path), hashes)
+}
+
+// Gets the hashes of the media in the backup at path.
+func backupMediaHashes(path string) ([]string, error) {
+	db, err := openDbNoInit("file:" + path + "?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	version, err := db.schemaVersion()
+	if err != nil {
+		return nil, err
+	} else if version < 18 {
+		// There's no media table before migration 18.
+		return nil, nil
+	}
+	rows, err := db.Query(`SELECT hash FROM media`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// Copies the files with the hashes from one media dir to another, skipping
+// ones that are already in the destination. Files missing from the source are
+// logged and skipped.
+func copyMedia(from, to mediaStore, hashes []string) error {
+	for _, hash := range hashes {
+		dest := to.path(hash)
+		if _, err := os.Stat(dest); err == nil {
+			continue
+		}
+		src, err := from.open(hash)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("media file %s is missing", hash)
+			continue
+		} else if err != nil {
+			return err
+		}
+		err = copyToFile(dest, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the contents of r to the file at path, creating its dir. The file is
+// written to a temp file first so that path is only ever complete.
+func copyToFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Deletes all but the newest keep snapshots in the dir (none if keep isn't
+// positive), along with the media only used by deleted snapshots.
+func pruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) &&
+			strings.HasSuffix(name, backupExt) {
+			names = append(names, name)
+		}
+	}
+	if len(names) <= keep {
+		return nil
+	}
+	sort.Strings(names)
+	for _, name := range names[:len(names)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	used := map[string]bool{}
+	for _, name := range names[len(names)-keep:] {
+		hashes, err := backupMediaHashes(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			used[hash] = true
+		}
+	}
+	media := mediaStore{dir: filepath.Join(dir, "media")}
+	unused := []string{}
+	err = filepath.WalkDir(media.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() && !strings.HasPrefix(d.Name(), ".") && !used[d.Name()] {
+			unused = append(unused, d.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return media.remove(unused)
+}
+
+// Checks that the database at path is intact and can be used by this version
+// (i.e., its schema isn't newer), returning its schema version.
+func checkBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := openDbNoInit("file:" + path + "?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return 0, err
+	}
+	problems := []string{}
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if problem != "ok" {
+			problems = append(problems, problem)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	} else if len(problems) != 0 {
+		return 0, fmt.Errorf(
+			"integrity check failed: %s", strings.Join(problems, "; "),
+		)
+	}
+
+	var fkProblem bool
+	err = db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM pragma_foreign_key_check)`,
+	).Scan(&fkProblem)
+	if err != nil {
+		return 0, err
+	} else if fkProblem {
+		return 0, fmt.Errorf("foreign key check failed")
+	}
+
+	version, err := db.schemaVersion()
+	if err != nil {
+		return 0, err
+	} else if version > latestMigration() {
+		return 0, fmt.Errorf(
+			"schema version %d is newer than the latest supported (%d)",
+			version, latestMigration(),
+		)
+	}
+	return version, nil
+}
+
+// Replaces the database at dbPath with the backup at path after checking it.
+// The current database (if any) is kept as dbPath.pre-restore. The server
+// must not be running.
+func restoreBackup(path, dbPath string) error {
+	if _, err := checkBackup(path); err != nil {
+		return err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmpPath := dbPath + ".restore"
+	if err := copyToFile(tmpPath, src); err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	// Checks the copy too, in case it was corrupted while copying.
+	if _, err := checkBackup(tmpPath); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := os.Rename(dbPath, dbPath+".pre-restore"); err != nil {
+			return err
+		}
+	}
+	// A leftover journal would be applied to the restored database, corrupting
+	// it.
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		err := os.Remove(dbPath + suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(tmpPath, dbPath)
+}
+
+func runBackup(cmd *cobra.Command, args []string) {
+	log.SetFlags(0)
+
+	flags := cmd.Flags()
+	dbPath, _ := flags.GetString("db")
+	mediaPath, _ := flags.GetString("media")
+	path := args[0]
+
+	if _, err := os.Stat(dbPath); err != nil {
+		log.Fatal("error opening database: ", err)
+	}
+	db, err := openDbNoInit(dbPath)
+	if err != nil {
+		log.Fatal("error opening database: ", err)
+	}
+	defer db.Close()
+	if err := db.backupTo(path); err != nil {
+		log.Fatal("error making backup: ", err)
+	}
+	if mediaPath != "" {
+		if err := backupMedia(path, mediaStore{dir: mediaPath}); err != nil {
+			log.Fatal("error backing up media: ", err)
+		}
+	}
+	fmt.Println("backed up to", path)
+}
+
+func runRestore(cmd *cobra.Command, args []string) {
+	log.SetFlags(0)
+
+	flags := cmd.Flags()
+	dbPath, _ := flags.GetString("db")
+	mediaPath, _ := flags.GetString("media")
+	path := args[0]
+
+	if err := restoreBackup(path, dbPath); err != nil {
+		log.Fatal("error restoring backup: ", err)
+	}
+	if mediaPath != "" {
+		hashes, err := backupMediaHashes(dbPath)
+		if err == nil {
+			err = copyMedia(
+				backupMediaStore(path), mediaStore{dir: mediaPath}, hashes,
+			)
+		}
+		if err != nil {
+			log.Fatal("error restoring media: ", err)
+		}
+	}
+	fmt.Println("restored from", path)
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Saves the data to the media store and sets it as the word's audio (pruning
+// the old audio like the handler does), returning its hash.
+func addTestAudio(t *testing.T, db *DB, ms mediaStore, wordId int64, data string) string {
+	t.Helper()
+	hash, err := ms.save([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio := &Media{Hash: hash, Mime: "audio/mpeg", Size: int64(len(data))}
+	_, err = db.setWordMedia("spanish", wordId, time.Now(), wordMediaCol{col: "audio", media: audio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.pruneMedia(); err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// Returns the names of the files in the dir (and its subdirs), sorted.
+func fileNames(t *testing.T, dir string) []string {
+	t.Helper()
+	names := []string{}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if !d.IsDir() {
+			names = append(names, d.Name())
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestBackupTo(t *testing.T) {
+	db := newTestDb(t)
+	ms := mediaStore{dir: t.TempDir()}
+	addTestLang(t, db, "spanish")
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	gato := addTestWord(t, db, "spanish", "gato", "cat")
+	hash := addTestAudio(t, db, ms, perro.Id, "ID3 perro")
+	// Files missing from the media dir are skipped.
+	missing := addTestAudio(t, db, ms, gato.Id, "ID3 gato")
+	if err := ms.remove([]string{missing}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "backups", "backup.db")
+	if err := db.backupTo(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := backupMedia(path, ms); err != nil {
+		t.Fatal(err)
+	}
+	// No temp files are left behind.
+	if got := fileNames(t, filepath.Dir(path)); fmt.Sprint(got) != fmt.Sprint([]string{"backup.db", hash}) {
+		t.Errorf("unexpected backup files: %v", got)
+	}
+	if version, err := checkBackup(path); err != nil || version != latestMigration() {
+		t.Errorf("expected version %d, got %d (%v)", latestMigration(), version, err)
+	}
+
+	backup, err := openDbNoInit(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	words, err := backup.getAllWords("spanish")
+	if err != nil || fmt.Sprint(wordNames(words)) != "[perro gato]" {
+		t.Errorf("unexpected backed up words: %v (%v)", wordNames(words), err)
+	}
+	if hashes, err := backupMediaHashes(path); err != nil || len(hashes) != 2 {
+		t.Errorf("expected 2 media hashes, got %v (%v)", hashes, err)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	db := newTestDb(t)
+	ms := mediaStore{dir: t.TempDir()}
+	addTestLang(t, db, "spanish")
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	dir := t.TempDir()
+
+	// Each backup uses different audio, the last two sharing it.
+	hashes := []string{}
+	for i, data := range []string{"ID3 1", "ID3 2", "ID3 3", "ID3 3"} {
+		hashes = append(hashes, addTestAudio(t, db, ms, perro.Id, data))
+		path := filepath.Join(dir, backupPrefix+fmt.Sprintf("2024010%d-000000", i+1)+backupExt)
+		if err := db.backupTo(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := backupMedia(path, ms); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.db"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		keep  int
+		files []string
+	}{
+		{0, []string{"lively-langs-20240101-000000.db", "lively-langs-20240102-000000.db", "lively-langs-20240103-000000.db", "lively-langs-20240104-000000.db"}},
+		{5, []string{"lively-langs-20240101-000000.db", "lively-langs-20240102-000000.db", "lively-langs-20240103-000000.db", "lively-langs-20240104-000000.db"}},
+		{2, []string{"lively-langs-20240103-000000.db", "lively-langs-20240104-000000.db"}},
+		{1, []string{"lively-langs-20240104-000000.db"}},
+	}
+	for _, test := range tests {
+		if err := pruneBackups(dir, test.keep); err != nil {
+			t.Fatal(err)
+		}
+		want := append(append([]string{}, test.files...), "other.db")
+		for _, hash := range hashes[4-len(test.files):] {
+			if !contains(want, hash) {
+				want = append(want, hash)
+			}
+		}
+		sort.Strings(want)
+		if got := fileNames(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("keep %d: expected %v, got %v", test.keep, want, got)
+		}
+	}
+}
+
+func TestCheckBackup(t *testing.T) {
+	db := newTestDb(t)
+	_, err := db.Exec(
+		`INSERT INTO schema_migrations(version,name,applied_at) VALUES (?,'future',0)`,
+		latestMigration()+1,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	newer := filepath.Join(dir, "newer.db")
+	if err := db.backupTo(newer); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := filepath.Join(dir, "corrupt.db")
+	if err := os.WriteFile(corrupt, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "missing.db"), corrupt, newer} {
+		if _, err := checkBackup(path); err == nil {
+			t.Errorf("%s: expected error", filepath.Base(path))
+		}
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	addTestWord(t, db, "spanish", "perro", "dog")
+	dir := t.TempDir()
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := db.backupTo(backupPath); err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := filepath.Join(dir, "lively-langs.db")
+	current, err := openDbNoInit(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := current.Init(); err != nil {
+		t.Fatal(err)
+	}
+	current.Close()
+	if err := os.WriteFile(dbPath+"-journal", []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bad backups leave the database as it is.
+	if err := restoreBackup(filepath.Join(dir, "missing.db"), dbPath); err == nil {
+		t.Error("expected error restoring missing backup")
+	}
+	if got := fileNames(t, dir); fmt.Sprint(got) != "[backup.db lively-langs.db lively-langs.db-journal]" {
+		t.Errorf("unexpected files after failed restore: %v", got)
+	}
+
+	if err := restoreBackup(backupPath, dbPath); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileNames(t, dir); fmt.Sprint(got) != "[backup.db lively-langs.db lively-langs.db.pre-restore]" {
+		t.Errorf("unexpected files after restore: %v", got)
+	}
+	restored, err := openDbNoInit(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	words, err := restored.getAllWords("spanish")
+	if err != nil || fmt.Sprint(wordNames(words)) != "[perro]" {
+		t.Errorf("unexpected restored words: %v (%v)", wordNames(words), err)
+	}
+}
+
+func TestBackupHandler(t *testing.T) {
+	db := newTestDb(t)
+	s := &Server{
+		BackupDir:  t.TempDir(),
+		BackupKeep: 1,
+		db:         db,
+		store:      db,
+		scheduler:  SM2{},
+		media:      mediaStore{dir: t.TempDir()},
+	}
+	srvr := httptest.NewServer(s.createHandler())
+	t.Cleanup(srvr.Close)
+	admin, bob := newTestClient(t, srvr), newTestClient(t, srvr)
+	admin.register("admin")
+	bob.register("bob")
+
+	if code := bob.do(http.MethodPost, "/admin/backup", nil, nil); code != http.StatusForbidden {
+		t.Errorf("expected %d, got %d", http.StatusForbidden, code)
+	}
+	resp := Response[Backup]{}
+	if code := admin.do(http.MethodPost, "/admin/backup", nil, &resp); code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, code, resp.Error)
+	}
+	info, err := os.Stat(filepath.Join(s.BackupDir, resp.Content.Name))
+	if err != nil || info.Size() != resp.Content.Size {
+		t.Errorf("unexpected backup %+v: %v", resp.Content, err)
+	}
+
+	s.DbPath = memoryDbPath
+	if code := admin.do(http.MethodPost, "/admin/backup", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("expected %d in demo mode, got %d", http.StatusBadRequest, code)
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// The name of the SQLite driver with the language collations registered.
+const sqliteDriver = "sqlite3_lively_langs"
+
+// The tags of the languages supported by x/text/collate, excluding alternate
+// collations (like German phonebook order). The first is und (the root
+// collation).
+var collationTags = func() []language.Tag {
+	tags := []language.Tag{}
+	for _, tag := range collate.Supported() {
+		if !strings.Contains(tag.String(), "-u-") {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}()
+
+var collationMatcher = language.NewMatcher(collationTags)
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: registerCollations,
+	})
+}
+
+// Registers a collation for each supported language on the connection.
+func registerCollations(conn *sqlite3.SQLiteConn) error {
+	for _, tag := range collationTags {
+		tag, col := tag, (*collate.Collator)(nil)
+		err := conn.RegisterCollation(collationName(tag), func(a, b string) int {
+			// Collators aren't safe for concurrent use, but a connection is only
+			// used by one goroutine at a time. They're created lazily since most
+			// will never be used.
+			if col == nil {
+				col = collate.New(tag)
+			}
+			return col.CompareString(a, b)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func collationName(tag language.Tag) string {
+	return "lang_" + tag.String()
+}
+
+// Returns the COLLATE clause for the closest supported collation to the tag
+// (the root collation if there is none).
+func collateClause(tag language.Tag) string {
+	_, i, _ := collationMatcher.Match(tag)
+	return ` COLLATE "` + collationName(collationTags[i]) + `"`
+}
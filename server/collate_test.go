@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+func TestCollateClause(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"", `lang_und`},
+		{"es", `lang_es`},
+		{"de-AT", `lang_de`},
+		{"sv", `lang_sv`},
+		// Languages without their own collation use the closest one.
+		{"qu", `lang_es`},
+	}
+	for _, test := range tests {
+		tag := Lang{Locale: test.locale}.tag()
+		if got := collateClause(tag); got != ` COLLATE "`+test.want+`"` {
+			t.Errorf("collateClause(%s): expected %s, got %s", tag, test.want, got)
+		}
+	}
+	if collationTags[0] != language.Und {
+		t.Errorf("expected the first collation to be und, got %s", collationTags[0])
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+		ok     bool
+	}{
+		{"", "", true},
+		{" es ", "es", true},
+		{"ES-mx", "es-MX", true},
+		{"de_DE", "de-DE", true},
+		{"not a locale", "", false},
+	}
+	for _, test := range tests {
+		got, err := normalizeLocale(test.locale)
+		if !test.ok {
+			if !isUserError(err) {
+				t.Errorf("normalizeLocale(%q): expected ErrInvalidLocale, got %v", test.locale, err)
+			}
+		} else if err != nil || got != test.want {
+			t.Errorf("normalizeLocale(%q): expected %q, got %q (%v)", test.locale, test.want, got, err)
+		}
+	}
+}
+
+// Words are listed and exported in the order of their language's locale.
+func TestLocaleOrder(t *testing.T) {
+	db := newTestDb(t)
+	now := time.Now()
+	tests := []struct {
+		locale string
+		words  []string
+		want   []string
+	}{
+		// In Spanish, n with a tilde is a letter after n.
+		{"es", []string{"\u00f1u", "zorro", "nube", "oso"}, []string{"nube", "\u00f1u", "oso", "zorro"}},
+		// In Swedish, a with an umlaut is a letter after z.
+		{"sv", []string{"\u00e4pple", "zon", "apa"}, []string{"apa", "zon", "\u00e4pple"}},
+		// In German, it's sorted with a, and sharp s with ss.
+		{"de", []string{"zug", "\u00e4pfel", "apfel", "stra\u00dfe", "strasse", "stein"}, []string{"apfel", "\u00e4pfel", "stein", "strasse", "stra\u00dfe", "zug"}},
+	}
+	for _, test := range tests {
+		lang := Lang{Name: "lang-" + test.locale, Locale: test.locale}
+		if err := db.newLang(&lang, now); err != nil {
+			t.Fatal(err)
+		}
+		for _, word := range test.words {
+			addTestWord(t, db, lang.Name, word, "")
+		}
+
+		words, _, err := db.getWords(lang.Name, WordListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := wordNames(words); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: expected %q, got %q", test.locale, test.want, got)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := db.exportWords(lang.Name, "", buf, "csv"); err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, record := range records[1:] {
+			got = append(got, record[0])
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: expected export %q, got %q", test.locale, test.want, got)
+		}
+	}
+
+	// Changing the locale changes the order.
+	locale := "en"
+	if _, err := db.editLang("lang-sv", &LangDiff{Locale: &locale}, 0, now); err != nil {
+		t.Fatal(err)
+	}
+	words, _, err := db.getWords("lang-sv", WordListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := wordNames(words), []string{"apa", "\u00e4pple", "zon"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %q after changing locale, got %q", want, got)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"log"
+
+	jtutils "github.com/johnietre/utils/go"
+	"github.com/spf13/cobra"
+)
+
+func MakeDbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "db",
+		Short:                 "Manage the database",
+		DisableFlagsInUseLine: true,
+	}
+	cmd.PersistentFlags().String("db", "lively-langs.db", "Path to database")
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the database schema (to the latest version by default)",
+		Run:   runMigrate,
+	}
+	flags := migrateCmd.Flags()
+	flags.Int("to", -1, "Version to migrate to (0 reverts all migrations)")
+	flags.Bool("down", false, "Revert the most recently applied migration")
+	migrateCmd.MarkFlagsMutuallyExclusive("to", "down")
+	cmd.AddCommand(migrateCmd)
+
+	backupCmd := &cobra.Command{
+		Use:   "backup <path>",
+		Short: "Back up the database to the path (safe while the server is running)",
+		Args:  cobra.ExactArgs(1),
+		Run:   runBackup,
+	}
+	backupCmd.Flags().String(
+		"media", "./media",
+		"Path to the media dir (copied to the \"media\" dir next to the backup)",
+	)
+	cmd.AddCommand(backupCmd)
+
+	restoreCmd := &cobra.Command{
+		Use:   "restore <path>",
+		Short: "Replace the database with the backup (the server must be stopped)",
+		Long: `Replace the database with the backup after checking its integrity.
+The current database is kept with a ".pre-restore" suffix. The server must be
+stopped first.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runRestore,
+	}
+	restoreCmd.Flags().String(
+		"media", "./media",
+		"Path to the media dir (missing files are copied from the backup's)",
+	)
+	cmd.AddCommand(restoreCmd)
+
+	return cmd
+}
+
+func runMigrate(cmd *cobra.Command, _ []string) {
+	log.SetFlags(0)
+
+	flags := cmd.Flags()
+	dbPath, _ := flags.GetString("db")
+	to, _ := flags.GetInt("to")
+	down, _ := flags.GetBool("down")
+
+	db, err := openDbNoInit(dbPath)
+	if err != nil {
+		log.Fatal("error opening database: ", err)
+	}
+	defer db.Close()
+
+	curr, err := db.schemaVersion()
+	if err != nil {
+		log.Fatal("error getting schema version: ", err)
+	}
+	if down {
+		if curr == 0 {
+			fmt.Println("no migrations to revert")
+			return
+		}
+		to = curr - 1
+	} else if to == -1 {
+		to = latestMigration()
+	}
+	if err := db.migrate(to); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("migrated from version %d to %d\n", curr, to)
+}
+
+// openCmdDb opens the database for a command, scoping it to the user given by
+// the "user" flag, if any. Without a user, languages are looked up across all
+// users and new languages have no owner.
+func openCmdDb(cmd *cobra.Command) (*DB, error) {
+	flags := cmd.Flags()
+	db, err := openDb(jtutils.First(flags.GetString("db")))
+	if err != nil {
+		return nil, err
+	}
+	username, _ := flags.GetString("user")
+	if username == "" {
+		return db, nil
+	}
+	user, err := db.getUserByName(username)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+	return db.asUser(user.Id), nil
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+)
+
+const (
+	// The max size of an uploaded image.
+	maxImageSize = 10 << 20
+	// The max number of pixels in an uploaded image, which limits the memory
+	// used decoding it.
+	maxImagePixels = 40_000_000
+	// The max width and height of thumbnails.
+	thumbnailSize = 256
+)
+
+// Streams the word's image.
+func (s *Server) getImageHandler(c *jmux.Context) {
+	s.serveWordMedia(c, func(w Word) *Media { return w.Image })
+}
+
+// Streams the thumbnail of the word's image.
+func (s *Server) getThumbnailHandler(c *jmux.Context) {
+	s.serveWordMedia(c, func(w Word) *Media { return w.Thumbnail })
+}
+
+// Sets the word's image to the request body (a PNG, JPEG, or GIF), generating
+// its thumbnail, and returns the updated word.
+func (s *Server) putImageHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	if ct := c.Request.Header.Get("Content-Type"); ct != "" &&
+		!strings.HasPrefix(ct, "image/") &&
+		!strings.HasPrefix(ct, "application/octet-stream") {
+		c.WriteError(http.StatusUnsupportedMediaType, "expected image")
+		return
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImageSize)
+	data, err := io.ReadAll(body)
+	if err != nil {
+		if _, ok := errAs[*http.MaxBytesError](err); ok {
+			c.WriteError(http.StatusRequestEntityTooLarge, "file too large")
+		} else {
+			log.Print("error reading image: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+	img := Media{Mime: sniffImage(data), Size: int64(len(data))}
+	if img.Mime == "" {
+		c.WriteError(http.StatusUnsupportedMediaType, "unsupported image type")
+		return
+	}
+	thumbData, thumb, err := makeThumbnail(data, &img)
+	if err != nil {
+		c.BadRequest(errRespJson(err.Error()))
+		return
+	}
+	s.mediaMtx.Lock()
+	if img.Hash, err = s.media.save(data); err == nil {
+		thumb.Hash, err = s.media.save(thumbData)
+	}
+	if err != nil {
+		s.mediaMtx.Unlock()
+		log.Print("error saving image: ", err)
+		c.InternalServerError(errRespJson("internal server error"))
+		return
+	}
+
+	code, resp := http.StatusOK, Response[Word]{}
+	word, err := s.userDb(c).setWordMedia(
+		lang, id, time.Now(),
+		wordMediaCol{col: "image", media: &img},
+		wordMediaCol{col: "thumbnail", media: &thumb},
+	)
+	s.mediaMtx.Unlock()
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error setting image of word %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = word
+		c.RespHeader().Set("ETag", versionETag(word.Version))
+		// Frees the word's old image.
+		s.pruneMedia()
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Removes the word's image (and thumbnail), returning the updated word.
+func (s *Server) delImageHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+
+	code, resp := http.StatusOK, Response[Word]{}
+	word, err := s.userDb(c).setWordMedia(
+		lang, id, time.Now(),
+		wordMediaCol{col: "image"}, wordMediaCol{col: "thumbnail"},
+	)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error deleting image of word %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = word
+		c.RespHeader().Set("ETag", versionETag(word.Version))
+		s.pruneMedia()
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Returns the image type of the data from its signature, or an empty string
+// if it isn't a PNG, JPEG, or GIF.
+func sniffImage(data []byte) string {
+	switch mime := http.DetectContentType(data); mime {
+	case "image/png", "image/jpeg", "image/gif":
+		return mime
+	}
+	return ""
+}
+
+// Decodes the image, setting its dimensions, and returns its thumbnail (which
+// is the image itself if it's small enough). Thumbnails of JPEGs are JPEGs and
+// the others are PNGs. Returns ErrInvalidMedia if the image can't be decoded
+// or is too large.
+func makeThumbnail(data []byte, img *Media) ([]byte, Media, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, Media{}, fmt.Errorf("%w: can't decode image", ErrInvalidMedia)
+	} else if config.Width*config.Height > maxImagePixels {
+		return nil, Media{}, fmt.Errorf("%w: image too large", ErrInvalidMedia)
+	}
+	img.Width, img.Height = config.Width, config.Height
+	if img.Width <= thumbnailSize && img.Height <= thumbnailSize {
+		return data, *img, nil
+	}
+
+	var src image.Image
+	switch img.Mime {
+	case "image/gif":
+		// Only the first frame is used.
+		src, err = gif.Decode(bytes.NewReader(data))
+	default:
+		src, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, Media{}, fmt.Errorf("%w: can't decode image", ErrInvalidMedia)
+	}
+	w, h := thumbnailSize, thumbnailSize
+	if img.Width > img.Height {
+		h = maxInt(1, img.Height*thumbnailSize/img.Width)
+	} else {
+		w = maxInt(1, img.Width*thumbnailSize/img.Height)
+	}
+	dst := resizeImage(src, w, h)
+
+	buf, thumb := &bytes.Buffer{}, Media{Mime: "image/png", Width: w, Height: h}
+	if img.Mime == "image/jpeg" {
+		thumb.Mime = "image/jpeg"
+		err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(buf, dst)
+	}
+	if err != nil {
+		return nil, Media{}, err
+	}
+	thumb.Size = int64(buf.Len())
+	return buf.Bytes(), thumb, nil
+}
+
+// Scales the image to the given size by averaging the pixels covered by each
+// destination pixel (a box filter), which works well for downscaling.
+func resizeImage(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, maxInt((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, maxInt((x+1)*sw/w, x*sw/w+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n, i := (y1-y0)*(x1-x0), y*dst.Stride+x*4
+			for j := range sum {
+				dst.Pix[i+j] = uint8(sum[j] / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Returns a w by h image with each pixel's color set by its position.
+func newTestImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 100, 255})
+		}
+	}
+	return img
+}
+
+// Encodes the image with the type's encoder.
+func encodeTestImage(t *testing.T, img image.Image, mime string) []byte {
+	t.Helper()
+	buf, err := &bytes.Buffer{}, error(nil)
+	switch mime {
+	case "image/png":
+		err = png.Encode(buf, img)
+	case "image/jpeg":
+		err = jpeg.Encode(buf, img, nil)
+	case "image/gif":
+		err = gif.Encode(buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniffImage(t *testing.T) {
+	img := newTestImage(2, 2)
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{encodeTestImage(t, img, "image/png"), "image/png"},
+		{encodeTestImage(t, img, "image/jpeg"), "image/jpeg"},
+		{encodeTestImage(t, img, "image/gif"), "image/gif"},
+		{[]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), ""},
+		{[]byte("BM\x00\x00"), ""},
+		{[]byte("hello"), ""},
+	}
+	for _, test := range tests {
+		if got := sniffImage(test.data); got != test.want {
+			t.Errorf("sniffImage(%.8q): expected %q, got %q", test.data, test.want, got)
+		}
+	}
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	// A GIF that claims to be 10000x5000, which is only checked from its
+	// header.
+	huge := encodeTestImage(t, newTestImage(1, 1), "image/gif")
+	copy(huge[6:10], []byte{0x10, 0x27, 0x88, 0x13})
+
+	tests := []struct {
+		name          string
+		mime          string
+		data          []byte
+		width, height int
+		thumb         string
+		err           error
+	}{
+		{"small png", "image/png", encodeTestImage(t, newTestImage(100, 50), "image/png"), 100, 50, "image/png 100x50", nil},
+		{"wide png", "image/png", encodeTestImage(t, newTestImage(512, 256), "image/png"), 512, 256, "image/png 256x128", nil},
+		{"tall jpeg", "image/jpeg", encodeTestImage(t, newTestImage(300, 600), "image/jpeg"), 300, 600, "image/jpeg 128x256", nil},
+		{"gif", "image/gif", encodeTestImage(t, newTestImage(257, 257), "image/gif"), 257, 257, "image/png 256x256", nil},
+		{"thin png", "image/png", encodeTestImage(t, newTestImage(1000, 1), "image/png"), 1000, 1, "image/png 256x1", nil},
+		{"too large", "image/gif", huge, 0, 0, "", ErrInvalidMedia},
+		{"truncated", "image/png", encodeTestImage(t, newTestImage(300, 300), "image/png")[:100], 0, 0, "", ErrInvalidMedia},
+		{"not an image", "image/png", []byte("hello"), 0, 0, "", ErrInvalidMedia},
+	}
+	for _, test := range tests {
+		img := Media{Mime: test.mime, Size: int64(len(test.data))}
+		data, thumb, err := makeThumbnail(test.data, &img)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if img.Width != test.width || img.Height != test.height {
+			t.Errorf("%s: expected %dx%d, got %dx%d", test.name, test.width, test.height, img.Width, img.Height)
+		}
+		// The thumbnail's dimensions must match its data.
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: error decoding thumbnail: %v", test.name, err)
+		} else if got := sniffImage(data) + " " + jsonStr(config.Width) + "x" + jsonStr(config.Height); got != test.thumb {
+			t.Errorf("%s: expected thumbnail %s, got %s", test.name, test.thumb, got)
+		}
+		if thumb.Width != config.Width || thumb.Height != config.Height ||
+			thumb.Size != int64(len(data)) || thumb.Mime != sniffImage(data) {
+			t.Errorf("%s: thumbnail doesn't match its data: %+v", test.name, thumb)
+		}
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	// Each 2x2 quadrant has its own color.
+	colors := []color.RGBA{
+		{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {10, 20, 30, 40},
+	}
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			src.SetRGBA(x, y, colors[y/2*2+x/2])
+		}
+	}
+	dst := resizeImage(src, 2, 2)
+	for i, c := range colors {
+		if got := dst.RGBAAt(i%2, i/2); got != c {
+			t.Errorf("pixel %d: expected %v, got %v", i, c, got)
+		}
+	}
+
+	// Sub-images (with bounds not at the origin) are averaged too.
+	sub := src.SubImage(image.Rect(2, 0, 4, 2))
+	if got := resizeImage(sub, 1, 1).RGBAAt(0, 0); got != colors[1] {
+		t.Errorf("expected %v, got %v", colors[1], got)
+	}
+	mixed := resizeImage(src.SubImage(image.Rect(1, 0, 3, 1)), 1, 1).RGBAAt(0, 0)
+	if want := (color.RGBA{127, 127, 0, 255}); mixed != want {
+		t.Errorf("expected %v, got %v", want, mixed)
+	}
+	// Upscaling repeats pixels.
+	if got := resizeImage(src, 8, 8).RGBAAt(7, 7); got != colors[3] {
+		t.Errorf("expected %v, got %v", colors[3], got)
+	}
+}
+
+func TestPictureQuiz(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	now := time.Now()
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	addTestWord(t, db, "spanish", "gato", "cat")
+
+	req := NewQuizRequest{Mode: QuizModePicture}
+	if _, err := db.newQuiz("spanish", req, now); err != ErrNotEnoughWords {
+		t.Errorf("expected ErrNotEnoughWords, got %v", err)
+	}
+	img := &Media{Hash: "aaaa", Mime: "image/png", Size: 4, Width: 1, Height: 1}
+	_, err := db.setWordMedia("spanish", perro.Id, now, wordMediaCol{col: "image", media: img})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quiz, err := db.newQuiz("spanish", req, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "/langs/" + jsonStr(perro.LangId) + "/words/" + jsonStr(perro.Id) + "/image"
+	if len(quiz.Questions) != 1 || quiz.Questions[0].Prompt != want {
+		t.Fatalf("expected one question with prompt %s, got %+v", want, quiz.Questions)
+	}
+	res, err := db.answerQuiz(quiz.Id, QuizAnswerRequest{Question: 0, Answer: "Perro"}, now)
+	if err != nil || !res.Correct {
+		t.Errorf("expected correct answer, got %+v (%v)", res, err)
+	}
+}
+
+func TestImageHandlers(t *testing.T) {
+	db := newTestDb(t)
+	srvr := newTestServer(t, db)
+	alice, bob := newTestClient(t, srvr), newTestClient(t, srvr)
+	alice.register("alice")
+	bob.register("bob")
+	if code := alice.do(http.MethodPost, "/langs", Lang{Name: "spanish"}, nil); code != http.StatusOK {
+		t.Fatalf("error creating language: %d", code)
+	}
+	wordResp := Response[Word]{}
+	if code := alice.do(http.MethodPost, "/langs/spanish/words", Word{Word: "perro"}, &wordResp); code != http.StatusOK {
+		t.Fatalf("error adding word: %d", code)
+	}
+	path := "/langs/spanish/words/" + jsonStr(wordResp.Content.Id) + "/image"
+	pngData := encodeTestImage(t, newTestImage(300, 150), "image/png")
+	gifData := encodeTestImage(t, newTestImage(20, 10), "image/gif")
+
+	putTests := []struct {
+		name, ct      string
+		tc            *testClient
+		data          []byte
+		code          int
+		image, thumbs string
+	}{
+		{"put gif", "image/gif", alice, gifData, http.StatusOK, "image/gif 20x10", "image/gif 20x10"},
+		{"put png", "application/octet-stream", alice, pngData, http.StatusOK, "image/png 300x150", "image/png 256x128"},
+		{"not an image", "text/plain", alice, pngData, http.StatusUnsupportedMediaType, "", ""},
+		{"unknown type", "image/png", alice, []byte("hello"), http.StatusUnsupportedMediaType, "", ""},
+		{"undecodable", "image/png", alice, pngData[:100], http.StatusBadRequest, "", ""},
+		{"too large", "image/png", alice, append(pngData, make([]byte, maxImageSize)...), http.StatusRequestEntityTooLarge, "", ""},
+		{"other user", "image/png", bob, pngData, http.StatusBadRequest, "", ""},
+	}
+	for _, test := range putTests {
+		test.tc.header = http.Header{"Content-Type": {test.ct}}
+		resp := Response[Word]{}
+		res := test.tc.doRaw(http.MethodPut, path, bytes.NewReader(test.data))
+		if test.code == http.StatusOK {
+			if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		res.Body.Close()
+		test.tc.header = nil
+		if res.StatusCode != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, res.StatusCode)
+			continue
+		} else if test.code != http.StatusOK {
+			continue
+		}
+		mediaStr := func(m *Media) string {
+			if m == nil {
+				return ""
+			}
+			return m.Mime + " " + jsonStr(m.Width) + "x" + jsonStr(m.Height)
+		}
+		if got := mediaStr(resp.Content.Image); got != test.image {
+			t.Errorf("%s: expected image %s, got %s", test.name, test.image, got)
+		}
+		if got := mediaStr(resp.Content.Thumbnail); got != test.thumbs {
+			t.Errorf("%s: expected thumbnail %s, got %s", test.name, test.thumbs, got)
+		}
+	}
+	// The GIF is pruned once replaced.
+	if hashes := mediaHashes(t, db); len(hashes) != 2 {
+		t.Errorf("expected the image and thumbnail, got %v", hashes)
+	}
+
+	res := alice.doRaw(http.MethodGet, path+"/thumbnail", nil)
+	config, _, err := image.DecodeConfig(res.Body)
+	res.Body.Close()
+	if err != nil || res.Header.Get("Content-Type") != "image/png" ||
+		config.Width != 256 || config.Height != 128 {
+		t.Errorf("unexpected thumbnail: %+v %v (%v)", config, res.Header, err)
+	}
+
+	tests := []struct {
+		name   string
+		tc     *testClient
+		method string
+		path   string
+		code   int
+	}{
+		{"get", alice, http.MethodGet, path, http.StatusOK},
+		{"other user gets", bob, http.MethodGet, path + "/thumbnail", http.StatusBadRequest},
+		{"delete", alice, http.MethodDelete, path, http.StatusOK},
+		{"delete again", alice, http.MethodDelete, path, http.StatusBadRequest},
+		{"get deleted", alice, http.MethodGet, path + "/thumbnail", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		res := test.tc.doRaw(test.method, test.path, nil)
+		res.Body.Close()
+		if res.StatusCode != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, res.StatusCode)
+		}
+	}
+	if hashes := mediaHashes(t, db); len(hashes) != 0 {
+		t.Errorf("expected no media, got %v", hashes)
+	}
+}
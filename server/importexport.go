@@ -0,0 +1,627 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+	"github.com/spf13/cobra"
+	"golang.org/x/text/language"
+)
+
+const (
+	FormatCSV = "csv"
+	FormatTSV = "tsv"
+)
+
+// The max size of an import request body.
+const maxImportSize = 32 << 20
+
+// The columns of exported files, in order. Aliases and tags are separated by
+// "|".
+var wordColumns = []string{
+	"word", "definition", "aliases", "notes",
+	"pos", "gender", "plural", "register", "cefr", "tags",
+}
+
+// ImportRowIssue is a row that wasn't imported. Rows are numbered from 1,
+// counting the header. For Anki imports, rows are the notes, numbered from 1.
+type ImportRowIssue struct {
+	Row    int    `json:"row"`
+	Word   string `json:"word"`
+	Reason string `json:"reason"`
+}
+
+type ImportReport struct {
+	DryRun bool `json:"dryRun"`
+	// Total is the number of rows (excluding the header).
+	Total int `json:"total"`
+	// Added is the number of words added (or that would be added, if a dry
+	// run).
+	Added int `json:"added"`
+	// Scheduled is the number of added words that had their review states
+	// imported (only for Anki imports).
+	Scheduled int `json:"scheduled,omitempty"`
+	// Duplicates are rows with words that already exist in the language or
+	// appear earlier in the file. They are skipped.
+	Duplicates []ImportRowIssue `json:"duplicates"`
+	// Invalid are rows that couldn't be read or have invalid words. They are
+	// skipped.
+	Invalid []ImportRowIssue `json:"invalid"`
+}
+
+// Handles imports of CSV/TSV files. The format is taken from the "format"
+// query param, then the Content-Type, defaulting to CSV. If "dryRun" is true,
+// the report is returned without adding anything.
+func (s *Server) importHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	format := c.Query().Get("format")
+	if format == "" {
+		format = formatFromContentType(c.Request.Header.Get("Content-Type"))
+	}
+	dryRun, err := queryBool(c, "dryRun")
+	if err != nil {
+		c.WriteError(http.StatusBadRequest, "invalid value for 'dryRun'")
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	report, err := s.userDb(c).importWords(
+		lang, body, format, dryRun, time.Now(),
+	)
+	code, resp := http.StatusOK, Response[ImportReport]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else if _, ok := errAs[*http.MaxBytesError](err); ok {
+			code, resp.Error = http.StatusRequestEntityTooLarge, "file too large"
+		} else {
+			log.Printf("error importing words to lang %s: %v", lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = report
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Handles exports of all of a language's words as CSV/TSV (CSV by default).
+// If the "list" query param is given, only the list's words are exported.
+func (s *Server) exportHandler(c *jmux.Context) {
+	lang, list := c.Params["lang"], c.Query().Get("list")
+	format := strings.ToLower(c.Query().Get("format"))
+	if format == "" {
+		format = FormatCSV
+	}
+	if !formatIsValid(format) {
+		c.BadRequest(errRespJson(ErrInvalidFormat.Error()))
+		return
+	}
+	// Get the language (and list) first so that errors can be reported before
+	// the response is started.
+	l, err := s.userDb(c).getLang(lang)
+	if err == nil {
+		_, err = s.userDb(c).optListId(l.Id, list)
+	}
+	if err != nil {
+		if isUserError(err) {
+			c.BadRequest(errRespJson(err.Error()))
+		} else {
+			log.Printf("error getting lang %s: %v", lang, err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	contentType := "text/csv"
+	if format == FormatTSV {
+		contentType = "text/tab-separated-values"
+	}
+	hdr := c.RespHeader()
+	hdr.Set("Content-Type", contentType+"; charset=utf-8")
+	hdr.Set(
+		"Content-Disposition",
+		mime.FormatMediaType(
+			"attachment",
+			map[string]string{"filename": l.Name + "." + format},
+		),
+	)
+	err = s.userDb(c).exportWords(lang, list, c.Writer, format)
+	if err != nil {
+		// The response has already been started so the error can't be sent.
+		log.Printf("error exporting words from lang %s: %v", lang, err)
+	}
+}
+
+func formatIsValid(format string) bool {
+	return format == FormatCSV || format == FormatTSV
+}
+
+func formatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/tab-separated-values":
+		return FormatTSV
+	}
+	return FormatCSV
+}
+
+func newWordReader(r io.Reader, format string) *csv.Reader {
+	cr := csv.NewReader(r)
+	if format == FormatTSV {
+		cr.Comma, cr.LazyQuotes = '\t', true
+	}
+	// Rows are allowed to leave off trailing columns.
+	cr.FieldsPerRecord = -1
+	return cr
+}
+
+func newWordWriter(w io.Writer, format string) *csv.Writer {
+	cw := csv.NewWriter(w)
+	if format == FormatTSV {
+		cw.Comma = '\t'
+	}
+	return cw
+}
+
+// Maps the columns of the header to the index of the field in wordColumns.
+// The word column is required.
+func readImportHeader(header []string) ([]int, error) {
+	cols, seen, hasWord := make([]int, len(header)), map[int]bool{}, false
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		cols[i] = -1
+		for j, col := range wordColumns {
+			if name == col {
+				cols[i] = j
+			}
+		}
+		if cols[i] == -1 {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidHeader, name)
+		} else if seen[cols[i]] {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidHeader, name)
+		}
+		seen[cols[i]] = true
+		hasWord = hasWord || name == "word"
+	}
+	if !hasWord {
+		return nil, fmt.Errorf("%w: missing word column", ErrInvalidHeader)
+	}
+	return cols, nil
+}
+
+func wordFromRecord(record []string, cols []int) (word Word) {
+	for i, field := range record {
+		if i >= len(cols) {
+			break
+		}
+		setWordField(&word, wordColumns[cols[i]], field)
+	}
+	return word.normalized()
+}
+
+// Sets the field of the word for the column (one of wordColumns).
+func setWordField(word *Word, col, value string) {
+	switch col {
+	case "word":
+		word.Word = value
+	case "definition":
+		word.Definition = value
+	case "aliases":
+		word.Aliases = aliasesFromStr(value)
+	case "notes":
+		word.Notes = value
+	case "pos":
+		word.Pos = value
+	case "gender":
+		word.Gender = value
+	case "plural":
+		word.Plural = value
+	case "register":
+		word.Register = value
+	case "cefr":
+		word.CEFR = value
+	case "tags":
+		word.Tags = aliasesFromStr(value)
+	}
+}
+
+// Returns the value of the word's field for the column (one of wordColumns).
+func wordFieldValue(word Word, col string) string {
+	switch col {
+	case "word":
+		return word.Word
+	case "definition":
+		return word.Definition
+	case "aliases":
+		return strings.Join(word.Aliases, "|")
+	case "notes":
+		return word.Notes
+	case "pos":
+		return word.Pos
+	case "gender":
+		return word.Gender
+	case "plural":
+		return word.Plural
+	case "register":
+		return word.Register
+	case "cefr":
+		return word.CEFR
+	case "tags":
+		return strings.Join(word.Tags, "|")
+	}
+	return ""
+}
+
+// Imports words from the CSV/TSV data, skipping (and reporting) duplicate and
+// invalid rows. All words are added in a single transaction, which is rolled
+// back if dryRun is true.
+func (db *DB) importWords(
+	lang string,
+	r io.Reader,
+	format string,
+	dryRun bool,
+	now time.Time,
+) (ImportReport, error) {
+	report := ImportReport{
+		DryRun:     dryRun,
+		Duplicates: []ImportRowIssue{},
+		Invalid:    []ImportRowIssue{},
+	}
+	format = strings.ToLower(format)
+	if !formatIsValid(format) {
+		return report, ErrInvalidFormat
+	}
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return report, err
+	}
+	l, err := db.getLangById(langId)
+	if err != nil {
+		return report, err
+	}
+
+	cr := newWordReader(r, format)
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return report, fmt.Errorf("%w: missing header", ErrInvalidHeader)
+		} else if _, ok := errAs[*csv.ParseError](err); ok {
+			return report, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+		}
+		return report, err
+	}
+	cols, err := readImportHeader(header)
+	if err != nil {
+		return report, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	wi := db.newWordImporter(tx, l, &report, now)
+	for row := 2; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		report.Total++
+		if err != nil {
+			pe, ok := errAs[*csv.ParseError](err)
+			if !ok {
+				return report, err
+			}
+			report.Invalid = append(report.Invalid, ImportRowIssue{
+				Row: row, Reason: pe.Err.Error(),
+			})
+			continue
+		}
+
+		word := wordFromRecord(record, cols)
+		if _, err := wi.add(row, &word); err != nil {
+			return report, err
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	return report, tx.Commit()
+}
+
+// wordImporter adds imported words to a language within a transaction,
+// recording their revisions and skipped words in the report.
+type wordImporter struct {
+	db      *DB
+	tx      *sql.Tx
+	now     time.Time
+	langId  int64
+	tag     language.Tag
+	genders []string
+	report  *ImportReport
+	seen    map[string]bool
+}
+
+func (db *DB) newWordImporter(
+	tx *sql.Tx,
+	lang Lang,
+	report *ImportReport,
+	now time.Time,
+) *wordImporter {
+	return &wordImporter{
+		db:      db,
+		tx:      tx,
+		now:     now,
+		langId:  lang.Id,
+		tag:     lang.tag(),
+		genders: lang.Genders,
+		report:  report,
+		seen:    map[string]bool{},
+	}
+}
+
+// Adds the word (which is expected to be normalized) if it is valid and not a
+// duplicate, setting its IDs. Returns whether the word was added.
+func (wi *wordImporter) add(row int, word *Word) (bool, error) {
+	report := wi.report
+	if !word.wordIsValid() {
+		report.Invalid = append(report.Invalid, ImportRowIssue{
+			Row: row, Word: word.Word, Reason: ErrInvalidWord.Error(),
+		})
+		return false, nil
+	}
+	if err := word.checkMeta(wi.genders); err != nil {
+		report.Invalid = append(report.Invalid, ImportRowIssue{
+			Row: row, Word: word.Word, Reason: err.Error(),
+		})
+		return false, nil
+	}
+	if wi.seen[word.Word] {
+		report.Duplicates = append(report.Duplicates, ImportRowIssue{
+			Row: row, Word: word.Word, Reason: "duplicate of an earlier row",
+		})
+		return false, nil
+	}
+	wi.seen[word.Word] = true
+
+	var exists bool
+	err := wi.tx.QueryRow(
+		`SELECT EXISTS(
+      SELECT 1 FROM words WHERE lang_id=? AND word=? AND deleted_at IS NULL
+    )`,
+		wi.langId, word.Word,
+	).Scan(&exists)
+	if err != nil {
+		return false, err
+	} else if exists {
+		report.Duplicates = append(report.Duplicates, ImportRowIssue{
+			Row: row, Word: word.Word, Reason: "word already exists",
+		})
+		return false, nil
+	}
+
+	word.LangId = wi.langId
+	if err := wi.db.addWordTx(wi.tx, word, wi.tag, wi.now); err != nil {
+		return false, err
+	}
+	report.Added++
+	return true, nil
+}
+
+// Writes all of the language's words to w as CSV/TSV with a header, sorted
+// using the language's collation. If list is non-empty, only the words in the
+// list (given by its name or ID) are written, in the list's order.
+func (db *DB) exportWords(lang, list string, w io.Writer, format string) error {
+	format = strings.ToLower(format)
+	if !formatIsValid(format) {
+		return ErrInvalidFormat
+	}
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return err
+	}
+	tag, err := db.getLangTag(langId)
+	if err != nil {
+		return err
+	}
+	listId, err := db.optListId(langId, list)
+	if err != nil {
+		return err
+	}
+
+	stmt := `SELECT ` + wordCols + ` FROM words
+  WHERE lang_id=? AND deleted_at IS NULL ORDER BY words.word` + collateClause(tag) + `,words.id`
+	args := []any{langId}
+	if listId != 0 {
+		stmt = `SELECT ` + wordCols + ` FROM words
+    JOIN word_list_items AS items ON items.word_id=words.id
+    WHERE lang_id=? AND deleted_at IS NULL AND items.list_id=?
+    ORDER BY items.idx`
+		args = append(args, listId)
+	}
+	rows, err := db.Query(stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cw := newWordWriter(w, format)
+	if err := cw.Write(wordColumns); err != nil {
+		return err
+	}
+	for rows.Next() {
+		word, err := scanWord(rows)
+		if err != nil {
+			return err
+		}
+		record := make([]string, len(wordColumns))
+		for i, col := range wordColumns {
+			record[i] = wordFieldValue(word, col)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func MakeImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import [flags] FILE",
+		Short: "Import words into a language from a CSV/TSV file (- for stdin)",
+		Args:  cobra.ExactArgs(1),
+		Run:   runImport,
+	}
+	flags := cmd.Flags()
+	flags.String("db", "lively-langs.db", "Path to database")
+	flags.String("user", "", "User whose languages to use")
+	flags.String("lang", "", "Language to import into (name or ID)")
+	flags.String("format", "", "File format (csv or tsv; default from extension)")
+	flags.Bool("dry-run", false, "Report what would be imported without importing")
+	cmd.MarkFlagRequired("lang")
+	return cmd
+}
+
+func runImport(cmd *cobra.Command, args []string) {
+	log.SetFlags(0)
+
+	flags := cmd.Flags()
+	lang, _ := flags.GetString("lang")
+	dryRun, _ := flags.GetBool("dry-run")
+	path := args[0]
+	format := formatFromFlagOrPath(
+		jtutils.First(flags.GetString("format")), path,
+	)
+
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal("error opening file: ", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	db, err := openCmdDb(cmd)
+	if err != nil {
+		log.Fatal("error opening database: ", err)
+	}
+	defer db.Close()
+
+	report, err := db.importWords(lang, r, format, dryRun, time.Now())
+	if err != nil {
+		log.Fatal("error importing: ", err)
+	}
+	printImportReport(report)
+}
+
+func printImportReport(report ImportReport) {
+	for _, issue := range report.Invalid {
+		fmt.Printf("row %d: invalid (%s): %s\n", issue.Row, issue.Reason, issue.Word)
+	}
+	for _, issue := range report.Duplicates {
+		fmt.Printf("row %d: duplicate (%s): %s\n", issue.Row, issue.Reason, issue.Word)
+	}
+	verb := "added"
+	if report.DryRun {
+		verb = "would add"
+	}
+	fmt.Printf(
+		"%s %d of %d words (%d duplicates, %d invalid)\n",
+		verb, report.Added, report.Total,
+		len(report.Duplicates), len(report.Invalid),
+	)
+}
+
+func MakeExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export a language's words as CSV/TSV",
+		Args:  cobra.NoArgs,
+		Run:   runExport,
+	}
+	flags := cmd.Flags()
+	flags.String("db", "lively-langs.db", "Path to database")
+	flags.String("user", "", "User whose languages to use")
+	flags.String("lang", "", "Language to export (name or ID)")
+	flags.String("format", "", "File format (csv or tsv; default from extension)")
+	flags.String("list", "", "Only export the words in the list (name or ID)")
+	flags.StringP("out", "o", "-", "File to write to (- for stdout)")
+	cmd.MarkFlagRequired("lang")
+	return cmd
+}
+
+func runExport(cmd *cobra.Command, _ []string) {
+	log.SetFlags(0)
+
+	flags := cmd.Flags()
+	lang, _ := flags.GetString("lang")
+	list, _ := flags.GetString("list")
+	path, _ := flags.GetString("out")
+	format := formatFromFlagOrPath(
+		jtutils.First(flags.GetString("format")), path,
+	)
+	if !formatIsValid(format) {
+		log.Fatal(ErrInvalidFormat)
+	}
+
+	db, err := openCmdDb(cmd)
+	if err != nil {
+		log.Fatal("error opening database: ", err)
+	}
+	defer db.Close()
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		log.Fatal("error getting language: ", err)
+	}
+	if _, err := db.optListId(langId, list); err != nil {
+		log.Fatal("error getting list: ", err)
+	}
+
+	w := io.Writer(os.Stdout)
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			log.Fatal("error creating file: ", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := db.exportWords(lang, list, w, format); err != nil {
+		log.Fatal("error exporting: ", err)
+	}
+}
+
+// Returns the format flag if given, otherwise guesses it from the file's
+// extension (defaulting to CSV).
+func formatFromFlagOrPath(format, path string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".tsv") {
+		return FormatTSV
+	}
+	return FormatCSV
+}
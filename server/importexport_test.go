@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadImportHeader(t *testing.T) {
+	tests := []struct {
+		header []string
+		want   []int
+		ok     bool
+	}{
+		{[]string{"word"}, []int{0}, true},
+		{[]string{"\ufeffWord", " Definition "}, []int{0, 1}, true},
+		{[]string{"tags", "word", "cefr"}, []int{9, 0, 8}, true},
+		{[]string{"definition"}, nil, false},
+		{[]string{"word", "meaning"}, nil, false},
+		{[]string{"word", "notes", "Notes"}, nil, false},
+		{[]string{}, nil, false},
+	}
+	for _, test := range tests {
+		cols, err := readImportHeader(test.header)
+		if !test.ok {
+			if !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("header %q: expected ErrInvalidHeader, got %v", test.header, err)
+			}
+		} else if err != nil || fmt.Sprint(cols) != fmt.Sprint(test.want) {
+			t.Errorf("header %q: expected %v, got %v (%v)", test.header, test.want, cols, err)
+		}
+	}
+}
+
+func TestFormatFromContentType(t *testing.T) {
+	tests := []struct {
+		contentType, want string
+	}{
+		{"", FormatCSV},
+		{"text/csv", FormatCSV},
+		{"text/tab-separated-values", FormatTSV},
+		{"text/tab-separated-values; charset=utf-8", FormatTSV},
+		{"application/json", FormatCSV},
+	}
+	for _, test := range tests {
+		if got := formatFromContentType(test.contentType); got != test.want {
+			t.Errorf(
+				"formatFromContentType(%q): expected %s, got %s",
+				test.contentType, test.want, got,
+			)
+		}
+	}
+}
+
+// Every column that's set is read back the same.
+func TestWordFields(t *testing.T) {
+	values := map[string]string{
+		"word": "perro", "definition": "dog", "aliases": "can|chucho",
+		"notes": "note", "pos": "noun", "gender": "m", "plural": "perros",
+		"register": "neutral", "cefr": "A1", "tags": "animals|pets",
+	}
+	var word Word
+	for _, col := range wordColumns {
+		setWordField(&word, col, values[col])
+	}
+	for _, col := range wordColumns {
+		if got := wordFieldValue(word, col); got != values[col] {
+			t.Errorf("column %s: expected %q, got %q", col, values[col], got)
+		}
+	}
+	if wordFieldValue(word, "nope") != "" {
+		t.Error("expected unknown column to be empty")
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	// The last row has an unterminated quote. It's invalid in CSV, but the TSV
+	// reader uses lazy quotes, so it's read as a word.
+	tests := []struct {
+		format, data   string
+		added, invalid int
+	}{
+		{FormatCSV, "word,definition,aliases,tags\n" +
+			"perro,dog,can|chucho,animals\n" +
+			"gato,cat,,\n" +
+			"perro,dog again,,\n" +
+			"   ,nothing,,\n" +
+			"\"casa,house\n", 1, 2},
+		{FormatTSV, "word\tdefinition\taliases\ttags\n" +
+			"perro\tdog\tcan|chucho\tanimals\n" +
+			"gato\tcat\t\t\n" +
+			"perro\tdog again\t\t\n" +
+			"   \tnothing\t\t\n" +
+			"\"casa\thouse\n", 2, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			db := newTestDb(t)
+			addTestLang(t, db, "spanish")
+			addTestWord(t, db, "spanish", "gato", "cat")
+
+			// A dry run reports the same but adds nothing.
+			for _, dryRun := range []bool{true, false} {
+				report, err := db.importWords(
+					"spanish", strings.NewReader(test.data), test.format, dryRun, time.Now(),
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if report.DryRun != dryRun || report.Total != 5 ||
+					report.Added != test.added || len(report.Invalid) != test.invalid ||
+					len(report.Duplicates) != 2 {
+					t.Fatalf("unexpected report (dryRun=%v): %+v", dryRun, report)
+				}
+				if dup := report.Duplicates[0]; dup.Row != 3 || dup.Word != "gato" {
+					t.Errorf("unexpected duplicate: %+v", dup)
+				}
+				wantWords := 1
+				if !dryRun {
+					wantWords += test.added
+				}
+				words, err := db.getAllWords("spanish")
+				if err != nil || len(words) != wantWords {
+					t.Fatalf("expected %d words, got %d (%v)", wantWords, len(words), err)
+				}
+			}
+			// Imported words have their inserts recorded like added ones.
+			perro, err := db.getWord("spanish", "perro", false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			revs, err := db.getWordHistory("spanish", perro.Id)
+			if got := revisionStrs(t, revs); err != nil || fmt.Sprint(got) != "[insert - dog]" {
+				t.Errorf("unexpected history of imported word: %q (%v)", got, err)
+			}
+
+			var buf bytes.Buffer
+			if err := db.exportWords("spanish", "", &buf, test.format); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			sep := map[string]string{FormatCSV: ",", FormatTSV: "\t"}[test.format]
+			if lines[0] != strings.Join(wordColumns, sep) {
+				t.Errorf("unexpected header: %q", lines[0])
+			}
+			want := strings.Join([]string{
+				"perro", "dog", "can|chucho", "", "", "", "", "", "", "animals",
+			}, sep)
+			if !contains(lines, want) {
+				t.Errorf("expected export to contain %q, got %q", want, lines)
+			}
+
+			// The exported file imports into another language.
+			addTestLang(t, db, "copy")
+			report, err := db.importWords("copy", &buf, test.format, false, time.Now())
+			if err != nil || report.Added != len(lines)-1 {
+				t.Errorf("unexpected reimport report: %+v (%v)", report, err)
+			}
+		})
+	}
+}
+
+func TestImportExportErrors(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	tests := []struct {
+		lang, format, data string
+		err                error
+	}{
+		{"spanish", "json", "word\n", ErrInvalidFormat},
+		{"spanish", FormatCSV, "", ErrInvalidHeader},
+		{"spanish", FormatCSV, "definition\ndog\n", ErrInvalidHeader},
+		{"german", FormatCSV, "word\nhund\n", ErrNoLangFound},
+	}
+	for _, test := range tests {
+		_, err := db.importWords(
+			test.lang, strings.NewReader(test.data), test.format, false, time.Now(),
+		)
+		if !errors.Is(err, test.err) {
+			t.Errorf(
+				"import %q as %s: expected %v, got %v",
+				test.data, test.format, test.err, err,
+			)
+		}
+	}
+	if err := db.exportWords("spanish", "", &bytes.Buffer{}, "xml"); err != ErrInvalidFormat {
+		t.Errorf("expected ErrInvalidFormat, got %v", err)
+	}
+}
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,628 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+)
+
+// WordList is a named, ordered list of words in a language (like a deck).
+type WordList struct {
+	Id          int64  `json:"id"`
+	LangId      int64  `json:"langId"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	CreatedAt   int64  `json:"createdAt"`
+	// WordCount is the number of words in the list.
+	WordCount int `json:"wordCount"`
+	// Words are the list's words in order. They're only included when getting
+	// a single list.
+	Words []Word `json:"words,omitempty"`
+}
+
+type NewWordList struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	WordIds     []int64 `json:"wordIds,omitempty"`
+}
+
+type WordListDiff struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	// WordIds, if set, replaces the list's words (in order).
+	WordIds *[]int64 `json:"wordIds,omitempty"`
+}
+
+// Reads the diff from a JSON Merge Patch of a WordList. Null fields are
+// cleared.
+func wordListDiffFromPatch(
+	patch map[string]json.RawMessage,
+) (WordListDiff, error) {
+	wld := WordListDiff{}
+	if err := patchField(patch, "name", &wld.Name); err != nil {
+		return wld, err
+	}
+	if err := patchField(patch, "description", &wld.Description); err != nil {
+		return wld, err
+	}
+	if err := patchField(patch, "wordIds", &wld.WordIds); err != nil {
+		return wld, err
+	}
+	return wld, checkPatchEmpty(patch)
+}
+
+// ListWordsRequest is the IDs of words to add to a list.
+type ListWordsRequest struct {
+	Ids []int64 `json:"ids"`
+}
+
+// TagCount is a tag and the number of words with it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+func (s *Server) getListsHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	lists, err := s.userDb(c).getLists(lang)
+	code, resp := http.StatusOK, Response[[]WordList]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error getting lists for lang %s: %v", lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = lists
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Gets the list (by ID or name) along with its words.
+func (s *Server) getListHandler(c *jmux.Context) {
+	lang, name := c.Params["lang"], c.Params["list"]
+	list, err := s.userDb(c).getList(lang, name)
+	code, resp := http.StatusOK, Response[WordList]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error getting list %s for lang %s: %v", name, lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = list
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+func (s *Server) newListHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	nl := NewWordList{}
+	if err := c.ReadBodyJSON(&nl); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	list, err := s.userDb(c).newList(lang, nl, time.Now())
+	code, resp := http.StatusOK, Response[WordList]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error creating list for lang %s: %v", lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = list
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Edits the list using a JSON Merge Patch of its fields.
+func (s *Server) editListHandler(c *jmux.Context) {
+	lang, name := c.Params["lang"], c.Params["list"]
+	wld, patch, err := WordListDiff{}, map[string]json.RawMessage(nil), error(nil)
+	if patch, err = readMergePatch(c); err == nil {
+		wld, err = wordListDiffFromPatch(patch)
+	}
+	if err != nil {
+		writePatchReadError(c, err)
+		return
+	}
+
+	list, err := s.userDb(c).editList(lang, name, wld)
+	code, resp := http.StatusOK, Response[WordList]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error editing list %s for lang %s: %v", name, lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = list
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Deleting a list doesn't delete its words.
+func (s *Server) delListHandler(c *jmux.Context) {
+	lang, name := c.Params["lang"], c.Params["list"]
+	list, err := s.userDb(c).delList(lang, name)
+	code, resp := http.StatusOK, Response[WordList]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error deleting list %s for lang %s: %v", name, lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = list
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Appends the words to the list, returning the updated list.
+func (s *Server) addListWordsHandler(c *jmux.Context) {
+	lang, name := c.Params["lang"], c.Params["list"]
+	req := ListWordsRequest{}
+	if err := c.ReadBodyJSON(&req); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	list, err := s.userDb(c).addListWords(lang, name, req.Ids)
+	code, resp := http.StatusOK, Response[WordList]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error adding words to list %s for lang %s: %v", name, lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = list
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Removes the word from the list, returning the updated list.
+func (s *Server) delListWordHandler(c *jmux.Context) {
+	lang, name := c.Params["lang"], c.Params["list"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+
+	list, err := s.userDb(c).delListWord(lang, name, id)
+	code, resp := http.StatusOK, Response[WordList]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error removing word %d from list %s: %v", id, name, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = list
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Gets the language's tags with the number of words with each, sorted by tag.
+func (s *Server) getTagsHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	tags, err := s.userDb(c).getTags(lang)
+	code, resp := http.StatusOK, Response[[]TagCount]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error getting tags for lang %s: %v", lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = tags
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Lowercases and trims the tags, removing empty and duplicate ones. Tags
+// can't contain "|" since it separates them in exports.
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	return jtutils.FilterMapSlice(
+		tags,
+		func(tag string) (string, bool) {
+			tag = strings.ToLower(normalizeText(tag))
+			if tag == "" || strings.Contains(tag, "|") || seen[tag] {
+				return "", false
+			}
+			seen[tag] = true
+			return tag, true
+		},
+	)
+}
+
+// Adds the tags to the word. Existing tags are kept.
+func setWordTags(ex DBExecer, wordId int64, tags []string) error {
+	for _, tag := range tags {
+		_, err := ex.Exec(
+			`INSERT OR IGNORE INTO word_tags(word_id,tag) VALUES (?,?)`,
+			wordId, tag,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) getTags(lang string) ([]TagCount, error) {
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(
+		`SELECT tag,COUNT(*) FROM word_tags
+    JOIN words ON words.id=word_tags.word_id
+    WHERE words.lang_id=? AND words.deleted_at IS NULL GROUP BY tag ORDER BY tag`,
+		langId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []TagCount{}
+	for rows.Next() {
+		tc := TagCount{}
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tc)
+	}
+	return tags, rows.Err()
+}
+
+const listCols = `id,lang_id,name,description,created_at,
+(SELECT COUNT(*) FROM word_list_items AS items
+  JOIN words ON words.id=items.word_id
+  WHERE items.list_id=word_lists.id AND words.deleted_at IS NULL)`
+
+func scanList(dbs DBScanner) (list WordList, err error) {
+	err = dbs.Scan(
+		&list.Id, &list.LangId, &list.Name, &list.Description, &list.CreatedAt,
+		&list.WordCount,
+	)
+	return
+}
+
+// Gets the ID of the language's list, which can be passed as the name (in any
+// case) or ID.
+func (db *DB) getListId(langId int64, name string) (int64, error) {
+	stmt := `SELECT id FROM word_lists WHERE lang_id=? AND name=?`
+	arg := any(foldListName(name))
+	if id, err := strconv.ParseInt(name, 10, 64); err == nil {
+		stmt, arg = `SELECT id FROM word_lists WHERE lang_id=? AND id=?`, id
+	}
+	id := int64(0)
+	err := db.QueryRow(stmt, langId, arg).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNoListFound
+	}
+	return id, err
+}
+
+// Gets the IDs of the language and the list in it.
+func (db *DB) getLangListIds(lang, list string) (int64, int64, error) {
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return 0, 0, err
+	}
+	listId, err := db.getListId(langId, list)
+	return langId, listId, err
+}
+
+func (db *DB) getLists(lang string) ([]WordList, error) {
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(
+		`SELECT `+listCols+` FROM word_lists WHERE lang_id=? ORDER BY name`,
+		langId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lists := []WordList{}
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+func (db *DB) getList(lang, name string) (WordList, error) {
+	_, listId, err := db.getLangListIds(lang, name)
+	if err != nil {
+		return WordList{}, err
+	}
+	return getListById(db, listId)
+}
+
+// Gets the list with its words.
+func getListById(q DBQuerier, listId int64) (WordList, error) {
+	list, err := scanList(q.QueryRow(
+		`SELECT `+listCols+` FROM word_lists WHERE id=?`, listId,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNoListFound
+		}
+		return list, err
+	}
+	rows, err := q.Query(
+		`SELECT `+wordCols+` FROM words
+    JOIN word_list_items AS items ON items.word_id=words.id
+    WHERE items.list_id=? AND words.deleted_at IS NULL ORDER BY items.idx`,
+		listId,
+	)
+	if err != nil {
+		return list, err
+	}
+	defer rows.Close()
+	list.Words, err = scanWords(rows)
+	return list, err
+}
+
+// Returns the name lowercased (like tags), which is how list names are stored
+// so that they're unique ignoring case.
+func foldListName(name string) string {
+	return strings.ToLower(normalizeText(name))
+}
+
+// Returns the normalized list name, or ErrInvalidList if it's empty.
+func normalizeListName(name string) (string, error) {
+	name = foldListName(name)
+	if name == "" {
+		return "", fmt.Errorf("%w: missing name", ErrInvalidList)
+	}
+	return name, nil
+}
+
+func (db *DB) newList(lang string, nl NewWordList, now time.Time) (WordList, error) {
+	name, err := normalizeListName(nl.Name)
+	if err != nil {
+		return WordList{}, err
+	}
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return WordList{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return WordList{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`INSERT INTO word_lists(lang_id,name,description,created_at)
+    VALUES (?,?,?,?)`,
+		langId, name, normalizeText(nl.Description), now.Unix(),
+	)
+	if err != nil {
+		if isUniqueError(err) {
+			err = ErrListExists
+		}
+		return WordList{}, err
+	}
+	listId, err := res.LastInsertId()
+	if err != nil {
+		return WordList{}, err
+	}
+	if err := addListItems(tx, langId, listId, nl.WordIds); err != nil {
+		return WordList{}, err
+	}
+	list, err := getListById(tx, listId)
+	if err != nil {
+		return WordList{}, err
+	}
+	return list, tx.Commit()
+}
+
+func (db *DB) editList(lang, name string, wld WordListDiff) (WordList, error) {
+	langId, listId, err := db.getLangListIds(lang, name)
+	if err != nil {
+		return WordList{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return WordList{}, err
+	}
+	defer tx.Rollback()
+
+	if wld.Name != nil {
+		newName, err := normalizeListName(*wld.Name)
+		if err != nil {
+			return WordList{}, err
+		}
+		_, err = tx.Exec(`UPDATE word_lists SET name=? WHERE id=?`, newName, listId)
+		if err != nil {
+			if isUniqueError(err) {
+				err = ErrListExists
+			}
+			return WordList{}, err
+		}
+	}
+	if wld.Description != nil {
+		_, err := tx.Exec(
+			`UPDATE word_lists SET description=? WHERE id=?`,
+			normalizeText(*wld.Description), listId,
+		)
+		if err != nil {
+			return WordList{}, err
+		}
+	}
+	if wld.WordIds != nil {
+		_, err := tx.Exec(`DELETE FROM word_list_items WHERE list_id=?`, listId)
+		if err != nil {
+			return WordList{}, err
+		}
+		if err := addListItems(tx, langId, listId, *wld.WordIds); err != nil {
+			return WordList{}, err
+		}
+	}
+	list, err := getListById(tx, listId)
+	if err != nil {
+		return WordList{}, err
+	}
+	return list, tx.Commit()
+}
+
+func (db *DB) delList(lang, name string) (WordList, error) {
+	_, listId, err := db.getLangListIds(lang, name)
+	if err != nil {
+		return WordList{}, err
+	}
+	list, err := getListById(db, listId)
+	if err != nil {
+		return WordList{}, err
+	}
+	_, err = db.Exec(`DELETE FROM word_lists WHERE id=?`, listId)
+	return list, err
+}
+
+// Appends the words to the list. Words already in the list are left where
+// they are.
+func (db *DB) addListWords(lang, name string, ids []int64) (WordList, error) {
+	langId, listId, err := db.getLangListIds(lang, name)
+	if err != nil {
+		return WordList{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return WordList{}, err
+	}
+	defer tx.Rollback()
+
+	if err := addListItems(tx, langId, listId, ids); err != nil {
+		return WordList{}, err
+	}
+	list, err := getListById(tx, listId)
+	if err != nil {
+		return WordList{}, err
+	}
+	return list, tx.Commit()
+}
+
+func (db *DB) delListWord(lang, name string, wordId int64) (WordList, error) {
+	_, listId, err := db.getLangListIds(lang, name)
+	if err != nil {
+		return WordList{}, err
+	}
+	res, err := db.Exec(
+		`DELETE FROM word_list_items WHERE list_id=? AND word_id=?`,
+		listId, wordId,
+	)
+	if err != nil {
+		return WordList{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return WordList{}, err
+	} else if n == 0 {
+		return WordList{}, ErrNoWordFound
+	}
+	return getListById(db, listId)
+}
+
+// Appends the words, which must be in the language, to the end of the list.
+// Words already in the list are skipped.
+func addListItems(tx *sql.Tx, langId, listId int64, wordIds []int64) error {
+	for _, id := range wordIds {
+		res, err := tx.Exec(
+			`INSERT OR IGNORE INTO word_list_items(list_id,word_id,idx)
+      SELECT ?,id,(
+        SELECT IFNULL(MAX(idx)+1,0) FROM word_list_items WHERE list_id=?
+      ) FROM words WHERE id=? AND lang_id=? AND deleted_at IS NULL`,
+			listId, listId, id, langId,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			// Either the word doesn't exist or it's already in the list.
+			var exists bool
+			err := tx.QueryRow(
+				`SELECT EXISTS(
+          SELECT 1 FROM words WHERE id=? AND lang_id=? AND deleted_at IS NULL
+        )`,
+				id, langId,
+			).Scan(&exists)
+			if err != nil {
+				return err
+			} else if !exists {
+				return fmt.Errorf("%w: %d", ErrNoWordFound, id)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the SQL condition limiting words to those in the list (always true
+// if listId is 0), along with its args.
+func listWordsCond(listId int64) (string, []any) {
+	if listId == 0 {
+		return "1", nil
+	}
+	return `words.id IN (SELECT word_id FROM word_list_items WHERE list_id=?)`,
+		[]any{listId}
+}
+
+// Gets the ID of the list in the language, or 0 if the list is empty.
+func (db *DB) optListId(langId int64, list string) (int64, error) {
+	if list == "" {
+		return 0, nil
+	}
+	return db.getListId(langId, list)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got := normalizeTags([]string{" Animals ", "pets", "ANIMALS", "", "a|b", "Pets"})
+	if want := "[animals pets]"; fmt.Sprint(got) != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+}
+
+func TestNormalizeListName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{" Chapter 3 ", "chapter 3"},
+		{"VERBS I keep missing", "verbs i keep missing"},
+		{"\u00d1and\u00fa", "\u00f1and\u00fa"},
+		{" ", ""},
+	}
+	for _, test := range tests {
+		got, err := normalizeListName(test.name)
+		if test.want == "" {
+			if !errors.Is(err, ErrInvalidList) {
+				t.Errorf("normalizeListName(%q): expected ErrInvalidList, got %v", test.name, err)
+			}
+		} else if err != nil || got != test.want {
+			t.Errorf("normalizeListName(%q): expected %q, got %q (%v)", test.name, test.want, got, err)
+		}
+	}
+}
+
+func TestLists(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	now := time.Now()
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	gato := addTestWord(t, db, "spanish", "gato", "cat")
+	pez := addTestWord(t, db, "spanish", "pez", "fish")
+
+	list, err := db.newList("spanish", NewWordList{
+		Name: " Travel ", Description: "for trips", WordIds: []int64{gato.Id, perro.Id},
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Name != "travel" || list.WordCount != 2 {
+		t.Errorf("unexpected list: %+v", list)
+	}
+
+	newTests := []struct {
+		nl  NewWordList
+		err error
+	}{
+		// Names are unique ignoring case.
+		{NewWordList{Name: "TRAVEL"}, ErrListExists},
+		{NewWordList{Name: " "}, ErrInvalidList},
+		{NewWordList{Name: "verbs", WordIds: []int64{999}}, ErrNoWordFound},
+	}
+	for _, test := range newTests {
+		if _, err := db.newList("spanish", test.nl, now); !errors.Is(err, test.err) {
+			t.Errorf("newList(%+v): expected %v, got %v", test.nl, test.err, err)
+		}
+	}
+	// Failed lists aren't created.
+	if _, err := db.getList("spanish", "verbs"); err != ErrNoListFound {
+		t.Errorf("expected ErrNoListFound, got %v", err)
+	}
+
+	// Lists can be referred to by ID or by name in any case.
+	for _, name := range []string{"travel", "Travel", jsonStr(list.Id)} {
+		got, err := db.getList("spanish", name)
+		if err != nil || fmt.Sprint(wordNames(got.Words)) != "[gato perro]" {
+			t.Errorf("getList(%q): unexpected list %+v (%v)", name, got, err)
+		}
+	}
+
+	list, err = db.addListWords("spanish", "TRAVEL", []int64{pez.Id, gato.Id})
+	if err != nil || fmt.Sprint(wordNames(list.Words)) != "[gato perro pez]" {
+		t.Errorf("unexpected list after adding words: %+v (%v)", list, err)
+	}
+	if _, err := db.delListWord("spanish", "travel", perro.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.delListWord("spanish", "travel", perro.Id); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound, got %v", err)
+	}
+
+	other, err := db.newList("spanish", NewWordList{Name: "Other"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, ids := " Trips ", []int64{pez.Id}
+	list, err = db.editList("spanish", "travel", WordListDiff{Name: &name, WordIds: &ids})
+	if err != nil || list.Name != "trips" || fmt.Sprint(wordNames(list.Words)) != "[pez]" {
+		t.Errorf("unexpected list after editing: %+v (%v)", list, err)
+	}
+	name = "TRIPS"
+	if _, err := db.editList("spanish", jsonStr(other.Id), WordListDiff{Name: &name}); err != ErrListExists {
+		t.Errorf("expected ErrListExists, got %v", err)
+	}
+
+	// Deleted words aren't counted.
+	if _, err := db.delWordById("spanish", pez.Id, now); err != nil {
+		t.Fatal(err)
+	}
+	lists, err := db.getLists("spanish")
+	if err != nil || len(lists) != 2 || lists[0].Name != "other" || lists[1].WordCount != 0 {
+		t.Errorf("unexpected lists: %+v (%v)", lists, err)
+	}
+	if _, err := db.delList("spanish", "Trips"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.getWordById("spanish", gato.Id); err != nil {
+		t.Errorf("expected words to be kept, got %v", err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	now := time.Now()
+	for _, word := range []Word{
+		{Word: "perro", Tags: []string{"Animals", "pets"}},
+		{Word: "gato", Tags: []string{"animals", "PETS", "pets"}},
+		{Word: "mesa", Tags: []string{"house"}},
+	} {
+		if err := db.addWord("spanish", &word, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tags, err := db.getTags("spanish")
+	if want := "[{animals 2} {house 1} {pets 2}]"; err != nil || fmt.Sprint(tags) != want {
+		t.Errorf("expected %s, got %v (%v)", want, tags, err)
+	}
+}
+
+func TestListHandlers(t *testing.T) {
+	srvr := newTestServer(t, newTestDb(t))
+	tc := newTestClient(t, srvr)
+	tc.register("alice")
+	if code := tc.do(http.MethodPost, "/langs", Lang{Name: "spanish"}, nil); code != http.StatusOK {
+		t.Fatalf("error creating language: %d", code)
+	}
+	wordResp := Response[Word]{}
+	if code := tc.do(http.MethodPost, "/langs/spanish/words", Word{Word: "perro", Tags: []string{"Pets"}}, &wordResp); code != http.StatusOK {
+		t.Fatalf("error adding word: %d", code)
+	}
+	perroId := wordResp.Content.Id
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		code   int
+	}{
+		{"create", http.MethodPost, "/langs/spanish/lists", NewWordList{Name: "Chapter 3"}, http.StatusOK},
+		{"create again", http.MethodPost, "/langs/spanish/lists", NewWordList{Name: "CHAPTER 3"}, http.StatusBadRequest},
+		{"get", http.MethodGet, "/langs/spanish/lists/Chapter%203", nil, http.StatusOK},
+		{"add words", http.MethodPost, "/langs/spanish/lists/chapter%203/words", ListWordsRequest{Ids: []int64{perroId}}, http.StatusOK},
+		{"add missing word", http.MethodPost, "/langs/spanish/lists/chapter%203/words", ListWordsRequest{Ids: []int64{999}}, http.StatusBadRequest},
+		{"rename", http.MethodPatch, "/langs/spanish/lists/chapter%203", map[string]any{"name": "Travel"}, http.StatusOK},
+		{"unknown field", http.MethodPatch, "/langs/spanish/lists/travel", map[string]any{"id": 1}, http.StatusBadRequest},
+		{"get renamed", http.MethodGet, "/langs/spanish/lists/TRAVEL", nil, http.StatusOK},
+		{"get old name", http.MethodGet, "/langs/spanish/lists/chapter%203", nil, http.StatusBadRequest},
+		{"remove word", http.MethodDelete, "/langs/spanish/lists/travel/words/" + jsonStr(perroId), nil, http.StatusOK},
+		{"tags", http.MethodGet, "/langs/spanish/tags", nil, http.StatusOK},
+		{"delete", http.MethodDelete, "/langs/spanish/lists/travel", nil, http.StatusOK},
+		{"delete again", http.MethodDelete, "/langs/spanish/lists/travel", nil, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		resp := Response[any]{}
+		if code := tc.do(test.method, test.path, test.body, &resp); code != test.code {
+			t.Errorf("%s: expected %d, got %d (%s)", test.name, test.code, code, resp.Error)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+)
+
+// The max size of an uploaded audio file.
+const maxAudioSize = 10 << 20
+
+// Media is an uploaded file, identified by the SHA-256 hash of its contents.
+type Media struct {
+	Hash string `json:"hash"`
+	Mime string `json:"mime"`
+	Size int64  `json:"size"`
+	// Width and Height are the dimensions of images.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+// The extensions of the accepted media types, which are used when exporting
+// them as files.
+var mediaExts = map[string]string{
+	"audio/mpeg": ".mp3",
+	"audio/ogg":  ".ogg",
+	"audio/wav":  ".wav",
+	"audio/flac": ".flac",
+	"audio/mp4":  ".m4a",
+	"audio/webm": ".webm",
+	"audio/aac":  ".aac",
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+// Returns the file name of the media (its hash with an extension).
+func (m Media) fileName() string {
+	return m.Hash + mediaExts[m.Mime]
+}
+
+// Returns the audio type of the data from its signature, or an empty string
+// if it isn't one of the accepted types.
+func sniffAudio(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("ID3")):
+		return "audio/mpeg"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return "audio/ogg"
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) &&
+		bytes.Equal(data[8:12], []byte("WAVE")):
+		return "audio/wav"
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return "audio/flac"
+	case len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")):
+		return "audio/mp4"
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return "audio/webm"
+	case len(data) >= 2 && data[0] == 0xFF && data[1]&0xF6 == 0xF0:
+		// ADTS frames have a layer of 0, unlike MPEG audio frames.
+		return "audio/aac"
+	case len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return "audio/mpeg"
+	}
+	return ""
+}
+
+// mediaStore stores media files in a directory, named by their hash (under
+// subdirectories named by the first 2 characters of it).
+type mediaStore struct {
+	dir string
+}
+
+func (ms mediaStore) path(hash string) string {
+	return filepath.Join(ms.dir, hash[:2], hash)
+}
+
+// Saves the data (if it isn't already stored), returning its hash.
+func (ms mediaStore) save(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	path := ms.path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	// Written to a temp file first so that partially written files are never
+	// served.
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return hash, os.Rename(f.Name(), path)
+}
+
+func (ms mediaStore) open(hash string) (*os.File, error) {
+	return os.Open(ms.path(hash))
+}
+
+// Removes the files with the hashes, ignoring ones that don't exist.
+func (ms mediaStore) remove(hashes []string) error {
+	for _, hash := range hashes {
+		err := os.Remove(ms.path(hash))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes the media no longer used by any words along with their files.
+// Errors are only logged since they only leave unused files behind.
+func (s *Server) pruneMedia() {
+	s.mediaMtx.Lock()
+	defer s.mediaMtx.Unlock()
+	hashes, err := s.db.pruneMedia()
+	if err != nil {
+		log.Print("error pruning media: ", err)
+	} else if err := s.media.remove(hashes); err != nil {
+		log.Print("error removing media files: ", err)
+	}
+}
+
+// Streams the word's audio, supporting range requests.
+func (s *Server) getAudioHandler(c *jmux.Context) {
+	s.serveWordMedia(c, func(w Word) *Media { return w.Audio })
+}
+
+// Serves the media of the word returned by get, supporting range requests.
+func (s *Server) serveWordMedia(c *jmux.Context, get func(Word) *Media) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["word"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	word, err := s.userDb(c).getWordById(lang, id)
+	if err == nil && get(word) == nil {
+		err = ErrNoMediaFound
+	}
+	if err != nil {
+		if isUserError(err) {
+			c.BadRequest(errRespJson(err.Error()))
+		} else {
+			log.Printf("error getting word %d: %v", id, err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	media := *get(word)
+	f, err := s.media.open(media.Hash)
+	if err != nil {
+		log.Printf("error opening media %s: %v", media.Hash, err)
+		c.InternalServerError(errRespJson("internal server error"))
+		return
+	}
+	defer f.Close()
+	hdr := c.RespHeader()
+	hdr.Set("Content-Type", media.Mime)
+	// The contents never change for a hash.
+	hdr.Set("ETag", `"`+media.Hash+`"`)
+	hdr.Set("Cache-Control", "private, max-age=31536000, immutable")
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, f)
+}
+
+// Sets the word's audio to the request body, returning the updated word. The
+// type is detected from the contents and must be one of the accepted audio
+// types.
+func (s *Server) putAudioHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	if ct := c.Request.Header.Get("Content-Type"); ct != "" &&
+		!strings.HasPrefix(ct, "audio/") &&
+		!strings.HasPrefix(ct, "application/octet-stream") {
+		c.WriteError(http.StatusUnsupportedMediaType, "expected audio")
+		return
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxAudioSize)
+	data, err := io.ReadAll(body)
+	if err != nil {
+		if _, ok := errAs[*http.MaxBytesError](err); ok {
+			c.WriteError(http.StatusRequestEntityTooLarge, "file too large")
+		} else {
+			log.Print("error reading audio: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+	audio := Media{Mime: sniffAudio(data), Size: int64(len(data))}
+	if audio.Mime == "" {
+		c.WriteError(http.StatusUnsupportedMediaType, "unsupported audio type")
+		return
+	}
+	s.mediaMtx.Lock()
+	if audio.Hash, err = s.media.save(data); err != nil {
+		s.mediaMtx.Unlock()
+		log.Print("error saving audio: ", err)
+		c.InternalServerError(errRespJson("internal server error"))
+		return
+	}
+
+	code, resp := http.StatusOK, Response[Word]{}
+	word, err := s.userDb(c).setWordMedia(
+		lang, id, time.Now(), wordMediaCol{col: "audio", media: &audio},
+	)
+	s.mediaMtx.Unlock()
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error setting audio of word %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = word
+		c.RespHeader().Set("ETag", versionETag(word.Version))
+		// Frees the word's old audio.
+		s.pruneMedia()
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Removes the word's audio, returning the updated word.
+func (s *Server) delAudioHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+
+	code, resp := http.StatusOK, Response[Word]{}
+	word, err := s.userDb(c).setWordMedia(
+		lang, id, time.Now(), wordMediaCol{col: "audio"},
+	)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error deleting audio of word %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = word
+		c.RespHeader().Set("ETag", versionETag(word.Version))
+		s.pruneMedia()
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Selects media as a JSON object.
+const mediaJsonObj = `json_object(
+  'hash',hash,'mime',mime,'size',size,'width',width,'height',height
+)`
+
+// Select the media referenced by a word (NULL if there's none). Used as part
+// of wordCols.
+const (
+	audioCol     = `(SELECT ` + mediaJsonObj + ` FROM media WHERE hash=words.audio)`
+	imageCol     = `(SELECT ` + mediaJsonObj + ` FROM media WHERE hash=words.image)`
+	thumbnailCol = `(SELECT ` + mediaJsonObj + ` FROM media WHERE hash=words.thumbnail)`
+)
+
+// Decodes the media selected by a media column.
+func mediaFromJson(mediaJson sql.NullString) (*Media, error) {
+	if !mediaJson.Valid {
+		return nil, nil
+	}
+	m := &Media{}
+	if err := json.Unmarshal([]byte(mediaJson.String), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// wordMediaCol is (already stored) media to set a words column to, or nil to
+// clear it.
+type wordMediaCol struct {
+	col   string
+	media *Media
+}
+
+// Sets the word's media columns, incrementing the word's version. Clearing
+// columns that are already empty returns ErrNoMediaFound.
+func (db *DB) setWordMedia(
+	lang string,
+	wordId int64,
+	now time.Time,
+	cols ...wordMediaCol,
+) (Word, error) {
+	if _, err := db.getWordById(lang, wordId); err != nil {
+		return Word{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Word{}, err
+	}
+	defer tx.Rollback()
+
+	setStmt, args, changed := "", []any{}, false
+	for _, mc := range cols {
+		var hash any
+		if m := mc.media; m != nil {
+			hash = m.Hash
+			_, err := tx.Exec(
+				`INSERT OR IGNORE INTO media(hash,mime,size,width,height,created_at)
+        VALUES (?,?,?,?,?,?)`,
+				m.Hash, m.Mime, m.Size, m.Width, m.Height, now.Unix(),
+			)
+			if err != nil {
+				return Word{}, err
+			}
+		}
+		setStmt += ", " + mc.col + "=?"
+		args = append(args, hash)
+		changed = changed || hash != nil
+	}
+	if !changed {
+		cond := "0"
+		for _, mc := range cols {
+			cond += " OR " + mc.col + " IS NOT NULL"
+		}
+		var hasMedia bool
+		err := tx.QueryRow(
+			`SELECT `+cond+` FROM words WHERE id=?`, wordId,
+		).Scan(&hasMedia)
+		if err != nil {
+			return Word{}, err
+		} else if !hasMedia {
+			return Word{}, ErrNoMediaFound
+		}
+	}
+	_, err = tx.Exec(
+		`UPDATE words SET version=version+1`+setStmt+` WHERE id=?`,
+		append(args, wordId)...,
+	)
+	if err != nil {
+		return Word{}, err
+	}
+	word, err := scanWord(tx.QueryRow(
+		`SELECT `+wordCols+` FROM words WHERE id=?`, wordId,
+	))
+	if err != nil {
+		return Word{}, err
+	}
+	return word, tx.Commit()
+}
+
+// Deletes the media no longer used by any words, returning their hashes. This
+// isn't scoped to the DB's languages since media can be shared by words of
+// different users.
+func (db *DB) pruneMedia() ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const unusedCond = `hash NOT IN (
+    SELECT audio FROM words WHERE audio IS NOT NULL
+    UNION SELECT image FROM words WHERE image IS NOT NULL
+    UNION SELECT thumbnail FROM words WHERE thumbnail IS NOT NULL
+  )`
+	rows, err := tx.Query(`SELECT hash FROM media WHERE ` + unusedCond)
+	if err != nil {
+		return nil, err
+	}
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(hashes) == 0 {
+		return hashes, nil
+	}
+	if _, err := tx.Exec(`DELETE FROM media WHERE ` + unusedCond); err != nil {
+		return nil, err
+	}
+	return hashes, tx.Commit()
+}
+
+// Returns the default media dir, which is next to the static dir.
+func defaultMediaPath(staticPath string) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(staticPath)), "media")
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSniffAudio(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte("ID3\x04\x00"), "audio/mpeg"},
+		{[]byte("OggS\x00\x02"), "audio/ogg"},
+		{[]byte("RIFF\x24\x00\x00\x00WAVEfmt "), "audio/wav"},
+		{[]byte("RIFF\x24\x00\x00\x00AVI LIST"), ""},
+		{[]byte("fLaC\x00\x00"), "audio/flac"},
+		{[]byte("\x00\x00\x00\x20ftypM4A "), "audio/mp4"},
+		{[]byte{0x1A, 0x45, 0xDF, 0xA3, 0x01}, "audio/webm"},
+		{[]byte{0xFF, 0xF1, 0x50}, "audio/aac"},
+		{[]byte{0xFF, 0xFB, 0x90}, "audio/mpeg"},
+		{[]byte{0xFF}, ""},
+		{[]byte("hello"), ""},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		if got := sniffAudio(test.data); got != test.want {
+			t.Errorf("sniffAudio(%q): expected %q, got %q", test.data, test.want, got)
+		}
+	}
+}
+
+func TestMediaStore(t *testing.T) {
+	ms := mediaStore{dir: t.TempDir()}
+	data := []byte("ID3 some audio")
+	sum := sha256.Sum256(data)
+	want := hex.EncodeToString(sum[:])
+
+	// Saving the same data again keeps the one file.
+	for i := 0; i < 2; i++ {
+		hash, err := ms.save(data)
+		if err != nil || hash != want {
+			t.Fatalf("expected %s, got %s (%v)", want, hash, err)
+		}
+	}
+	f, err := ms.open(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("expected %q, got %q (%v)", data, got, err)
+	}
+	entries, err := os.ReadDir(ms.dir + "/" + want[:2])
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected 1 file, got %d (%v)", len(entries), err)
+	}
+
+	if err := ms.remove([]string{want, strings.Repeat("0", 64)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.open(want); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected file to be removed, got %v", err)
+	}
+
+	for _, m := range []Media{
+		{Hash: "abc", Mime: "audio/mpeg"},
+		{Hash: "abc", Mime: "image/jpeg"},
+		{Hash: "abc", Mime: "text/plain"},
+	} {
+		want := "abc" + mediaExts[m.Mime]
+		if got := m.fileName(); got != want {
+			t.Errorf("fileName(%+v): expected %s, got %s", m, want, got)
+		}
+	}
+}
+
+// Returns the hashes of the media in the DB.
+func mediaHashes(t *testing.T, db *DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT hash FROM media ORDER BY hash`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+func TestSetWordMedia(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	now := time.Now()
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	gato := addTestWord(t, db, "spanish", "gato", "cat")
+	audio := &Media{Hash: "aaaa", Mime: "audio/mpeg", Size: 4}
+
+	if _, err := db.setWordMedia("spanish", perro.Id, now, wordMediaCol{col: "audio"}); err != ErrNoMediaFound {
+		t.Errorf("expected ErrNoMediaFound, got %v", err)
+	}
+	for _, id := range []int64{perro.Id, gato.Id} {
+		word, err := db.setWordMedia("spanish", id, now, wordMediaCol{col: "audio", media: audio})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if word.Audio == nil || *word.Audio != *audio || word.Version != 2 {
+			t.Errorf("unexpected word: %+v", word)
+		}
+	}
+	if _, err := db.setWordMedia("spanish", 999, now, wordMediaCol{col: "audio", media: audio}); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound, got %v", err)
+	}
+
+	// Media is only pruned once no words use it.
+	pruneTests := []struct {
+		id   int64
+		want []string
+	}{
+		{perro.Id, nil},
+		{gato.Id, []string{"aaaa"}},
+	}
+	for _, test := range pruneTests {
+		word, err := db.setWordMedia("spanish", test.id, now, wordMediaCol{col: "audio"})
+		if err != nil || word.Audio != nil || word.Version != 3 {
+			t.Errorf("unexpected word after clearing audio: %+v (%v)", word, err)
+		}
+		hashes, err := db.pruneMedia()
+		if err != nil || len(hashes) != len(test.want) ||
+			(len(hashes) != 0 && hashes[0] != test.want[0]) {
+			t.Errorf("expected %v to be pruned, got %v (%v)", test.want, hashes, err)
+		}
+	}
+	if hashes := mediaHashes(t, db); len(hashes) != 0 {
+		t.Errorf("expected no media, got %v", hashes)
+	}
+}
+
+func TestAudioHandlers(t *testing.T) {
+	db := newTestDb(t)
+	srvr := newTestServer(t, db)
+	alice, bob := newTestClient(t, srvr), newTestClient(t, srvr)
+	alice.register("alice")
+	bob.register("bob")
+	if code := alice.do(http.MethodPost, "/langs", Lang{Name: "spanish"}, nil); code != http.StatusOK {
+		t.Fatalf("error creating language: %d", code)
+	}
+	wordResp := Response[Word]{}
+	if code := alice.do(http.MethodPost, "/langs/spanish/words", Word{Word: "perro"}, &wordResp); code != http.StatusOK {
+		t.Fatalf("error adding word: %d", code)
+	}
+	path := "/langs/spanish/words/" + jsonStr(wordResp.Content.Id) + "/audio"
+	mp3 := []byte("ID3\x04\x00 some audio")
+	ogg := []byte("OggS\x00 other audio")
+
+	putTests := []struct {
+		name, ct string
+		tc       *testClient
+		data     []byte
+		code     int
+		mime     string
+	}{
+		{"put", "audio/mpeg", alice, mp3, http.StatusOK, "audio/mpeg"},
+		// The type is detected from the contents.
+		{"put other type", "application/octet-stream", alice, ogg, http.StatusOK, "audio/ogg"},
+		{"put without type", "", alice, mp3, http.StatusOK, "audio/mpeg"},
+		{"not audio", "text/plain", alice, mp3, http.StatusUnsupportedMediaType, ""},
+		{"unknown type", "audio/mpeg", alice, []byte("not audio"), http.StatusUnsupportedMediaType, ""},
+		{"too large", "audio/mpeg", alice, append(mp3, make([]byte, maxAudioSize)...), http.StatusRequestEntityTooLarge, ""},
+		{"other user", "audio/mpeg", bob, mp3, http.StatusBadRequest, ""},
+	}
+	for _, test := range putTests {
+		test.tc.header = http.Header{}
+		if test.ct != "" {
+			test.tc.header.Set("Content-Type", test.ct)
+		}
+		res := test.tc.doRaw(http.MethodPut, path, bytes.NewReader(test.data))
+		res.Body.Close()
+		if res.StatusCode != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, res.StatusCode)
+		}
+		test.tc.header = nil
+	}
+	// The replaced audio is pruned.
+	sum := sha256.Sum256(mp3)
+	hash := hex.EncodeToString(sum[:])
+	if hashes := mediaHashes(t, db); len(hashes) != 1 || hashes[0] != hash {
+		t.Errorf("expected only %s, got %v", hash, hashes)
+	}
+
+	alice.header = http.Header{"Range": {"bytes=0-2"}}
+	res := alice.doRaw(http.MethodGet, path, nil)
+	alice.header = nil
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent || string(body) != "ID3" ||
+		res.Header.Get("Content-Type") != "audio/mpeg" ||
+		res.Header.Get("ETag") != `"`+hash+`"` {
+		t.Errorf("unexpected range response: %d %q %v", res.StatusCode, body, res.Header)
+	}
+
+	tests := []struct {
+		name   string
+		tc     *testClient
+		method string
+		code   int
+	}{
+		{"get", alice, http.MethodGet, http.StatusOK},
+		{"other user gets", bob, http.MethodGet, http.StatusBadRequest},
+		{"other user deletes", bob, http.MethodDelete, http.StatusBadRequest},
+		{"delete", alice, http.MethodDelete, http.StatusOK},
+		{"delete again", alice, http.MethodDelete, http.StatusBadRequest},
+		{"get deleted", alice, http.MethodGet, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		res := test.tc.doRaw(test.method, path, nil)
+		res.Body.Close()
+		if res.StatusCode != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, res.StatusCode)
+		}
+	}
+	if hashes := mediaHashes(t, db); len(hashes) != 0 {
+		t.Errorf("expected no media, got %v", hashes)
+	}
+}
+
+func TestAudioHandlersConcurrently(t *testing.T) {
+	db := newTestDb(t)
+	srvr := newTestServer(t, db)
+	tc := newTestClient(t, srvr)
+	tc.register("alice")
+	if code := tc.do(http.MethodPost, "/langs", Lang{Name: "spanish"}, nil); code != http.StatusOK {
+		t.Fatalf("error creating language: %d", code)
+	}
+	paths := [2]string{}
+	for i, w := range []string{"perro", "gato"} {
+		wordResp := Response[Word]{}
+		if code := tc.do(http.MethodPost, "/langs/spanish/words", Word{Word: w}, &wordResp); code != http.StatusOK {
+			t.Fatalf("error adding word: %d", code)
+		}
+		paths[i] = "/langs/spanish/words/" + jsonStr(wordResp.Content.Id) + "/audio"
+	}
+	mp3 := []byte("ID3\x04\x00 some audio")
+	do := func(method, path string, body []byte) {
+		res := tc.doRaw(method, path, bytes.NewReader(body))
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s %s: expected %d, got %d", method, path, http.StatusOK, res.StatusCode)
+		}
+	}
+
+	// The audio's file must survive being pruned (by the first word's audio
+	// being deleted) while it's being uploaded for the second word.
+	for i := 0; i < 50; i++ {
+		do(http.MethodPut, paths[0], mp3)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			do(http.MethodDelete, paths[0], nil)
+		}()
+		go func() {
+			defer wg.Done()
+			do(http.MethodPut, paths[1], mp3)
+		}()
+		wg.Wait()
+		res := tc.doRaw(http.MethodGet, paths[1], nil)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("audio missing after %d tries: %d", i+1, res.StatusCode)
+		}
+		do(http.MethodDelete, paths[1], nil)
+	}
+}
@@ -0,0 +1,615 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jtutils "github.com/johnietre/utils/go"
+	"golang.org/x/text/language"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migration is a single numbered schema change. The SQL is run first when
+// migrating up and last when migrating down, with the optional Go funcs
+// running on the other side of it (for changes that can't be expressed in
+// plain SQL, like the per-language tables).
+type migration struct {
+	version        int
+	name           string
+	upSQL, downSQL string
+	up, down       func(*sql.Tx) error
+	// noForeignKeys disables foreign keys while the migration runs (checking
+	// them before committing), which is needed to rebuild tables that are
+	// referenced by others.
+	noForeignKeys bool
+}
+
+// Go halves of migrations and options, keyed by version.
+var migrationFuncs = map[int]struct {
+	up, down      func(*sql.Tx) error
+	noForeignKeys bool
+}{
+	2:  {up: migrateLangTablesUp2, down: migrateLangTablesDown2},
+	3:  {up: migrateWordsUp3, down: migrateWordsDown3},
+	5:  {up: migrateFoldUp5},
+	8:  {noForeignKeys: true},
+	12: {up: migrateLocaleUp12},
+	13: {up: migrateGendersUp13},
+}
+
+var migrations = jtutils.Must(loadMigrations(migrationsFS))
+
+// Files are expected to be named NNNN_name.up.sql or NNNN_name.down.sql.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	names, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, name := range names {
+		base := path.Base(name)
+		verStr, rest, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", base)
+		}
+		version, err := strconv.Atoi(verStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version: %s", base)
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{version: version}
+			byVersion[version] = m
+		}
+		if strings.HasSuffix(rest, ".up.sql") {
+			m.name, m.upSQL = strings.TrimSuffix(rest, ".up.sql"), string(b)
+		} else if strings.HasSuffix(rest, ".down.sql") {
+			m.name, m.downSQL = strings.TrimSuffix(rest, ".down.sql"), string(b)
+		} else {
+			return nil, fmt.Errorf("invalid migration file name: %s", base)
+		}
+	}
+
+	ms := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if f, ok := migrationFuncs[m.version]; ok {
+			m.up, m.down, m.noForeignKeys = f.up, f.down, f.noForeignKeys
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].version < ms[j].version })
+	for i, m := range ms {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("missing migration version %d", i+1)
+		}
+	}
+	return ms, nil
+}
+
+func latestMigration() int {
+	return len(migrations)
+}
+
+func (db *DB) initMigrations() error {
+	const stmt = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_at INTEGER NOT NULL
+);
+  `
+	_, err := db.Exec(stmt)
+	return err
+}
+
+// schemaVersion returns the version of the last applied migration (0 if
+// none have been applied).
+func (db *DB) schemaVersion() (int, error) {
+	if err := db.initMigrations(); err != nil {
+		return 0, err
+	}
+	version := 0
+	row := db.QueryRow(`SELECT IFNULL(MAX(version), 0) FROM schema_migrations`)
+	err := row.Scan(&version)
+	return version, err
+}
+
+// migrate migrates the database up or down to the given version, one
+// migration (and transaction) at a time.
+func (db *DB) migrate(to int) error {
+	if to < 0 || to > latestMigration() {
+		return fmt.Errorf("invalid migration version: %d", to)
+	}
+	if err := db.checkFts5(); err != nil {
+		return err
+	}
+	curr, err := db.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if curr > latestMigration() {
+		return fmt.Errorf(
+			"database version %d is newer than latest known version %d",
+			curr, latestMigration(),
+		)
+	}
+	for ; curr < to; curr++ {
+		if err := db.runMigration(migrations[curr], true); err != nil {
+			return fmt.Errorf("error migrating up to %d: %v", curr+1, err)
+		}
+	}
+	for ; curr > to; curr-- {
+		if err := db.runMigration(migrations[curr-1], false); err != nil {
+			return fmt.Errorf("error migrating down from %d: %v", curr, err)
+		}
+	}
+	return nil
+}
+
+// Returns an error if SQLite was built without FTS5, which the search index
+// (and so every schema since version 4) needs. go-sqlite3 only includes it
+// with the sqlite_fts5 build tag.
+func (db *DB) checkFts5() error {
+	used := false
+	row := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`)
+	if err := row.Scan(&used); err != nil {
+		return err
+	} else if !used {
+		return fmt.Errorf(
+			"lively-langs was built without SQLite FTS5 " +
+				"(build with -tags sqlite_fts5 or use the makefile)",
+		)
+	}
+	return nil
+}
+
+func (db *DB) runMigration(m migration, up bool) error {
+	// The foreign keys pragma is per connection and can't be changed inside a
+	// transaction, so a single connection is used for the whole migration.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if m.noForeignKeys {
+		if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys=OFF`); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, `PRAGMA foreign_keys=ON`)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		if _, err := tx.Exec(m.upSQL); err != nil {
+			return err
+		}
+		if m.up != nil {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(
+			`INSERT INTO schema_migrations(version, name, applied_at) VALUES (?,?,?)`,
+			m.version, m.name, time.Now().Unix(),
+		)
+	} else {
+		if m.down != nil {
+			if err := m.down(tx); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(m.downSQL); err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			`DELETE FROM schema_migrations WHERE version=?`, m.version,
+		)
+	}
+	if err != nil {
+		return err
+	}
+	if m.noForeignKeys {
+		if err := txCheckForeignKeys(tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func txCheckForeignKeys(tx *sql.Tx) error {
+	rows, err := tx.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int64
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return err
+		}
+		return fmt.Errorf(
+			"foreign key violation: row %d in %s references missing %s row",
+			rowid.Int64, table, parent,
+		)
+	}
+	return rows.Err()
+}
+
+// Per-language word tables used to be named after the language; they're now
+// named after the language's ID and carry an aliases column.
+func migrateLangTablesUp2(tx *sql.Tx) error {
+	langs, err := txLangNames(tx)
+	if err != nil {
+		return err
+	}
+	for id, name := range langs {
+		if ok, err := txTableExists(tx, name); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		tbl := strconv.FormatInt(id, 10)
+		stmt := fmt.Sprintf(`ALTER TABLE [%s] RENAME TO [%s]`, name, tbl)
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+		if ok, err := txColumnExists(tx, tbl, "aliases"); err != nil {
+			return err
+		} else if !ok {
+			stmt := fmt.Sprintf(
+				`ALTER TABLE [%s] ADD COLUMN aliases TEXT NOT NULL DEFAULT ''`,
+				tbl,
+			)
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func migrateLangTablesDown2(tx *sql.Tx) error {
+	langs, err := txLangNames(tx)
+	if err != nil {
+		return err
+	}
+	for id, name := range langs {
+		tbl := strconv.FormatInt(id, 10)
+		if ok, err := txTableExists(tx, tbl); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		stmt := fmt.Sprintf(`ALTER TABLE [%s] DROP COLUMN aliases`, tbl)
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+		stmt = fmt.Sprintf(`ALTER TABLE [%s] RENAME TO [%s]`, tbl, name)
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Folds the per-language tables into the words and word_aliases tables. Word
+// IDs are reassigned since they were only unique per language.
+func migrateWordsUp3(tx *sql.Tx) error {
+	langs, err := txLangNames(tx)
+	if err != nil {
+		return err
+	}
+	for id := range langs {
+		tbl := strconv.FormatInt(id, 10)
+		if ok, err := txTableExists(tx, tbl); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if err := foldLangTable(tx, id, tbl); err != nil {
+			return fmt.Errorf("error folding table for language %d: %v", id, err)
+		}
+		stmt := fmt.Sprintf(`DROP TABLE [%s]`, tbl)
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func foldLangTable(tx *sql.Tx, langId int64, tbl string) error {
+	type oldWord struct {
+		word, definition, notes, aliases string
+	}
+	stmt := fmt.Sprintf(
+		`SELECT word,definition,IFNULL(notes,''),IFNULL(aliases,'') FROM [%s]
+    ORDER BY id`,
+		tbl,
+	)
+	rows, err := tx.Query(stmt)
+	if err != nil {
+		return err
+	}
+	words := []oldWord{}
+	for rows.Next() {
+		w := oldWord{}
+		if err := rows.Scan(&w.word, &w.definition, &w.notes, &w.aliases); err != nil {
+			rows.Close()
+			return err
+		}
+		words = append(words, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, w := range words {
+		res, err := tx.Exec(
+			`INSERT INTO words(lang_id,word,definition,notes) VALUES (?,?,?,?)`,
+			langId, w.word, w.definition, w.notes,
+		)
+		if err != nil {
+			return err
+		}
+		wordId, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, alias := range aliasesFromStr(w.aliases) {
+			_, err := tx.Exec(
+				`INSERT OR IGNORE INTO word_aliases(word_id,alias) VALUES (?,?)`,
+				wordId, alias,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func migrateWordsDown3(tx *sql.Tx) error {
+	langs, err := txLangNames(tx)
+	if err != nil {
+		return err
+	}
+	for id := range langs {
+		tbl := strconv.FormatInt(id, 10)
+		stmt := fmt.Sprintf(`
+CREATE TABLE [%s] (
+  id INTEGER PRIMARY KEY,
+  word TEXT NOT NULL,
+  definition TEXT NOT NULL,
+  notes TEXT,
+  aliases TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO [%s](word,definition,notes,aliases)
+  SELECT word, definition, notes, IFNULL((
+    SELECT '|' || group_concat(alias, '|') || '|'
+    FROM word_aliases WHERE word_id=words.id
+  ), '')
+  FROM words WHERE lang_id=%d ORDER BY id;
+    `, tbl, tbl, id)
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NFC normalizes existing words and aliases and fills in their folded keys.
+func migrateFoldUp5(tx *sql.Tx) error {
+	tags, err := txLangTags(tx)
+	if err != nil {
+		return err
+	}
+	for langId, tag := range tags {
+		if err := foldLangWords(tx, langId, tag); err != nil {
+			return fmt.Errorf("error folding words for language %d: %v", langId, err)
+		}
+	}
+	return nil
+}
+
+func foldLangWords(tx *sql.Tx, langId int64, tag language.Tag) error {
+	type oldWord struct {
+		id                      int64
+		word, definition, notes string
+		aliases                 []string
+	}
+	rows, err := tx.Query(
+		`SELECT id, word, definition, notes FROM words WHERE lang_id=?`, langId,
+	)
+	if err != nil {
+		return err
+	}
+	words := []oldWord{}
+	for rows.Next() {
+		w := oldWord{}
+		if err := rows.Scan(&w.id, &w.word, &w.definition, &w.notes); err != nil {
+			rows.Close()
+			return err
+		}
+		words = append(words, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, w := range words {
+		_, err := tx.Exec(
+			`UPDATE words SET word=?, definition=?, notes=?, folded=? WHERE id=?`,
+			normalizeText(w.word), normalizeText(w.definition),
+			normalizeText(w.notes), foldWord(w.word, tag), w.id,
+		)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(
+			`SELECT alias FROM word_aliases WHERE word_id=? ORDER BY rowid`, w.id,
+		)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			alias := ""
+			if err := rows.Scan(&alias); err != nil {
+				rows.Close()
+				return err
+			}
+			w.aliases = append(w.aliases, alias)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		// Re-add the aliases since normalizing them could create duplicates.
+		_, err = tx.Exec(`DELETE FROM word_aliases WHERE word_id=?`, w.id)
+		if err != nil {
+			return err
+		}
+		for _, alias := range w.aliases {
+			_, err := tx.Exec(
+				`INSERT OR IGNORE INTO word_aliases(word_id,alias,folded)
+        VALUES (?,?,?)`,
+				w.id, normalizeText(alias), foldWord(alias, tag),
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Sets each language's locale to the tag guessed from its name and aliases,
+// which is what was used before locales were stored.
+func migrateLocaleUp12(tx *sql.Tx) error {
+	tags, err := txLangTags(tx)
+	if err != nil {
+		return err
+	}
+	for langId, tag := range tags {
+		if tag == language.Und {
+			continue
+		}
+		_, err := tx.Exec(
+			`UPDATE languages SET locale=? WHERE id=?`, tag.String(), langId,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateGendersUp13(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, locale FROM languages`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	langs := []Lang{}
+	for rows.Next() {
+		lang := Lang{}
+		if err := rows.Scan(&lang.Id, &lang.Locale); err != nil {
+			return err
+		}
+		langs = append(langs, lang)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, lang := range langs {
+		genders := langDefaultGenders(lang.tag())
+		if genders == nil {
+			continue
+		}
+		_, err := tx.Exec(
+			`UPDATE languages SET genders=? WHERE id=?`,
+			aliasesToStr(genders), lang.Id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gets the tags guessed from the languages' names and aliases.
+func txLangTags(tx *sql.Tx) (map[int64]language.Tag, error) {
+	rows, err := tx.Query(`SELECT id, name, aliases FROM languages`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := map[int64]language.Tag{}
+	for rows.Next() {
+		id, name, aliases := int64(0), "", ""
+		if err := rows.Scan(&id, &name, &aliases); err != nil {
+			return nil, err
+		}
+		tags[id] = langTag(name, aliasesFromStr(aliases))
+	}
+	return tags, rows.Err()
+}
+
+func txLangNames(tx *sql.Tx) (map[int64]string, error) {
+	rows, err := tx.Query(`SELECT id, name FROM languages`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	langs := map[int64]string{}
+	for rows.Next() {
+		id, name := int64(0), ""
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		langs[id] = name
+	}
+	return langs, rows.Err()
+}
+
+func txTableExists(tx *sql.Tx, name string) (bool, error) {
+	n := 0
+	err := tx.QueryRow(
+		`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?`,
+		name,
+	).Scan(&n)
+	return n != 0, err
+}
+
+func txColumnExists(tx *sql.Tx, table, column string) (bool, error) {
+	n := 0
+	err := tx.QueryRow(
+		`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?`,
+		table, column,
+	).Scan(&n)
+	return n != 0, err
+}
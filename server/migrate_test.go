@@ -0,0 +1,160 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %d has version %d", i, m.version)
+		}
+		if m.name == "" || m.upSQL == "" || m.downSQL == "" {
+			t.Errorf("migration %d is missing its name or SQL", m.version)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		files []string
+		ok    bool
+	}{
+		{"valid", []string{"0001_a.up.sql", "0001_a.down.sql", "0002_b.up.sql"}, true},
+		{"gap", []string{"0001_a.up.sql", "0003_c.up.sql"}, false},
+		{"no name", []string{"0001.up.sql"}, false},
+		{"bad version", []string{"x_a.up.sql"}, false},
+		{"zero version", []string{"0000_a.up.sql"}, false},
+		{"bad suffix", []string{"0001_a.sql"}, false},
+	}
+	for _, test := range tests {
+		fsys := fstest.MapFS{}
+		for _, name := range test.files {
+			fsys["migrations/"+name] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+		}
+		_, err := loadMigrations(fsys)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v, expected ok=%v", test.name, err, test.ok)
+		}
+	}
+}
+
+// Returns the schema of the database (excluding the migrations table), with
+// the whitespace and quoting of the statements normalized.
+func dumpSchema(t *testing.T, db *DB) string {
+	t.Helper()
+	rows, err := db.Query(
+		`SELECT type, name, IFNULL(sql, '') FROM sqlite_master
+    WHERE name NOT LIKE 'sqlite_%' AND name != 'schema_migrations'
+    ORDER BY type, name`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	for rows.Next() {
+		var typ, name, stmt string
+		if err := rows.Scan(&typ, &name, &stmt); err != nil {
+			t.Fatal(err)
+		}
+		// Renaming a table quotes its name and keeps the original formatting.
+		stmt = strings.Join(strings.Fields(strings.ReplaceAll(stmt, `"`, "")), " ")
+		sb.WriteString(typ + " " + name + ": " + stmt + "\n")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+// Each migration's down migration should undo its up migration exactly.
+func TestMigrateRoundTrip(t *testing.T) {
+	db := newTestDbNoInit(t)
+	schemas := []string{dumpSchema(t, db)}
+	for v := 1; v <= latestMigration(); v++ {
+		if err := db.migrate(v); err != nil {
+			t.Fatal(err)
+		}
+		schemas = append(schemas, dumpSchema(t, db))
+
+		if err := db.migrate(v - 1); err != nil {
+			t.Fatal(err)
+		}
+		if got := dumpSchema(t, db); got != schemas[v-1] {
+			t.Fatalf("schema after migrating down from %d differs:\n%s", v, got)
+		}
+		if err := db.migrate(v); err != nil {
+			t.Fatal(err)
+		}
+		if got := dumpSchema(t, db); got != schemas[v] {
+			t.Fatalf("schema after migrating up to %d again differs:\n%s", v, got)
+		}
+	}
+
+	if err := db.migrate(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := dumpSchema(t, db); got != schemas[0] {
+		t.Fatalf("schema after migrating down to 0 differs:\n%s", got)
+	}
+	if v, err := db.schemaVersion(); err != nil || v != 0 {
+		t.Fatalf("expected version 0, got %d (%v)", v, err)
+	}
+}
+
+func TestMigrateInvalidVersion(t *testing.T) {
+	db := newTestDbNoInit(t)
+	for _, v := range []int{-1, latestMigration() + 1} {
+		if err := db.migrate(v); err == nil {
+			t.Errorf("expected error migrating to %d", v)
+		}
+	}
+}
+
+// Databases made before migrations existed (with a table per language) are
+// upgraded without losing words.
+func TestMigrateLegacyDb(t *testing.T) {
+	db := newTestDbNoInit(t)
+	_, err := db.Exec(`
+CREATE TABLE languages (language TEXT NOT NULL UNIQUE, aliases TEXT);
+INSERT INTO languages VALUES ('spanish', '|es|español|');
+CREATE TABLE [spanish] (
+  id INTEGER PRIMARY KEY,
+  word TEXT NOT NULL,
+  definition TEXT NOT NULL,
+  notes TEXT
+);
+INSERT INTO [spanish](word, definition, notes) VALUES
+  ('perro', 'dog', NULL), ('gato', 'cat', 'meows');
+  `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	lang, err := db.getLang("spanish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"es", "español"}; strings.Join(lang.Aliases, ",") !=
+		strings.Join(want, ",") {
+		t.Errorf("expected aliases %v, got %v", want, lang.Aliases)
+	}
+	words, err := db.getAllWords("spanish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(words) != 2 {
+		t.Fatalf("expected 2 words, got %d", len(words))
+	}
+	if words[0].Word != "perro" || words[0].Definition != "dog" {
+		t.Errorf("unexpected first word: %+v", words[0])
+	}
+	if words[1].Word != "gato" || words[1].Notes != "meows" {
+		t.Errorf("unexpected second word: %+v", words[1])
+	}
+}
@@ -0,0 +1,5 @@
+-- The original schema created by DB.Init before migrations existed.
+CREATE TABLE IF NOT EXISTS languages (
+  language TEXT NOT NULL UNIQUE,
+  aliases TEXT
+);
@@ -0,0 +1,8 @@
+CREATE TABLE languages_old (
+  language TEXT NOT NULL UNIQUE,
+  aliases TEXT
+);
+INSERT INTO languages_old(rowid, language, aliases)
+  SELECT id, name, aliases FROM languages;
+DROP TABLE languages;
+ALTER TABLE languages_old RENAME TO languages;
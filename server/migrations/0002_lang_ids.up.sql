@@ -0,0 +1,11 @@
+-- Give languages a real ID and notes, keeping the old rowids as the IDs.
+CREATE TABLE languages_new (
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE,
+  aliases TEXT NOT NULL DEFAULT '',
+  notes TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO languages_new(id, name, aliases)
+  SELECT rowid, language, IFNULL(aliases, '') FROM languages;
+DROP TABLE languages;
+ALTER TABLE languages_new RENAME TO languages;
@@ -0,0 +1,2 @@
+DROP TABLE word_aliases;
+DROP TABLE words;
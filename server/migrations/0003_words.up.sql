@@ -0,0 +1,17 @@
+-- A single table for all words, replacing the per-language tables (which are
+-- folded into it by the Go half of the migration).
+CREATE TABLE words (
+  id INTEGER PRIMARY KEY,
+  lang_id INTEGER NOT NULL REFERENCES languages(id) ON DELETE CASCADE,
+  word TEXT NOT NULL,
+  definition TEXT NOT NULL,
+  notes TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX words_lang_id_word ON words(lang_id, word);
+
+CREATE TABLE word_aliases (
+  word_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
+  alias TEXT NOT NULL,
+  UNIQUE (word_id, alias)
+);
+CREATE INDEX word_aliases_alias ON word_aliases(alias);
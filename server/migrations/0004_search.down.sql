@@ -0,0 +1,6 @@
+DROP TRIGGER word_aliases_fts_delete;
+DROP TRIGGER word_aliases_fts_insert;
+DROP TRIGGER words_fts_delete;
+DROP TRIGGER words_fts_update;
+DROP TRIGGER words_fts_insert;
+DROP TABLE words_fts;
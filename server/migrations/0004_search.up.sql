@@ -0,0 +1,41 @@
+-- Full-text index of words, kept in sync by triggers. The rowid of an entry is
+-- the ID of the word and the aliases are stored space separated.
+CREATE VIRTUAL TABLE words_fts USING fts5(
+  word, definition, notes, aliases,
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO words_fts(rowid, word, definition, notes, aliases)
+  SELECT id, word, definition, notes, IFNULL((
+    SELECT group_concat(alias, ' ') FROM word_aliases WHERE word_id=words.id
+  ), '')
+  FROM words;
+
+CREATE TRIGGER words_fts_insert AFTER INSERT ON words BEGIN
+  INSERT INTO words_fts(rowid, word, definition, notes, aliases)
+    VALUES (new.id, new.word, new.definition, new.notes, '');
+END;
+
+CREATE TRIGGER words_fts_update AFTER UPDATE ON words BEGIN
+  UPDATE words_fts
+    SET word=new.word, definition=new.definition, notes=new.notes
+    WHERE rowid=old.id;
+END;
+
+CREATE TRIGGER words_fts_delete AFTER DELETE ON words BEGIN
+  DELETE FROM words_fts WHERE rowid=old.id;
+END;
+
+CREATE TRIGGER word_aliases_fts_insert AFTER INSERT ON word_aliases BEGIN
+  UPDATE words_fts SET aliases=IFNULL((
+    SELECT group_concat(alias, ' ') FROM word_aliases WHERE word_id=new.word_id
+  ), '')
+  WHERE rowid=new.word_id;
+END;
+
+CREATE TRIGGER word_aliases_fts_delete AFTER DELETE ON word_aliases BEGIN
+  UPDATE words_fts SET aliases=IFNULL((
+    SELECT group_concat(alias, ' ') FROM word_aliases WHERE word_id=old.word_id
+  ), '')
+  WHERE rowid=old.word_id;
+END;
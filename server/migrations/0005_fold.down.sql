@@ -0,0 +1,5 @@
+DROP INDEX word_aliases_folded;
+ALTER TABLE word_aliases DROP COLUMN folded;
+
+DROP INDEX words_lang_id_folded;
+ALTER TABLE words DROP COLUMN folded;
@@ -0,0 +1,7 @@
+-- Accent and case folded keys for lookups (filled in by the Go half of the
+-- migration, which also NFC normalizes existing words).
+ALTER TABLE words ADD COLUMN folded TEXT NOT NULL DEFAULT '';
+CREATE INDEX words_lang_id_folded ON words(lang_id, folded);
+
+ALTER TABLE word_aliases ADD COLUMN folded TEXT NOT NULL DEFAULT '';
+CREATE INDEX word_aliases_folded ON word_aliases(folded);
@@ -0,0 +1,2 @@
+DROP TABLE review_log;
+DROP TABLE review_states;
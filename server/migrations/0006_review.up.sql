@@ -0,0 +1,28 @@
+-- Spaced repetition state for each word that has been reviewed at least once.
+-- Words without a row are new. Times are unix timestamps (seconds) and
+-- intervals are in days.
+CREATE TABLE review_states (
+  word_id INTEGER PRIMARY KEY REFERENCES words(id) ON DELETE CASCADE,
+  algorithm TEXT NOT NULL,
+  ease REAL NOT NULL,
+  interval REAL NOT NULL,
+  repetitions INTEGER NOT NULL,
+  lapses INTEGER NOT NULL,
+  stability REAL NOT NULL,
+  difficulty REAL NOT NULL,
+  due INTEGER NOT NULL,
+  last_review INTEGER NOT NULL
+);
+CREATE INDEX review_states_due ON review_states(due);
+
+CREATE TABLE review_log (
+  id INTEGER PRIMARY KEY,
+  word_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
+  algorithm TEXT NOT NULL,
+  grade INTEGER NOT NULL,
+  reviewed_at INTEGER NOT NULL,
+  prev_interval REAL NOT NULL,
+  interval REAL NOT NULL,
+  due INTEGER NOT NULL
+);
+CREATE INDEX review_log_word_id ON review_log(word_id);
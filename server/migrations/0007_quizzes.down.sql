@@ -0,0 +1,2 @@
+DROP TABLE quiz_questions;
+DROP TABLE quizzes;
@@ -0,0 +1,26 @@
+-- Quiz sessions and their questions. Questions are generated up front and
+-- keep their prompt and answer so quizzes aren't affected by later edits.
+CREATE TABLE quizzes (
+  id INTEGER PRIMARY KEY,
+  lang_id INTEGER NOT NULL REFERENCES languages(id) ON DELETE CASCADE,
+  mode TEXT NOT NULL,
+  created_at INTEGER NOT NULL,
+  finished_at INTEGER,
+  score INTEGER NOT NULL DEFAULT 0,
+  total INTEGER NOT NULL
+);
+
+CREATE TABLE quiz_questions (
+  quiz_id INTEGER NOT NULL REFERENCES quizzes(id) ON DELETE CASCADE,
+  idx INTEGER NOT NULL,
+  word_id INTEGER REFERENCES words(id) ON DELETE SET NULL,
+  prompt TEXT NOT NULL,
+  choices TEXT NOT NULL DEFAULT '[]',
+  answer TEXT NOT NULL,
+  -- Other answers accepted for typed and cloze questions (JSON array).
+  accepted TEXT NOT NULL DEFAULT '[]',
+  response TEXT,
+  correct INTEGER,
+  answered_at INTEGER,
+  PRIMARY KEY (quiz_id, idx)
+);
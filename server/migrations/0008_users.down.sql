@@ -0,0 +1,14 @@
+-- Fails if different users have languages with the same name.
+CREATE TABLE languages_old (
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE,
+  aliases TEXT NOT NULL DEFAULT '',
+  notes TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO languages_old(id, name, aliases, notes)
+  SELECT id, name, aliases, notes FROM languages;
+DROP TABLE languages;
+ALTER TABLE languages_old RENAME TO languages;
+
+DROP TABLE sessions;
+DROP TABLE users;
@@ -0,0 +1,34 @@
+-- Users and their login sessions. Languages (and so their words) are now owned
+-- by users, with names only unique per owner. Languages from before have no
+-- owner until the first user registers.
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY,
+  username TEXT NOT NULL UNIQUE,
+  password_hash TEXT NOT NULL,
+  is_admin INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL
+);
+
+-- Sessions are looked up by the SHA-256 hash of their token.
+CREATE TABLE sessions (
+  token_hash TEXT PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at INTEGER NOT NULL,
+  expires_at INTEGER NOT NULL
+);
+CREATE INDEX sessions_user_id ON sessions(user_id);
+
+-- Rebuilt to drop the UNIQUE constraint on the name (this migration runs with
+-- foreign keys off so that dropping the table doesn't delete the words).
+CREATE TABLE languages_new (
+  id INTEGER PRIMARY KEY,
+  owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  aliases TEXT NOT NULL DEFAULT '',
+  notes TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO languages_new(id, name, aliases, notes)
+  SELECT id, name, aliases, notes FROM languages;
+DROP TABLE languages;
+ALTER TABLE languages_new RENAME TO languages;
+CREATE UNIQUE INDEX languages_owner_name ON languages(IFNULL(owner_id, 0), name);
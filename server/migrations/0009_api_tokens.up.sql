@@ -0,0 +1,14 @@
+-- Personal API tokens, looked up by the SHA-256 hash of the token. Tokens are
+-- either read-only or read-write, and are optionally restricted to a JSON
+-- array of language IDs (NULL for all of the user's languages).
+CREATE TABLE api_tokens (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  scope TEXT NOT NULL,
+  lang_ids TEXT,
+  created_at INTEGER NOT NULL,
+  last_used_at INTEGER
+);
+CREATE INDEX api_tokens_user_id ON api_tokens(user_id);
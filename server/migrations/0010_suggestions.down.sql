@@ -0,0 +1,2 @@
+DROP TABLE suggestions;
+ALTER TABLE languages DROP COLUMN shared;
@@ -0,0 +1,23 @@
+-- Whether a language is shared with the community, letting other users see it
+-- and suggest changes to its words.
+ALTER TABLE languages ADD COLUMN shared INTEGER NOT NULL DEFAULT 0;
+
+-- Suggested word additions, edits, and deletions, which are applied once the
+-- language's owner (or an admin) approves them. The diff is a JSON WordDiff; word_id is the word being
+-- edited or deleted (or the added word, once approved).
+CREATE TABLE suggestions (
+  id INTEGER PRIMARY KEY,
+  lang_id INTEGER NOT NULL REFERENCES languages(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL,
+  word_id INTEGER,
+  diff TEXT NOT NULL,
+  comment TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'pending',
+  reason TEXT NOT NULL DEFAULT '',
+  created_at INTEGER NOT NULL,
+  reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  reviewed_at INTEGER
+);
+CREATE INDEX suggestions_status ON suggestions(status, lang_id);
+CREATE INDEX suggestions_user_id ON suggestions(user_id);
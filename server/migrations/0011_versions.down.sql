@@ -0,0 +1,2 @@
+ALTER TABLE words DROP COLUMN version;
+ALTER TABLE languages DROP COLUMN version;
@@ -0,0 +1,4 @@
+-- Versions are incremented on every edit and used as ETags for optimistic
+-- concurrency.
+ALTER TABLE languages ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE words ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
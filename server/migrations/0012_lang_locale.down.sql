@@ -0,0 +1 @@
+ALTER TABLE languages DROP COLUMN locale;
@@ -0,0 +1,4 @@
+-- The BCP-47 locale of each language, used for case folding and collation
+-- (empty for none). It's filled in from the names and aliases by the Go half
+-- of the migration.
+ALTER TABLE languages ADD COLUMN locale TEXT NOT NULL DEFAULT '';
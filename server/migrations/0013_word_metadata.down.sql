@@ -0,0 +1,6 @@
+ALTER TABLE languages DROP COLUMN genders;
+ALTER TABLE words DROP COLUMN cefr;
+ALTER TABLE words DROP COLUMN register;
+ALTER TABLE words DROP COLUMN plural;
+ALTER TABLE words DROP COLUMN gender;
+ALTER TABLE words DROP COLUMN pos;
@@ -0,0 +1,9 @@
+-- Optional grammatical and usage metadata of words (empty if unknown).
+ALTER TABLE words ADD COLUMN pos TEXT NOT NULL DEFAULT '';
+ALTER TABLE words ADD COLUMN gender TEXT NOT NULL DEFAULT '';
+ALTER TABLE words ADD COLUMN plural TEXT NOT NULL DEFAULT '';
+ALTER TABLE words ADD COLUMN register TEXT NOT NULL DEFAULT '';
+ALTER TABLE words ADD COLUMN cefr TEXT NOT NULL DEFAULT '';
+-- The grammatical genders words of each language can have, stored like
+-- aliases. They're filled in from the locales by the Go half of the migration.
+ALTER TABLE languages ADD COLUMN genders TEXT NOT NULL DEFAULT '';
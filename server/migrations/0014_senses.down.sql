@@ -0,0 +1,2 @@
+DROP TABLE sense_examples;
+DROP TABLE word_senses;
@@ -0,0 +1,19 @@
+-- The senses (meanings) of words, in the order given by idx, and their example
+-- sentences. A word's definition is kept as its main definition.
+CREATE TABLE word_senses (
+  id INTEGER PRIMARY KEY,
+  word_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
+  idx INTEGER NOT NULL,
+  definition TEXT NOT NULL,
+  pos TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX word_senses_word_id ON word_senses(word_id, idx);
+
+CREATE TABLE sense_examples (
+  id INTEGER PRIMARY KEY,
+  sense_id INTEGER NOT NULL REFERENCES word_senses(id) ON DELETE CASCADE,
+  idx INTEGER NOT NULL,
+  sentence TEXT NOT NULL,
+  translation TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX sense_examples_sense_id ON sense_examples(sense_id, idx);
@@ -0,0 +1,9 @@
+-- Links between words in different languages that translate each other. Each
+-- link is stored once, with the lower word ID first.
+CREATE TABLE word_translations (
+  word_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
+  other_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
+  PRIMARY KEY (word_id, other_id),
+  CHECK (word_id < other_id)
+);
+CREATE INDEX word_translations_other_id ON word_translations(other_id);
@@ -0,0 +1,11 @@
+-- Typed relations between words. Symmetric relations (all but derivedFrom)
+-- are stored once with the lower word ID first; for derivedFrom, word_id is
+-- the word derived from other_id.
+CREATE TABLE word_relations (
+  word_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
+  other_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL,
+  PRIMARY KEY (word_id, other_id, kind),
+  CHECK (word_id <> other_id)
+);
+CREATE INDEX word_relations_other_id ON word_relations(other_id);
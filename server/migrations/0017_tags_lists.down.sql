@@ -0,0 +1,3 @@
+DROP TABLE word_list_items;
+DROP TABLE word_lists;
+DROP TABLE word_tags;
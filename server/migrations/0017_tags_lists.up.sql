@@ -0,0 +1,27 @@
+-- Tags of words, which can be used to filter them.
+CREATE TABLE word_tags (
+  word_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
+  tag TEXT NOT NULL,
+  UNIQUE (word_id, tag)
+);
+CREATE INDEX word_tags_tag ON word_tags(tag);
+
+-- Named, ordered lists of words in a language (like decks), whose words are
+-- ordered by idx. Names are lowercased like tags (see normalizeListName), so
+-- the UNIQUE constraint on them ignores case.
+CREATE TABLE word_lists (
+  id INTEGER PRIMARY KEY,
+  lang_id INTEGER NOT NULL REFERENCES languages(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  created_at INTEGER NOT NULL,
+  UNIQUE (lang_id, name)
+);
+
+CREATE TABLE word_list_items (
+  list_id INTEGER NOT NULL REFERENCES word_lists(id) ON DELETE CASCADE,
+  word_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
+  idx INTEGER NOT NULL,
+  PRIMARY KEY (list_id, word_id)
+);
+CREATE INDEX word_list_items_word_id ON word_list_items(word_id);
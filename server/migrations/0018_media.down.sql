@@ -0,0 +1,2 @@
+ALTER TABLE words DROP COLUMN audio;
+DROP TABLE media;
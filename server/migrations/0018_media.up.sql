@@ -0,0 +1,10 @@
+-- Uploaded files, which are stored in the media dir named by the SHA-256 hash
+-- of their contents. Media no longer used by any words is deleted.
+CREATE TABLE media (
+  hash TEXT PRIMARY KEY,
+  mime TEXT NOT NULL,
+  size INTEGER NOT NULL,
+  created_at INTEGER NOT NULL
+);
+
+ALTER TABLE words ADD COLUMN audio TEXT REFERENCES media(hash);
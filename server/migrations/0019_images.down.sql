@@ -0,0 +1,5 @@
+ALTER TABLE words DROP COLUMN thumbnail;
+ALTER TABLE words DROP COLUMN image;
+
+ALTER TABLE media DROP COLUMN height;
+ALTER TABLE media DROP COLUMN width;
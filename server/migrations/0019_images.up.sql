@@ -0,0 +1,6 @@
+-- Images (and their thumbnails) of words, which are stored as media.
+ALTER TABLE media ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE words ADD COLUMN image TEXT REFERENCES media(hash);
+ALTER TABLE words ADD COLUMN thumbnail TEXT REFERENCES media(hash);
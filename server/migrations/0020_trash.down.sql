@@ -0,0 +1,11 @@
+-- Everything in the trash is purged.
+DELETE FROM words WHERE deleted_at IS NOT NULL;
+DELETE FROM languages WHERE deleted_at IS NOT NULL;
+
+DROP INDEX words_deleted_at;
+DROP INDEX languages_deleted_at;
+DROP INDEX languages_owner_name;
+CREATE UNIQUE INDEX languages_owner_name ON languages(IFNULL(owner_id, 0), name);
+
+ALTER TABLE words DROP COLUMN deleted_at;
+ALTER TABLE languages DROP COLUMN deleted_at;
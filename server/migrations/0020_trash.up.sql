@@ -0,0 +1,13 @@
+-- Deleted languages and words are kept in the trash (with the time they were
+-- deleted) until they're purged. Names only need to be unique among languages
+-- that aren't deleted.
+ALTER TABLE languages ADD COLUMN deleted_at INTEGER;
+ALTER TABLE words ADD COLUMN deleted_at INTEGER;
+
+DROP INDEX languages_owner_name;
+CREATE UNIQUE INDEX languages_owner_name ON languages(IFNULL(owner_id, 0), name)
+  WHERE deleted_at IS NULL;
+CREATE INDEX languages_deleted_at ON languages(deleted_at)
+  WHERE deleted_at IS NOT NULL;
+CREATE INDEX words_deleted_at ON words(deleted_at)
+  WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,19 @@
+-- Append-only log of the changes made to languages and words. Before and after
+-- are JSON snapshots of the item (null before it was added and after it was
+-- deleted). The revisions of purged items are deleted with them since their
+-- IDs can be reused.
+CREATE TABLE revisions (
+  id INTEGER PRIMARY KEY,
+  kind TEXT NOT NULL,
+  item_id INTEGER NOT NULL,
+  lang_id INTEGER NOT NULL REFERENCES languages(id) ON DELETE CASCADE,
+  action TEXT NOT NULL,
+  user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  created_at INTEGER NOT NULL,
+  before TEXT,
+  after TEXT,
+  -- The revision that this one reverted, if any.
+  revert_of INTEGER REFERENCES revisions(id) ON DELETE SET NULL
+);
+CREATE INDEX revisions_item ON revisions(kind, item_id);
+CREATE INDEX revisions_lang_id ON revisions(lang_id);
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	jmux "github.com/johnietre/go-jmux"
+)
+
+// The max size of a PATCH request body.
+const maxPatchSize = 1 << 20
+
+// Reads the request's body as a JSON Merge Patch (RFC 7396) object, mapping
+// each member to its raw value. Null members are kept since they mean the
+// field should be cleared.
+func readMergePatch(c *jmux.Context) (map[string]json.RawMessage, error) {
+	body, err := io.ReadAll(
+		http.MaxBytesReader(c.Writer, c.Request.Body, maxPatchSize),
+	)
+	if err != nil {
+		return nil, err
+	}
+	patch := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return nil, fmt.Errorf("%w: must be a JSON object", ErrInvalidPatch)
+	}
+	return patch, nil
+}
+
+// Writes the error from reading a patch (with readMergePatch) and converting it
+// to a diff. Patches that are too large get a 413.
+func writePatchReadError(c *jmux.Context, err error) {
+	if isUserError(err) {
+		c.BadRequest(errRespJson(err.Error()))
+	} else if _, ok := errAs[*http.MaxBytesError](err); ok {
+		c.WriteError(
+			http.StatusRequestEntityTooLarge, errRespJson("patch too large"),
+		)
+	} else {
+		log.Print("error reading patch: ", err)
+		c.InternalServerError(errRespJson("internal server error"))
+	}
+}
+
+// Unmarshals the patch's member with the name into dest, removing it from the
+// patch. If the member is null, dest is set to the zero value; if it is
+// missing, dest is left nil.
+func patchField[T any](
+	patch map[string]json.RawMessage,
+	name string,
+	dest **T,
+) error {
+	raw, ok := patch[name]
+	if !ok {
+		return nil
+	}
+	delete(patch, name)
+	v := new(T)
+	if string(raw) != "null" {
+		if err := json.Unmarshal(raw, v); err != nil {
+			return fmt.Errorf("%w: invalid value for %q", ErrInvalidPatch, name)
+		}
+	}
+	*dest = v
+	return nil
+}
+
+// Returns an error listing the patch's members, if any. Called after the
+// known fields have been removed.
+func checkPatchEmpty(patch map[string]json.RawMessage) error {
+	if len(patch) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(patch))
+	for name := range patch {
+		names = append(names, strconv.Quote(name))
+	}
+	sort.Strings(names)
+	return fmt.Errorf(
+		"%w: unknown or read-only fields %s",
+		ErrInvalidPatch, strings.Join(names, ", "),
+	)
+}
+
+// Returns the ETag for the version of a row.
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Parses the If-Match header, returning the version it requires, or 0 if the
+// header is missing or "*".
+func ifMatchVersion(c *jmux.Context) (int64, error) {
+	hdr := strings.TrimSpace(c.Request.Header.Get("If-Match"))
+	if hdr == "" || hdr == "*" {
+		return 0, nil
+	}
+	str, err := strconv.Unquote(hdr)
+	if err != nil {
+		return 0, ErrInvalidETag
+	}
+	version, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, ErrInvalidETag
+	}
+	return version, nil
+}
+
+// Returns the status code for an error from a PATCH, or 0 if the error isn't
+// a user error.
+func patchErrorCode(err error) int {
+	if errors.Is(err, ErrVersionMismatch) {
+		return http.StatusPreconditionFailed
+	} else if isUserError(err) {
+		return http.StatusBadRequest
+	}
+	return 0
+}
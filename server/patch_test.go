@@ -0,0 +1,200 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jmux "github.com/johnietre/go-jmux"
+)
+
+// Returns a context for a request with the body and headers (given as name,
+// value pairs).
+func newTestContext(method, body string, header ...string) *jmux.Context {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	return &jmux.Context{Request: req, Writer: httptest.NewRecorder()}
+}
+
+func TestReadMergePatch(t *testing.T) {
+	tests := []struct {
+		body    string
+		members []string
+		ok      bool
+	}{
+		{`{}`, nil, true},
+		{`{"notes": "x", "locale": null}`, []string{"locale", "notes"}, true},
+		{`null`, nil, false},
+		{`[]`, nil, false},
+		{`"notes"`, nil, false},
+		{`{"notes": `, nil, false},
+		{``, nil, false},
+	}
+	for _, test := range tests {
+		patch, err := readMergePatch(newTestContext(http.MethodPatch, test.body))
+		if !test.ok {
+			if !errors.Is(err, ErrInvalidPatch) {
+				t.Errorf("patch %q: expected ErrInvalidPatch, got %v", test.body, err)
+			}
+			continue
+		} else if err != nil || len(patch) != len(test.members) {
+			t.Errorf("patch %q: expected %v, got %v (%v)", test.body, test.members, patch, err)
+			continue
+		}
+		for _, name := range test.members {
+			if _, ok := patch[name]; !ok {
+				t.Errorf("patch %q: missing member %q", test.body, name)
+			}
+		}
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		header  string
+		version int64
+		err     error
+	}{
+		{"", 0, nil},
+		{"*", 0, nil},
+		{`"3"`, 3, nil},
+		{` "12" `, 12, nil},
+		{`3`, 0, ErrInvalidETag},
+		{`"0"`, 0, ErrInvalidETag},
+		{`"-1"`, 0, ErrInvalidETag},
+		{`"x"`, 0, ErrInvalidETag},
+		{`W/"3"`, 0, ErrInvalidETag},
+	}
+	for _, test := range tests {
+		c := newTestContext(http.MethodPatch, "", "If-Match", test.header)
+		version, err := ifMatchVersion(c)
+		if version != test.version || err != test.err {
+			t.Errorf(
+				"If-Match %q: expected %d (%v), got %d (%v)",
+				test.header, test.version, test.err, version, err,
+			)
+		}
+	}
+	if etag := versionETag(7); etag != `"7"` {
+		t.Errorf(`expected "7", got %s`, etag)
+	}
+}
+
+func TestDiffFromPatch(t *testing.T) {
+	patch, err := readMergePatch(newTestContext(
+		http.MethodPatch, `{"notes": null, "locale": "es", "genders": ["m"]}`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, err := langDiffFromPatch(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Null members are cleared rather than left unchanged.
+	if ld.Name != nil || ld.Notes == nil || *ld.Notes != "" ||
+		ld.Locale == nil || *ld.Locale != "es" ||
+		ld.Genders == nil || len(*ld.Genders) != 1 {
+		t.Errorf("unexpected diff: %+v", ld)
+	}
+
+	tests := []struct {
+		body string
+		err  string
+	}{
+		{`{"name": 1}`, `invalid value for "name"`},
+		{`{"id": 2, "version": 3}`, `unknown or read-only fields "id", "version"`},
+		{`{"words": []}`, `unknown or read-only fields "words"`},
+	}
+	for _, test := range tests {
+		patch, err := readMergePatch(newTestContext(http.MethodPatch, test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = langDiffFromPatch(patch)
+		if !errors.Is(err, ErrInvalidPatch) || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("patch %s: expected error with %q, got %v", test.body, test.err, err)
+		}
+	}
+
+	patch, err = readMergePatch(newTestContext(
+		http.MethodPatch, `{"aliases": null, "definition": "dog"}`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := wordDiffFromPatch(patch)
+	if err != nil || wd.Word != nil || wd.Aliases == nil || len(*wd.Aliases) != 0 ||
+		wd.Definition == nil || *wd.Definition != "dog" {
+		t.Errorf("unexpected diff: %+v (%v)", wd, err)
+	}
+}
+
+func TestPatchHandlers(t *testing.T) {
+	db := newTestDb(t)
+	srvr := newTestServer(t, db)
+	tc := newTestClient(t, srvr)
+	tc.register("alice")
+	if code := tc.do(http.MethodPost, "/langs", Lang{Name: "spanish", Notes: "notes"}, nil); code != http.StatusOK {
+		t.Fatalf("error creating language: %d", code)
+	}
+	wordResp := Response[Word]{}
+	word := Word{Word: "perro", Definition: "dog", Aliases: []string{"can"}}
+	if code := tc.do(http.MethodPost, "/langs/spanish/words", word, &wordResp); code != http.StatusOK {
+		t.Fatalf("error adding word: %d", code)
+	}
+	wordPath := "/langs/spanish/words/" + jsonStr(wordResp.Content.Id)
+	tooLarge := strings.Repeat("x", maxPatchSize)
+
+	tests := []struct {
+		name    string
+		path    string
+		ifMatch string
+		patch   any
+		code    int
+		version int64
+	}{
+		{"lang", "/langs/spanish", "", map[string]any{"notes": nil}, http.StatusOK, 2},
+		{"lang matching", "/langs/spanish", `"2"`, map[string]any{"locale": "es"}, http.StatusOK, 3},
+		{"lang stale", "/langs/spanish", `"2"`, map[string]any{"notes": "x"}, http.StatusPreconditionFailed, 0},
+		{"lang bad etag", "/langs/spanish", `2`, map[string]any{"notes": "x"}, http.StatusBadRequest, 0},
+		{"lang unknown field", "/langs/spanish", "", map[string]any{"owner": 1}, http.StatusBadRequest, 0},
+		{"lang not object", "/langs/spanish", "", []string{}, http.StatusBadRequest, 0},
+		{"lang empty", "/langs/spanish", "", map[string]any{}, http.StatusOK, 3},
+		{"lang too large", "/langs/spanish", "", map[string]any{"notes": tooLarge}, http.StatusRequestEntityTooLarge, 0},
+		{"word", wordPath, `"1"`, map[string]any{"aliases": nil}, http.StatusOK, 2},
+		{"word stale", wordPath, `"1"`, map[string]any{"notes": "x"}, http.StatusPreconditionFailed, 0},
+		{"word invalid", wordPath, "", map[string]any{"word": " "}, http.StatusBadRequest, 0},
+		{"word missing", "/langs/spanish/words/999", "", map[string]any{"notes": "x"}, http.StatusBadRequest, 0},
+		{"word too large", wordPath, "", map[string]any{"notes": tooLarge}, http.StatusRequestEntityTooLarge, 0},
+	}
+	for _, test := range tests {
+		tc.header = http.Header{}
+		if test.ifMatch != "" {
+			tc.header.Set("If-Match", test.ifMatch)
+		}
+		resp := Response[struct {
+			Version int64 `json:"version"`
+		}]{}
+		code := tc.do(http.MethodPatch, test.path, test.patch, &resp)
+		if code != test.code || resp.Content.Version != test.version {
+			t.Errorf(
+				"%s: expected %d (version %d), got %d (version %d, %s)",
+				test.name, test.code, test.version, code, resp.Content.Version, resp.Error,
+			)
+		}
+	}
+
+	lang, err := db.getLang("spanish")
+	if err != nil || lang.Notes != "" || lang.Locale != "es" {
+		t.Errorf("unexpected language after patches: %+v (%v)", lang, err)
+	}
+	got, err := db.getWordById("spanish", wordResp.Content.Id)
+	if err != nil || len(got.Aliases) != 0 || got.Definition != "dog" {
+		t.Errorf("unexpected word after patches: %+v (%v)", got, err)
+	}
+}
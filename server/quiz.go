@@ -0,0 +1,574 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+	"golang.org/x/text/language"
+)
+
+const (
+	defaultQuizLength  = 10
+	maxQuizLength      = 100
+	defaultQuizChoices = 4
+	maxQuizChoices     = 8
+)
+
+type QuizMode string
+
+const (
+	// QuizModeChoice shows the word and asks to pick its definition.
+	QuizModeChoice QuizMode = "choice"
+	// QuizModeTyped shows the definition and asks to type the word.
+	QuizModeTyped QuizMode = "typed"
+	// QuizModeCloze shows a sentence with the word blanked out and asks to type
+	// the missing word.
+	QuizModeCloze QuizMode = "cloze"
+	// QuizModePicture shows the word's image and asks to type the word. The
+	// prompt is the path of the image, and words without images are skipped.
+	QuizModePicture QuizMode = "picture"
+)
+
+func (m QuizMode) IsValid() bool {
+	return m == QuizModeChoice || m == QuizModeTyped || m == QuizModeCloze ||
+		m == QuizModePicture
+}
+
+type NewQuizRequest struct {
+	Mode QuizMode `json:"mode"`
+	// Length is the number of questions.
+	Length int `json:"length,omitempty"`
+	// Choices is the number of choices for multiple choice questions.
+	Choices int `json:"choices,omitempty"`
+	// List, if set, is the name or ID of the list whose words are used
+	// (including for choices) instead of all of the language's words.
+	List string `json:"list,omitempty"`
+}
+
+func (s *Server) newQuizHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	req := NewQuizRequest{}
+	if err := c.ReadBodyJSON(&req); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	quiz, err := s.userDb(c).newQuiz(lang, req, time.Now())
+	code, resp := http.StatusOK, Response[Quiz]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error creating quiz for lang %s: %v", lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = quiz
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+func (s *Server) getQuizHandler(c *jmux.Context) {
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.WriteError(http.StatusBadRequest, "invalid quiz ID")
+		return
+	}
+	quiz, err := s.userDb(c).getQuiz(id)
+	code, resp := http.StatusOK, Response[Quiz]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error getting quiz %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = quiz
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+type QuizAnswerRequest struct {
+	// Question is the index of the question being answered.
+	Question int `json:"question"`
+	// Answer is the typed answer, or the text of the choice.
+	Answer string `json:"answer,omitempty"`
+	// Choice is the index of the chosen choice for multiple choice questions.
+	Choice *int `json:"choice,omitempty"`
+}
+
+// Answering a question that's already been answered fails with 409 Conflict.
+func (s *Server) answerQuizHandler(c *jmux.Context) {
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.WriteError(http.StatusBadRequest, "invalid quiz ID")
+		return
+	}
+	req := QuizAnswerRequest{}
+	if err := c.ReadBodyJSON(&req); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	result, err := s.userDb(c).answerQuiz(id, req, time.Now())
+	code, resp := http.StatusOK, Response[QuizAnswerResult]{}
+	if err != nil {
+		if errors.Is(err, ErrQuestionAnswered) {
+			code, resp.Error = http.StatusConflict, err.Error()
+		} else if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error answering quiz %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = result
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+type Quiz struct {
+	Id         int64          `json:"id"`
+	LangId     int64          `json:"langId"`
+	Mode       QuizMode       `json:"mode"`
+	CreatedAt  int64          `json:"createdAt"`
+	FinishedAt int64          `json:"finishedAt,omitempty"`
+	Score      int            `json:"score"`
+	Total      int            `json:"total"`
+	Questions  []QuizQuestion `json:"questions,omitempty"`
+}
+
+// QuizQuestion is a question in a quiz. The answer is only included once the
+// question has been answered.
+type QuizQuestion struct {
+	Index    int      `json:"index"`
+	WordId   int64    `json:"wordId,omitempty"`
+	Prompt   string   `json:"prompt"`
+	Choices  []string `json:"choices,omitempty"`
+	Response *string  `json:"response,omitempty"`
+	Correct  *bool    `json:"correct,omitempty"`
+	Answer   string   `json:"answer,omitempty"`
+
+	answer   string
+	accepted []string
+}
+
+type QuizAnswerResult struct {
+	Correct bool `json:"correct"`
+	// Exact is whether the answer matched exactly (i.e., not just after
+	// ignoring accents, case, and typos).
+	Exact bool `json:"exact"`
+	// Answer is the expected answer.
+	Answer string `json:"answer"`
+	// Quiz is the quiz summary (without questions).
+	Quiz Quiz `json:"quiz"`
+}
+
+func (db *DB) newQuiz(
+	lang string,
+	req NewQuizRequest,
+	now time.Time,
+) (Quiz, error) {
+	if !req.Mode.IsValid() {
+		return Quiz{}, ErrInvalidQuizMode
+	}
+	length := req.Length
+	if length <= 0 {
+		length = defaultQuizLength
+	} else if length > maxQuizLength {
+		length = maxQuizLength
+	}
+	numChoices := req.Choices
+	if numChoices <= 1 {
+		numChoices = defaultQuizChoices
+	} else if numChoices > maxQuizChoices {
+		numChoices = maxQuizChoices
+	}
+
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return Quiz{}, err
+	}
+	tag, err := db.getLangTag(langId)
+	if err != nil {
+		return Quiz{}, err
+	}
+	words := []Word{}
+	if req.List != "" {
+		listId, err := db.getListId(langId, req.List)
+		if err != nil {
+			return Quiz{}, err
+		}
+		list, err := getListById(db, listId)
+		if err != nil {
+			return Quiz{}, err
+		}
+		words = list.Words
+	} else if words, err = db.getAllWords(lang); err != nil {
+		return Quiz{}, err
+	}
+	rng := rand.New(rand.NewSource(now.UnixNano()))
+	rng.Shuffle(len(words), func(i, j int) {
+		words[i], words[j] = words[j], words[i]
+	})
+
+	questions := []QuizQuestion{}
+	for _, word := range words {
+		if len(questions) == length {
+			break
+		}
+		q, ok := QuizQuestion{WordId: word.Id}, true
+		switch req.Mode {
+		case QuizModeChoice:
+			q, ok = makeChoiceQuestion(word, words, numChoices, rng)
+		case QuizModeTyped:
+			q.Prompt, q.answer, q.accepted = word.Definition, word.Word, word.Aliases
+		case QuizModeCloze:
+			q, ok = makeClozeQuestion(word, tag)
+		case QuizModePicture:
+			q, ok = makePictureQuestion(word)
+		}
+		if ok {
+			q.Index = len(questions)
+			questions = append(questions, q)
+		}
+	}
+	if len(questions) == 0 {
+		return Quiz{}, ErrNotEnoughWords
+	}
+
+	quiz := Quiz{
+		LangId:    langId,
+		Mode:      req.Mode,
+		CreatedAt: now.Unix(),
+		Total:     len(questions),
+		Questions: questions,
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return Quiz{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`INSERT INTO quizzes(lang_id,mode,created_at,total) VALUES (?,?,?,?)`,
+		quiz.LangId, quiz.Mode, quiz.CreatedAt, quiz.Total,
+	)
+	if err != nil {
+		return Quiz{}, err
+	}
+	if quiz.Id, err = res.LastInsertId(); err != nil {
+		return Quiz{}, err
+	}
+	for _, q := range questions {
+		choices, accepted := []byte("[]"), []byte("[]")
+		if len(q.Choices) != 0 {
+			choices, _ = json.Marshal(q.Choices)
+		}
+		if len(q.accepted) != 0 {
+			accepted, _ = json.Marshal(q.accepted)
+		}
+		_, err := tx.Exec(
+			`INSERT INTO quiz_questions(`+
+				`quiz_id,idx,word_id,prompt,choices,answer,accepted`+
+				`) VALUES (?,?,?,?,?,?,?)`,
+			quiz.Id, q.Index, q.WordId, q.Prompt, string(choices), q.answer,
+			string(accepted),
+		)
+		if err != nil {
+			return Quiz{}, err
+		}
+	}
+	return quiz, tx.Commit()
+}
+
+// Makes a question with the path of the word's image as the prompt. Fails if
+// the word has no image.
+func makePictureQuestion(word Word) (QuizQuestion, bool) {
+	if word.Image == nil {
+		return QuizQuestion{}, false
+	}
+	return QuizQuestion{
+		WordId:   word.Id,
+		Prompt:   fmt.Sprintf("/langs/%d/words/%d/image", word.LangId, word.Id),
+		answer:   word.Word,
+		accepted: word.Aliases,
+	}, true
+}
+
+// Makes a question with the word's definition and up to numChoices-1 other
+// definitions from the given words. Fails if there are no other definitions.
+func makeChoiceQuestion(
+	word Word,
+	words []Word,
+	numChoices int,
+	rng *rand.Rand,
+) (QuizQuestion, bool) {
+	q := QuizQuestion{WordId: word.Id, Prompt: word.Word, answer: word.Definition}
+	seen := map[string]bool{word.Definition: true}
+	choices := []string{word.Definition}
+	for _, i := range rng.Perm(len(words)) {
+		if len(choices) == numChoices {
+			break
+		}
+		if def := words[i].Definition; !seen[def] {
+			seen[def] = true
+			choices = append(choices, def)
+		}
+	}
+	if len(choices) < 2 {
+		return q, false
+	}
+	rng.Shuffle(len(choices), func(i, j int) {
+		choices[i], choices[j] = choices[j], choices[i]
+	})
+	q.Choices = choices
+	return q, true
+}
+
+var (
+	sentenceRegex = regexp.MustCompile(`[^.!?。！？\n]+[.!?。！？]*`)
+	tokenRegex    = regexp.MustCompile(`[\pL\pM\pN'’-]+`)
+)
+
+const clozeBlank = "_____"
+
+// Makes a question by blanking out the word (or one of its aliases) in the
+// first of the word's example sentences, then the sentences of its notes,
+// that contains it. Fails if there is no such sentence.
+func makeClozeQuestion(word Word, tag language.Tag) (QuizQuestion, bool) {
+	q := QuizQuestion{WordId: word.Id}
+	targets := map[string]bool{foldWord(word.Word, tag): true}
+	for _, alias := range word.Aliases {
+		targets[foldWord(alias, tag)] = true
+	}
+	sentences := []string{}
+	for _, sense := range word.Senses {
+		for _, example := range sense.Examples {
+			sentences = append(sentences, example.Sentence)
+		}
+	}
+	sentences = append(sentences, sentenceRegex.FindAllString(word.Notes, -1)...)
+	for _, sentence := range sentences {
+		sentence = strings.TrimSpace(sentence)
+		for _, loc := range tokenRegex.FindAllStringIndex(sentence, -1) {
+			token := sentence[loc[0]:loc[1]]
+			if !targets[foldWord(token, tag)] {
+				continue
+			}
+			q.Prompt = sentence[:loc[0]] + clozeBlank + sentence[loc[1]:]
+			q.answer = token
+			q.accepted = append([]string{word.Word}, word.Aliases...)
+			return q, true
+		}
+	}
+	return q, false
+}
+
+func (db *DB) getQuiz(id int64) (Quiz, error) {
+	quiz, err := db.getQuizSummary(id)
+	if err != nil {
+		return quiz, err
+	}
+	rows, err := db.Query(
+		`SELECT idx,IFNULL(word_id,0),prompt,choices,answer,accepted,response,
+    correct FROM quiz_questions WHERE quiz_id=? ORDER BY idx`,
+		id,
+	)
+	if err != nil {
+		return quiz, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		q, err := scanQuizQuestion(rows)
+		if err != nil {
+			return quiz, err
+		}
+		if q.Response != nil {
+			q.Answer = q.answer
+		}
+		quiz.Questions = append(quiz.Questions, q)
+	}
+	return quiz, rows.Err()
+}
+
+func (db *DB) getQuizSummary(id int64) (Quiz, error) {
+	quiz := Quiz{}
+	cond, args := db.langIdCond("lang_id")
+	err := db.QueryRow(
+		`SELECT id,lang_id,mode,created_at,IFNULL(finished_at,0),score,total
+    FROM quizzes WHERE id=? AND `+cond,
+		append([]any{id}, args...)...,
+	).Scan(
+		&quiz.Id, &quiz.LangId, &quiz.Mode, &quiz.CreatedAt, &quiz.FinishedAt,
+		&quiz.Score, &quiz.Total,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNoQuizFound
+	}
+	return quiz, err
+}
+
+func scanQuizQuestion(dbs DBScanner) (q QuizQuestion, err error) {
+	choices, accepted := "", ""
+	response, correct := sql.NullString{}, sql.NullBool{}
+	err = dbs.Scan(
+		&q.Index, &q.WordId, &q.Prompt, &choices, &q.answer, &accepted,
+		&response, &correct,
+	)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal([]byte(choices), &q.Choices); err != nil {
+		return
+	}
+	if err = json.Unmarshal([]byte(accepted), &q.accepted); err != nil {
+		return
+	}
+	if response.Valid {
+		q.Response = &response.String
+	}
+	if correct.Valid {
+		q.Correct = &correct.Bool
+	}
+	return
+}
+
+// Grades and records the answer to a question. The quiz is finished once all
+// questions have been answered.
+func (db *DB) answerQuiz(
+	id int64,
+	req QuizAnswerRequest,
+	now time.Time,
+) (QuizAnswerResult, error) {
+	quiz, err := db.getQuiz(id)
+	if err != nil {
+		return QuizAnswerResult{}, err
+	}
+	if req.Question < 0 || req.Question >= len(quiz.Questions) {
+		return QuizAnswerResult{}, ErrInvalidQuestion
+	}
+	q := quiz.Questions[req.Question]
+	if q.Response != nil {
+		return QuizAnswerResult{}, ErrQuestionAnswered
+	}
+
+	response := req.Answer
+	if req.Choice != nil {
+		if *req.Choice < 0 || *req.Choice >= len(q.Choices) {
+			return QuizAnswerResult{}, ErrInvalidQuestion
+		}
+		response = q.Choices[*req.Choice]
+	}
+	result := QuizAnswerResult{Answer: q.answer}
+	if quiz.Mode == QuizModeChoice {
+		result.Correct = response == q.answer
+		result.Exact = result.Correct
+	} else {
+		tag, err := db.getLangTag(quiz.LangId)
+		if err != nil {
+			return QuizAnswerResult{}, err
+		}
+		result.Correct, result.Exact = gradeTypedAnswer(
+			response, append([]string{q.answer}, q.accepted...), tag,
+		)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return QuizAnswerResult{}, err
+	}
+	defer tx.Rollback()
+
+	// The question may have been answered since it was read.
+	res, err := tx.Exec(
+		`UPDATE quiz_questions SET response=?, correct=?, answered_at=?
+    WHERE quiz_id=? AND idx=? AND response IS NULL`,
+		response, result.Correct, now.Unix(), id, q.Index,
+	)
+	if err != nil {
+		return QuizAnswerResult{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return QuizAnswerResult{}, err
+	} else if n == 0 {
+		return QuizAnswerResult{}, ErrQuestionAnswered
+	}
+	_, err = tx.Exec(
+		`UPDATE quizzes SET
+      score=(SELECT COUNT(*) FROM quiz_questions WHERE quiz_id=? AND correct),
+      finished_at=CASE
+        WHEN EXISTS (
+          SELECT 1 FROM quiz_questions WHERE quiz_id=? AND response IS NULL
+        ) THEN NULL ELSE ?
+      END
+    WHERE id=?`,
+		id, id, now.Unix(), id,
+	)
+	if err != nil {
+		return QuizAnswerResult{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return QuizAnswerResult{}, err
+	}
+	result.Quiz, err = db.getQuizSummary(id)
+	return result, err
+}
+
+// Grades a typed answer against the accepted answers, ignoring accents and case
+// and allowing small typos (more for longer answers).
+func gradeTypedAnswer(
+	response string,
+	accepted []string,
+	tag language.Tag,
+) (correct, exact bool) {
+	response = normalizeText(response)
+	folded := foldWord(response, tag)
+	for _, ans := range accepted {
+		if response == normalizeText(ans) {
+			return true, true
+		}
+		foldedAns := foldWord(ans, tag)
+		if editDistance(folded, foldedAns) <= allowedTypos(foldedAns) {
+			correct = true
+		}
+	}
+	return
+}
+
+func allowedTypos(answer string) int {
+	n := len([]rune(answer))
+	switch {
+	case n <= 4:
+		return 0
+	case n <= 8:
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"perro", "perro", 0},
+		{"perro", "pero", 1},
+		{"perro", "perros", 1},
+		{"perro", "parro", 1},
+		// Adjacent transpositions count as one edit.
+		{"ab", "ba", 1},
+		{"gato", "gaot", 1},
+		{"kitten", "sitting", 3},
+		{"ñu", "nu", 1},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q): expected %d, got %d", test.a, test.b, test.want, got)
+		}
+		if got := editDistance(test.b, test.a); got != test.want {
+			t.Errorf("editDistance(%q, %q): expected %d, got %d", test.b, test.a, test.want, got)
+		}
+	}
+}
+
+func TestGradeTypedAnswer(t *testing.T) {
+	tests := []struct {
+		response       string
+		accepted       []string
+		correct, exact bool
+	}{
+		{"perro", []string{"perro"}, true, true},
+		{" perro ", []string{"perro"}, true, true},
+		{"Perro", []string{"perro"}, true, false},
+		{"arbol", []string{"árbol"}, true, false},
+		// Short answers allow no typos, longer ones allow more.
+		{"gata", []string{"gato"}, false, false},
+		{"pero", []string{"perro"}, true, false},
+		{"pro", []string{"perro"}, false, false},
+		{"bibliotca", []string{"biblioteca"}, true, false},
+		{"bibltca", []string{"biblioteca"}, false, false},
+		{"can", []string{"perro", "can"}, true, true},
+		{"", []string{"perro"}, false, false},
+	}
+	for _, test := range tests {
+		correct, exact := gradeTypedAnswer(test.response, test.accepted, language.Spanish)
+		if correct != test.correct || exact != test.exact {
+			t.Errorf(
+				"gradeTypedAnswer(%q, %v): expected %v/%v, got %v/%v",
+				test.response, test.accepted, test.correct, test.exact, correct, exact,
+			)
+		}
+	}
+}
+
+func TestMakeClozeQuestion(t *testing.T) {
+	tests := []struct {
+		word           Word
+		prompt, answer string
+		ok             bool
+	}{
+		{
+			Word{Word: "perro", Notes: "Tengo un gato. El Perro ladra!"},
+			"El _____ ladra!", "Perro", true,
+		},
+		{
+			Word{Word: "perro", Senses: []Sense{{
+				Examples: []Example{{Sentence: "Mi perro come."}},
+			}}, Notes: "El perro ladra."},
+			"Mi _____ come.", "perro", true,
+		},
+		{
+			Word{Word: "árbol", Aliases: []string{"arbolito"}, Notes: "Un Arbolito."},
+			"Un _____.", "Arbolito", true,
+		},
+		// Only whole words are blanked out.
+		{Word{Word: "gato", Notes: "Los gatos duermen."}, "", "", false},
+		{Word{Word: "gato"}, "", "", false},
+	}
+	for _, test := range tests {
+		q, ok := makeClozeQuestion(test.word, language.Spanish)
+		if ok != test.ok || q.Prompt != test.prompt || q.answer != test.answer {
+			t.Errorf(
+				"makeClozeQuestion(%q): expected %q/%q/%v, got %q/%q/%v",
+				test.word.Word, test.prompt, test.answer, test.ok,
+				q.Prompt, q.answer, ok,
+			)
+		}
+	}
+}
+
+func TestMakeChoiceQuestion(t *testing.T) {
+	words := []Word{
+		{Id: 1, Word: "perro", Definition: "dog"},
+		{Id: 2, Word: "can", Definition: "dog"},
+		{Id: 3, Word: "gato", Definition: "cat"},
+		{Id: 4, Word: "casa", Definition: "house"},
+	}
+	rng := rand.New(rand.NewSource(1))
+	q, ok := makeChoiceQuestion(words[0], words, 4, rng)
+	if !ok || q.Prompt != "perro" || q.answer != "dog" {
+		t.Fatalf("unexpected question: %+v", q)
+	}
+	// Duplicate definitions are only used once.
+	seen := map[string]bool{}
+	for _, choice := range q.Choices {
+		if seen[choice] {
+			t.Errorf("duplicate choice %q", choice)
+		}
+		seen[choice] = true
+	}
+	if len(q.Choices) != 3 || !seen["dog"] {
+		t.Errorf("unexpected choices: %v", q.Choices)
+	}
+	if _, ok := makeChoiceQuestion(words[0], words[:2], 4, rng); ok {
+		t.Error("expected no question without other definitions")
+	}
+}
+
+func TestAnswerQuiz(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	addTestWord(t, db, "spanish", "perro", "dog")
+	addTestWord(t, db, "spanish", "biblioteca", "library")
+
+	now := time.Unix(1_700_000_000, 0)
+	quiz, err := db.newQuiz("spanish", NewQuizRequest{Mode: QuizModeTyped}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quiz.Total != 2 {
+		t.Fatalf("expected 2 questions, got %d", quiz.Total)
+	}
+	answers := map[string]string{"dog": "perro", "library": "bibliotca"}
+
+	for i, q := range quiz.Questions {
+		req := QuizAnswerRequest{Question: i, Answer: answers[q.Prompt]}
+		result, err := db.answerQuiz(quiz.Id, req, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Correct || result.Exact != (q.Prompt == "dog") {
+			t.Errorf("unexpected result for %q: %+v", q.Prompt, result)
+		}
+		if finished := i == len(quiz.Questions)-1; finished != (result.Quiz.FinishedAt != 0) {
+			t.Errorf("unexpected finish time after question %d: %+v", i, result.Quiz)
+		}
+	}
+	summary, err := db.getQuizSummary(quiz.Id)
+	if err != nil || summary.Score != 2 {
+		t.Errorf("expected a score of 2, got %d (%v)", summary.Score, err)
+	}
+
+	req := QuizAnswerRequest{Question: 0, Answer: "gato"}
+	if _, err := db.answerQuiz(quiz.Id, req, now); err != ErrQuestionAnswered {
+		t.Errorf("expected ErrQuestionAnswered, got %v", err)
+	}
+	req.Question = 2
+	if _, err := db.answerQuiz(quiz.Id, req, now); err != ErrInvalidQuestion {
+		t.Errorf("expected ErrInvalidQuestion, got %v", err)
+	}
+	if _, err := db.newQuiz("spanish", NewQuizRequest{Mode: "essay"}, now); err != ErrInvalidQuizMode {
+		t.Errorf("expected ErrInvalidQuizMode, got %v", err)
+	}
+	if _, err := db.newQuiz("spanish", NewQuizRequest{Mode: QuizModeCloze}, now); err != ErrNotEnoughWords {
+		t.Errorf("expected ErrNotEnoughWords, got %v", err)
+	}
+}
+
+// Only one of many concurrent answers to a question is recorded.
+func TestAnswerQuizConcurrent(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	addTestWord(t, db, "spanish", "perro", "dog")
+	now := time.Unix(1_700_000_000, 0)
+	quiz, err := db.newQuiz("spanish", NewQuizRequest{Mode: QuizModeTyped}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 32
+	var wg sync.WaitGroup
+	start, errs := make(chan struct{}), make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := db.answerQuiz(quiz.Id, QuizAnswerRequest{Answer: "perro"}, now)
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	answered := 0
+	for err := range errs {
+		if err == nil {
+			answered++
+		} else if err != ErrQuestionAnswered {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if answered != 1 {
+		t.Errorf("expected 1 answer to be recorded, got %d", answered)
+	}
+}
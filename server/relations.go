@@ -0,0 +1,318 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+)
+
+type RelationKind string
+
+const (
+	RelationSynonym RelationKind = "synonym"
+	RelationAntonym RelationKind = "antonym"
+	// RelationCognate and RelationFalseFriend relate words that look alike
+	// (and have the same meaning or not).
+	RelationCognate     RelationKind = "cognate"
+	RelationFalseFriend RelationKind = "falseFriend"
+	// RelationDerivedFrom relates a word to the word it's derived from.
+	RelationDerivedFrom RelationKind = "derivedFrom"
+	// RelationDerivative is the inverse of RelationDerivedFrom, relating a
+	// word to a word derived from it.
+	RelationDerivative RelationKind = "derivative"
+)
+
+func (k RelationKind) IsValid() bool {
+	switch k {
+	case RelationSynonym, RelationAntonym, RelationCognate, RelationFalseFriend,
+		RelationDerivedFrom, RelationDerivative:
+		return true
+	}
+	return false
+}
+
+// RelatedWord is a word related to the word whose relations were fetched.
+// The kind is the relation of the fetched word to this one, as it was added:
+// derivedFrom means the fetched word is derived from this one, and derivative
+// means this one is derived from the fetched word.
+type RelatedWord struct {
+	Kind RelationKind `json:"kind"`
+	Word Word         `json:"word"`
+}
+
+// NewRelation is the kind of relation to add and the word (in the same
+// language) to relate to, given by its ID or by its text.
+type NewRelation struct {
+	Kind RelationKind `json:"kind"`
+	Id   int64        `json:"id,omitempty"`
+	Word string       `json:"word,omitempty"`
+}
+
+// Returns the stored form of a relation of the given kind from the word to
+// the other word.
+func relationKey(
+	kind RelationKind,
+	wordId, otherId int64,
+) (RelationKind, int64, int64) {
+	switch kind {
+	case RelationDerivedFrom:
+		return kind, wordId, otherId
+	case RelationDerivative:
+		return RelationDerivedFrom, otherId, wordId
+	}
+	if wordId > otherId {
+		wordId, otherId = otherId, wordId
+	}
+	return kind, wordId, otherId
+}
+
+// wordExpand is the optional data included with fetched words, given by the
+// "expand" query param as a comma-separated list.
+type wordExpand struct {
+	related bool
+}
+
+func wordExpandFromQuery(c *jmux.Context) (wordExpand, error) {
+	exp := wordExpand{}
+	expandStr := c.Query().Get("expand")
+	if expandStr == "" {
+		return exp, nil
+	}
+	for _, name := range strings.Split(expandStr, ",") {
+		switch strings.TrimSpace(name) {
+		case "related":
+			exp.related = true
+		default:
+			return exp, invalidQueryValue("expand")
+		}
+	}
+	return exp, nil
+}
+
+// Fills in the parts of the word given by exp.
+func (db *DB) expandWord(lang string, word *Word, exp wordExpand) error {
+	if exp.related {
+		related, err := db.getRelated(lang, word.Id)
+		if err != nil {
+			return err
+		}
+		word.Related = related
+	}
+	return nil
+}
+
+// Gets the words related to the word.
+func (s *Server) getRelatedHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["word"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+
+	code, resp := http.StatusOK, Response[[]RelatedWord]{}
+	related, err := s.userDb(c).getRelated(lang, id)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error getting words related to word %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = related
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Relates the word to another word, returning the words related to it.
+func (s *Server) addRelationHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	nr := NewRelation{}
+	if err := c.ReadBodyJSON(&nr); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	code, resp := http.StatusOK, Response[[]RelatedWord]{}
+	related, err := s.userDb(c).addRelation(lang, id, nr)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error adding relation to word %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = related
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Removes the relation of the kind given by the "kind" query param between the
+// words (all relations between them if not given), returning the words still
+// related to the word.
+func (s *Server) delRelationHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	otherId, err := strconv.ParseInt(c.Params["other"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	kind := RelationKind(c.Query().Get("kind"))
+
+	code, resp := http.StatusOK, Response[[]RelatedWord]{}
+	related, err := s.userDb(c).delRelation(lang, id, otherId, kind)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error deleting relation %d of word %d: %v", otherId, id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = related
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Gets the words related to the word, ordered by the kind of relation.
+func (db *DB) getRelated(lang string, id int64) ([]RelatedWord, error) {
+	if _, err := db.getWordById(lang, id); err != nil {
+		return nil, err
+	}
+	cond, args := db.wordsCond()
+	rows, err := db.Query(
+		`SELECT IIF(r.kind=? AND r.other_id=?,?,r.kind) AS k,`+wordCols+`
+    FROM word_relations AS r
+    JOIN words ON words.id=IIF(r.word_id=?,r.other_id,r.word_id)
+    WHERE (r.word_id=? OR r.other_id=?) AND `+cond+`
+    ORDER BY k,words.id`,
+		append(
+			[]any{RelationDerivedFrom, id, RelationDerivative, id, id, id},
+			args...,
+		)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	related := []RelatedWord{}
+	for rows.Next() {
+		rw := RelatedWord{}
+		rw.Word, err = scanWord(scannerFunc(func(dest ...any) error {
+			return rows.Scan(append([]any{&rw.Kind}, dest...)...)
+		}))
+		if err != nil {
+			return nil, err
+		}
+		related = append(related, rw)
+	}
+	return related, rows.Err()
+}
+
+// Relates the word to another word in its language. Adding an existing
+// relation does nothing.
+func (db *DB) addRelation(
+	lang string,
+	id int64,
+	nr NewRelation,
+) ([]RelatedWord, error) {
+	if !nr.Kind.IsValid() {
+		return nil, fmt.Errorf("%w: invalid kind %q", ErrInvalidRelation, nr.Kind)
+	}
+	word, err := db.getWordById(lang, id)
+	if err != nil {
+		return nil, err
+	}
+	other := Word{}
+	if nr.Id != 0 {
+		other, err = db.getWordByIdInAnyLang(nr.Id)
+	} else if nr.Word != "" {
+		other, err = db.getWord(
+			strconv.FormatInt(word.LangId, 10), nr.Word, false, true, nr.Word,
+		)
+	} else {
+		err = fmt.Errorf("%w: must have an ID or a word", ErrInvalidRelation)
+	}
+	if err != nil {
+		return nil, err
+	} else if other.Id == word.Id {
+		return nil, fmt.Errorf(
+			"%w: words can't be related to themselves", ErrInvalidRelation,
+		)
+	} else if other.LangId != word.LangId {
+		return nil, fmt.Errorf(
+			"%w: words must be in the same language", ErrInvalidRelation,
+		)
+	}
+
+	kind, wordId, otherId := relationKey(nr.Kind, word.Id, other.Id)
+	_, err = db.Exec(
+		`INSERT OR IGNORE INTO word_relations(word_id,other_id,kind)
+    VALUES (?,?,?)`,
+		wordId, otherId, kind,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return db.getRelated(lang, id)
+}
+
+// Removes the relation of the kind between the words, or all relations
+// between them if kind is empty.
+func (db *DB) delRelation(
+	lang string,
+	id, otherId int64,
+	kind RelationKind,
+) ([]RelatedWord, error) {
+	if kind != "" && !kind.IsValid() {
+		return nil, fmt.Errorf("%w: invalid kind %q", ErrInvalidRelation, kind)
+	}
+	if _, err := db.getWordById(lang, id); err != nil {
+		return nil, err
+	}
+	stmt := `DELETE FROM word_relations
+  WHERE (word_id=? AND other_id=?) OR (word_id=? AND other_id=?)`
+	args := []any{id, otherId, otherId, id}
+	if kind != "" {
+		stmt = `DELETE FROM word_relations
+    WHERE kind=? AND word_id=? AND other_id=?`
+		k, wordId, otherId := relationKey(kind, id, otherId)
+		args = []any{k, wordId, otherId}
+	}
+	res, err := db.Exec(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNoRelationFound
+	}
+	return db.getRelated(lang, id)
+}
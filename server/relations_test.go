@@ -0,0 +1,194 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRelationKey(t *testing.T) {
+	tests := []struct {
+		kind            RelationKind
+		wordId, otherId int64
+		want            string
+	}{
+		{RelationSynonym, 1, 2, "synonym 1 2"},
+		{RelationSynonym, 2, 1, "synonym 1 2"},
+		{RelationFalseFriend, 5, 3, "falseFriend 3 5"},
+		// Derivations are stored from the derived word.
+		{RelationDerivedFrom, 2, 1, "derivedFrom 2 1"},
+		{RelationDerivative, 1, 2, "derivedFrom 2 1"},
+	}
+	for _, test := range tests {
+		kind, wordId, otherId := relationKey(test.kind, test.wordId, test.otherId)
+		if got := fmt.Sprint(kind, " ", wordId, " ", otherId); got != test.want {
+			t.Errorf(
+				"relationKey(%s, %d, %d): expected %s, got %s",
+				test.kind, test.wordId, test.otherId, test.want, got,
+			)
+		}
+	}
+}
+
+// Returns the related words as "kind word" strings.
+func relatedStrs(related []RelatedWord) []string {
+	strs := []string{}
+	for _, rw := range related {
+		strs = append(strs, string(rw.Kind)+" "+rw.Word.Word)
+	}
+	return strs
+}
+
+func TestRelations(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	addTestLang(t, db, "english")
+	now := time.Now()
+	word := func(w string) Word {
+		return addTestWord(t, db, "spanish", w, "")
+	}
+	libro, libreria, libreta, texto := word("libro"), word("librer\u00eda"), word("libreta"), word("texto")
+	book := addTestWord(t, db, "english", "book", "")
+
+	tests := []struct {
+		id   int64
+		nr   NewRelation
+		want []string
+		err  error
+	}{
+		{libreria.Id, NewRelation{Kind: RelationDerivedFrom, Id: libro.Id}, []string{"derivedFrom libro"}, nil},
+		{libro.Id, NewRelation{Kind: RelationDerivative, Word: "LIBRETA"}, []string{"derivative librer\u00eda", "derivative libreta"}, nil},
+		{libro.Id, NewRelation{Kind: RelationSynonym, Id: texto.Id}, []string{"derivative librer\u00eda", "derivative libreta", "synonym texto"}, nil},
+		// Adding a relation again does nothing.
+		{texto.Id, NewRelation{Kind: RelationSynonym, Id: libro.Id}, []string{"synonym libro"}, nil},
+		{libreria.Id, NewRelation{Kind: RelationFalseFriend, Word: "libreta"}, []string{"derivedFrom libro", "falseFriend libreta"}, nil},
+		{libro.Id, NewRelation{Kind: RelationSynonym, Id: libro.Id}, nil, ErrInvalidRelation},
+		{libro.Id, NewRelation{Kind: "related", Id: texto.Id}, nil, ErrInvalidRelation},
+		{libro.Id, NewRelation{Kind: RelationSynonym}, nil, ErrInvalidRelation},
+		// Relations are only between words in the same language.
+		{libro.Id, NewRelation{Kind: RelationCognate, Id: book.Id}, nil, ErrInvalidRelation},
+		{libro.Id, NewRelation{Kind: RelationAntonym, Word: "book"}, nil, ErrNoWordFound},
+		{999, NewRelation{Kind: RelationSynonym, Id: libro.Id}, nil, ErrNoWordFound},
+	}
+	for _, test := range tests {
+		related, err := db.addRelation("spanish", test.id, test.nr)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("addRelation(%d, %+v): expected %v, got %v", test.id, test.nr, test.err, err)
+			}
+		} else if got := relatedStrs(related); err != nil || fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("addRelation(%d, %+v): expected %q, got %q (%v)", test.id, test.nr, test.want, got, err)
+		}
+	}
+
+	related, err := db.getRelated("spanish", libreta.Id)
+	if got := relatedStrs(related); err != nil ||
+		fmt.Sprint(got) != "[derivedFrom libro falseFriend librer\u00eda]" {
+		t.Errorf("unexpected relations: %q (%v)", got, err)
+	}
+
+	delTests := []struct {
+		id, otherId int64
+		kind        RelationKind
+		want        []string
+		err         error
+	}{
+		{libro.Id, libreta.Id, RelationSynonym, nil, ErrNoRelationFound},
+		{libro.Id, libreta.Id, RelationDerivedFrom, nil, ErrNoRelationFound},
+		{libro.Id, libreta.Id, RelationDerivative, []string{"derivative librer\u00eda", "synonym texto"}, nil},
+		{libro.Id, libreria.Id, "related", nil, ErrInvalidRelation},
+		{libro.Id, libreria.Id, "", []string{"synonym texto"}, nil},
+		{libro.Id, libreria.Id, "", nil, ErrNoRelationFound},
+	}
+	for _, test := range delTests {
+		related, err := db.delRelation("spanish", test.id, test.otherId, test.kind)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("delRelation(%d, %d, %q): expected %v, got %v", test.id, test.otherId, test.kind, test.err, err)
+			}
+		} else if got := relatedStrs(related); err != nil || fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("delRelation(%d, %d, %q): expected %q, got %q (%v)", test.id, test.otherId, test.kind, test.want, got, err)
+		}
+	}
+
+	// Deleted words aren't listed.
+	if _, err := db.delWordById("spanish", texto.Id, now); err != nil {
+		t.Fatal(err)
+	}
+	if related, err := db.getRelated("spanish", libro.Id); err != nil || len(related) != 0 {
+		t.Errorf("expected no relations, got %q (%v)", relatedStrs(related), err)
+	}
+}
+
+func TestRelationHandlers(t *testing.T) {
+	srvr := newTestServer(t, newTestDb(t))
+	alice, bob := newTestClient(t, srvr), newTestClient(t, srvr)
+	alice.register("alice")
+	bob.register("bob")
+	if code := alice.do(http.MethodPost, "/langs", Lang{Name: "spanish"}, nil); code != http.StatusOK {
+		t.Fatalf("error creating language: %d", code)
+	}
+	ids := map[string]int64{}
+	for _, w := range []string{"libro", "texto"} {
+		resp := Response[Word]{}
+		if code := alice.do(http.MethodPost, "/langs/spanish/words", Word{Word: w}, &resp); code != http.StatusOK {
+			t.Fatalf("error adding %s: %d", w, code)
+		}
+		ids[w] = resp.Content.Id
+	}
+	path := "/langs/spanish/words/" + jsonStr(ids["libro"]) + "/related"
+	synonym := NewRelation{Kind: RelationSynonym, Word: "texto"}
+
+	tests := []struct {
+		name   string
+		tc     *testClient
+		method string
+		path   string
+		body   any
+		code   int
+		want   string
+	}{
+		{"other user adds", bob, http.MethodPost, path, synonym, http.StatusBadRequest, ""},
+		{"add", alice, http.MethodPost, path, synonym, http.StatusOK, "[synonym texto]"},
+		{"invalid kind", alice, http.MethodPost, path, NewRelation{Kind: "x", Word: "texto"}, http.StatusBadRequest, ""},
+		{"get", alice, http.MethodGet, path, nil, http.StatusOK, "[synonym texto]"},
+		{"other user gets", bob, http.MethodGet, path, nil, http.StatusBadRequest, ""},
+		{"invalid kind to delete", alice, http.MethodDelete, path + "/" + jsonStr(ids["texto"]) + "?kind=x", nil, http.StatusBadRequest, ""},
+		{"delete", alice, http.MethodDelete, path + "/" + jsonStr(ids["texto"]) + "?kind=synonym", nil, http.StatusOK, "[]"},
+		{"delete again", alice, http.MethodDelete, path + "/" + jsonStr(ids["texto"]), nil, http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		resp := Response[[]RelatedWord]{}
+		code := test.tc.do(test.method, test.path, test.body, &resp)
+		if code != test.code {
+			t.Errorf("%s: expected %d, got %d (%s)", test.name, test.code, code, resp.Error)
+		} else if test.want != "" && fmt.Sprint(relatedStrs(resp.Content)) != test.want {
+			t.Errorf("%s: expected %s, got %q", test.name, test.want, relatedStrs(resp.Content))
+		}
+	}
+
+	antonym := NewRelation{Kind: RelationAntonym, Id: ids["texto"]}
+	if code := alice.do(http.MethodPost, path, antonym, nil); code != http.StatusOK {
+		t.Fatalf("error adding relation: %d", code)
+	}
+	expandTests := []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{"", http.StatusOK, "[]"},
+		{"?expand=related", http.StatusOK, "[antonym texto]"},
+		{"?expand=senses", http.StatusBadRequest, ""},
+	}
+	for _, test := range expandTests {
+		resp := Response[Word]{}
+		code := alice.do(http.MethodGet, "/langs/spanish/words/libro"+test.query, nil, &resp)
+		if code != test.code {
+			t.Errorf("query %q: expected %d, got %d", test.query, test.code, code)
+		} else if test.want != "" && fmt.Sprint(relatedStrs(resp.Content.Related)) != test.want {
+			t.Errorf("query %q: expected %s, got %q", test.query, test.want, relatedStrs(resp.Content.Related))
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+)
+
+const (
+	defaultDueLimit = 20
+	maxDueLimit     = 500
+)
+
+func (s *Server) getDueWordsHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	limit := defaultDueLimit
+	if limitStr := c.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			c.WriteError(http.StatusBadRequest, "invalid value for 'limit'")
+			return
+		}
+		if l > maxDueLimit {
+			l = maxDueLimit
+		}
+		limit = l
+	}
+	includeNew := true
+	if newStr := c.Query().Get("new"); newStr != "" {
+		b, err := strconv.ParseBool(newStr)
+		if err != nil {
+			c.WriteError(http.StatusBadRequest, "invalid value for 'new'")
+			return
+		}
+		includeNew = b
+	}
+
+	list := c.Query().Get("list")
+
+	items, err := s.userDb(c).getDueWords(
+		lang, list, time.Now(), limit, includeNew,
+	)
+	code, resp := http.StatusOK, Response[[]ReviewItem]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else if items == nil {
+			log.Printf("error getting due words for lang %s: %v", lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		} else {
+			resp.Error = "partial internal server error"
+		}
+	}
+	resp.Content = items
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+type ReviewRequest struct {
+	Grade Grade `json:"grade"`
+}
+
+func (s *Server) reviewWordHandler(c *jmux.Context) {
+	lang, idStr := c.Params["lang"], c.Params["id"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.WriteError(http.StatusBadRequest, "invalid word ID")
+		return
+	}
+	req := ReviewRequest{}
+	if err := c.ReadBodyJSON(&req); err != nil {
+		if errors.Is(err, ErrInvalidGrade) {
+			c.BadRequest(errRespJson(err.Error()))
+		} else if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	state, err := s.userDb(c).reviewWord(lang, id, req.Grade, s.scheduler, time.Now())
+	code, resp := http.StatusOK, Response[ReviewState]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error reviewing word %d in lang %s: %v", id, lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = state
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// ReviewItem is a word along with its review state (nil if the word is new).
+type ReviewItem struct {
+	Word   Word         `json:"word"`
+	Review *ReviewState `json:"review"`
+}
+
+const reviewStateCols = `review_states.word_id,review_states.algorithm,
+review_states.ease,review_states.interval,review_states.repetitions,
+review_states.lapses,review_states.stability,review_states.difficulty,
+review_states.due,review_states.last_review`
+
+// Columns for scanning a ReviewItem from words left joined with
+// review_states.
+const reviewItemCols = wordCols + `,review_states.word_id IS NOT NULL,
+  IFNULL(review_states.algorithm,''),IFNULL(review_states.ease,0),
+  IFNULL(review_states.interval,0),IFNULL(review_states.repetitions,0),
+  IFNULL(review_states.lapses,0),IFNULL(review_states.stability,0),
+  IFNULL(review_states.difficulty,0),IFNULL(review_states.due,0),
+  IFNULL(review_states.last_review,0)`
+
+func scanReviewState(dbs DBScanner) (rs ReviewState, err error) {
+	err = dbs.Scan(
+		&rs.WordId, &rs.Algorithm, &rs.Ease, &rs.Interval, &rs.Repetitions,
+		&rs.Lapses, &rs.Stability, &rs.Difficulty, &rs.Due, &rs.LastReview,
+	)
+	return
+}
+
+// Gets words that are due for review at the given time, most overdue first.
+// New words come after all due words if includeNew is true. If list is
+// non-empty, only words in the list (given by its name or ID) are included.
+func (db *DB) getDueWords(
+	lang, list string,
+	now time.Time,
+	limit int,
+	includeNew bool,
+) ([]ReviewItem, error) {
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return nil, err
+	}
+	listId, err := db.optListId(langId, list)
+	if err != nil {
+		return nil, err
+	}
+	listCond, listArgs := listWordsCond(listId)
+
+	cond := `review_states.due<=?`
+	if includeNew {
+		cond = `(review_states.word_id IS NULL OR review_states.due<=?)`
+	}
+	stmt := `SELECT ` + reviewItemCols + `
+FROM words LEFT JOIN review_states ON review_states.word_id=words.id
+WHERE words.lang_id=? AND words.deleted_at IS NULL
+  AND ` + listCond + ` AND ` + cond + `
+ORDER BY review_states.word_id IS NULL, review_states.due, words.id
+LIMIT ?`
+	args := append(append([]any{langId}, listArgs...), now.Unix(), limit)
+	rows, err := db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ReviewItem{}
+	for rows.Next() {
+		item, e := scanReviewItem(rows)
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+		} else {
+			items = append(items, item)
+		}
+	}
+	return items, err
+}
+
+func scanReviewItem(dbs DBScanner) (item ReviewItem, err error) {
+	hasState, rs := false, ReviewState{}
+	item.Word, err = scanWord(scannerFunc(func(dest ...any) error {
+		dest = append(dest, &hasState)
+		dest = append(dest,
+			&rs.Algorithm, &rs.Ease, &rs.Interval, &rs.Repetitions, &rs.Lapses,
+			&rs.Stability, &rs.Difficulty, &rs.Due, &rs.LastReview,
+		)
+		return dbs.Scan(dest...)
+	}))
+	if err == nil && hasState {
+		rs.WordId = item.Word.Id
+		item.Review = &rs
+	}
+	return
+}
+
+// Gets the review state of the word, returning a new state if the word has
+// never been reviewed.
+func (db *DB) getReviewState(lang string, id int64) (ReviewState, error) {
+	word, err := db.getWordById(lang, id)
+	if err != nil {
+		return ReviewState{}, err
+	}
+	return getReviewStateOf(db, word.Id)
+}
+
+// Gets the review state of the word with the ID like getReviewState, without
+// checking the word exists.
+func getReviewStateOf(dbq DBQuerier, wordId int64) (ReviewState, error) {
+	row := dbq.QueryRow(
+		`SELECT `+reviewStateCols+` FROM review_states WHERE word_id=?`, wordId,
+	)
+	rs, err := scanReviewState(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ReviewState{WordId: wordId}, nil
+	}
+	return rs, err
+}
+
+// Records a review of the word, returning its new state.
+func (db *DB) reviewWord(
+	lang string,
+	id int64,
+	grade Grade,
+	sched Scheduler,
+	now time.Time,
+) (ReviewState, error) {
+	if !grade.IsValid() {
+		return ReviewState{}, ErrInvalidGrade
+	}
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return ReviewState{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return ReviewState{}, err
+	}
+	defer tx.Rollback()
+
+	// The previous state is read in the same transaction it's replaced in so
+	// that concurrent reviews of the word can't overwrite each other.
+	word, err := getWordTx(tx, langId, id)
+	if err != nil {
+		return ReviewState{}, err
+	}
+	prev, err := getReviewStateOf(tx, word.Id)
+	if err != nil {
+		return ReviewState{}, err
+	}
+	state := sched.Schedule(prev, grade, now)
+
+	if err := saveReviewState(tx, state); err != nil {
+		return ReviewState{}, err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO review_log(`+
+			`word_id,algorithm,grade,reviewed_at,prev_interval,interval,due`+
+			`) VALUES (?,?,?,?,?,?,?)`,
+		state.WordId, state.Algorithm, int(grade), now.Unix(),
+		prev.Interval, state.Interval, state.Due,
+	)
+	if err != nil {
+		return ReviewState{}, err
+	}
+	return state, tx.Commit()
+}
+
+// Inserts or replaces the review state of the word.
+func saveReviewState(ex DBExecer, state ReviewState) error {
+	_, err := ex.Exec(
+		`INSERT OR REPLACE INTO review_states(`+
+			`word_id,algorithm,ease,interval,repetitions,lapses,stability,`+
+			`difficulty,due,last_review) VALUES (?,?,?,?,?,?,?,?,?,?)`,
+		state.WordId, state.Algorithm, state.Ease, state.Interval,
+		state.Repetitions, state.Lapses, state.Stability, state.Difficulty,
+		state.Due, state.LastReview,
+	)
+	return err
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReviewWord(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	gato := addTestWord(t, db, "spanish", "gato", "cat")
+	casa := addTestWord(t, db, "spanish", "casa", "house")
+
+	dueIds := func(now time.Time, includeNew bool) string {
+		t.Helper()
+		items, err := db.getDueWords("spanish", "", now, 10, includeNew)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int64{}
+		for _, item := range items {
+			ids = append(ids, item.Word.Id)
+			if (item.Review == nil) != (item.Word.Id == casa.Id) {
+				t.Errorf("unexpected review state for word %d: %+v", item.Word.Id, item.Review)
+			}
+		}
+		return fmt.Sprint(ids)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	state, err := db.reviewWord("spanish", perro.Id, GradeGood, SM2{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.WordId != perro.Id || state.Interval != 1 || state.Repetitions != 1 {
+		t.Errorf("unexpected state: %+v", state)
+	}
+	// The second review builds on the saved state.
+	later := now.Add(24 * time.Hour)
+	if state, err = db.reviewWord("spanish", perro.Id, GradeGood, SM2{}, later); err != nil {
+		t.Fatal(err)
+	} else if state.Interval != 6 || state.Repetitions != 2 {
+		t.Errorf("unexpected state after second review: %+v", state)
+	}
+	if _, err := db.reviewWord("spanish", gato.Id, GradeAgain, SM2{}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now        time.Time
+		includeNew bool
+		want       []int64
+	}{
+		{now, false, []int64{}},
+		{now, true, []int64{casa.Id}},
+		// Most overdue first, then new words.
+		{now.Add(2 * 24 * time.Hour), true, []int64{gato.Id, casa.Id}},
+		{now.Add(8 * 24 * time.Hour), false, []int64{gato.Id, perro.Id}},
+	}
+	for _, test := range tests {
+		if got := dueIds(test.now, test.includeNew); got != fmt.Sprint(test.want) {
+			t.Errorf(
+				"due at %v (new=%v): expected %v, got %v",
+				test.now, test.includeNew, test.want, got,
+			)
+		}
+	}
+
+	if _, err := db.reviewWord("spanish", perro.Id, 0, SM2{}, now); err != ErrInvalidGrade {
+		t.Errorf("expected ErrInvalidGrade, got %v", err)
+	}
+	if _, err := db.reviewWord("spanish", 999, GradeGood, SM2{}, now); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound, got %v", err)
+	}
+}
+
+func TestReviewWordConcurrently(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+
+	// Reviews may fail with the database being busy, but none that succeed may
+	// be lost.
+	now := time.Unix(1_700_000_000, 0)
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	var reviewed int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := db.reviewWord("spanish", perro.Id, GradeGood, SM2{}, now)
+			if err == nil {
+				mtx.Lock()
+				reviewed++
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if reviewed == 0 {
+		t.Fatal("no reviews succeeded")
+	}
+	state, err := db.getReviewState("spanish", perro.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Repetitions != reviewed {
+		t.Errorf("expected %d repetitions, got %d", reviewed, state.Repetitions)
+	}
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+)
+
+// Kinds of items revisions are recorded for.
+const (
+	RevisionLang = "lang"
+	RevisionWord = "word"
+)
+
+// Actions revisions record.
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+// Revision is a recorded change to a language or word.
+type Revision struct {
+	Id     int64  `json:"id"`
+	Kind   string `json:"kind"`
+	ItemId int64  `json:"itemId"`
+	LangId int64  `json:"langId"`
+	Action string `json:"action"`
+	// UserId is the user that made the change (0 if it wasn't made by a user,
+	// like through the command line).
+	UserId    int64  `json:"userId,omitempty"`
+	Username  string `json:"username,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+	// Before and After are the item before and after the change. Before is
+	// null for inserts and restores, and After is null for deletes.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+	// RevertOf is the revision reverted by the change, if any.
+	RevertOf int64 `json:"revertOf,omitempty"`
+}
+
+// Gets the language's revisions, newest first.
+func (s *Server) getLangHistoryHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	revs, err := s.userDb(c).getLangHistory(lang)
+	code, resp := http.StatusOK, Response[[]Revision]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error getting history of lang %s: %v", lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = revs
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Gets the word's revisions, newest first.
+func (s *Server) getWordHistoryHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["word"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+
+	revs, err := s.userDb(c).getWordHistory(lang, id)
+	code, resp := http.StatusOK, Response[[]Revision]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error getting history of word %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = revs
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Reverts the word to how it was before the revision, returning the updated
+// word.
+func (s *Server) revertWordHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	revId, err := strconv.ParseInt(c.Params["rev"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid revision ID"))
+		return
+	}
+
+	word, err := s.userDb(c).revertWord(lang, id, revId, time.Now())
+	code, resp := http.StatusOK, Response[Word]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error reverting word %d to revision %d: %v", id, revId, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = word
+		c.RespHeader().Set("ETag", versionETag(word.Version))
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Records the revision, made by the DB's actor, with the item before and
+// after it (either of which can be nil).
+func (db *DB) recordRevision(
+	ex DBExecer,
+	rev Revision,
+	before, after any,
+) error {
+	var beforeJson, afterJson, userId, revertOf any
+	if before != nil {
+		beforeJson = jsonStr(before)
+	}
+	if after != nil {
+		afterJson = jsonStr(after)
+	}
+	// Negative IDs are used for DBs that can't access anything.
+	if actor := db.actor(); actor > 0 {
+		userId = actor
+	}
+	if rev.RevertOf != 0 {
+		revertOf = rev.RevertOf
+	}
+	_, err := ex.Exec(
+		`INSERT INTO revisions(
+      kind,item_id,lang_id,action,user_id,created_at,before,after,revert_of
+    ) VALUES (?,?,?,?,?,?,?,?,?)`,
+		rev.Kind, rev.ItemId, rev.LangId, rev.Action, userId, rev.CreatedAt,
+		beforeJson, afterJson, revertOf,
+	)
+	return err
+}
+
+const revisionCols = `revisions.id,kind,item_id,lang_id,action,
+IFNULL(user_id,0),IFNULL(users.username,''),revisions.created_at,
+before,after,IFNULL(revert_of,0)`
+
+func scanRevision(dbs DBScanner) (rev Revision, err error) {
+	var before, after sql.NullString
+	err = dbs.Scan(
+		&rev.Id, &rev.Kind, &rev.ItemId, &rev.LangId, &rev.Action, &rev.UserId,
+		&rev.Username, &rev.CreatedAt, &before, &after, &rev.RevertOf,
+	)
+	if before.Valid {
+		rev.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		rev.After = json.RawMessage(after.String)
+	}
+	return
+}
+
+// Gets the revisions of the item, newest first.
+func (db *DB) getRevisions(kind string, itemId int64) ([]Revision, error) {
+	rows, err := db.Query(
+		`SELECT `+revisionCols+` FROM revisions
+    LEFT JOIN users ON users.id=revisions.user_id
+    WHERE kind=? AND item_id=? ORDER BY revisions.id DESC`,
+		kind, itemId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revs := []Revision{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
+
+func (db *DB) getLangHistory(lang string) ([]Revision, error) {
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return nil, err
+	}
+	return db.getRevisions(RevisionLang, langId)
+}
+
+// The word can be in the trash.
+func (db *DB) getWordHistory(lang string, wordId int64) ([]Revision, error) {
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := getWordDeletedAt(db, langId, wordId); err != nil {
+		return nil, err
+	}
+	return db.getRevisions(RevisionWord, wordId)
+}
+
+// Gets when the word in the language was put in the trash (invalid if it
+// isn't in the trash).
+func getWordDeletedAt(
+	q DBQuerier,
+	langId, wordId int64,
+) (sql.NullInt64, error) {
+	var deletedAt sql.NullInt64
+	err := q.QueryRow(
+		`SELECT deleted_at FROM words WHERE id=? AND lang_id=?`, wordId, langId,
+	).Scan(&deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNoWordFound
+	}
+	return deletedAt, err
+}
+
+// Reverts the word to how it was before the revision, which undoes it and
+// every later change. If the word didn't exist before the revision, it's put
+// in the trash; otherwise, it's taken out of the trash if it's in it. Only the
+// fields that can be edited directly are reverted (not senses or media). The
+// revert is recorded as a new revision.
+func (db *DB) revertWord(
+	lang string,
+	wordId, revId int64,
+	now time.Time,
+) (Word, error) {
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return Word{}, err
+	}
+	rev, err := scanRevision(db.QueryRow(
+		`SELECT `+revisionCols+` FROM revisions
+    LEFT JOIN users ON users.id=revisions.user_id
+    WHERE revisions.id=? AND kind=? AND item_id=? AND lang_id=?`,
+		revId, RevisionWord, wordId, langId,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNoRevisionFound
+		}
+		return Word{}, err
+	}
+	if rev.Before == nil {
+		return db.revertWordToTrash(lang, wordId, rev.Id, now)
+	}
+
+	old := Word{}
+	if err := json.Unmarshal(rev.Before, &old); err != nil {
+		return Word{}, fmt.Errorf("error reading revision %d: %w", rev.Id, err)
+	}
+	wd := wordDiffFromWord(old)
+	wd.Id = wordId
+	langId, tag, err := db.checkWordDiff(lang, &wd)
+	if err != nil {
+		return Word{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Word{}, err
+	}
+	defer tx.Rollback()
+
+	deletedAt, err := getWordDeletedAt(tx, langId, wordId)
+	if err != nil {
+		return Word{}, err
+	}
+	action := RevisionUpdate
+	if deletedAt.Valid {
+		_, err := tx.Exec(`UPDATE words SET deleted_at=NULL WHERE id=?`, wordId)
+		if err != nil {
+			return Word{}, err
+		}
+		action = RevisionRestore
+	}
+	prev, word, err := updateWord(tx, langId, tag, &wd, 0)
+	if err != nil {
+		return Word{}, err
+	}
+	var before any = prev
+	if action == RevisionRestore {
+		before = nil
+	}
+	err = db.recordRevision(tx, Revision{
+		Kind: RevisionWord, ItemId: wordId, LangId: langId,
+		Action: action, CreatedAt: now.Unix(), RevertOf: rev.Id,
+	}, before, word)
+	if err != nil {
+		return Word{}, err
+	}
+	return word, tx.Commit()
+}
+
+// Reverts the insert of the word by putting it in the trash.
+func (db *DB) revertWordToTrash(
+	lang string,
+	wordId, revId int64,
+	now time.Time,
+) (Word, error) {
+	word, err := db.getWordById(lang, wordId)
+	if err != nil {
+		return Word{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Word{}, err
+	}
+	defer tx.Rollback()
+
+	if err := trashWord(tx, wordId, now); err != nil {
+		return Word{}, err
+	}
+	err = db.recordRevision(tx, Revision{
+		Kind: RevisionWord, ItemId: wordId, LangId: word.LangId,
+		Action: RevisionDelete, CreatedAt: now.Unix(), RevertOf: revId,
+	}, word, nil)
+	if err != nil {
+		return Word{}, err
+	}
+	return word, tx.Commit()
+}
+
+// Returns a diff setting all of the word's directly editable fields to the
+// word's.
+func wordDiffFromWord(w Word) WordDiff {
+	aliases, tags := w.Aliases, w.Tags
+	if aliases == nil {
+		aliases = []string{}
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	return WordDiff{
+		Id:         w.Id,
+		Word:       &w.Word,
+		Definition: &w.Definition,
+		Aliases:    &aliases,
+		Tags:       &tags,
+		Notes:      &w.Notes,
+		Pos:        &w.Pos,
+		Gender:     &w.Gender,
+		Plural:     &w.Plural,
+		Register:   &w.Register,
+		CEFR:       &w.CEFR,
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Returns the revisions as "action before after" strings, with the before and
+// after given by the word's definition ("-" if there's none).
+func revisionStrs(t *testing.T, revs []Revision) []string {
+	t.Helper()
+	def := func(data json.RawMessage) string {
+		if data == nil {
+			return "-"
+		}
+		w := Word{}
+		if err := json.Unmarshal(data, &w); err != nil {
+			t.Fatal(err)
+		}
+		return w.Definition
+	}
+	strs := []string{}
+	for _, rev := range revs {
+		strs = append(strs, rev.Action+" "+def(rev.Before)+" "+def(rev.After))
+	}
+	return strs
+}
+
+func TestRevisions(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	now := time.Now()
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	for _, def := range []string{"a dog", "the dog"} {
+		def := def
+		_, err := db.editWord("spanish", &WordDiff{Id: perro.Id, Definition: &def}, 0, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.delWordById("spanish", perro.Id, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.restoreWord(perro.Id, now); err != nil {
+		t.Fatal(err)
+	}
+
+	revs, err := db.getWordHistory("spanish", perro.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"restore - the dog",
+		"delete the dog -",
+		"update a dog the dog",
+		"update dog a dog",
+		"insert - dog",
+	}
+	if got := revisionStrs(t, revs); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	for _, rev := range revs {
+		if rev.Kind != RevisionWord || rev.ItemId != perro.Id ||
+			rev.LangId != perro.LangId || rev.UserId != 0 || rev.CreatedAt != now.Unix() {
+			t.Errorf("unexpected revision: %+v", rev)
+		}
+	}
+
+	// Changes are recorded as made by the acting user.
+	alice, err := db.newUser("alice", "password123", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := "dog"
+	_, err = db.actingAs(alice.Id).editWord("spanish", &WordDiff{Id: perro.Id, Definition: &def}, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revs, err = db.getWordHistory("spanish", perro.Id)
+	if err != nil || revs[0].UserId != alice.Id || revs[0].Username != "alice" {
+		t.Errorf("unexpected revision: %+v (%v)", revs[0], err)
+	}
+
+	revs, err = db.getLangHistory("spanish")
+	if err != nil || len(revs) != 1 || revs[0].Action != RevisionInsert || revs[0].Kind != RevisionLang {
+		t.Errorf("unexpected language history: %+v (%v)", revs, err)
+	}
+	if _, err := db.getWordHistory("spanish", 999); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound, got %v", err)
+	}
+}
+
+func TestRevertWord(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	now := time.Now()
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	gato := addTestWord(t, db, "spanish", "gato", "cat")
+	for _, def := range []string{"a dog", "the dog"} {
+		def := def
+		_, err := db.editWord("spanish", &WordDiff{Id: perro.Id, Definition: &def}, 0, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	revs, err := db.getWordHistory("spanish", perro.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertRev, firstEdit := revs[2].Id, revs[1].Id
+
+	tests := []struct {
+		name   string
+		wordId int64
+		revId  int64
+		def    string
+		err    error
+		// The new revision.
+		rev string
+	}{
+		{"edit", perro.Id, firstEdit, "dog", nil, "update the dog dog"},
+		{"other word's revision", gato.Id, firstEdit, "", ErrNoRevisionFound, ""},
+		{"missing revision", perro.Id, 999, "", ErrNoRevisionFound, ""},
+		// Reverting the insert puts the word in the trash.
+		{"insert", perro.Id, insertRev, "dog", nil, "delete dog -"},
+		{"insert again", perro.Id, insertRev, "", ErrNoWordFound, ""},
+		// Reverting a word in the trash restores it.
+		{"in trash", perro.Id, firstEdit, "dog", nil, "restore - dog"},
+	}
+	for _, test := range tests {
+		word, err := db.revertWord("spanish", test.wordId, test.revId, now)
+		if test.err != nil {
+			if err != test.err {
+				t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+			}
+			continue
+		} else if err != nil || word.Definition != test.def {
+			t.Errorf("%s: expected definition %q, got %+v (%v)", test.name, test.def, word, err)
+			continue
+		}
+		revs, err := db.getWordHistory("spanish", test.wordId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := revisionStrs(t, revs[:1])[0]; got != test.rev || revs[0].RevertOf != test.revId {
+			t.Errorf("%s: expected revision %q reverting %d, got %q reverting %d", test.name, test.rev, test.revId, got, revs[0].RevertOf)
+		}
+	}
+	if _, err := db.getWordById("spanish", perro.Id); err != nil {
+		t.Errorf("expected word to be restored, got %v", err)
+	}
+}
+
+func TestHistoryHandlers(t *testing.T) {
+	srvr := newTestServer(t, newTestDb(t))
+	alice, bob := newTestClient(t, srvr), newTestClient(t, srvr)
+	alice.register("alice")
+	bob.register("bob")
+	if code := alice.do(http.MethodPost, "/langs", Lang{Name: "spanish"}, nil); code != http.StatusOK {
+		t.Fatalf("error creating language: %d", code)
+	}
+	wordResp := Response[Word]{}
+	if code := alice.do(http.MethodPost, "/langs/spanish/words", Word{Word: "perro", Definition: "dog"}, &wordResp); code != http.StatusOK {
+		t.Fatalf("error adding word: %d", code)
+	}
+	path := "/langs/spanish/words/" + jsonStr(wordResp.Content.Id)
+	if code := alice.do(http.MethodPatch, path, map[string]any{"definition": "a dog"}, nil); code != http.StatusOK {
+		t.Fatalf("error editing word: %d", code)
+	}
+	histResp := Response[[]Revision]{}
+	if code := alice.do(http.MethodGet, path+"/history", nil, &histResp); code != http.StatusOK {
+		t.Fatalf("error getting history: %d", code)
+	}
+	revs := histResp.Content
+	if got := revisionStrs(t, revs); len(revs) != 2 || got[0] != "update dog a dog" || revs[0].Username != "alice" {
+		t.Fatalf("unexpected history: %q %+v", got, revs)
+	}
+	revert := path + "/revert/" + jsonStr(revs[0].Id)
+
+	tests := []struct {
+		name   string
+		tc     *testClient
+		method string
+		path   string
+		code   int
+	}{
+		{"language history", alice, http.MethodGet, "/langs/spanish/history", http.StatusOK},
+		{"other user's history", bob, http.MethodGet, path + "/history", http.StatusBadRequest},
+		{"invalid word ID", alice, http.MethodGet, "/langs/spanish/words/x/history", http.StatusBadRequest},
+		{"other user reverts", bob, http.MethodPost, revert, http.StatusBadRequest},
+		{"invalid revision ID", alice, http.MethodPost, path + "/revert/x", http.StatusBadRequest},
+		{"missing revision", alice, http.MethodPost, path + "/revert/999", http.StatusBadRequest},
+		{"revert", alice, http.MethodPost, revert, http.StatusOK},
+	}
+	for _, test := range tests {
+		resp := Response[any]{}
+		if code := test.tc.do(test.method, test.path, nil, &resp); code != test.code {
+			t.Errorf("%s: expected %d, got %d (%s)", test.name, test.code, code, resp.Error)
+		}
+	}
+	wordResp = Response[Word]{}
+	if code := alice.do(http.MethodGet, "/langs/spanish/words/perro", nil, &wordResp); code != http.StatusOK || wordResp.Content.Definition != "dog" {
+		t.Errorf("expected reverted word, got %d %+v", code, wordResp.Content)
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Grade is how well a word was recalled during a review.
+type Grade int
+
+const (
+	GradeAgain Grade = iota + 1
+	GradeHard
+	GradeGood
+	GradeEasy
+)
+
+var gradeNames = [...]string{"", "again", "hard", "good", "easy"}
+
+func ParseGrade(s string) (Grade, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range gradeNames {
+		if i != 0 && s == name {
+			return Grade(i), nil
+		}
+	}
+	return 0, ErrInvalidGrade
+}
+
+func (g Grade) IsValid() bool {
+	return g >= GradeAgain && g <= GradeEasy
+}
+
+func (g Grade) String() string {
+	if !g.IsValid() {
+		return fmt.Sprintf("Grade(%d)", int(g))
+	}
+	return gradeNames[g]
+}
+
+func (g Grade) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.String())
+}
+
+// UnmarshalJSON accepts either the name of the grade or its number (1-4).
+func (g *Grade) UnmarshalJSON(b []byte) error {
+	s, n := "", 0
+	if err := json.Unmarshal(b, &s); err == nil {
+		grade, err := ParseGrade(s)
+		if err != nil {
+			return err
+		}
+		*g = grade
+		return nil
+	}
+	if err := json.Unmarshal(b, &n); err != nil {
+		return ErrInvalidGrade
+	}
+	if grade := Grade(n); grade.IsValid() {
+		*g = grade
+		return nil
+	}
+	return ErrInvalidGrade
+}
+
+// ReviewState is the spaced repetition state of a word. Intervals are in days
+// and times are unix timestamps (seconds).
+type ReviewState struct {
+	WordId      int64   `json:"wordId"`
+	Algorithm   string  `json:"algorithm"`
+	Ease        float64 `json:"ease"`
+	Interval    float64 `json:"interval"`
+	Repetitions int64   `json:"repetitions"`
+	Lapses      int64   `json:"lapses"`
+	Stability   float64 `json:"stability,omitempty"`
+	Difficulty  float64 `json:"difficulty,omitempty"`
+	Due         int64   `json:"due"`
+	LastReview  int64   `json:"lastReview,omitempty"`
+}
+
+// IsNew returns whether the word has never been reviewed.
+func (rs ReviewState) IsNew() bool {
+	return rs.LastReview == 0
+}
+
+// Scheduler schedules the next review of a word.
+type Scheduler interface {
+	Name() string
+	// Schedule returns the new state of the word after being reviewed with the
+	// given grade at the given time. The passed state may be from a different
+	// scheduler (or new).
+	Schedule(state ReviewState, grade Grade, now time.Time) ReviewState
+}
+
+const (
+	SchedulerSM2  = "sm2"
+	SchedulerFSRS = "fsrs"
+)
+
+func NewScheduler(name string) (Scheduler, error) {
+	switch strings.ToLower(name) {
+	case SchedulerSM2, "":
+		return SM2{}, nil
+	case SchedulerFSRS:
+		return FSRS{}, nil
+	}
+	return nil, fmt.Errorf("unknown scheduler: %s", name)
+}
+
+const (
+	sm2InitialEase = 2.5
+	sm2MinEase     = 1.3
+)
+
+// SM2 implements the SuperMemo 2 algorithm. The 4 grades are mapped to SM-2
+// qualities of 1 (again), 3 (hard), 4 (good), and 5 (easy).
+type SM2 struct{}
+
+func (SM2) Name() string {
+	return SchedulerSM2
+}
+
+func (SM2) Schedule(state ReviewState, grade Grade, now time.Time) ReviewState {
+	if state.Ease == 0 {
+		state.Ease = sm2InitialEase
+	}
+	q := float64(map[Grade]int{
+		GradeAgain: 1, GradeHard: 3, GradeGood: 4, GradeEasy: 5,
+	}[grade])
+
+	if grade == GradeAgain {
+		if !state.IsNew() {
+			state.Lapses++
+		}
+		state.Repetitions, state.Interval = 0, 1
+	} else {
+		switch state.Repetitions {
+		case 0:
+			state.Interval = 1
+		case 1:
+			state.Interval = 6
+		default:
+			state.Interval = math.Round(state.Interval * state.Ease)
+		}
+		state.Repetitions++
+	}
+	state.Ease += 0.1 - (5-q)*(0.08+(5-q)*0.02)
+	if state.Ease < sm2MinEase {
+		state.Ease = sm2MinEase
+	}
+
+	state.Algorithm = SchedulerSM2
+	state.LastReview = now.Unix()
+	state.Due = now.Add(daysToDuration(state.Interval)).Unix()
+	return state
+}
+
+// Default FSRS-4.5 parameters.
+var fsrsWeights = [17]float64{
+	0.4872, 1.4003, 3.7145, 13.8206, 5.1618, 1.2298, 0.8975, 0.031, 1.6474,
+	0.1367, 1.0461, 2.1072, 0.0793, 0.3246, 1.587, 0.2272, 2.8755,
+}
+
+const (
+	fsrsDecay = -0.5
+	// Chosen so that R(S, S) = 0.9.
+	fsrsFactor           = 19.0 / 81.0
+	fsrsDesiredRetention = 0.9
+	fsrsMaxInterval      = 36500
+)
+
+// FSRS implements the Free Spaced Repetition Scheduler (v4.5) with the default
+// parameters and a desired retention of 90%. Ease is unused. States from SM-2
+// are converted by treating the interval as the stability.
+type FSRS struct{}
+
+func (FSRS) Name() string {
+	return SchedulerFSRS
+}
+
+func (f FSRS) Schedule(state ReviewState, grade Grade, now time.Time) ReviewState {
+	w := fsrsWeights
+	g := float64(grade)
+
+	if state.Algorithm != SchedulerFSRS && !state.IsNew() {
+		state.Stability = math.Max(state.Interval, w[0])
+		state.Difficulty = f.initDifficulty(float64(GradeGood))
+	}
+
+	if state.IsNew() || state.Stability == 0 {
+		state.Stability = w[grade-1]
+		state.Difficulty = f.initDifficulty(g)
+	} else {
+		elapsed := now.Sub(time.Unix(state.LastReview, 0)).Hours() / 24
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		r := math.Pow(1+fsrsFactor*elapsed/state.Stability, fsrsDecay)
+		d, s := state.Difficulty, state.Stability
+		if grade == GradeAgain {
+			state.Stability = w[11] * math.Pow(d, -w[12]) *
+				(math.Pow(s+1, w[13]) - 1) * math.Exp(w[14]*(1-r))
+			state.Lapses++
+		} else {
+			mult := 1.0
+			if grade == GradeHard {
+				mult = w[15]
+			} else if grade == GradeEasy {
+				mult = w[16]
+			}
+			state.Stability = s * (math.Exp(w[8])*(11-d)*math.Pow(s, -w[9])*
+				(math.Exp(w[10]*(1-r))-1)*mult + 1)
+		}
+		d -= w[6] * (g - 3)
+		state.Difficulty = clampFloat(
+			w[7]*f.initDifficulty(float64(GradeGood))+(1-w[7])*d, 1, 10,
+		)
+	}
+
+	if grade == GradeAgain {
+		state.Repetitions = 0
+	} else {
+		state.Repetitions++
+	}
+	interval := state.Stability / fsrsFactor *
+		(math.Pow(fsrsDesiredRetention, 1/fsrsDecay) - 1)
+	state.Interval = clampFloat(math.Round(interval), 1, fsrsMaxInterval)
+
+	state.Algorithm = SchedulerFSRS
+	state.LastReview = now.Unix()
+	state.Due = now.Add(daysToDuration(state.Interval)).Unix()
+	return state
+}
+
+func (FSRS) initDifficulty(g float64) float64 {
+	return clampFloat(fsrsWeights[4]-(g-3)*fsrsWeights[5], 1, 10)
+}
+
+func daysToDuration(days float64) time.Duration {
+	return time.Duration(days * float64(24*time.Hour))
+}
+
+func clampFloat(f, min, max float64) float64 {
+	return math.Max(min, math.Min(max, f))
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseGrade(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Grade
+		err  error
+	}{
+		{"again", GradeAgain, nil},
+		{" Hard ", GradeHard, nil},
+		{"GOOD", GradeGood, nil},
+		{"easy", GradeEasy, nil},
+		{"", 0, ErrInvalidGrade},
+		{"great", 0, ErrInvalidGrade},
+	}
+	for _, test := range tests {
+		grade, err := ParseGrade(test.s)
+		if grade != test.want || err != test.err {
+			t.Errorf(
+				"ParseGrade(%q): expected %v (%v), got %v (%v)",
+				test.s, test.want, test.err, grade, err,
+			)
+		}
+	}
+}
+
+func TestGradeJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want Grade
+		ok   bool
+	}{
+		{`"good"`, GradeGood, true},
+		{`"Easy"`, GradeEasy, true},
+		{`1`, GradeAgain, true},
+		{`4`, GradeEasy, true},
+		{`0`, 0, false},
+		{`5`, 0, false},
+		{`"meh"`, 0, false},
+		{`true`, 0, false},
+	}
+	for _, test := range tests {
+		var grade Grade
+		err := json.Unmarshal([]byte(test.json), &grade)
+		if (err == nil) != test.ok || grade != test.want {
+			t.Errorf(
+				"unmarshal %s: expected %v (ok=%v), got %v (%v)",
+				test.json, test.want, test.ok, grade, err,
+			)
+		}
+	}
+
+	b, err := json.Marshal(GradeHard)
+	if err != nil || string(b) != `"hard"` {
+		t.Errorf(`expected "hard", got %s (%v)`, b, err)
+	}
+}
+
+func TestNewScheduler(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"", SchedulerSM2},
+		{"sm2", SchedulerSM2},
+		{"FSRS", SchedulerFSRS},
+		{"leitner", ""},
+	}
+	for _, test := range tests {
+		sched, err := NewScheduler(test.name)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("expected error for scheduler %q", test.name)
+			}
+		} else if err != nil || sched.Name() != test.want {
+			t.Errorf("NewScheduler(%q): expected %s, got %v", test.name, test.want, err)
+		}
+	}
+}
+
+// A sequence of reviews and the state expected after each.
+type scheduleStep struct {
+	grade       Grade
+	interval    float64
+	ease        float64
+	stability   float64
+	difficulty  float64
+	repetitions int64
+	lapses      int64
+}
+
+func runScheduleSteps(t *testing.T, sched Scheduler, steps []scheduleStep) {
+	t.Helper()
+	now := time.Unix(1_700_000_000, 0)
+	state := ReviewState{WordId: 1}
+	for i, step := range steps {
+		state = sched.Schedule(state, step.grade, now)
+		if state.Interval != step.interval ||
+			!approxEqual(state.Ease, step.ease) ||
+			!approxEqual(state.Stability, step.stability) ||
+			!approxEqual(state.Difficulty, step.difficulty) ||
+			state.Repetitions != step.repetitions || state.Lapses != step.lapses {
+			t.Fatalf("step %d (%v): expected %+v, got %+v", i, step.grade, step, state)
+		}
+		if state.Algorithm != sched.Name() || state.LastReview != now.Unix() ||
+			state.Due != now.Add(daysToDuration(state.Interval)).Unix() {
+			t.Fatalf("step %d: unexpected times or algorithm: %+v", i, state)
+		}
+		// Each review happens when the word is due.
+		now = time.Unix(state.Due, 0)
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-4
+}
+
+func TestSM2(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []scheduleStep
+	}{
+		{"good", []scheduleStep{
+			{grade: GradeGood, interval: 1, ease: 2.5, repetitions: 1},
+			{grade: GradeGood, interval: 6, ease: 2.5, repetitions: 2},
+			{grade: GradeGood, interval: 15, ease: 2.5, repetitions: 3},
+			{grade: GradeGood, interval: 38, ease: 2.5, repetitions: 4},
+		}},
+		{"easy and hard", []scheduleStep{
+			{grade: GradeEasy, interval: 1, ease: 2.6, repetitions: 1},
+			{grade: GradeEasy, interval: 6, ease: 2.7, repetitions: 2},
+			{grade: GradeHard, interval: 16, ease: 2.56, repetitions: 3},
+		}},
+		{"lapse", []scheduleStep{
+			// Failing a new word isn't a lapse.
+			{grade: GradeAgain, interval: 1, ease: 1.96},
+			{grade: GradeGood, interval: 1, ease: 1.96, repetitions: 1},
+			{grade: GradeAgain, interval: 1, ease: 1.42, lapses: 1},
+			// The ease doesn't go below the min.
+			{grade: GradeAgain, interval: 1, ease: sm2MinEase, lapses: 2},
+			{grade: GradeGood, interval: 1, ease: sm2MinEase, repetitions: 1, lapses: 2},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runScheduleSteps(t, SM2{}, test.steps)
+		})
+	}
+}
+
+func TestFSRS(t *testing.T) {
+	w := fsrsWeights
+	tests := []struct {
+		name  string
+		steps []scheduleStep
+	}{
+		// With a desired retention of 90%, the interval is the stability.
+		{"first review", []scheduleStep{
+			{grade: GradeEasy, interval: 14, stability: w[3], difficulty: 3.932, repetitions: 1},
+		}},
+		{"good", []scheduleStep{
+			{grade: GradeGood, interval: 4, stability: w[2], difficulty: w[4], repetitions: 1},
+			{grade: GradeGood, interval: 15, stability: 14.8081, difficulty: w[4], repetitions: 2},
+		}},
+		{"lapse", []scheduleStep{
+			{grade: GradeGood, interval: 4, stability: w[2], difficulty: w[4], repetitions: 1},
+			{grade: GradeAgain, interval: 1, stability: 1.4332, difficulty: 6.9012, lapses: 1},
+		}},
+		{"again", []scheduleStep{
+			{grade: GradeAgain, interval: 1, stability: w[0], difficulty: 7.6214},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runScheduleSteps(t, FSRS{}, test.steps)
+		})
+	}
+}
+
+// States from SM-2 are converted, using the interval as the stability.
+func TestFSRSFromSM2(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	state := ReviewState{
+		Algorithm: SchedulerSM2, Ease: 2.5, Interval: 6, Repetitions: 2,
+		LastReview: now.Add(-6 * 24 * time.Hour).Unix(),
+	}
+	state = FSRS{}.Schedule(state, GradeGood, now)
+	if state.Algorithm != SchedulerFSRS || state.Repetitions != 3 ||
+		state.Stability <= 6 || state.Interval <= 6 {
+		t.Errorf("unexpected state: %+v", state)
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	jmux "github.com/johnietre/go-jmux"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Matches on the word itself are weighted most, followed by aliases, the
+// definition, then notes (the column order is word, definition, notes,
+// aliases).
+const ftsRank = `bm25(words_fts, 10.0, 2.0, 1.0, 5.0)`
+
+// Handles searches across all languages (/search) and a single language
+// (/langs/{lang}/search).
+func (s *Server) searchHandler(c *jmux.Context) {
+	lang, query := c.Params["lang"], c.Query().Get("q")
+	limit := defaultSearchLimit
+	if limitStr := c.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			c.WriteError(http.StatusBadRequest, "invalid value for 'limit'")
+			return
+		}
+		if l > maxSearchLimit {
+			l = maxSearchLimit
+		}
+		limit = l
+	}
+
+	results, err := s.userDb(c).searchWords(lang, query, limit)
+	code, resp := http.StatusOK, Response[[]SearchResult]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else if results == nil {
+			log.Printf("error searching for %q in lang %q: %v", query, lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		} else {
+			resp.Error = "partial internal server error"
+		}
+	}
+	resp.Content = results
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+type SearchResult struct {
+	Word Word `json:"word"`
+	// Snippet is the best matching part of the word as HTML, with the matching
+	// terms surrounded by <mark></mark> (the rest of the text is escaped).
+	Snippet string `json:"snippet"`
+	// Rank is the bm25 rank of the result; lower is better.
+	Rank float64 `json:"rank"`
+}
+
+// Searches the words, definitions, notes, and aliases of words in the given
+// language, or all languages if lang is empty. Results are ordered by rank.
+func (db *DB) searchWords(
+	lang, query string,
+	limit int,
+) ([]SearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, ErrInvalidQuery
+	}
+
+	stmt := `SELECT ` + wordCols + `,
+  snippet(words_fts, -1, ?, ?, '…', 12), ` + ftsRank + `
+FROM words_fts JOIN words ON words.id=words_fts.rowid
+WHERE words_fts MATCH ?`
+	args := []any{snippetStart, snippetEnd, match}
+	if lang != "" {
+		langId, err := db.getLangId(lang)
+		if err != nil {
+			return nil, err
+		}
+		stmt += ` AND words.lang_id=? AND words.deleted_at IS NULL`
+		args = append(args, langId)
+	} else {
+		cond, condArgs := db.wordsCond()
+		stmt += ` AND ` + cond
+		args = append(args, condArgs...)
+	}
+	stmt += ` ORDER BY ` + ftsRank + ` LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		res, e := scanSearchResult(rows)
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+		} else {
+			results = append(results, res)
+		}
+	}
+	return results, err
+}
+
+func scanSearchResult(dbs DBScanner) (res SearchResult, err error) {
+	res.Word, err = scanWord(scannerFunc(func(dest ...any) error {
+		return dbs.Scan(append(dest, &res.Snippet, &res.Rank)...)
+	}))
+	res.Snippet = snippetHTML(res.Snippet)
+	return
+}
+
+// The markers FTS5 puts around matching terms in snippets. They're private use
+// characters so they can be told apart from the text, which is escaped before
+// they're replaced with tags.
+const snippetStart, snippetEnd = "\ue000", "\ue001"
+
+var snippetReplacer = strings.NewReplacer(
+	snippetStart, "<mark>", snippetEnd, "</mark>",
+)
+
+// Converts a snippet with the markers into HTML.
+func snippetHTML(snippet string) string {
+	return snippetReplacer.Replace(html.EscapeString(snippet))
+}
+
+// Converts free text into an FTS5 query, quoting each term so that user input
+// can't be interpreted as query syntax. Each term is treated as a prefix and
+// all terms must match.
+func ftsQuery(query string) string {
+	terms := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsMark(r) &&
+			!unicode.IsNumber(r) && r != '\''
+	})
+	for i, term := range terms {
+		terms[i] = `"` + term + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// scannerFunc allows a function to be used as a DBScanner.
+type scannerFunc func(...any) error
+
+func (f scannerFunc) Scan(dest ...any) error {
+	return f(dest...)
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFtsQuery(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"", ""},
+		{"  ", ""},
+		{"kitchen", `"kitchen"*`},
+		{"big kitchen", `"big"* "kitchen"*`},
+		{`"kitchen" OR NOT*`, `"kitchen"* "OR"* "NOT"*`},
+		{"l'eau", `"l'eau"*`},
+		{"café-crème", `"café"* "crème"*`},
+		{"(a) NEAR(b)", `"a"* "NEAR"* "b"*`},
+		{"***", ""},
+	}
+	for _, test := range tests {
+		if got := ftsQuery(test.query); got != test.want {
+			t.Errorf("ftsQuery(%q): expected %q, got %q", test.query, test.want, got)
+		}
+	}
+}
+
+func TestSnippetHTML(t *testing.T) {
+	tests := []struct {
+		snippet, want string
+	}{
+		{"plain", "plain"},
+		{"a " + snippetStart + "dog" + snippetEnd + " barks", "a <mark>dog</mark> barks"},
+		{
+			"<img onerror=alert(1)> " + snippetStart + "dog" + snippetEnd,
+			"&lt;img onerror=alert(1)&gt; <mark>dog</mark>",
+		},
+		{"<mark>&</mark>", "&lt;mark&gt;&amp;&lt;/mark&gt;"},
+	}
+	for _, test := range tests {
+		if got := snippetHTML(test.snippet); got != test.want {
+			t.Errorf("snippetHTML(%q): expected %q, got %q", test.snippet, test.want, got)
+		}
+	}
+}
+
+func TestSearchWords(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	addTestLang(t, db, "french")
+	cocina := addTestWord(t, db, "spanish", "cocina", "kitchen")
+	horno := addTestWord(t, db, "spanish", "horno", "the oven in a kitchen")
+	addTestWord(t, db, "spanish", "perro", "<img src=x onerror=alert(1)> dog")
+	cuisine := addTestWord(t, db, "french", "cuisine", "kitchen")
+
+	ids := func(results []SearchResult) []int64 {
+		ids := []int64{}
+		for _, res := range results {
+			ids = append(ids, res.Word.Id)
+		}
+		return ids
+	}
+	// The results are compared in order, so each test's results must have
+	// different ranks.
+	tests := []struct {
+		lang, query string
+		want        []int64
+	}{
+		{"spanish", "kitchen", []int64{cocina.Id, horno.Id}},
+		{"spanish", "kitch", []int64{cocina.Id, horno.Id}},
+		{"spanish", "oven kitchen", []int64{horno.Id}},
+		{"spanish", "coc", []int64{cocina.Id}},
+		{"spanish", "cat", []int64{}},
+		{"french", "kitchen", []int64{cuisine.Id}},
+		{"", "oven", []int64{horno.Id}},
+		{"", "cuis", []int64{cuisine.Id}},
+	}
+	for _, test := range tests {
+		results, err := db.searchWords(test.lang, test.query, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(results); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf(
+				"search %q in %q: expected %v, got %v",
+				test.query, test.lang, test.want, got,
+			)
+		}
+	}
+
+	if _, err := db.searchWords("spanish", "  ", 10); err != ErrInvalidQuery {
+		t.Errorf("expected ErrInvalidQuery, got %v", err)
+	}
+
+	results, err := db.searchWords("spanish", "dog", 10)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d (%v)", len(results), err)
+	}
+	snippet := results[0].Snippet
+	if strings.Contains(snippet, "<img") || !strings.Contains(snippet, "<mark>dog</mark>") {
+		t.Errorf("snippet isn't escaped: %q", snippet)
+	}
+
+	// Edits and deletes are reflected in the index.
+	def := "stove"
+	if _, err := db.editWord(
+		"spanish", &WordDiff{Id: horno.Id, Definition: &def}, 0, time.Now(),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.delWordById("spanish", cocina.Id, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	results, err = db.searchWords("spanish", "kitchen", 10)
+	if err != nil || len(results) != 0 {
+		t.Errorf("expected no results after edits, got %v (%v)", ids(results), err)
+	}
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+)
+
+// Sense is one of the meanings of a word.
+type Sense struct {
+	Id         int64  `json:"id,omitempty"`
+	Definition string `json:"definition"`
+	// Pos is the part of speech of the sense (one of PartsOfSpeech).
+	Pos      string    `json:"pos,omitempty"`
+	Examples []Example `json:"examples,omitempty"`
+}
+
+// Example is an example sentence using a sense of a word.
+type Example struct {
+	Sentence    string `json:"sentence"`
+	Translation string `json:"translation,omitempty"`
+}
+
+// Returns a copy of the sense with its fields normalized (without its ID).
+func (s Sense) normalized() Sense {
+	sense := Sense{
+		Definition: normalizeText(s.Definition),
+		Pos:        normalizeMetaValue(s.Pos),
+	}
+	for _, ex := range s.Examples {
+		sense.Examples = append(sense.Examples, Example{
+			Sentence:    normalizeText(ex.Sentence),
+			Translation: normalizeText(ex.Translation),
+		})
+	}
+	return sense
+}
+
+// Checks the (normalized) sense, which must have a definition, and examples
+// with sentences.
+func (s Sense) check() error {
+	if s.Definition == "" {
+		return fmt.Errorf("%w: missing definition", ErrInvalidSense)
+	}
+	for _, ex := range s.Examples {
+		if ex.Sentence == "" {
+			return fmt.Errorf("%w: examples must have a sentence", ErrInvalidSense)
+		}
+	}
+	return checkMetaValue("part of speech", s.Pos, PartsOfSpeech)
+}
+
+// ReorderSensesRequest gives the new order of a word's senses, which must
+// contain the IDs of all of them.
+type ReorderSensesRequest struct {
+	Order []int64 `json:"order"`
+}
+
+// Adds a sense to the end of the word's senses, returning the updated word.
+func (s *Server) addSenseHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	wordId, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	sense := Sense{}
+	if err := c.ReadBodyJSON(&sense); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	code, resp := http.StatusOK, Response[Word]{}
+	word, err := s.userDb(c).addSense(lang, wordId, &sense)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error adding sense to word %d: %v", wordId, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = word
+		c.RespHeader().Set("ETag", versionETag(word.Version))
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Reorders the word's senses, returning the updated word.
+func (s *Server) reorderSensesHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	wordId, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	req := ReorderSensesRequest{}
+	if err := c.ReadBodyJSON(&req); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	code, resp := http.StatusOK, Response[Word]{}
+	word, err := s.userDb(c).reorderSenses(lang, wordId, req.Order)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error reordering senses of word %d: %v", wordId, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = word
+		c.RespHeader().Set("ETag", versionETag(word.Version))
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Removes the sense from the word, returning the updated word.
+func (s *Server) delSenseHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	wordId, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	senseId, err := strconv.ParseInt(c.Params["sense"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid sense ID"))
+		return
+	}
+
+	code, resp := http.StatusOK, Response[Word]{}
+	word, err := s.userDb(c).delSense(lang, wordId, senseId)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error deleting sense %d of word %d: %v", senseId, wordId, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = word
+		c.RespHeader().Set("ETag", versionETag(word.Version))
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Selects a word's senses (with their examples) as a JSON array. Used as part
+// of wordCols.
+const senseCol = `(
+  SELECT json_group_array(json_object(
+    'id',s.id,'definition',s.definition,'pos',s.pos,'examples',json((
+      SELECT json_group_array(json_object(
+        'sentence',sentence,'translation',translation
+      )) FROM (
+        SELECT sentence,translation FROM sense_examples
+        WHERE sense_id=s.id ORDER BY idx
+      )
+    ))
+  )) FROM (
+    SELECT id,definition,pos FROM word_senses
+    WHERE word_id=words.id ORDER BY idx
+  ) AS s
+)`
+
+// Decodes the senses selected by senseCol.
+func sensesFromJson(sensesJson string) ([]Sense, error) {
+	senses := []Sense{}
+	if err := json.Unmarshal([]byte(sensesJson), &senses); err != nil {
+		return nil, err
+	}
+	for i := range senses {
+		if len(senses[i].Examples) == 0 {
+			senses[i].Examples = nil
+		}
+	}
+	if len(senses) == 0 {
+		return nil, nil
+	}
+	return senses, nil
+}
+
+// Inserts the (normalized and valid) sense at the end of the word's senses,
+// setting its ID.
+func insertSense(ex DBExecer, wordId int64, sense *Sense) error {
+	res, err := ex.Exec(
+		`INSERT INTO word_senses(word_id,idx,definition,pos)
+    VALUES (?,(
+      SELECT IFNULL(MAX(idx)+1,0) FROM word_senses WHERE word_id=?
+    ),?,?)`,
+		wordId, wordId, sense.Definition, sense.Pos,
+	)
+	if err != nil {
+		return err
+	}
+	if sense.Id, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	for i, example := range sense.Examples {
+		_, err := ex.Exec(
+			`INSERT INTO sense_examples(sense_id,idx,sentence,translation)
+      VALUES (?,?,?,?)`,
+			sense.Id, i, example.Sentence, example.Translation,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) addSense(lang string, wordId int64, sense *Sense) (Word, error) {
+	newSense := sense.normalized()
+	if err := newSense.check(); err != nil {
+		return Word{}, err
+	}
+	return db.editSenses(lang, wordId, func(tx *sql.Tx) error {
+		if err := insertSense(tx, wordId, &newSense); err != nil {
+			return err
+		}
+		*sense = newSense
+		return nil
+	})
+}
+
+// Reorders the word's senses, returning ErrInvalidSenseOrder if the order
+// doesn't contain the IDs of all of the word's senses exactly once.
+func (db *DB) reorderSenses(lang string, wordId int64, order []int64) (Word, error) {
+	return db.editSenses(lang, wordId, func(tx *sql.Tx) error {
+		seen := map[int64]bool{}
+		for i, id := range order {
+			if seen[id] {
+				return fmt.Errorf("%w: duplicate ID %d", ErrInvalidSenseOrder, id)
+			}
+			seen[id] = true
+			res, err := tx.Exec(
+				`UPDATE word_senses SET idx=? WHERE id=? AND word_id=?`,
+				i, id, wordId,
+			)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				return fmt.Errorf("%w: unknown ID %d", ErrInvalidSenseOrder, id)
+			}
+		}
+		var count int
+		err := tx.QueryRow(
+			`SELECT COUNT(*) FROM word_senses WHERE word_id=?`, wordId,
+		).Scan(&count)
+		if err != nil {
+			return err
+		} else if count != len(order) {
+			return fmt.Errorf("%w: missing IDs", ErrInvalidSenseOrder)
+		}
+		return nil
+	})
+}
+
+func (db *DB) delSense(lang string, wordId, senseId int64) (Word, error) {
+	return db.editSenses(lang, wordId, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`DELETE FROM word_senses WHERE id=? AND word_id=?`, senseId, wordId,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNoSenseFound
+		}
+		return nil
+	})
+}
+
+// Makes changes to the word's senses in a transaction, incrementing the word's
+// version, and returns the updated word.
+func (db *DB) editSenses(
+	lang string,
+	wordId int64,
+	edit func(tx *sql.Tx) error,
+) (Word, error) {
+	if _, err := db.getWordById(lang, wordId); err != nil {
+		return Word{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Word{}, err
+	}
+	defer tx.Rollback()
+
+	if err := edit(tx); err != nil {
+		return Word{}, err
+	}
+	_, err = tx.Exec(`UPDATE words SET version=version+1 WHERE id=?`, wordId)
+	if err != nil {
+		return Word{}, err
+	}
+	word, err := scanWord(tx.QueryRow(
+		`SELECT `+wordCols+` FROM words WHERE id=?`, wordId,
+	))
+	if err != nil {
+		return Word{}, err
+	}
+	return word, tx.Commit()
+}
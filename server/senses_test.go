@@ -0,0 +1,174 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSenseCheck(t *testing.T) {
+	tests := []struct {
+		sense Sense
+		ok    bool
+	}{
+		{Sense{Definition: " bank ", Pos: " Noun "}, true},
+		{Sense{Definition: "bench", Examples: []Example{{Sentence: "Me siento en el banco."}}}, true},
+		{Sense{Definition: " "}, false},
+		{Sense{Definition: "bank", Pos: "thing"}, false},
+		{Sense{Definition: "bank", Examples: []Example{{Translation: "the bank"}}}, false},
+	}
+	for _, test := range tests {
+		err := test.sense.normalized().check()
+		if test.ok && err != nil {
+			t.Errorf("%+v: unexpected error: %v", test.sense, err)
+		} else if !test.ok && !errors.Is(err, ErrInvalidSense) && !errors.Is(err, ErrInvalidWordMeta) {
+			t.Errorf("%+v: expected invalid sense, got %v", test.sense, err)
+		}
+	}
+	sense := Sense{Id: 3, Definition: " a bank ", Pos: "NOUN"}.normalized()
+	if sense.Id != 0 || sense.Definition != "a bank" || sense.Pos != "noun" {
+		t.Errorf("unexpected normalized sense: %+v", sense)
+	}
+}
+
+// Returns the definitions of the word's senses, in order.
+func senseDefs(word Word) []string {
+	defs := []string{}
+	for _, sense := range word.Senses {
+		defs = append(defs, sense.Definition)
+	}
+	return defs
+}
+
+func TestSenses(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	now := time.Now()
+	banco := Word{Word: "banco", Senses: []Sense{
+		{Definition: "bank", Pos: "noun", Examples: []Example{
+			{Sentence: "Voy al banco.", Translation: "I'm going to the bank."},
+			{Sentence: "El banco cierra."},
+		}},
+	}}
+	if err := db.addWord("spanish", &banco, now); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.getWordById("spanish", banco.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Senses) != 1 || len(got.Senses[0].Examples) != 2 ||
+		got.Senses[0].Examples[1] != (Example{Sentence: "El banco cierra."}) {
+		t.Fatalf("unexpected senses: %+v", got.Senses)
+	}
+	bank := got.Senses[0]
+
+	bench := Sense{Definition: "bench"}
+	word, err := db.addSense("spanish", banco.Id, &bench)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bench.Id == 0 || word.Version != 2 || fmt.Sprint(senseDefs(word)) != "[bank bench]" {
+		t.Errorf("unexpected word after adding sense: %+v", word)
+	}
+	if word.Senses[1].Examples != nil {
+		t.Errorf("expected no examples, got %+v", word.Senses[1].Examples)
+	}
+	if _, err := db.addSense("spanish", banco.Id, &Sense{}); !errors.Is(err, ErrInvalidSense) {
+		t.Errorf("expected ErrInvalidSense, got %v", err)
+	}
+	if _, err := db.addSense("spanish", 999, &Sense{Definition: "x"}); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound, got %v", err)
+	}
+
+	orderTests := []struct {
+		order []int64
+		ok    bool
+	}{
+		{[]int64{bench.Id, bank.Id}, true},
+		{[]int64{bench.Id}, false},
+		{[]int64{bench.Id, bench.Id}, false},
+		{[]int64{bench.Id, bank.Id, 999}, false},
+	}
+	for _, test := range orderTests {
+		_, err := db.reorderSenses("spanish", banco.Id, test.order)
+		if test.ok && err != nil {
+			t.Errorf("reorderSenses(%v): unexpected error: %v", test.order, err)
+		} else if !test.ok && !errors.Is(err, ErrInvalidSenseOrder) {
+			t.Errorf("reorderSenses(%v): expected ErrInvalidSenseOrder, got %v", test.order, err)
+		}
+	}
+	// Failed reorders are rolled back.
+	got, err = db.getWordById("spanish", banco.Id)
+	if err != nil || fmt.Sprint(senseDefs(got)) != "[bench bank]" || got.Version != 3 {
+		t.Errorf("unexpected word after reordering: %+v (%v)", got, err)
+	}
+
+	word, err = db.delSense("spanish", banco.Id, bench.Id)
+	if err != nil || fmt.Sprint(senseDefs(word)) != "[bank]" {
+		t.Errorf("unexpected word after deleting sense: %+v (%v)", word, err)
+	}
+	if _, err := db.delSense("spanish", banco.Id, bench.Id); err != ErrNoSenseFound {
+		t.Errorf("expected ErrNoSenseFound, got %v", err)
+	}
+	// Senses can't be deleted through other words.
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	if _, err := db.delSense("spanish", perro.Id, bank.Id); err != ErrNoSenseFound {
+		t.Errorf("expected ErrNoSenseFound, got %v", err)
+	}
+}
+
+func TestSenseHandlers(t *testing.T) {
+	srvr := newTestServer(t, newTestDb(t))
+	alice, bob := newTestClient(t, srvr), newTestClient(t, srvr)
+	alice.register("alice")
+	bob.register("bob")
+	if code := alice.do(http.MethodPost, "/langs", Lang{Name: "spanish"}, nil); code != http.StatusOK {
+		t.Fatalf("error creating language: %d", code)
+	}
+	resp := Response[Word]{}
+	if code := alice.do(http.MethodPost, "/langs/spanish/words", Word{Word: "banco"}, &resp); code != http.StatusOK {
+		t.Fatalf("error adding word: %d", code)
+	}
+	path := "/langs/spanish/words/" + jsonStr(resp.Content.Id) + "/senses"
+
+	senseIds := []int64{}
+	for _, def := range []string{"bank", "bench"} {
+		resp := Response[Word]{}
+		if code := alice.do(http.MethodPost, path, Sense{Definition: def}, &resp); code != http.StatusOK {
+			t.Fatalf("error adding sense: %d %s", code, resp.Error)
+		}
+		senseIds = append(senseIds, resp.Content.Senses[len(resp.Content.Senses)-1].Id)
+	}
+	order := ReorderSensesRequest{Order: []int64{senseIds[1], senseIds[0]}}
+
+	tests := []struct {
+		name   string
+		tc     *testClient
+		method string
+		path   string
+		body   any
+		code   int
+		want   string
+	}{
+		{"invalid sense", alice, http.MethodPost, path, Sense{}, http.StatusBadRequest, ""},
+		{"other user adds", bob, http.MethodPost, path, Sense{Definition: "x"}, http.StatusBadRequest, ""},
+		{"other user reorders", bob, http.MethodPut, path, order, http.StatusBadRequest, ""},
+		{"reorder", alice, http.MethodPut, path, order, http.StatusOK, "[bench bank]"},
+		{"invalid order", alice, http.MethodPut, path, ReorderSensesRequest{}, http.StatusBadRequest, ""},
+		{"invalid sense ID", alice, http.MethodDelete, path + "/x", nil, http.StatusBadRequest, ""},
+		{"delete", alice, http.MethodDelete, path + "/" + jsonStr(senseIds[1]), nil, http.StatusOK, "[bank]"},
+		{"delete again", alice, http.MethodDelete, path + "/" + jsonStr(senseIds[1]), nil, http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		resp := Response[Word]{}
+		code := test.tc.do(test.method, test.path, test.body, &resp)
+		if code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, code)
+		} else if test.want != "" && fmt.Sprint(senseDefs(resp.Content)) != test.want {
+			t.Errorf("%s: expected senses %s, got %v", test.name, test.want, senseDefs(resp.Content))
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
@@ -12,12 +14,15 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 
 	jmux "github.com/johnietre/go-jmux"
 	jtutils "github.com/johnietre/utils/go"
 	sqlite3 "github.com/mattn/go-sqlite3"
 	"github.com/spf13/cobra"
+	"golang.org/x/text/language"
 )
 
 func Run() {
@@ -36,10 +41,31 @@ func MakeCmd() *cobra.Command {
 	flags := cmd.Flags()
 	flags.IP("ip", net.IPv4(127, 0, 0, 1), "IP address to use")
 	flags.Uint16("port", 8000, "Port to use")
-	flags.String("db", "lively-langs.db", "Path to database")
+	flags.String(
+		"db", "lively-langs.db",
+		"Path to database (:memory: for a demo that isn't saved)",
+	)
 	flags.String("templates", "./templates", "Path to templates dir")
 	flags.String("static", "./static", "Path to static dir")
+	flags.String(
+		"media", "", "Path to the dir uploads are stored in (default next to static)",
+	)
+	flags.String(
+		"backup-dir", "", "Path to the dir backups are stored in (default next to db)",
+	)
+	flags.Duration(
+		"backup-interval", 0, "How often to back up the database (0 = never)",
+	)
+	flags.Int("backup-keep", 7, "Number of backups to keep (0 = all)")
+	flags.Int(
+		"trash-days", 30,
+		"Days deleted languages and words are kept in the trash (0 = forever)",
+	)
 	flags.String("log", "", "Log file (empty = stderr)")
+	flags.String(
+		"scheduler", SchedulerSM2,
+		"Spaced repetition scheduler to use for reviews (sm2 or fsrs)",
+	)
 
 	return cmd
 }
@@ -65,6 +91,13 @@ func run(cmd *cobra.Command, _ []string) {
 		DbPath:     jtutils.First(flags.GetString("db")),
 		TmplsPath:  jtutils.First(flags.GetString("templates")),
 		StaticPath: jtutils.First(flags.GetString("static")),
+		MediaPath:  jtutils.First(flags.GetString("media")),
+		Scheduler:  jtutils.First(flags.GetString("scheduler")),
+
+		BackupDir:      jtutils.First(flags.GetString("backup-dir")),
+		BackupInterval: jtutils.First(flags.GetDuration("backup-interval")),
+		BackupKeep:     jtutils.First(flags.GetInt("backup-keep")),
+		TrashDays:      jtutils.First(flags.GetInt("trash-days")),
 	}
 	if err := srvr.Init(); err != nil {
 		log.Fatal("error initializing server: ", err)
@@ -79,12 +112,39 @@ func run(cmd *cobra.Command, _ []string) {
 }
 
 type Server struct {
+	// DbPath is the path to the database. If it's ":memory:", the server runs
+	// in demo mode, with the database kept in memory and nothing saved.
 	DbPath     string
 	TmplsPath  string
 	StaticPath string
-
-	db    *DB
-	tmpls *jtutils.AValue[TemplateMap]
+	// MediaPath is the dir uploaded media is stored in (defaults to "media"
+	// next to the static dir).
+	MediaPath string
+	// Scheduler is the name of the spaced repetition scheduler to use
+	// (defaults to SM-2).
+	Scheduler string
+	// BackupDir is the dir backups are stored in (defaults to "backups" next
+	// to the database).
+	BackupDir string
+	// BackupInterval is how often the database is backed up. Backups are only
+	// made on request if it's 0.
+	BackupInterval time.Duration
+	// BackupKeep is the number of backups to keep. All are kept if it's 0.
+	BackupKeep int
+	// TrashDays is the number of days deleted languages and words are kept in
+	// the trash before they're purged. They're kept forever if it's 0.
+	TrashDays int
+
+	db *DB
+	// store is what languages and words are accessed through (db).
+	store     Store
+	scheduler Scheduler
+	media     mediaStore
+	tmpls     *jtutils.AValue[TemplateMap]
+	backupMtx sync.Mutex
+	// mediaMtx serializes saving media for words with pruning media so that a
+	// saved file isn't removed before the word using it is committed.
+	mediaMtx sync.Mutex
 
 	srvr *http.Server
 }
@@ -101,17 +161,42 @@ func (s *Server) Init() error {
 	if _, err := os.Stat(s.TmplsPath); err != nil {
 		return fmt.Errorf("error checking templates path: %v", err)
 	}
+	if s.MediaPath == "" {
+		s.MediaPath = defaultMediaPath(s.StaticPath)
+	}
+	if err := os.MkdirAll(s.MediaPath, 0755); err != nil {
+		return fmt.Errorf("error creating media dir: %v", err)
+	}
+	s.media = mediaStore{dir: s.MediaPath}
+	if s.BackupDir == "" && !s.demoMode() {
+		s.BackupDir = filepath.Join(filepath.Dir(s.DbPath), "backups")
+	}
+	sched, err := NewScheduler(s.Scheduler)
+	if err != nil {
+		return err
+	}
+	s.scheduler = sched
+
 	tm, err := loadTmpls(s.TmplsPath)
 	if err != nil {
 		return err
 	}
 	s.tmpls = jtutils.NewAValue(tm)
 
-	db, err := openDb(s.DbPath)
+	var db *DB
+	if s.demoMode() {
+		db, err = openMemoryDb()
+	} else {
+		db, err = openDb(s.DbPath)
+	}
 	if err != nil {
 		return err
 	}
 	deferrer.Add(func() { db.Close() })
+	s.db, s.store = db, db
+	if s.demoMode() {
+		log.Print("running in demo mode, nothing will be saved")
+	}
 
 	s.srvr = &http.Server{
 		Handler: s.createHandler(),
@@ -126,15 +211,100 @@ func (s *Server) createHandler() http.Handler {
 
 	r.GetFunc("/", s.homeHandler)
 
+	r.PostFunc("/auth/register", s.registerHandler)
+	r.PostFunc("/auth/login", s.loginHandler)
+	r.PostFunc("/auth/logout", s.logoutHandler)
+	r.GetFunc("/auth/me", s.meHandler)
+
+	r.GetFunc("/tokens", s.getTokensHandler)
+	r.PostFunc("/tokens", s.newTokenHandler)
+	r.DeleteFunc("/tokens/{id}", s.revokeTokenHandler)
+
 	r.GetFunc("/langs", s.getLangsHandler)
 	r.GetFunc("/langs/{lang}", s.getLangHandler)
 	r.PostFunc("/langs", s.newLangHandler)
+	r.HandleFunc(
+		"/langs/{lang}", jmux.NewMethods(http.MethodPatch), s.editLangHandler,
+	)
 	r.DeleteFunc("/langs/{lang}", s.delLangHandler)
+	r.GetFunc("/langs/{lang}/history", s.getLangHistoryHandler)
 
 	r.GetFunc("/langs/{lang}/words", s.getWordsHandler)
+	// GET routes use {word} and the others {id} since jmux can't tell apart
+	// parameters with different names that match the same methods.
 	r.GetFunc("/langs/{lang}/words/{word}", s.getWordHandler)
 	r.PostFunc("/langs/{lang}/words", s.addWordHandler)
+	r.HandleFunc(
+		"/langs/{lang}/words/{id}",
+		jmux.NewMethods(http.MethodPatch),
+		s.editWordHandler,
+	)
 	r.DeleteFunc("/langs/{lang}/words/{id}", s.delWordHandler)
+	r.PostFunc("/langs/{lang}/words/{id}/senses", s.addSenseHandler)
+	r.PutFunc("/langs/{lang}/words/{id}/senses", s.reorderSensesHandler)
+	r.DeleteFunc("/langs/{lang}/words/{id}/senses/{sense}", s.delSenseHandler)
+	r.GetFunc("/langs/{lang}/words/{word}/translations", s.getTranslationsHandler)
+	r.PostFunc("/langs/{lang}/words/{id}/translations", s.addTranslationHandler)
+	r.DeleteFunc(
+		"/langs/{lang}/words/{id}/translations/{other}", s.delTranslationHandler,
+	)
+	r.GetFunc("/langs/{lang}/words/{word}/related", s.getRelatedHandler)
+	r.PostFunc("/langs/{lang}/words/{id}/related", s.addRelationHandler)
+	r.DeleteFunc(
+		"/langs/{lang}/words/{id}/related/{other}", s.delRelationHandler,
+	)
+	r.GetFunc("/langs/{lang}/words/{word}/history", s.getWordHistoryHandler)
+	r.PostFunc(
+		"/langs/{lang}/words/{id}/revert/{rev}", s.revertWordHandler,
+	)
+	r.GetFunc("/langs/{lang}/words/{word}/audio", s.getAudioHandler)
+	r.PutFunc("/langs/{lang}/words/{id}/audio", s.putAudioHandler)
+	r.DeleteFunc("/langs/{lang}/words/{id}/audio", s.delAudioHandler)
+	r.GetFunc("/langs/{lang}/words/{word}/image", s.getImageHandler)
+	r.GetFunc("/langs/{lang}/words/{word}/image/thumbnail", s.getThumbnailHandler)
+	r.PutFunc("/langs/{lang}/words/{id}/image", s.putImageHandler)
+	r.DeleteFunc("/langs/{lang}/words/{id}/image", s.delImageHandler)
+	r.GetFunc("/translate", s.translateHandler)
+
+	r.GetFunc("/langs/{lang}/tags", s.getTagsHandler)
+	r.GetFunc("/langs/{lang}/lists", s.getListsHandler)
+	r.PostFunc("/langs/{lang}/lists", s.newListHandler)
+	r.GetFunc("/langs/{lang}/lists/{list}", s.getListHandler)
+	r.HandleFunc(
+		"/langs/{lang}/lists/{list}",
+		jmux.NewMethods(http.MethodPatch),
+		s.editListHandler,
+	)
+	r.DeleteFunc("/langs/{lang}/lists/{list}", s.delListHandler)
+	r.PostFunc("/langs/{lang}/lists/{list}/words", s.addListWordsHandler)
+	r.DeleteFunc("/langs/{lang}/lists/{list}/words/{id}", s.delListWordHandler)
+
+	r.PostFunc("/langs/{lang}/import", s.importHandler)
+	r.GetFunc("/langs/{lang}/export", s.exportHandler)
+	r.GetFunc("/langs/{lang}/anki", s.ankiExportHandler)
+	r.PostFunc("/langs/{lang}/anki", s.ankiImportHandler)
+
+	r.GetFunc("/langs/{lang}/review/due", s.getDueWordsHandler)
+	r.PostFunc("/langs/{lang}/review/{id}", s.reviewWordHandler)
+
+	r.PostFunc("/langs/{lang}/quizzes", s.newQuizHandler)
+	r.GetFunc("/quizzes/{id}", s.getQuizHandler)
+	r.PostFunc("/quizzes/{id}/answers", s.answerQuizHandler)
+
+	r.GetFunc("/langs/{lang}/suggestions", s.getSuggestionsHandler)
+	r.PostFunc("/langs/{lang}/suggestions", s.newSuggestionHandler)
+	r.GetFunc("/suggestions", s.getSuggestionsHandler)
+	r.GetFunc("/suggestions/{id}", s.getSuggestionHandler)
+	r.PostFunc("/suggestions/{id}/approve", s.approveSuggestionHandler)
+	r.PostFunc("/suggestions/{id}/reject", s.rejectSuggestionHandler)
+
+	r.GetFunc("/trash", s.getTrashHandler)
+	r.PostFunc("/trash/{kind}/{id}/restore", s.restoreTrashHandler)
+
+	r.PostFunc("/admin/backup", s.backupHandler)
+
+	r.GetFunc("/search", s.searchHandler)
+	r.GetFunc("/langs/{lang}/search", s.searchHandler)
 
 	r.Get(
 		"/static/",
@@ -143,7 +313,7 @@ func (s *Server) createHandler() http.Handler {
 		)),
 	).MatchAny(jmux.MethodsGet())
 
-	return r
+	return s.authMiddleware(r)
 }
 
 func (s *Server) RunTCP(addr *net.TCPAddr) error {
@@ -154,6 +324,12 @@ func (s *Server) RunTCP(addr *net.TCPAddr) error {
 	if err != nil {
 		return err
 	}
+	if s.BackupInterval > 0 && !s.demoMode() {
+		go s.runBackups()
+	}
+	if s.TrashDays > 0 {
+		go s.runPurges()
+	}
 	log.Printf("running server on %s", addr)
 	return s.srvr.Serve(ln)
 }
@@ -175,9 +351,9 @@ func (s *Server) getLangHandler(c *jmux.Context) {
 	aliases := c.Query()["alias"]
 	lang, err := Lang{}, error(nil)
 	if id, e := strconv.ParseInt(name, 10, 64); e == nil {
-		lang, err = s.db.getLangById(id)
+		lang, err = s.userStore(c).getLangById(id)
 	} else {
-		lang, err = s.db.getLang(name, aliases...)
+		lang, err = s.userStore(c).getLang(name, aliases...)
 	}
 	code, resp := http.StatusOK, Response[Lang]{}
 	if err != nil {
@@ -189,6 +365,7 @@ func (s *Server) getLangHandler(c *jmux.Context) {
 		}
 	} else {
 		resp.Content = lang
+		c.RespHeader().Set("ETag", versionETag(lang.Version))
 	}
 	c.WriteHeader(code)
 	c.WriteJSON(resp)
@@ -208,7 +385,18 @@ func (s *Server) getLangsHandler(c *jmux.Context) {
 		return
 	}
 
-	langs, err := s.db.getLangs()
+	// Languages shared with the community are included with "shared=true".
+	shared, err := queryBool(c, "shared")
+	if err != nil {
+		c.BadRequest(errRespJson("invalid value for 'shared'"))
+		return
+	}
+	var langs []Lang
+	if shared {
+		langs, err = s.communityDb(c).getLangs()
+	} else {
+		langs, err = s.userStore(c).getLangs()
+	}
 	code, resp := http.StatusOK, Response[[]Lang]{}
 	if err != nil {
 		log.Printf("error gettings langs: %v", err)
@@ -224,6 +412,8 @@ func (s *Server) getLangsHandler(c *jmux.Context) {
 	c.WriteJSON(resp)
 }
 
+// Creating a language with a token restricted to languages fails with 403
+// Forbidden.
 func (s *Server) newLangHandler(c *jmux.Context) {
 	lang := Lang{}
 	if err := c.ReadBodyJSON(&lang); err != nil {
@@ -236,14 +426,15 @@ func (s *Server) newLangHandler(c *jmux.Context) {
 		return
 	}
 	code, resp := http.StatusOK, Response[Lang]{}
-	if err := s.db.newLang(&lang); err != nil {
-		if isUserError(err) {
+	if err := s.userStore(c).newLang(&lang, time.Now()); err != nil {
+		if errors.Is(err, ErrForbidden) {
+			code, resp.Error = http.StatusForbidden, err.Error()
+		} else if isUserError(err) {
 			code, resp.Error = http.StatusBadRequest, err.Error()
 		} else {
 			log.Printf("error adding lang %s: %v", lang.Name, err)
 			code, resp.Error = http.StatusInternalServerError, "internal server error"
 		}
-		return
 	} else {
 		resp.Content = lang
 	}
@@ -251,27 +442,37 @@ func (s *Server) newLangHandler(c *jmux.Context) {
 	c.WriteJSON(resp)
 }
 
+// Edits the language using a JSON Merge Patch of its fields. If the If-Match
+// header is given, the edit fails with 412 unless it matches the language's
+// ETag.
 func (s *Server) editLangHandler(c *jmux.Context) {
-	ld := LangDiff{}
-	if err := c.ReadBodyJSON(&ld); err != nil {
-		if jtutils.IsUnmarshalError(err) {
-			c.BadRequest(errRespJson("invalid JSON"))
-		} else {
-			log.Print("error reading json: ", err)
-			c.InternalServerError(errRespJson("internal server error"))
-		}
+	name := c.Params["lang"]
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.BadRequest(errRespJson(err.Error()))
+		return
 	}
-	code, resp := http.StatusOK, Response[LangDiff]{}
-	if err := s.db.editLang(&ld); err != nil {
-		if isUserError(err) {
-			code, resp.Error = http.StatusBadRequest, err.Error()
+	ld, patch := LangDiff{}, map[string]json.RawMessage(nil)
+	if patch, err = readMergePatch(c); err == nil {
+		ld, err = langDiffFromPatch(patch)
+	}
+	if err != nil {
+		writePatchReadError(c, err)
+		return
+	}
+
+	lang, err := s.userStore(c).editLang(name, &ld, version, time.Now())
+	code, resp := http.StatusOK, Response[Lang]{}
+	if err != nil {
+		if code = patchErrorCode(err); code != 0 {
+			resp.Error = err.Error()
 		} else {
-			log.Printf("error editing lang %d: %v", ld.Id, err)
+			log.Printf("error editing lang %s: %v", name, err)
 			code, resp.Error = http.StatusInternalServerError, "internal server error"
 		}
-		return
 	} else {
-		resp.Content = ld
+		resp.Content = lang
+		c.RespHeader().Set("ETag", versionETag(lang.Version))
 	}
 	c.WriteHeader(code)
 	c.WriteJSON(resp)
@@ -279,7 +480,7 @@ func (s *Server) editLangHandler(c *jmux.Context) {
 
 func (s *Server) delLangHandler(c *jmux.Context) {
 	name := c.Params["lang"]
-	lang, err := s.db.delLang(name)
+	lang, err := s.userStore(c).delLang(name, time.Now())
 	code, resp := http.StatusOK, Response[Lang]{}
 	if err != nil {
 		if isUserError(err) {
@@ -298,18 +499,29 @@ func (s *Server) delLangHandler(c *jmux.Context) {
 func (s *Server) getWordHandler(c *jmux.Context) {
 	lang, wordStr := c.Params["lang"], c.Params["word"]
 	aliases := c.Query()["alias"]
-	likeStr, like := c.Query().Get("like"), false
-	if b, err := strconv.ParseBool(likeStr); err != nil {
+	like, err := queryBool(c, "like")
+	if err != nil {
 		c.WriteError(http.StatusBadRequest, "invalid value for 'like'")
 		return
-	} else {
-		like = b
 	}
-	word, err := Word{}, error(nil)
+	fold, err := queryBool(c, "fold")
+	if err != nil {
+		c.WriteError(http.StatusBadRequest, "invalid value for 'fold'")
+		return
+	}
+	exp, err := wordExpandFromQuery(c)
+	if err != nil {
+		c.BadRequest(errRespJson(err.Error()))
+		return
+	}
+	store, word := s.userStore(c), Word{}
 	if id, e := strconv.ParseInt(wordStr, 10, 64); e == nil {
-		word, err = s.db.getWordById(lang, id)
+		word, err = store.getWordById(lang, id)
 	} else {
-		word, err = s.db.getWord(lang, wordStr, like, aliases...)
+		word, err = store.getWord(lang, wordStr, like, fold, aliases...)
+	}
+	if err == nil {
+		err = s.userDb(c).expandWord(lang, &word, exp)
 	}
 	code, resp := http.StatusOK, Response[Word]{}
 	if err != nil {
@@ -321,6 +533,7 @@ func (s *Server) getWordHandler(c *jmux.Context) {
 		}
 	} else {
 		resp.Content = word
+		c.RespHeader().Set("ETag", versionETag(word.Version))
 	}
 	c.WriteHeader(code)
 	c.WriteJSON(resp)
@@ -344,19 +557,23 @@ func (s *Server) getWordsHandler(c *jmux.Context) {
 		return
 	}
 
-	words, err := s.db.getAllWords(lang)
+	opts, err := wordListOptionsFromQuery(c)
+	if err != nil {
+		c.BadRequest(errRespJson(err.Error()))
+		return
+	}
+	words, next, err := s.userStore(c).getWords(lang, opts)
 	code, resp := http.StatusOK, Response[[]Word]{}
 	if err != nil {
 		if isUserError(err) {
 			code, resp.Error = http.StatusBadRequest, err.Error()
-		} else if words == nil {
+		} else {
 			log.Printf("error getting words for lang %s: %v", lang, err)
 			code, resp.Error = http.StatusInternalServerError, "internal server error"
-		} else {
-			resp.Error = "partial internal server error"
 		}
+	} else {
+		resp.Content, resp.Next = words, next
 	}
-	resp.Content = words
 	c.WriteHeader(code)
 	c.WriteJSON(resp)
 }
@@ -375,14 +592,13 @@ func (s *Server) addWordHandler(c *jmux.Context) {
 	}
 
 	code, resp := http.StatusOK, Response[Word]{}
-	if err := s.db.addWord(lang, &word); err != nil {
+	if err := s.userStore(c).addWord(lang, &word, time.Now()); err != nil {
 		if isUserError(err) {
 			code, resp.Error = http.StatusBadRequest, err.Error()
 		} else {
 			log.Printf("error adding to lang %s: %v", word.Word, err)
 			code, resp.Error = http.StatusInternalServerError, "internal server error"
 		}
-		return
 	} else {
 		resp.Content = word
 	}
@@ -390,28 +606,42 @@ func (s *Server) addWordHandler(c *jmux.Context) {
 	c.WriteJSON(resp)
 }
 
+// Edits the word using a JSON Merge Patch of its fields. If the If-Match
+// header is given, the edit fails with 412 unless it matches the word's ETag.
 func (s *Server) editWordHandler(c *jmux.Context) {
 	lang := c.Params["lang"]
-	wd := WordDiff{}
-	if err := c.ReadBodyJSON(&wd); err != nil {
-		if jtutils.IsUnmarshalError(err) {
-			c.BadRequest(errRespJson("invalid JSON"))
-		} else {
-			log.Print("error reading json: ", err)
-			c.InternalServerError(errRespJson("internal server error"))
-		}
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
 	}
-	code, resp := http.StatusOK, Response[WordDiff]{}
-	if err := s.db.editWord(lang, &wd); err != nil {
-		if isUserError(err) {
-			code, resp.Error = http.StatusBadRequest, err.Error()
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.BadRequest(errRespJson(err.Error()))
+		return
+	}
+	wd, patch := WordDiff{}, map[string]json.RawMessage(nil)
+	if patch, err = readMergePatch(c); err == nil {
+		wd, err = wordDiffFromPatch(patch)
+	}
+	if err != nil {
+		writePatchReadError(c, err)
+		return
+	}
+	wd.Id = id
+
+	word, err := s.userStore(c).editWord(lang, &wd, version, time.Now())
+	code, resp := http.StatusOK, Response[Word]{}
+	if err != nil {
+		if code = patchErrorCode(err); code != 0 {
+			resp.Error = err.Error()
 		} else {
-			log.Printf("error editing word %d in lang %s: %v", wd.Id, lang, err)
+			log.Printf("error editing word %d in lang %s: %v", id, lang, err)
 			code, resp.Error = http.StatusInternalServerError, "internal server error"
 		}
-		return
 	} else {
-		resp.Content = wd
+		resp.Content = word
+		c.RespHeader().Set("ETag", versionETag(word.Version))
 	}
 	c.WriteHeader(code)
 	c.WriteJSON(resp)
@@ -421,9 +651,10 @@ func (s *Server) delWordHandler(c *jmux.Context) {
 	lang, idStr := c.Params["lang"], c.Params["id"]
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
 		return
 	}
-	word, err := s.db.delWordById(lang, id)
+	word, err := s.userStore(c).delWordById(lang, id, time.Now())
 	code, resp := http.StatusOK, Response[Word]{}
 	if err != nil {
 		if isUserError(err) {
@@ -453,11 +684,38 @@ func loadTmpls(path string) (TemplateMap, error) {
 }
 
 func openDb(path string) (*DB, error) {
-	sqlDb, err := sql.Open("go-sqlite3", path)
+	db, err := openDbNoInit(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Init(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// The DB path that runs the server in demo mode.
+const memoryDbPath = ":memory:"
+
+// Returns whether the server is in demo mode (see Server.DbPath).
+func (s *Server) demoMode() bool {
+	return s.DbPath == memoryDbPath
+}
+
+// Opens an empty in-memory database, used for everything in demo mode. The
+// memdb VFS lets all of the connections in the pool
+// share the database, which exists as long as one of them is open, so one is
+// kept open until the DB is closed.
+func openMemoryDb() (*DB, error) {
+	db, err := openDbNoInit("file:/lively-langs?vfs=memdb")
 	if err != nil {
 		return nil, err
 	}
-	db := &DB{sqlDb}
+	if _, err := db.Conn(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
 	if err := db.Init(); err != nil {
 		db.Close()
 		return nil, err
@@ -465,48 +723,139 @@ func openDb(path string) (*DB, error) {
 	return db, nil
 }
 
+// openDbNoInit opens the database without running any migrations.
+func openDbNoInit(path string) (*DB, error) {
+	// Foreign keys are needed for cascading deletes. Transactions take the
+	// write lock when they begin, waiting for other writers to finish, so ones
+	// that read before writing can't fail with "database is locked".
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	sqlDb, err := sql.Open(
+		sqliteDriver,
+		path+sep+"_foreign_keys=on&_busy_timeout=5000&_txlock=immediate",
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{DB: sqlDb}, nil
+}
+
 type DB struct {
 	*sql.DB
+	// userId is the user the DB is scoped to. If non-zero, only the languages
+	// (and so words) owned by the user are accessible.
+	userId int64
+	// shared also gives access to the languages shared with the community, if
+	// the DB is scoped to a user.
+	shared bool
+	// langIds further limits the accessible languages, if non-nil.
+	langIds []int64
+	// actorId is the user that changes are recorded as being made by, if it
+	// differs from userId.
+	actorId int64
 }
 
-func (db *DB) Init() error {
-	const initStmt = `
-CREATE TABLE IF NOT EXISTS languages (
-  language TEXT NOT NULL UNIQUE,
-  aliases TEXT
-);
-  `
-	return jtutils.Second(db.Exec(initStmt))
+// asUser returns a copy of the DB scoped to the user.
+func (db *DB) asUser(userId int64) *DB {
+	return &DB{DB: db.DB, userId: userId}
 }
 
-func (db *DB) getLang(name string, aliases ...string) (Lang, error) {
-	tryGet := func(what string, alias bool) (Lang, error) {
-		stmt, args := `SELECT * FROM languages WHERE name=?`, []any{what}
-		if alias {
-			stmt = `SELECT * FROM languages WHERE ? aliases LIKE %|` + what + `|%`
-			args = []any{}
-			/*
-			   stmt = `SELECT * FROM languages WHERE ? aliases LIKE ?`
-			   what = "%|"+what+"|%"
-			*/
-		}
-		row := db.QueryRow(stmt, args...)
-		lang, err := scanLang(row)
-		if errors.Is(err, sql.ErrNoRows) {
-			err = ErrNoLangFound
-		}
-		return lang, err
+// withShared returns a copy of the DB that can also access the languages
+// shared with the community.
+func (db *DB) withShared() *DB {
+	return &DB{
+		DB: db.DB, userId: db.userId, shared: true, langIds: db.langIds,
+		actorId: db.actorId,
 	}
+}
 
-	lang, err := tryGet(name, false)
-	for i := 0; i < len(aliases) && err == ErrNoLangFound; i++ {
-		lang, err = tryGet(aliases[i], true)
+// withLangs returns a copy of the DB that can only access the given
+// languages.
+func (db *DB) withLangs(langIds []int64) *DB {
+	return &DB{
+		DB: db.DB, userId: db.userId, shared: db.shared, langIds: langIds,
+		actorId: db.actorId,
 	}
-	return lang, err
+}
+
+// actingAs returns a copy of the DB whose changes are recorded as being made
+// by the user (without changing its scope).
+func (db *DB) actingAs(userId int64) *DB {
+	return &DB{
+		DB: db.DB, userId: db.userId, shared: db.shared, langIds: db.langIds,
+		actorId: userId,
+	}
+}
+
+// Returns the user changes made through the DB are recorded as being made by
+// (0 if none).
+func (db *DB) actor() int64 {
+	if db.actorId != 0 {
+		return db.actorId
+	}
+	return db.userId
+}
+
+// Returns an SQL condition on the languages table limiting it to the
+// languages accessible by the DB that aren't deleted, along with its args.
+func (db *DB) langsCond() (string, []any) {
+	cond, args := db.scopeCond()
+	return "deleted_at IS NULL AND " + cond, args
+}
+
+// Like langsCond, but includes deleted languages. The condition is always true
+// if the DB isn't scoped.
+func (db *DB) scopeCond() (string, []any) {
+	conds, args := []string{}, []any{}
+	if db.userId != 0 && db.shared {
+		conds, args = append(conds, "(owner_id=? OR shared)"), append(args, db.userId)
+	} else if db.userId != 0 {
+		conds, args = append(conds, "owner_id=?"), append(args, db.userId)
+	}
+	if db.langIds != nil {
+		conds = append(conds, "id IN (SELECT value FROM json_each(?))")
+		args = append(args, jsonStr(db.langIds))
+	}
+	if len(conds) == 0 {
+		return "1", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// Like langsCond, but limits a column of language IDs.
+func (db *DB) langIdCond(col string) (string, []any) {
+	cond, args := db.langsCond()
+	return col + " IN (SELECT id FROM languages WHERE " + cond + ")", args
+}
+
+// Returns an SQL condition on the words table limiting it to the words in the
+// DB's languages that aren't deleted, along with its args.
+func (db *DB) wordsCond() (string, []any) {
+	cond, args := db.langIdCond("words.lang_id")
+	return "words.deleted_at IS NULL AND " + cond, args
+}
+
+// Init migrates the database to the latest schema version.
+func (db *DB) Init() error {
+	return db.migrate(latestMigration())
+}
+
+func (db *DB) getLang(name string, aliases ...string) (Lang, error) {
+	id, err := db.getLangId(name, aliases...)
+	if err != nil {
+		return Lang{}, err
+	}
+	return db.getLangById(id)
 }
 
 func (db *DB) getLangById(id int64) (Lang, error) {
-	row := db.QueryRow(`SELECT * FROM languages WHERE id=?`, id)
+	cond, args := db.langsCond()
+	row := db.QueryRow(
+		`SELECT `+langCols+` FROM languages WHERE id=? AND `+cond,
+		append([]any{id}, args...)...,
+	)
 	lang, err := scanLang(row)
 	if errors.Is(err, sql.ErrNoRows) {
 		err = ErrNoLangFound
@@ -514,42 +863,87 @@ func (db *DB) getLangById(id int64) (Lang, error) {
 	return lang, err
 }
 
-// Gets the name of the language's database table
-func (db *DB) getLangName(name string, aliases ...string) (string, error) {
+// Gets the ID of the language, which can be passed as the name or ID. If the
+// DB isn't scoped to a user, names belonging to multiple users' languages
+// are ambiguous. If the DB includes shared languages, the user's own language
+// is preferred over shared ones with the same name.
+func (db *DB) getLangId(name string, aliases ...string) (int64, error) {
+	cond, condArgs := db.langsCond()
 	if id, err := strconv.ParseInt(name, 10, 64); err == nil {
-		row := db.QueryRow(`SELECT id FROM languages WHERE id=?`, id)
+		row := db.QueryRow(
+			`SELECT id FROM languages WHERE id=? AND `+cond,
+			append([]any{id}, condArgs...)...,
+		)
 		err := row.Scan(&id)
 		if errors.Is(err, sql.ErrNoRows) {
 			err = ErrNoLangFound
 		}
-		return strconv.FormatInt(id, 10), err
-	}
-	tryGet := func(what string, alias bool) (string, error) {
-		stmt, args := `SELECT id FROM languages WHERE name=?`, []any{what}
+		return id, err
+	}
+	tryGet := func(what string, alias bool) (int64, error) {
+		// Languages are only preferred for being the user's own when the DB
+		// includes shared ones.
+		stmt := `SELECT id,(? AND IFNULL(owner_id,0)=?) AS own FROM languages
+    WHERE `
+		args := []any{db.shared, db.userId, what}
 		if alias {
-			stmt = `SELECT id FROM languages WHERE ? aliases LIKE %|` + what + `|%`
-			args = []any{}
+			stmt += `aliases LIKE ?`
+			args[2] = "%|" + what + "|%"
+		} else {
+			stmt += `name=?`
 		}
-		row, id := db.QueryRow(stmt, args...), int64(0)
-		err := row.Scan(&id)
+		stmt += ` AND ` + cond + ` ORDER BY own DESC,id LIMIT 2`
+		rows, err := db.Query(stmt, append(args, condArgs...)...)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				err = ErrNoLangFound
+			return 0, err
+		}
+		defer rows.Close()
+		ids, owns := []int64{}, []bool{}
+		for rows.Next() {
+			var id int64
+			var own bool
+			if err := rows.Scan(&id, &own); err != nil {
+				return 0, err
 			}
+			ids, owns = append(ids, id), append(owns, own)
 		}
-		return strconv.FormatInt(id, 10), err
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		switch {
+		case len(ids) == 0:
+			return 0, ErrNoLangFound
+		case len(ids) == 1, owns[0] && !owns[1]:
+			return ids[0], nil
+		}
+		return 0, ErrAmbiguousLang
 	}
 
-	langName, err := tryGet(name, false)
+	langId, err := tryGet(name, false)
 	for i := 0; i < len(aliases) && err == ErrNoLangFound; i++ {
-		langName, err = tryGet(aliases[i], true)
+		langId, err = tryGet(aliases[i], true)
 	}
-	return langName, err
+	return langId, err
 }
 
+// Gets the tag used for language-specific text handling.
+func (db *DB) getLangTag(langId int64) (language.Tag, error) {
+	lang := Lang{}
+	row := db.QueryRow(`SELECT locale FROM languages WHERE id=?`, langId)
+	if err := row.Scan(&lang.Locale); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNoLangFound
+		}
+		return language.Und, err
+	}
+	return lang.tag(), nil
+}
+
+// Gets the languages in the order they were added.
 func (db *DB) getLangs() ([]Lang, error) {
-	stmt := fmt.Sprint(`SELECT * FROM languages`)
-	rows, err := db.Query(stmt)
+	cond, args := db.langsCond()
+	stmt := `SELECT ` + langCols + ` FROM languages WHERE ` + cond + ` ORDER BY id`
+	rows, err := db.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -569,25 +963,39 @@ func (db *DB) getLangs() ([]Lang, error) {
 	return langs, err
 }
 
-func (db *DB) newLang(lang *Lang) error {
-	newLang := Lang{
-		Name: strings.ToLower(strings.TrimSpace(lang.Name)),
-		Aliases: jtutils.FilterMapSlice(
-			lang.Aliases,
-			func(s string) (string, bool) {
-				s = strings.TrimSpace(s)
-				return s, len(s) != 0
-			},
-		),
-		Notes: strings.TrimSpace(lang.Notes),
-		Words: lang.Words,
+func (db *DB) newLang(lang *Lang, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
 	}
-	if newLang.Name == "" {
-		return ErrInvalidLang
+	defer tx.Rollback()
+
+	if err := db.insertLang(tx, lang); err != nil {
+		return err
 	}
+	err = db.recordRevision(tx, Revision{
+		Kind: RevisionLang, ItemId: lang.Id, LangId: lang.Id,
+		Action: RevisionInsert, CreatedAt: now.Unix(),
+	}, nil, lang)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-	insStmt, args := lang.toInsertParts()
-	res, err := db.Exec(insStmt, args...)
+// Normalizes and inserts the language, setting its ID. The language is owned
+// by the DB's user.
+func (db *DB) insertLang(ex DBExecer, lang *Lang) error {
+	if db.langIds != nil {
+		return ErrLangsRestricted
+	}
+	newLang, err := lang.newVersion(db.userId)
+	if err != nil {
+		return err
+	}
+
+	insStmt, args := newLang.toInsertParts()
+	res, err := ex.Exec(insStmt, args...)
 	if err != nil {
 		if isUniqueError(err) {
 			err = ErrLangExists
@@ -599,91 +1007,146 @@ func (db *DB) newLang(lang *Lang) error {
 		return err
 	}
 	newLang.Id = id
-
-	tblStmt := fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS [%s] (
-  id INTEGER PRIMARY KEY,
-  word TEXT NOT NULL,
-  definition TEXT NOT NULL,
-  notes TEXT
-);
-  `, lang.Name)
 	*lang = newLang
-	return jtutils.Second(db.Exec(tblStmt))
+	return nil
 }
 
-func (db *DB) editLang(ld *LangDiff) error {
-	*ld.Name = normalizeWord(*ld.Name)
-	if wordIsValid(*ld.Name) {
-		return ErrInvalidLang
+// Applies the diff to the language, returning the updated language. If
+// version is non-zero, ErrVersionMismatch is returned if the language's
+// current version differs. If the language's locale changes, its words are
+// refolded.
+func (db *DB) editLang(
+	lang string,
+	ld *LangDiff,
+	version int64,
+	now time.Time,
+) (Lang, error) {
+	if err := ld.normalize(); err != nil {
+		return Lang{}, err
+	}
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return Lang{}, err
+	}
+	ld.Id = langId
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Lang{}, err
+	}
+	defer tx.Rollback()
+
+	getLang := func() (Lang, error) {
+		return scanLang(tx.QueryRow(
+			`SELECT `+langCols+` FROM languages WHERE id=?`, langId,
+		))
+	}
+	old, err := getLang()
+	if err != nil {
+		return Lang{}, err
+	} else if version != 0 && old.Version != version {
+		return Lang{}, ErrVersionMismatch
+	}
+	if ld.isEmpty() {
+		return old, nil
 	}
 
 	stmt, args := ld.toUpdateParts()
-	if stmt == "" {
-		return nil
+	if _, err := tx.Exec(stmt, args...); err != nil {
+		if isUniqueError(err) {
+			err = ErrLangExists
+		}
+		return Lang{}, err
+	}
+	newLang, err := getLang()
+	if err != nil {
+		return Lang{}, err
 	}
-	err := jtutils.Second(db.Exec(stmt, args...))
-	if isUniqueError(err) {
-		err = ErrLangExists
+	if newTag := newLang.tag(); newTag != old.tag() {
+		if err := foldLangWords(tx, langId, newTag); err != nil {
+			return Lang{}, err
+		}
 	}
-	return err
+	err = db.recordRevision(tx, Revision{
+		Kind: RevisionLang, ItemId: langId, LangId: langId,
+		Action: RevisionUpdate, CreatedAt: now.Unix(),
+	}, old, newLang)
+	if err != nil {
+		return Lang{}, err
+	}
+	return newLang, tx.Commit()
 }
 
-func (db *DB) delLang(name string) (Lang, error) {
-	lang, err := db.getLang(name)
+// Moves the language (and so all of its words) to the trash.
+func (db *DB) delLang(name string, now time.Time) (Lang, error) {
+	id, err := db.getLangId(name)
 	if err != nil {
-		return lang, err
+		return Lang{}, err
 	}
-	stmt := `DELETE FROM languages WHERE name=?`
-	res, err := db.Exec(stmt, name)
+	lang, err := db.getLangById(id)
 	if err != nil {
 		return lang, err
 	}
-	if n, err := res.RowsAffected(); err != nil {
-		return lang, err
-	} else if n == 0 {
-		return lang, nil
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Lang{}, err
 	}
-	dropStmt := fmt.Sprintf(`DROP TABLE [%s]`, name)
-	return lang, jtutils.Second(db.Exec(dropStmt))
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE languages SET deleted_at=? WHERE id=?`, now.Unix(), lang.Id,
+	)
+	if err != nil {
+		return Lang{}, err
+	}
+	err = db.recordRevision(tx, Revision{
+		Kind: RevisionLang, ItemId: lang.Id, LangId: lang.Id,
+		Action: RevisionDelete, CreatedAt: now.Unix(),
+	}, lang, nil)
+	if err != nil {
+		return Lang{}, err
+	}
+	return lang, tx.Commit()
 }
 
+// If fold is true, the word and aliases are matched using their accent- and
+// case-folded forms.
 func (db *DB) getWord(
 	lang, wordStr string,
-	like bool,
+	like, fold bool,
 	aliases ...string,
 ) (Word, error) {
-	lang, err := db.getLangName(lang)
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return Word{}, err
+	}
+	tag, err := db.getLangTag(langId)
 	if err != nil {
 		return Word{}, err
 	}
 
-	getWord := func(lang, wordStr string, like, alias bool) (Word, error) {
-		stmt, args := "", []any{}
-		if !alias {
-			if !like {
-				stmt = fmt.Sprintf(`SELECT * FROM [%s] WHERE word=?`, lang)
-				args = []any{wordStr}
-			} else {
-				stmt = fmt.Sprintf(
-					`SELECT * FROM [%s] WHERE word LIKE %%%s%%`,
-					lang, wordStr,
-				)
-			}
-		} else {
-			if !like {
-				stmt = fmt.Sprintf(
-					`SELECT * FROM [%s] WHERE aliases LIKE %%|%s|%%`,
-					lang, wordStr,
-				)
-			} else {
-				stmt = fmt.Sprintf(
-					`SELECT * FROM [%s] WHERE aliases LIKE %%%s%%`,
-					lang, wordStr,
-				)
+	getWord := func(wordStr string, like, alias bool) (Word, error) {
+		col, arg := "word", normalizeText(wordStr)
+		if fold {
+			col, arg = "folded", foldWord(wordStr, tag)
+		}
+		if alias {
+			col = "alias"
+			if fold {
+				col = "folded"
 			}
 		}
-		row := db.QueryRow(stmt, args...)
+		cond := col + `=?`
+		if like {
+			cond, arg = col+` LIKE ?`, "%"+arg+"%"
+		}
+		if alias {
+			cond = `id IN (SELECT word_id FROM word_aliases WHERE ` + cond + `)`
+		}
+		stmt := `SELECT ` + wordCols + ` FROM words
+    WHERE lang_id=? AND deleted_at IS NULL AND ` + cond
+		row := db.QueryRow(stmt, langId, arg)
 		word, err := scanWord(row)
 		if errors.Is(err, sql.ErrNoRows) {
 			err = ErrNoWordFound
@@ -691,38 +1154,40 @@ func (db *DB) getWord(
 		return word, err
 	}
 
-	word, err := getWord(lang, wordStr, like, false)
+	word, err := getWord(wordStr, like, false)
 	for i := 0; i < len(aliases) && errors.Is(err, ErrNoWordFound); i++ {
-		word, err = getWord(lang, aliases[i], like, true)
+		word, err = getWord(aliases[i], like, true)
 	}
-	return word, nil
+	return word, err
 }
 
 func (db *DB) getWordById(lang string, id int64) (Word, error) {
-	lang, err := db.getLangName(lang)
+	langId, err := db.getLangId(lang)
 	if err != nil {
 		return Word{}, err
 	}
 
-	stmt := fmt.Sprintf(`SELECT * FROM [%s] WHERE id=?`, lang)
-	row := db.QueryRow(stmt, id)
+	stmt := `SELECT ` + wordCols + ` FROM words
+  WHERE id=? AND lang_id=? AND deleted_at IS NULL`
+	row := db.QueryRow(stmt, id, langId)
 	word, err := scanWord(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			err = ErrNoWordFound
 		}
 	}
-	return word, nil
+	return word, err
 }
 
 func (db *DB) getAllWords(lang string) ([]Word, error) {
-	lang, err := db.getLangName(lang)
+	langId, err := db.getLangId(lang)
 	if err != nil {
 		return nil, err
 	}
 
-	stmt := fmt.Sprintf(`SELECT * FROM [%s]`, lang)
-	rows, err := db.Query(stmt)
+	stmt := `SELECT ` + wordCols + ` FROM words
+  WHERE lang_id=? AND deleted_at IS NULL ORDER BY id`
+	rows, err := db.Query(stmt, langId)
 	if err != nil {
 		return nil, err
 	}
@@ -742,92 +1207,461 @@ func (db *DB) getAllWords(lang string) ([]Word, error) {
 	return words, err
 }
 
-func (db *DB) addWord(lang string, word *Word) error {
-	newWord := Word{
-		Word:       strings.TrimSpace(word.Word),
-		Definition: strings.TrimSpace(word.Definition),
-		Notes:      strings.TrimSpace(word.Notes),
+func (db *DB) addWord(lang string, word *Word, now time.Time) error {
+	newWord, tag, err := db.checkNewWord(lang, *word)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
+
+	if err := db.addWordTx(tx, &newWord, tag, now); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*word = newWord
+	return nil
+}
+
+// Normalizes and checks the new word against the language, returning it with
+// its LangId set, along with the language's tag.
+func (db *DB) checkNewWord(lang string, word Word) (Word, language.Tag, error) {
+	newWord := word.normalized()
 	if !newWord.wordIsValid() {
-		return ErrInvalidWord
+		return Word{}, language.Und, ErrInvalidWord
 	}
 
-	lang, err := db.getLangName(lang)
+	langId, err := db.getLangId(lang)
 	if err != nil {
+		return Word{}, language.Und, err
+	}
+	newWord.LangId = langId
+	l, err := db.getLangById(langId)
+	if err != nil {
+		return Word{}, language.Und, err
+	} else if err := newWord.checkMeta(l.Genders); err != nil {
+		return Word{}, language.Und, err
+	}
+	for _, sense := range newWord.Senses {
+		if err := sense.check(); err != nil {
+			return Word{}, language.Und, err
+		}
+	}
+	return newWord, l.tag(), nil
+}
+
+// Inserts the checked word within the transaction, recording the revision.
+func (db *DB) addWordTx(
+	tx *sql.Tx,
+	word *Word,
+	tag language.Tag,
+	now time.Time,
+) error {
+	if err := insertWord(tx, word, tag); err != nil {
 		return err
 	}
+	return db.recordRevision(tx, Revision{
+		Kind: RevisionWord, ItemId: word.Id, LangId: word.LangId,
+		Action: RevisionInsert, CreatedAt: now.Unix(),
+	}, nil, *word)
+}
 
-	stmt, args := newWord.toInsertParts(lang)
-	res, err := db.Exec(stmt, args...)
+// Inserts the word and its aliases and tags, setting the word's ID. Expects the word
+// to be normalized and valid, with its LangId set.
+func insertWord(ex DBExecer, word *Word, tag language.Tag) error {
+	stmt, args := word.toInsertParts(tag)
+	res, err := ex.Exec(stmt, args...)
 	if err != nil {
 		return err
 	}
-	newWord.Id, err = res.LastInsertId()
-	if err == nil {
-		*word = newWord
+	word.Id, err = res.LastInsertId()
+	if err != nil {
+		return err
 	}
-	return err
+	word.Version = 1
+	for i := range word.Senses {
+		if err := insertSense(ex, word.Id, &word.Senses[i]); err != nil {
+			return err
+		}
+	}
+	if err := setWordTags(ex, word.Id, word.Tags); err != nil {
+		return err
+	}
+	return setWordAliases(ex, word.Id, word.Aliases, tag)
 }
 
-func (db *DB) editWord(lang string, wd *WordDiff) error {
-	*wd.Word = normalizeWord(*wd.Word)
-	if wordIsValid(*wd.Word) {
-		return ErrInvalidWord
+// Applies the diff to the word with the diff's ID, returning the updated word.
+// If version is non-zero, ErrVersionMismatch is returned if the word's current
+// version differs.
+func (db *DB) editWord(
+	lang string,
+	wd *WordDiff,
+	version int64,
+	now time.Time,
+) (Word, error) {
+	langId, tag, err := db.checkWordDiff(lang, wd)
+	if err != nil {
+		return Word{}, err
 	}
 
-	lang, err := db.getLangName(lang)
+	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return Word{}, err
+	}
+	defer tx.Rollback()
+
+	word, err := db.editWordTx(tx, langId, tag, wd, version, now)
+	if err != nil {
+		return Word{}, err
+	}
+	return word, tx.Commit()
+}
+
+// Applies the checked diff within the transaction like updateWord, recording
+// the revision if the word changed. Returns the updated word.
+func (db *DB) editWordTx(
+	tx *sql.Tx,
+	langId int64,
+	tag language.Tag,
+	wd *WordDiff,
+	version int64,
+	now time.Time,
+) (Word, error) {
+	old, word, err := updateWord(tx, langId, tag, wd, version)
+	if err != nil {
+		return Word{}, err
+	} else if word.Version == old.Version {
+		return word, nil
 	}
+	err = db.recordRevision(tx, Revision{
+		Kind: RevisionWord, ItemId: word.Id, LangId: langId,
+		Action: RevisionUpdate, CreatedAt: now.Unix(),
+	}, old, word)
+	return word, err
+}
 
-	stmt, args := wd.toUpdateParts(lang)
-	if stmt == "" {
-		return nil
+// Normalizes and checks the diff against the language, returning the
+// language's ID and tag.
+func (db *DB) checkWordDiff(
+	lang string,
+	wd *WordDiff,
+) (int64, language.Tag, error) {
+	if err := wd.normalize(); err != nil {
+		return 0, language.Und, err
+	}
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return 0, language.Und, err
 	}
-	return jtutils.Second(db.Exec(stmt, args...))
+	l, err := db.getLangById(langId)
+	if err != nil {
+		return 0, language.Und, err
+	} else if err := wd.checkMeta(l.Genders); err != nil {
+		return 0, language.Und, err
+	}
+	return langId, l.tag(), nil
 }
 
-func (db *DB) delWordById(lang string, id int64) (Word, error) {
+// Applies the checked diff to the word (which can't be in the trash),
+// returning the word before and after. The word is unchanged if the diff is
+// empty.
+func updateWord(
+	tx *sql.Tx,
+	langId int64,
+	tag language.Tag,
+	wd *WordDiff,
+	version int64,
+) (Word, Word, error) {
+	old, err := getWordTx(tx, langId, wd.Id)
+	if err != nil {
+		return Word{}, Word{}, err
+	} else if version != 0 && old.Version != version {
+		return Word{}, Word{}, ErrVersionMismatch
+	}
+	if wd.isEmpty() {
+		return old, old, nil
+	}
+
+	stmt, args := wd.toUpdateParts(tag)
+	if _, err := tx.Exec(stmt, args...); err != nil {
+		return Word{}, Word{}, err
+	}
+	if wd.Aliases != nil {
+		if _, err := tx.Exec(
+			`DELETE FROM word_aliases WHERE word_id=?`, wd.Id,
+		); err != nil {
+			return Word{}, Word{}, err
+		}
+		if err := setWordAliases(tx, wd.Id, *wd.Aliases, tag); err != nil {
+			return Word{}, Word{}, err
+		}
+	}
+	if wd.Tags != nil {
+		if _, err := tx.Exec(
+			`DELETE FROM word_tags WHERE word_id=?`, wd.Id,
+		); err != nil {
+			return Word{}, Word{}, err
+		}
+		if err := setWordTags(tx, wd.Id, *wd.Tags); err != nil {
+			return Word{}, Word{}, err
+		}
+	}
+	word, err := getWordTx(tx, langId, wd.Id)
+	if err != nil {
+		return Word{}, Word{}, err
+	}
+	return old, word, nil
+}
+
+// Gets the word in the language (which can't be in the trash) within the
+// transaction.
+func getWordTx(tx *sql.Tx, langId, id int64) (Word, error) {
+	word, err := scanWord(tx.QueryRow(
+		`SELECT `+wordCols+` FROM words
+    WHERE id=? AND lang_id=? AND deleted_at IS NULL`,
+		id, langId,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNoWordFound
+	}
+	return word, err
+}
+
+// Moves the word to the trash.
+func (db *DB) delWordById(lang string, id int64, now time.Time) (Word, error) {
 	word, err := db.getWordById(lang, id)
 	if err != nil {
 		return word, err
 	}
-	stmt := fmt.Sprintf(`DELETE FROM [%s] WHERE id=?`, lang)
-	_, err = db.Exec(stmt, id)
-	return word, err
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Word{}, err
+	}
+	defer tx.Rollback()
+
+	if err := db.delWordTx(tx, word, now); err != nil {
+		return Word{}, err
+	}
+	return word, tx.Commit()
+}
+
+// Moves the word to the trash within the transaction, recording the revision.
+func (db *DB) delWordTx(tx *sql.Tx, word Word, now time.Time) error {
+	if err := trashWord(tx, word.Id, now); err != nil {
+		return err
+	}
+	return db.recordRevision(tx, Revision{
+		Kind: RevisionWord, ItemId: word.Id, LangId: word.LangId,
+		Action: RevisionDelete, CreatedAt: now.Unix(),
+	}, word, nil)
+}
+
+func trashWord(ex DBExecer, id int64, now time.Time) error {
+	_, err := ex.Exec(`UPDATE words SET deleted_at=? WHERE id=?`, now.Unix(), id)
+	return err
+}
+
+// Adds the aliases to the word. Existing aliases are kept.
+func setWordAliases(
+	ex DBExecer,
+	wordId int64,
+	aliases []string,
+	tag language.Tag,
+) error {
+	for _, alias := range aliases {
+		_, err := ex.Exec(
+			`INSERT OR IGNORE INTO word_aliases(word_id,alias,folded)
+      VALUES (?,?,?)`,
+			wordId, alias, foldWord(alias, tag),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 var (
-	ErrLangExists  = fmt.Errorf("language already exists")
-	ErrNoLangFound = fmt.Errorf("no language found")
-	ErrInvalidLang = fmt.Errorf("invalid language")
-	ErrNoWordFound = fmt.Errorf("no word found")
-	ErrInvalidWord = fmt.Errorf("invalid word")
+	ErrLangExists   = fmt.Errorf("language already exists")
+	ErrNoLangFound  = fmt.Errorf("no language found")
+	ErrInvalidLang  = fmt.Errorf("invalid language")
+	ErrNoWordFound  = fmt.Errorf("no word found")
+	ErrInvalidWord  = fmt.Errorf("invalid word")
+	ErrInvalidQuery = fmt.Errorf("invalid search query")
+	ErrInvalidGrade = fmt.Errorf("invalid grade")
+
+	ErrInvalidQuizMode  = fmt.Errorf("invalid quiz mode")
+	ErrNotEnoughWords   = fmt.Errorf("not enough words for quiz")
+	ErrNoQuizFound      = fmt.Errorf("no quiz found")
+	ErrInvalidQuestion  = fmt.Errorf("invalid question")
+	ErrQuestionAnswered = fmt.Errorf("question already answered")
+
+	ErrInvalidFormat = fmt.Errorf("invalid format")
+	ErrInvalidHeader = fmt.Errorf("invalid header")
+
+	ErrInvalidAnkiPackage = fmt.Errorf("invalid anki package")
+	ErrInvalidAnkiFields  = fmt.Errorf("invalid anki fields")
+
+	ErrAmbiguousLang      = fmt.Errorf("multiple languages with name")
+	ErrUnauthorized       = fmt.Errorf("not logged in")
+	ErrInvalidCredentials = fmt.Errorf("invalid username or password")
+	ErrUserExists         = fmt.Errorf("user already exists")
+	ErrNoUserFound        = fmt.Errorf("no user found")
+	ErrInvalidUsername    = fmt.Errorf("invalid username")
+	ErrInvalidPassword    = fmt.Errorf("invalid password")
+
+	ErrForbidden         = fmt.Errorf("forbidden")
+	ErrLangsRestricted   = fmt.Errorf("%w: token is restricted to languages", ErrForbidden)
+	ErrNoTokenFound      = fmt.Errorf("no token found")
+	ErrInvalidTokenName  = fmt.Errorf("invalid token name")
+	ErrInvalidTokenScope = fmt.Errorf("invalid token scope")
+
+	ErrNoSuggestionFound   = fmt.Errorf("no suggestion found")
+	ErrInvalidSuggestion   = fmt.Errorf("invalid suggestion")
+	ErrSuggestionReviewed  = fmt.Errorf("suggestion already reviewed")
+	ErrMissingRejectReason = fmt.Errorf("missing reason for rejection")
+
+	ErrInvalidPatch    = fmt.Errorf("invalid patch")
+	ErrInvalidETag     = fmt.Errorf("invalid ETag")
+	ErrVersionMismatch = fmt.Errorf("version mismatch")
+
+	ErrInvalidParam  = fmt.Errorf("invalid value")
+	ErrInvalidCursor = fmt.Errorf("invalid cursor")
+	ErrInvalidLocale = fmt.Errorf("invalid locale")
+
+	ErrInvalidWordMeta = fmt.Errorf("invalid word metadata")
+
+	ErrNoSenseFound      = fmt.Errorf("no sense found")
+	ErrInvalidSense      = fmt.Errorf("invalid sense")
+	ErrInvalidSenseOrder = fmt.Errorf("invalid sense order")
+
+	ErrNoTranslationFound = fmt.Errorf("no translation found")
+	ErrInvalidTranslation = fmt.Errorf("invalid translation")
+
+	ErrNoRelationFound = fmt.Errorf("no relation found")
+	ErrInvalidRelation = fmt.Errorf("invalid relation")
+
+	ErrNoListFound = fmt.Errorf("no list found")
+	ErrInvalidList = fmt.Errorf("invalid list")
+	ErrListExists  = fmt.Errorf("list already exists")
+
+	ErrNoMediaFound = fmt.Errorf("no media found")
+	ErrInvalidMedia = fmt.Errorf("invalid media")
+
+	ErrInvalidTrashKind = fmt.Errorf("invalid trash kind (must be lang or word)")
+
+	ErrNoRevisionFound = fmt.Errorf("no revision found")
+
+	ErrDemoMode = fmt.Errorf("not available in demo mode")
 )
 
+const langCols = `id,IFNULL(owner_id,0),name,aliases,notes,version,locale,genders,
+shared`
+
 type Lang struct {
-	Id      int64
+	Id int64 `json:"id"`
+	// OwnerId is the ID of the user that owns the language (0 if unowned).
+	OwnerId int64    `json:"ownerId,omitempty"`
 	Name    string   `json:"name"`
 	Aliases []string `json:"aliases,omitempty"`
 	Notes   string   `json:"notes,omitempty"`
 	Words   []string `json:"words,omitempty"`
+	// Locale is the BCP-47 tag used for case folding and sorting (empty for
+	// none).
+	Locale string `json:"locale,omitempty"`
+	// Genders are the grammatical genders words can have (like "m" and "f").
+	// New languages without any get the defaults for their locale; an empty
+	// array gives none.
+	Genders []string `json:"genders,omitempty"`
+	// Shared languages can be seen by all users, who can suggest changes to
+	// their words.
+	Shared bool `json:"shared,omitempty"`
+	// Version is incremented on every edit.
+	Version int64 `json:"version,omitempty"`
 }
 
 func scanLang(dbs DBScanner) (lang Lang, err error) {
-	aliasesStr := ""
-	err = dbs.Scan(&lang.Id, &lang.Name, &aliasesStr, &lang.Notes)
+	aliasesStr, gendersStr := "", ""
+	err = dbs.Scan(
+		&lang.Id, &lang.OwnerId, &lang.Name, &aliasesStr, &lang.Notes,
+		&lang.Version, &lang.Locale, &gendersStr, &lang.Shared,
+	)
 	lang.Aliases = aliasesFromStr(aliasesStr)
+	lang.Genders = aliasesFromStr(gendersStr)
 	return
 }
 
+// Returns the tag used for language-specific text handling (und if the
+// language has no locale).
+func (l Lang) tag() language.Tag {
+	tag, err := language.Parse(l.Locale)
+	if err != nil {
+		return language.Und
+	}
+	return tag
+}
+
+// Returns the normalized first version of the new language, owned by the user
+// (0 for none), or ErrInvalidLang if it's invalid. The locale is guessed from
+// the name and aliases if not given.
+func (l Lang) newVersion(ownerId int64) (Lang, error) {
+	newLang := Lang{
+		OwnerId: ownerId,
+		Version: 1,
+		Name:    strings.ToLower(normalizeText(l.Name)),
+		Aliases: cleanAliases(l.Aliases),
+		Notes:   strings.TrimSpace(l.Notes),
+		Words:   l.Words,
+		Shared:  l.Shared,
+	}
+	if newLang.Name == "" {
+		return Lang{}, ErrInvalidLang
+	}
+	locale, err := normalizeLocale(l.Locale)
+	if err != nil {
+		return Lang{}, err
+	} else if locale == "" {
+		if tag := langTag(newLang.Name, newLang.Aliases); tag != language.Und {
+			locale = tag.String()
+		}
+	}
+	newLang.Locale = locale
+	if l.Genders == nil {
+		newLang.Genders = langDefaultGenders(newLang.tag())
+	} else {
+		newLang.Genders = normalizeGenders(l.Genders)
+	}
+	return newLang, nil
+}
+
 func (l Lang) toInsertParts() (string, []any) {
-	stmt := `INSERT INTO languages VALUES (?,?,?)`
-	return stmt, []any{l.Name, aliasesToStr(l.Aliases), l.Notes}
+	stmt := `INSERT INTO languages(owner_id,name,aliases,notes,locale,genders,shared)
+  VALUES (?,?,?,?,?,?,?)`
+	ownerId := sql.NullInt64{Int64: l.OwnerId, Valid: l.OwnerId != 0}
+	return stmt, []any{
+		ownerId, l.Name, aliasesToStr(l.Aliases), l.Notes, l.Locale,
+		aliasesToStr(l.Genders), l.Shared,
+	}
 }
 
-func (l Lang) tableName() string {
-	//return l.Name
-	return strconv.FormatInt(l.Id, 10)
+// Returns the canonical form of the BCP-47 locale (empty if it's empty).
+func normalizeLocale(locale string) (string, error) {
+	locale = strings.TrimSpace(locale)
+	if locale == "" {
+		return "", nil
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidLocale, locale)
+	}
+	return tag.String(), nil
 }
 
 type LangDiff struct {
@@ -835,8 +1669,70 @@ type LangDiff struct {
 	Name    *string   `json:"name,omitempty"`
 	Aliases *[]string `json:"aliases,omitempty"`
 	Notes   *string   `json:"notes,omitempty"`
+	Locale  *string   `json:"locale,omitempty"`
+	Genders *[]string `json:"genders,omitempty"`
+	Shared  *bool     `json:"shared,omitempty"`
+}
+
+// Reads the diff from a JSON Merge Patch of a Lang. Null fields are cleared.
+func langDiffFromPatch(patch map[string]json.RawMessage) (LangDiff, error) {
+	ld := LangDiff{}
+	if err := patchField(patch, "name", &ld.Name); err != nil {
+		return ld, err
+	}
+	if err := patchField(patch, "aliases", &ld.Aliases); err != nil {
+		return ld, err
+	}
+	if err := patchField(patch, "notes", &ld.Notes); err != nil {
+		return ld, err
+	}
+	if err := patchField(patch, "locale", &ld.Locale); err != nil {
+		return ld, err
+	}
+	if err := patchField(patch, "genders", &ld.Genders); err != nil {
+		return ld, err
+	}
+	if err := patchField(patch, "shared", &ld.Shared); err != nil {
+		return ld, err
+	}
+	return ld, checkPatchEmpty(patch)
 }
 
+// Normalizes the set fields the same way as new languages, returning
+// ErrInvalidLang if the name is set and invalid.
+func (ld *LangDiff) normalize() error {
+	if ld.Name != nil {
+		*ld.Name = strings.ToLower(normalizeText(*ld.Name))
+		if *ld.Name == "" {
+			return ErrInvalidLang
+		}
+	}
+	if ld.Aliases != nil {
+		*ld.Aliases = cleanAliases(*ld.Aliases)
+	}
+	if ld.Notes != nil {
+		*ld.Notes = strings.TrimSpace(*ld.Notes)
+	}
+	if ld.Locale != nil {
+		locale, err := normalizeLocale(*ld.Locale)
+		if err != nil {
+			return err
+		}
+		*ld.Locale = locale
+	}
+	if ld.Genders != nil {
+		*ld.Genders = normalizeGenders(*ld.Genders)
+	}
+	return nil
+}
+
+// Returns whether no fields are set.
+func (ld LangDiff) isEmpty() bool {
+	return ld.Name == nil && ld.Aliases == nil && ld.Notes == nil &&
+		ld.Locale == nil && ld.Genders == nil && ld.Shared == nil
+}
+
+// The language's version is incremented.
 func (ld LangDiff) toUpdateParts() (string, []any) {
 	args, setStmt := []any{}, ""
 	if ld.Name != nil {
@@ -851,37 +1747,139 @@ func (ld LangDiff) toUpdateParts() (string, []any) {
 		args = append(args, *ld.Notes)
 		setStmt += ", notes=?"
 	}
+	if ld.Locale != nil {
+		args = append(args, *ld.Locale)
+		setStmt += ", locale=?"
+	}
+	if ld.Genders != nil {
+		args = append(args, aliasesToStr(*ld.Genders))
+		setStmt += ", genders=?"
+	}
+	if ld.Shared != nil {
+		args = append(args, *ld.Shared)
+		setStmt += ", shared=?"
+	}
 	if len(setStmt) == 0 {
 		return "", nil
-	} else {
-		setStmt = setStmt[1:]
 	}
 	args = append(args, ld.Id)
-	stmt := fmt.Sprintf(`UPDATE languages SET %s WHERE id=?`, setStmt)
+	stmt := fmt.Sprintf(
+		`UPDATE languages SET version=version+1%s WHERE id=?`, setStmt,
+	)
 	return stmt, args
 }
 
+// The aliases, tags, and senses are selected as JSON arrays, and the media as
+// JSON objects. Columns are qualified so
+// they can be used in joins.
+const wordCols = `words.id,words.lang_id,words.word,words.definition,(
+  SELECT json_group_array(alias) FROM (
+    SELECT alias FROM word_aliases WHERE word_id=words.id ORDER BY rowid
+  )
+),words.notes,words.version,
+words.pos,words.gender,words.plural,words.register,words.cefr,(
+  SELECT json_group_array(tag) FROM (
+    SELECT tag FROM word_tags WHERE word_id=words.id ORDER BY tag
+  )
+),` + audioCol + `,` + imageCol + `,` + thumbnailCol + `,` + senseCol
+
 type Word struct {
 	Id         int64    `json:"id,omitempty"`
+	LangId     int64    `json:"langId,omitempty"`
 	Word       string   `json:"word"`
 	Definition string   `json:"definition"`
 	Aliases    []string `json:"aliases,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
 	Notes      string   `json:"notes,omitempty"`
+	// Senses are the word's meanings, in order. The definition is the word's
+	// main definition.
+	Senses []Sense `json:"senses,omitempty"`
+	// Related are the words related to the word. They're only included when
+	// requested with "expand=related".
+	Related []RelatedWord `json:"related,omitempty"`
+	// Audio is the word's pronunciation, if one was uploaded.
+	Audio *Media `json:"audio,omitempty"`
+	// Image is the word's picture, if one was uploaded, and Thumbnail is a
+	// smaller version of it.
+	Image     *Media `json:"image,omitempty"`
+	Thumbnail *Media `json:"thumbnail,omitempty"`
+	// Pos is the part of speech (one of PartsOfSpeech).
+	Pos string `json:"pos,omitempty"`
+	// Gender is the grammatical gender (one of the language's genders).
+	Gender string `json:"gender,omitempty"`
+	Plural string `json:"plural,omitempty"`
+	// Register is the level of formality (one of Registers).
+	Register string `json:"register,omitempty"`
+	// CEFR is the CEFR level (one of CEFRLevels).
+	CEFR string `json:"cefr,omitempty"`
+	// Version is incremented on every edit.
+	Version int64 `json:"version,omitempty"`
 }
 
 func scanWord(dbs DBScanner) (word Word, err error) {
-	aliasesStr := ""
-	err = dbs.Scan(&word.Id, &word.Word, &word.Definition, &aliasesStr, &word.Notes)
-	word.Aliases = aliasesFromStr(aliasesStr)
+	aliasesJson, tagsJson, sensesJson := "", "", ""
+	var audioJson, imageJson, thumbJson sql.NullString
+	err = dbs.Scan(
+		&word.Id, &word.LangId, &word.Word, &word.Definition,
+		&aliasesJson, &word.Notes, &word.Version, &word.Pos, &word.Gender,
+		&word.Plural, &word.Register, &word.CEFR, &tagsJson, &audioJson,
+		&imageJson, &thumbJson, &sensesJson,
+	)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal([]byte(aliasesJson), &word.Aliases); err != nil {
+		return
+	}
+	if len(word.Aliases) == 0 {
+		word.Aliases = nil
+	}
+	if err = json.Unmarshal([]byte(tagsJson), &word.Tags); err != nil {
+		return
+	}
+	if len(word.Tags) == 0 {
+		word.Tags = nil
+	}
+	if word.Audio, err = mediaFromJson(audioJson); err != nil {
+		return
+	}
+	if word.Image, err = mediaFromJson(imageJson); err != nil {
+		return
+	}
+	if word.Thumbnail, err = mediaFromJson(thumbJson); err != nil {
+		return
+	}
+	word.Senses, err = sensesFromJson(sensesJson)
 	return
 }
 
-func (w Word) toInsertParts(lang string) (string, []any) {
-	stmt := fmt.Sprintf(
-		`INSERT INTO [%s](word,description,aliases,notes) VALUES (?,?,?,?)`,
-		lang,
-	)
-	return stmt, []any{w.Word, w.Definition, aliasesToStr(w.Aliases), w.Notes}
+// The tag is used to fold the word.
+func (w Word) toInsertParts(tag language.Tag) (string, []any) {
+	stmt := `INSERT INTO words(
+    lang_id,word,definition,notes,folded,pos,gender,plural,register,cefr
+  ) VALUES (?,?,?,?,?,?,?,?,?,?)`
+	args := []any{
+		w.LangId, w.Word, w.Definition, w.Notes, foldWord(w.Word, tag),
+		w.Pos, w.Gender, w.Plural, w.Register, w.CEFR,
+	}
+	return stmt, args
+}
+
+// Returns a copy of the word with its text fields normalized (without its IDs).
+func (w Word) normalized() Word {
+	return Word{
+		Word:       normalizeText(w.Word),
+		Definition: normalizeText(w.Definition),
+		Aliases:    normalizeTexts(cleanAliases(w.Aliases)),
+		Tags:       normalizeTags(w.Tags),
+		Notes:      normalizeText(w.Notes),
+		Pos:        normalizeMetaValue(w.Pos),
+		Gender:     normalizeMetaValue(w.Gender),
+		Plural:     normalizeText(w.Plural),
+		Register:   normalizeMetaValue(w.Register),
+		CEFR:       normalizeCEFR(w.CEFR),
+		Senses:     jtutils.MapSlice(w.Senses, Sense.normalized),
+	}
 }
 
 // Expects word to be trimmed.
@@ -894,34 +1892,171 @@ type WordDiff struct {
 	Word       *string   `json:"word,omitempty"`
 	Definition *string   `json:"definition,omitempty"`
 	Aliases    *[]string `json:"aliases,omitempty"`
+	Tags       *[]string `json:"tags,omitempty"`
 	Notes      *string   `json:"notes,omitempty"`
+	Pos        *string   `json:"pos,omitempty"`
+	Gender     *string   `json:"gender,omitempty"`
+	Plural     *string   `json:"plural,omitempty"`
+	Register   *string   `json:"register,omitempty"`
+	CEFR       *string   `json:"cefr,omitempty"`
 }
 
-func (wd WordDiff) toUpdateParts(lang string) (string, []any) {
+// Reads the diff from a JSON Merge Patch of a Word. Null fields are cleared.
+func wordDiffFromPatch(patch map[string]json.RawMessage) (WordDiff, error) {
+	wd := WordDiff{}
+	if err := patchField(patch, "word", &wd.Word); err != nil {
+		return wd, err
+	}
+	if err := patchField(patch, "definition", &wd.Definition); err != nil {
+		return wd, err
+	}
+	if err := patchField(patch, "aliases", &wd.Aliases); err != nil {
+		return wd, err
+	}
+	if err := patchField(patch, "tags", &wd.Tags); err != nil {
+		return wd, err
+	}
+	if err := patchField(patch, "notes", &wd.Notes); err != nil {
+		return wd, err
+	}
+	if err := patchField(patch, "pos", &wd.Pos); err != nil {
+		return wd, err
+	}
+	if err := patchField(patch, "gender", &wd.Gender); err != nil {
+		return wd, err
+	}
+	if err := patchField(patch, "plural", &wd.Plural); err != nil {
+		return wd, err
+	}
+	if err := patchField(patch, "register", &wd.Register); err != nil {
+		return wd, err
+	}
+	if err := patchField(patch, "cefr", &wd.CEFR); err != nil {
+		return wd, err
+	}
+	return wd, checkPatchEmpty(patch)
+}
+
+// Normalizes the set fields, returning ErrInvalidWord if the word is set and
+// invalid.
+func (wd *WordDiff) normalize() error {
+	if wd.Word != nil {
+		*wd.Word = normalizeText(*wd.Word)
+		if !wordIsValid(*wd.Word) {
+			return ErrInvalidWord
+		}
+	}
+	if wd.Definition != nil {
+		*wd.Definition = normalizeText(*wd.Definition)
+	}
+	if wd.Aliases != nil {
+		*wd.Aliases = normalizeTexts(cleanAliases(*wd.Aliases))
+	}
+	if wd.Tags != nil {
+		*wd.Tags = normalizeTags(*wd.Tags)
+	}
+	if wd.Notes != nil {
+		*wd.Notes = normalizeText(*wd.Notes)
+	}
+	if wd.Pos != nil {
+		*wd.Pos = normalizeMetaValue(*wd.Pos)
+	}
+	if wd.Gender != nil {
+		*wd.Gender = normalizeMetaValue(*wd.Gender)
+	}
+	if wd.Plural != nil {
+		*wd.Plural = normalizeText(*wd.Plural)
+	}
+	if wd.Register != nil {
+		*wd.Register = normalizeMetaValue(*wd.Register)
+	}
+	if wd.CEFR != nil {
+		*wd.CEFR = normalizeCEFR(*wd.CEFR)
+	}
+	return nil
+}
+
+// Returns the word with the diff's set fields (without its IDs).
+func (wd WordDiff) toWord() Word {
+	word := Word{}
+	if wd.Word != nil {
+		word.Word = *wd.Word
+	}
+	if wd.Definition != nil {
+		word.Definition = *wd.Definition
+	}
+	if wd.Aliases != nil {
+		word.Aliases = *wd.Aliases
+	}
+	if wd.Tags != nil {
+		word.Tags = *wd.Tags
+	}
+	if wd.Notes != nil {
+		word.Notes = *wd.Notes
+	}
+	if wd.Pos != nil {
+		word.Pos = *wd.Pos
+	}
+	if wd.Gender != nil {
+		word.Gender = *wd.Gender
+	}
+	if wd.Plural != nil {
+		word.Plural = *wd.Plural
+	}
+	if wd.Register != nil {
+		word.Register = *wd.Register
+	}
+	if wd.CEFR != nil {
+		word.CEFR = *wd.CEFR
+	}
+	return word
+}
+
+// Returns whether no fields are set.
+func (wd WordDiff) isEmpty() bool {
+	return wd.Word == nil && wd.Definition == nil && wd.Aliases == nil &&
+		wd.Tags == nil && wd.Notes == nil && wd.Pos == nil && wd.Gender == nil &&
+		wd.Plural == nil && wd.Register == nil && wd.CEFR == nil
+}
+
+// Aliases and tags aren't part of the words table and must be updated separately, but
+// the word's version is always incremented. The tag is used to fold the word.
+func (wd WordDiff) toUpdateParts(tag language.Tag) (string, []any) {
 	args, setStmt := []any{}, ""
 	if wd.Word != nil {
-		args = append(args, *wd.Word)
-		setStmt += ", word=?"
+		args = append(args, *wd.Word, foldWord(*wd.Word, tag))
+		setStmt += ", word=?, folded=?"
 	}
 	if wd.Definition != nil {
 		args = append(args, *wd.Definition)
 		setStmt += ", definition=?"
 	}
-	if wd.Aliases != nil {
-		args = append(args, aliasesToStr(*wd.Aliases))
-		setStmt += ", aliases=?"
-	}
 	if wd.Notes != nil {
 		args = append(args, *wd.Notes)
 		setStmt += ", notes=?"
 	}
-	if len(setStmt) == 0 {
-		return "", nil
-	} else {
-		setStmt = setStmt[1:]
+	if wd.Pos != nil {
+		args = append(args, *wd.Pos)
+		setStmt += ", pos=?"
+	}
+	if wd.Gender != nil {
+		args = append(args, *wd.Gender)
+		setStmt += ", gender=?"
+	}
+	if wd.Plural != nil {
+		args = append(args, *wd.Plural)
+		setStmt += ", plural=?"
+	}
+	if wd.Register != nil {
+		args = append(args, *wd.Register)
+		setStmt += ", register=?"
+	}
+	if wd.CEFR != nil {
+		args = append(args, *wd.CEFR)
+		setStmt += ", cefr=?"
 	}
 	args = append(args, wd.Id)
-	stmt := fmt.Sprintf(`UPDATE [%s] SET %s WHERE id=?`, setStmt, lang)
+	stmt := fmt.Sprintf(`UPDATE words SET version=version+1%s WHERE id=?`, setStmt)
 	return stmt, args
 }
 
@@ -959,10 +2094,28 @@ func (tm TemplateMap) Index() *template.Template {
 type Response[T any] struct {
 	Content T      `json:"content"`
 	Error   string `json:"error,omitempty"`
+	// Next is the cursor for the next page of a paginated response (empty if
+	// there are no more pages).
+	Next string `json:"next,omitempty"`
+}
+
+// queryBool parses the query parameter as a bool, returning false if it is
+// empty.
+func queryBool(c *jmux.Context, name string) (bool, error) {
+	str := c.Query().Get(name)
+	if str == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(str)
+}
+
+// Returns an ErrInvalidParam error for the query param.
+func invalidQueryValue(name string) error {
+	return fmt.Errorf("%w for '%s'", ErrInvalidParam, name)
 }
 
 func errRespJson(errMsg string) string {
-	return fmt.Sprintf(`{"error": %q`, errMsg)
+	return fmt.Sprintf(`{"error": %q}`, errMsg)
 }
 
 func aliasesFromStr(s string) []string {
@@ -972,17 +2125,19 @@ func aliasesFromStr(s string) []string {
 	)
 }
 
-func aliasesToStr(aliases []string) string {
-	aliasesStr := strings.Join(
-		jtutils.FilterMapSlice(
-			aliases,
-			func(s string) (string, bool) {
-				s = strings.TrimSpace(s)
-				return s, len(s) != 0
-			},
-		),
-		"|",
+// Trims the aliases, removing empty ones.
+func cleanAliases(aliases []string) []string {
+	return jtutils.FilterMapSlice(
+		aliases,
+		func(s string) (string, bool) {
+			s = strings.TrimSpace(s)
+			return s, len(s) != 0
+		},
 	)
+}
+
+func aliasesToStr(aliases []string) string {
+	aliasesStr := strings.Join(cleanAliases(aliases), "|")
 	if aliasesStr != "" {
 		aliasesStr = "|" + aliasesStr + "|"
 	}
@@ -993,6 +2148,15 @@ type DBScanner interface {
 	Scan(...any) error
 }
 
+type DBExecer interface {
+	Exec(string, ...any) (sql.Result, error)
+}
+
+type DBQuerier interface {
+	QueryRow(string, ...any) *sql.Row
+	Query(string, ...any) (*sql.Rows, error)
+}
+
 func errAs[T error](err error) (T, bool) {
 	if err == nil {
 		var t T
@@ -1007,11 +2171,57 @@ func isUserError(err error) bool {
 		errors.Is(err, ErrNoLangFound) ||
 		errors.Is(err, ErrInvalidLang) ||
 		errors.Is(err, ErrNoWordFound) ||
-		errors.Is(err, ErrInvalidWord)
+		errors.Is(err, ErrInvalidWord) ||
+		errors.Is(err, ErrInvalidWordMeta) ||
+		errors.Is(err, ErrNoSenseFound) ||
+		errors.Is(err, ErrInvalidSense) ||
+		errors.Is(err, ErrInvalidSenseOrder) ||
+		errors.Is(err, ErrNoTranslationFound) ||
+		errors.Is(err, ErrInvalidTranslation) ||
+		errors.Is(err, ErrNoRelationFound) ||
+		errors.Is(err, ErrInvalidRelation) ||
+		errors.Is(err, ErrNoListFound) ||
+		errors.Is(err, ErrInvalidList) ||
+		errors.Is(err, ErrListExists) ||
+		errors.Is(err, ErrNoMediaFound) ||
+		errors.Is(err, ErrInvalidMedia) ||
+		errors.Is(err, ErrInvalidTrashKind) ||
+		errors.Is(err, ErrNoRevisionFound) ||
+		errors.Is(err, ErrDemoMode) ||
+		errors.Is(err, ErrInvalidQuery) ||
+		errors.Is(err, ErrInvalidGrade) ||
+		errors.Is(err, ErrInvalidQuizMode) ||
+		errors.Is(err, ErrNotEnoughWords) ||
+		errors.Is(err, ErrNoQuizFound) ||
+		errors.Is(err, ErrInvalidQuestion) ||
+		errors.Is(err, ErrQuestionAnswered) ||
+		errors.Is(err, ErrInvalidFormat) ||
+		errors.Is(err, ErrInvalidHeader) ||
+		errors.Is(err, ErrInvalidAnkiPackage) ||
+		errors.Is(err, ErrInvalidAnkiFields) ||
+		errors.Is(err, ErrAmbiguousLang) ||
+		errors.Is(err, ErrUserExists) ||
+		errors.Is(err, ErrNoUserFound) ||
+		errors.Is(err, ErrInvalidUsername) ||
+		errors.Is(err, ErrInvalidPassword) ||
+		errors.Is(err, ErrForbidden) ||
+		errors.Is(err, ErrNoTokenFound) ||
+		errors.Is(err, ErrInvalidTokenName) ||
+		errors.Is(err, ErrInvalidTokenScope) ||
+		errors.Is(err, ErrNoSuggestionFound) ||
+		errors.Is(err, ErrInvalidSuggestion) ||
+		errors.Is(err, ErrSuggestionReviewed) ||
+		errors.Is(err, ErrMissingRejectReason) ||
+		errors.Is(err, ErrInvalidPatch) ||
+		errors.Is(err, ErrInvalidETag) ||
+		errors.Is(err, ErrVersionMismatch) ||
+		errors.Is(err, ErrInvalidParam) ||
+		errors.Is(err, ErrInvalidCursor) ||
+		errors.Is(err, ErrInvalidLocale)
 }
 
 func isUniqueError(err error) bool {
-	if se, ok := errAs[*sqlite3.Error](err); ok {
+	if se, ok := errAs[sqlite3.Error](err); ok {
 		if se.ExtendedCode == sqlite3.ErrConstraintUnique {
 			return true
 		}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Opens a new, fully migrated database in a temp dir that's removed (and
+// closed) when the test ends.
+func newTestDb(t *testing.T) *DB {
+	t.Helper()
+	db := newTestDbNoInit(t)
+	if err := db.Init(); err != nil {
+		t.Fatal("error initializing database: ", err)
+	}
+	return db
+}
+
+// Opens a new database without running any migrations. The test is skipped if
+// SQLite was built without FTS5 (see DB.checkFts5).
+func newTestDbNoInit(t *testing.T) *DB {
+	t.Helper()
+	db, err := openDbNoInit(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal("error opening database: ", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.checkFts5(); err != nil {
+		t.Skip(err)
+	}
+	return db
+}
+
+// Adds a language with the name to the DB.
+func addTestLang(t *testing.T, db *DB, name string, aliases ...string) Lang {
+	t.Helper()
+	lang := Lang{Name: name, Aliases: aliases}
+	if err := db.newLang(&lang, time.Now()); err != nil {
+		t.Fatalf("error adding language %s: %v", name, err)
+	}
+	return lang
+}
+
+// Adds a word with the definition to the language.
+func addTestWord(t *testing.T, db *DB, lang, word, def string) Word {
+	t.Helper()
+	w := Word{Word: word, Definition: def}
+	if err := db.addWord(lang, &w, time.Now()); err != nil {
+		t.Fatalf("error adding word %s: %v", word, err)
+	}
+	return w
+}
+
+func TestLangs(t *testing.T) {
+	db := newTestDb(t)
+	spanish := addTestLang(t, db, " Spanish ", "es", "español")
+	if spanish.Id == 0 || spanish.Name != "spanish" || spanish.Version != 1 {
+		t.Fatalf("unexpected new language: %+v", spanish)
+	}
+	if err := db.newLang(&Lang{Name: "spanish"}, time.Now()); err != ErrLangExists {
+		t.Errorf("expected ErrLangExists, got %v", err)
+	}
+	if err := db.newLang(&Lang{Name: "  "}, time.Now()); err != ErrInvalidLang {
+		t.Errorf("expected ErrInvalidLang, got %v", err)
+	}
+	addTestLang(t, db, "catalan", "es-ca", "español")
+
+	tests := []struct {
+		name    string
+		aliases []string
+		id      int64
+		err     error
+	}{
+		{"spanish", nil, spanish.Id, nil},
+		{strconv.FormatInt(spanish.Id, 10), nil, spanish.Id, nil},
+		{"x", []string{"es"}, spanish.Id, nil},
+		{"x", []string{"nope", "es"}, spanish.Id, nil},
+		{"x", []string{"español"}, 0, ErrAmbiguousLang},
+		{"x", nil, 0, ErrNoLangFound},
+		{"999", nil, 0, ErrNoLangFound},
+	}
+	for _, test := range tests {
+		lang, err := db.getLang(test.name, test.aliases...)
+		if err != test.err || lang.Id != test.id {
+			t.Errorf(
+				"getLang(%q, %v): expected %d (%v), got %d (%v)",
+				test.name, test.aliases, test.id, test.err, lang.Id, err,
+			)
+		}
+	}
+
+	langs, err := db.getLangs()
+	if err != nil || len(langs) != 2 {
+		t.Fatalf("expected 2 languages, got %d (%v)", len(langs), err)
+	}
+	if _, err := db.delLang("spanish", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.getLang("spanish"); err != ErrNoLangFound {
+		t.Errorf("expected ErrNoLangFound after delete, got %v", err)
+	}
+}
+
+func TestWords(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	addTestLang(t, db, "french")
+	perro := Word{Word: " perro ", Definition: "dog", Aliases: []string{"can"}}
+	if err := db.addWord("spanish", &perro, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if perro.Id == 0 || perro.Word != "perro" || perro.Version != 1 {
+		t.Fatalf("unexpected new word: %+v", perro)
+	}
+	if err := db.addWord("spanish", &Word{Word: " "}, time.Now()); err != ErrInvalidWord {
+		t.Errorf("expected ErrInvalidWord, got %v", err)
+	}
+	if err := db.addWord("german", &Word{Word: "hund"}, time.Now()); err != ErrNoLangFound {
+		t.Errorf("expected ErrNoLangFound, got %v", err)
+	}
+	addTestWord(t, db, "french", "chien", "dog")
+
+	tests := []struct {
+		lang, word string
+		aliases    []string
+		id         int64
+		err        error
+	}{
+		{"spanish", "perro", nil, perro.Id, nil},
+		{"spanish", "x", []string{"can"}, perro.Id, nil},
+		{"spanish", "can", nil, 0, ErrNoWordFound},
+		{"spanish", "chien", nil, 0, ErrNoWordFound},
+	}
+	for _, test := range tests {
+		word, err := db.getWord(test.lang, test.word, false, false, test.aliases...)
+		if err != test.err || word.Id != test.id {
+			t.Errorf(
+				"getWord(%q, %q, %v): expected %d (%v), got %d (%v)",
+				test.lang, test.word, test.aliases, test.id, test.err, word.Id, err,
+			)
+		}
+	}
+	if _, err := db.getWordById("french", perro.Id); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound from other language, got %v", err)
+	}
+
+	def := "a dog"
+	word, err := db.editWord(
+		"spanish", &WordDiff{Id: perro.Id, Definition: &def}, 1, time.Now(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if word.Definition != def || word.Version != 2 ||
+		len(word.Aliases) != 1 || word.Aliases[0] != "can" {
+		t.Errorf("unexpected edited word: %+v", word)
+	}
+
+	if _, err := db.delWordById("spanish", perro.Id, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	words, err := db.getAllWords("spanish")
+	if err != nil || len(words) != 0 {
+		t.Errorf("expected no words after delete, got %d (%v)", len(words), err)
+	}
+}
+
+// Returns a server using the DB for everything, running until the test ends.
+func newTestServer(t *testing.T, db *DB) *httptest.Server {
+	t.Helper()
+	s := &Server{
+		db:        db,
+		store:     db,
+		scheduler: SM2{},
+		media:     mediaStore{dir: t.TempDir()},
+	}
+	srvr := httptest.NewServer(s.createHandler())
+	t.Cleanup(srvr.Close)
+	return srvr
+}
+
+// testClient makes requests to a test server, keeping its session cookie. If
+// token is set, it's sent as a bearer token, and header is added to every
+// request.
+type testClient struct {
+	t      *testing.T
+	url    string
+	client *http.Client
+	token  string
+	header http.Header
+}
+
+func newTestClient(t *testing.T, srvr *httptest.Server) *testClient {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testClient{t: t, url: srvr.URL, client: &http.Client{Jar: jar}}
+}
+
+// Sends the body (if non-nil) as JSON, decoding the response into resp (if
+// non-nil) and returning the status code.
+func (tc *testClient) do(method, path string, body, resp any) int {
+	tc.t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			tc.t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	res := tc.doRaw(method, path, r)
+	defer res.Body.Close()
+	if resp != nil {
+		if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+			tc.t.Fatalf("error decoding response to %s %s: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// Like do, but the body is sent as is and the response is returned (for the
+// caller to close).
+func (tc *testClient) doRaw(method, path string, body io.Reader) *http.Response {
+	tc.t.Helper()
+	req, err := http.NewRequest(method, tc.url+path, body)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	for name, values := range tc.header {
+		req.Header[name] = values
+	}
+	if tc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+	}
+	res, err := tc.client.Do(req)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	return res
+}
+
+// Registers the user, logging the client in.
+func (tc *testClient) register(username string) User {
+	tc.t.Helper()
+	resp := Response[User]{}
+	code := tc.do(
+		http.MethodPost, "/auth/register",
+		Credentials{Username: username, Password: "password123"}, &resp,
+	)
+	if code != http.StatusOK {
+		tc.t.Fatalf("error registering %s: %d %s", username, code, resp.Error)
+	}
+	return resp.Content
+}
@@ -0,0 +1,33 @@
+package server
+
+import "time"
+
+// Store stores languages and their words (along with the words' aliases).
+// *DB is the SQLite implementation, which is also used in demo mode (with an
+// in-memory database). The rest of the data (users, lists, reviews, etc.) is
+// only stored by DB.
+type Store interface {
+	// scoped returns a copy of the store that can only access the user's
+	// languages (all if userId is 0), further limited to langIds if non-nil.
+	scoped(userId int64, langIds []int64) Store
+
+	getLangs() ([]Lang, error)
+	getLang(name string, aliases ...string) (Lang, error)
+	getLangById(id int64) (Lang, error)
+	newLang(lang *Lang, now time.Time) error
+	editLang(lang string, ld *LangDiff, version int64, now time.Time) (Lang, error)
+	delLang(lang string, now time.Time) (Lang, error)
+
+	getWord(lang, word string, like, fold bool, aliases ...string) (Word, error)
+	getWordById(lang string, id int64) (Word, error)
+	getWords(lang string, opts WordListOptions) ([]Word, string, error)
+	addWord(lang string, word *Word, now time.Time) error
+	editWord(lang string, wd *WordDiff, version int64, now time.Time) (Word, error)
+	delWordById(lang string, id int64, now time.Time) (Word, error)
+}
+
+var _ Store = (*DB)(nil)
+
+func (db *DB) scoped(userId int64, langIds []int64) Store {
+	return db.asUser(userId).withLangs(langIds)
+}
@@ -0,0 +1,392 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Returns the test DB as a Store, with users 1 and 2 existing.
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	db := newTestDb(t)
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := db.newUser(name, "password123", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestStoreLangs(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Now()
+	alice, bob := store.scoped(1, nil), store.scoped(2, nil)
+	spanish := Lang{Name: " Spanish ", Aliases: []string{"es", "castellano"}}
+	if err := alice.newLang(&spanish, now); err != nil {
+		t.Fatal(err)
+	}
+	if spanish.Name != "spanish" || spanish.Version != 1 || spanish.OwnerId != 1 {
+		t.Errorf("unexpected new language: %+v", spanish)
+	}
+	// Names are only unique per user.
+	if err := bob.newLang(&Lang{Name: "spanish", Aliases: []string{"es"}}, now); err != nil {
+		t.Fatal(err)
+	}
+	newTests := []struct {
+		store Store
+		lang  Lang
+		err   error
+	}{
+		{alice, Lang{Name: "SPANISH"}, ErrLangExists},
+		{alice, Lang{Name: " "}, ErrInvalidLang},
+		{alice.scoped(1, []int64{spanish.Id}), Lang{Name: "french"}, ErrLangsRestricted},
+	}
+	for _, test := range newTests {
+		if err := test.store.newLang(&test.lang, now); err != test.err {
+			t.Errorf("newLang(%+v): expected %v, got %v", test.lang, test.err, err)
+		}
+	}
+	if err := alice.newLang(&Lang{Name: "catalan", Aliases: []string{"castellano"}}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	getTests := []struct {
+		store   Store
+		name    string
+		aliases []string
+		id      int64
+		err     error
+	}{
+		{alice, "spanish", nil, spanish.Id, nil},
+		{alice, jsonStr(spanish.Id), nil, spanish.Id, nil},
+		{alice, "x", []string{"nope", "es"}, spanish.Id, nil},
+		{alice, "x", []string{"castellano"}, 0, ErrAmbiguousLang},
+		{bob, jsonStr(spanish.Id), nil, 0, ErrNoLangFound},
+		{alice.scoped(1, []int64{999}), "spanish", nil, 0, ErrNoLangFound},
+		{store, "x", []string{"es"}, 0, ErrAmbiguousLang},
+	}
+	for _, test := range getTests {
+		lang, err := test.store.getLang(test.name, test.aliases...)
+		if err != test.err || lang.Id != test.id {
+			t.Errorf(
+				"getLang(%q, %v): expected %d (%v), got %d (%v)",
+				test.name, test.aliases, test.id, test.err, lang.Id, err,
+			)
+		}
+	}
+	if langs, err := alice.getLangs(); err != nil || len(langs) != 2 || langs[0].Name != "spanish" {
+		t.Errorf("unexpected languages: %+v (%v)", langs, err)
+	}
+
+	name := "Espa\u00f1ol"
+	editTests := []struct {
+		version int64
+		ld      LangDiff
+		want    int64
+		err     error
+	}{
+		{2, LangDiff{Name: &name}, 0, ErrVersionMismatch},
+		{1, LangDiff{Name: &name}, 2, nil},
+		{0, LangDiff{}, 2, nil},
+		{0, LangDiff{Name: strPtr("catalan")}, 0, ErrLangExists},
+	}
+	for _, test := range editTests {
+		lang, err := alice.editLang(jsonStr(spanish.Id), &test.ld, test.version, now)
+		if err != test.err || lang.Version != test.want {
+			t.Errorf("editLang(%+v, %d): expected version %d (%v), got %+v (%v)", test.ld, test.version, test.want, test.err, lang, err)
+		}
+	}
+	if lang, err := alice.getLang("espa\u00f1ol"); err != nil || lang.Id != spanish.Id {
+		t.Errorf("expected renamed language, got %+v (%v)", lang, err)
+	}
+
+	addTestStoreWord(t, alice, "espa\u00f1ol", Word{Word: "perro"})
+	if _, err := bob.delLang(jsonStr(spanish.Id), now); err != ErrNoLangFound {
+		t.Errorf("expected ErrNoLangFound deleting another user's language, got %v", err)
+	}
+	if _, err := alice.delLang("espa\u00f1ol", now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.getLang("espa\u00f1ol"); err != ErrNoLangFound {
+		t.Errorf("expected ErrNoLangFound after delete, got %v", err)
+	}
+	if _, err := alice.getWord(jsonStr(spanish.Id), "perro", false, false); err != ErrNoLangFound {
+		t.Errorf("expected words to be deleted with the language, got %v", err)
+	}
+}
+
+// Adds the word to the store's language, returning it.
+func addTestStoreWord(t *testing.T, store Store, lang string, word Word) Word {
+	t.Helper()
+	if err := store.addWord(lang, &word, time.Now()); err != nil {
+		t.Fatalf("error adding word %s: %v", word.Word, err)
+	}
+	return word
+}
+
+func TestStoreWords(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Now()
+	for _, lang := range []Lang{{Name: "spanish", Locale: "es"}, {Name: "french"}} {
+		if err := store.newLang(&lang, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	perro := addTestStoreWord(t, store, "spanish", Word{
+		Word: " perro ", Definition: "dog", Aliases: []string{"can", "chucho", "can"},
+		Tags: []string{"pets", "animals"}, Notes: "Man's best friend",
+	})
+	if perro.Word != "perro" || perro.Version != 1 || perro.Id == 0 {
+		t.Errorf("unexpected new word: %+v", perro)
+	}
+	arbol := addTestStoreWord(t, store, "spanish", Word{Word: "\u00e1rbol", Definition: "tree", Pos: "noun"})
+	nino := addTestStoreWord(t, store, "spanish", Word{Word: "ni\u00f1o", Definition: "boy", Tags: []string{"people"}})
+	addTestStoreWord(t, store, "spanish", Word{Word: "nube", Definition: "cloud"})
+	chien := addTestStoreWord(t, store, "french", Word{Word: "chien", Definition: "dog"})
+
+	addTests := []struct {
+		lang string
+		word Word
+		err  error
+	}{
+		{"spanish", Word{Word: " "}, ErrInvalidWord},
+		{"german", Word{Word: "hund"}, ErrNoLangFound},
+		{"spanish", Word{Word: "gato", Pos: "thing"}, ErrInvalidWordMeta},
+	}
+	for _, test := range addTests {
+		if err := store.addWord(test.lang, &test.word, now); !errors.Is(err, test.err) {
+			t.Errorf("addWord(%q, %+v): expected %v, got %v", test.lang, test.word, test.err, err)
+		}
+	}
+
+	getTests := []struct {
+		word       string
+		like, fold bool
+		aliases    []string
+		id         int64
+	}{
+		{"perro", false, false, nil, perro.Id},
+		{"PERRO", false, false, nil, 0},
+		{"PERRO", false, true, nil, perro.Id},
+		{"arbol", false, true, nil, arbol.Id},
+		{"ERR", true, false, nil, perro.Id},
+		{"x", false, false, []string{"chucho"}, perro.Id},
+		{"can", false, false, nil, 0},
+		{"chien", false, false, nil, 0},
+	}
+	for _, test := range getTests {
+		word, err := store.getWord("spanish", test.word, test.like, test.fold, test.aliases...)
+		if (test.id == 0 && err != ErrNoWordFound) || word.Id != test.id {
+			t.Errorf(
+				"getWord(%q, %v, %v, %v): expected %d, got %d (%v)",
+				test.word, test.like, test.fold, test.aliases, test.id, word.Id, err,
+			)
+		}
+	}
+	if word, err := store.getWordById("spanish", perro.Id); err != nil ||
+		fmt.Sprint(word.Aliases) != "[can chucho]" || fmt.Sprint(word.Tags) != "[animals pets]" {
+		t.Errorf("unexpected word: %+v (%v)", word, err)
+	}
+	if _, err := store.getWordById("spanish", chien.Id); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound from other language, got %v", err)
+	}
+
+	hasAliases := false
+	listTests := []struct {
+		opts WordListOptions
+		want string
+	}{
+		{WordListOptions{}, "[\u00e1rbol ni\u00f1o nube perro]"},
+		{WordListOptions{Desc: true}, "[perro nube ni\u00f1o \u00e1rbol]"},
+		{WordListOptions{Sort: WordSortCreated}, "[perro \u00e1rbol ni\u00f1o nube]"},
+		{WordListOptions{HasAliases: &hasAliases}, "[\u00e1rbol ni\u00f1o nube]"},
+		{WordListOptions{Notes: "BEST"}, "[perro]"},
+		{WordListOptions{Pos: "noun"}, "[\u00e1rbol]"},
+		{WordListOptions{Tags: []string{"pets", "animals"}}, "[perro]"},
+		{WordListOptions{Tags: []string{"pets", "people"}}, "[]"},
+	}
+	for _, test := range listTests {
+		// Pages of each size list the same words.
+		for limit := 1; limit <= 5; limit++ {
+			opts, got := test.opts, []Word{}
+			opts.Limit = limit
+			for {
+				words, next, err := store.getWords("spanish", opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, words...)
+				if next == "" {
+					break
+				}
+				opts.After = next
+			}
+			if fmt.Sprint(wordNames(got)) != test.want {
+				t.Errorf("getWords(%+v): expected %s, got %v", opts, test.want, wordNames(got))
+			}
+		}
+	}
+	_, next, err := store.getWords("spanish", WordListOptions{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.getWords("spanish", WordListOptions{After: next, Desc: true}); err != ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	def := "a dog"
+	editTests := []struct {
+		wd      WordDiff
+		version int64
+		want    int64
+		err     error
+	}{
+		{WordDiff{Id: perro.Id, Definition: &def}, 2, 0, ErrVersionMismatch},
+		{WordDiff{Id: perro.Id, Definition: &def}, 1, 2, nil},
+		{WordDiff{Id: perro.Id}, 0, 2, nil},
+		{WordDiff{Id: chien.Id, Definition: &def}, 0, 0, ErrNoWordFound},
+		{WordDiff{Id: perro.Id, Pos: strPtr("thing")}, 0, 0, ErrInvalidWordMeta},
+	}
+	for _, test := range editTests {
+		word, err := store.editWord("spanish", &test.wd, test.version, now)
+		if !errors.Is(err, test.err) || word.Version != test.want {
+			t.Errorf("editWord(%+v, %d): expected version %d (%v), got %+v (%v)", test.wd, test.version, test.want, test.err, word, err)
+		} else if err == nil && word.Definition != def {
+			t.Errorf("expected definition %q, got %q", def, word.Definition)
+		}
+	}
+
+	if _, err := store.delWordById("spanish", nino.Id, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.delWordById("spanish", nino.Id, now); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound deleting again, got %v", err)
+	}
+	words, _, err := store.getWords("spanish", WordListOptions{})
+	if err != nil || fmt.Sprint(wordNames(words)) != "[\u00e1rbol nube perro]" {
+		t.Errorf("unexpected words after delete: %v (%v)", wordNames(words), err)
+	}
+}
+
+func TestStoreHandlers(t *testing.T) {
+	srvr := newTestServer(t, newTestDb(t))
+	alice, bob := newTestClient(t, srvr), newTestClient(t, srvr)
+	alice.register("alice")
+	bob.register("bob")
+
+	tests := []struct {
+		name   string
+		tc     *testClient
+		method string
+		path   string
+		body   any
+		header http.Header
+		code   int
+		want   string
+	}{
+		{"create language", alice, http.MethodPost, "/langs", Lang{Name: "Spanish", Aliases: []string{"es"}}, nil, http.StatusOK, `"spanish"`},
+		{"create again", alice, http.MethodPost, "/langs", Lang{Name: "spanish"}, nil, http.StatusBadRequest, ""},
+		{"list languages", alice, http.MethodGet, "/langs", nil, nil, http.StatusOK, `[spanish]`},
+		{"other user lists", bob, http.MethodGet, "/langs", nil, nil, http.StatusOK, `[]`},
+		{"get by alias", alice, http.MethodGet, "/langs/x?alias=es", nil, nil, http.StatusOK, `"spanish"`},
+		{"other user gets", bob, http.MethodGet, "/langs/spanish", nil, nil, http.StatusBadRequest, ""},
+		{"stale edit", alice, http.MethodPatch, "/langs/spanish", map[string]any{"notes": "x"}, http.Header{"If-Match": {`"2"`}}, http.StatusPreconditionFailed, ""},
+		{"edit", alice, http.MethodPatch, "/langs/spanish", map[string]any{"aliases": []string{"es", "castellano"}}, http.Header{"If-Match": {`"1"`}}, http.StatusOK, `"spanish"`},
+		{"add word", alice, http.MethodPost, "/langs/spanish/words", Word{Word: "perro", Definition: "dog", Aliases: []string{"can"}}, nil, http.StatusOK, `"perro"`},
+		{"add word 2", alice, http.MethodPost, "/langs/spanish/words", Word{Word: "\u00e1rbol", Definition: "tree"}, nil, http.StatusOK, "\"\u00e1rbol\""},
+		{"add invalid word", alice, http.MethodPost, "/langs/spanish/words", Word{Word: " "}, nil, http.StatusBadRequest, ""},
+		{"other user adds", bob, http.MethodPost, "/langs/spanish/words", Word{Word: "gato"}, nil, http.StatusBadRequest, ""},
+		{"get word", alice, http.MethodGet, "/langs/spanish/words/perro", nil, nil, http.StatusOK, `"perro"`},
+		{"get word by alias", alice, http.MethodGet, "/langs/spanish/words/x?alias=can", nil, nil, http.StatusOK, `"perro"`},
+		{"get folded word", alice, http.MethodGet, "/langs/spanish/words/ARBOL?fold=true", nil, nil, http.StatusOK, "\"\u00e1rbol\""},
+		{"list words", alice, http.MethodGet, "/langs/spanish/words?sort=word", nil, nil, http.StatusOK, "[\u00e1rbol perro]"},
+		{"list words descending", alice, http.MethodGet, "/langs/spanish/words?order=desc", nil, nil, http.StatusOK, "[perro \u00e1rbol]"},
+		{"invalid cursor", alice, http.MethodGet, "/langs/spanish/words?after=x", nil, nil, http.StatusBadRequest, ""},
+		{"edit word", alice, http.MethodPatch, "/langs/spanish/words/1", map[string]any{"definition": "a dog", "aliases": nil}, http.Header{"If-Match": {`"1"`}}, http.StatusOK, `"perro"`},
+		{"stale word edit", alice, http.MethodPatch, "/langs/spanish/words/1", map[string]any{"definition": "x"}, http.Header{"If-Match": {`"1"`}}, http.StatusPreconditionFailed, ""},
+		{"alias cleared", alice, http.MethodGet, "/langs/spanish/words/x?alias=can", nil, nil, http.StatusBadRequest, ""},
+		{"other user deletes word", bob, http.MethodDelete, "/langs/spanish/words/1", nil, nil, http.StatusBadRequest, ""},
+		{"delete word", alice, http.MethodDelete, "/langs/spanish/words/1", nil, nil, http.StatusOK, `"perro"`},
+		{"delete word again", alice, http.MethodDelete, "/langs/spanish/words/1", nil, nil, http.StatusBadRequest, ""},
+		{"delete language", alice, http.MethodDelete, "/langs/spanish", nil, nil, http.StatusOK, `"spanish"`},
+		{"get deleted language", alice, http.MethodGet, "/langs/spanish", nil, nil, http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		test.tc.header = test.header
+		resp := Response[any]{}
+		code := test.tc.do(test.method, test.path, test.body, &resp)
+		test.tc.header = nil
+		if code != test.code {
+			t.Errorf("%s: expected %d, got %d (%s)", test.name, test.code, code, resp.Error)
+			continue
+		} else if test.want == "" {
+			continue
+		}
+		// Checks the name of the language or word, or the names of a list of
+		// them.
+		got := ""
+		switch content := resp.Content.(type) {
+		case map[string]any:
+			name := content["name"]
+			if name == nil {
+				name = content["word"]
+			}
+			got = jsonStr(name)
+		case []any:
+			names := []string{}
+			for _, item := range content {
+				m := item.(map[string]any)
+				if name, ok := m["name"].(string); ok {
+					names = append(names, name)
+				} else {
+					names = append(names, m["word"].(string))
+				}
+			}
+			got = fmt.Sprint(names)
+		}
+		if got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+}
+
+// The demo database is shared by all of the connections in the pool, so every
+// feature works in demo mode.
+func TestOpenMemoryDb(t *testing.T) {
+	// Skips the test if SQLite was built without FTS5, which Init needs.
+	newTestDbNoInit(t)
+	db, err := openMemoryDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	addTestLang(t, db, "spanish")
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	if _, err := db.newList("spanish", NewWordList{Name: "pets", WordIds: []int64{perro.Id}}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Holds a connection so the next query uses another.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var n int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM words`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("expected 1 word, got %d (%v)", n, err)
+	}
+	list, err := db.getList("spanish", "pets")
+	if err != nil || fmt.Sprint(wordNames(list.Words)) != "[perro]" {
+		t.Errorf("unexpected list: %+v (%v)", list, err)
+	}
+	revs, err := db.getWordHistory("spanish", perro.Id)
+	if err != nil || len(revs) != 1 {
+		t.Errorf("expected 1 revision, got %d (%v)", len(revs), err)
+	}
+}
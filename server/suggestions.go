@@ -0,0 +1,654 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+	"golang.org/x/text/language"
+)
+
+type SuggestionKind string
+
+const (
+	SuggestionAdd    SuggestionKind = "add"
+	SuggestionEdit   SuggestionKind = "edit"
+	SuggestionDelete SuggestionKind = "delete"
+)
+
+func (sk SuggestionKind) IsValid() bool {
+	return sk == SuggestionAdd || sk == SuggestionEdit || sk == SuggestionDelete
+}
+
+type SuggestionStatus string
+
+const (
+	SuggestionPending  SuggestionStatus = "pending"
+	SuggestionApproved SuggestionStatus = "approved"
+	SuggestionRejected SuggestionStatus = "rejected"
+)
+
+func (ss SuggestionStatus) IsValid() bool {
+	return ss == SuggestionPending ||
+		ss == SuggestionApproved ||
+		ss == SuggestionRejected
+}
+
+// Suggestion is a change to a language's words proposed by a user, which is
+// applied once approved by the language's owner or an admin.
+type Suggestion struct {
+	Id       int64          `json:"id"`
+	LangId   int64          `json:"langId"`
+	UserId   int64          `json:"userId"`
+	Username string         `json:"username"`
+	Kind     SuggestionKind `json:"kind"`
+	// WordId is the word being edited or deleted, or the word that was added
+	// once an add is approved.
+	WordId int64 `json:"wordId,omitempty"`
+	// Diff is the proposed word for adds and the changes for edits (empty for
+	// deletes).
+	Diff    WordDiff         `json:"diff"`
+	Comment string           `json:"comment,omitempty"`
+	Status  SuggestionStatus `json:"status"`
+	// Reason is why the suggestion was rejected.
+	Reason     string `json:"reason,omitempty"`
+	CreatedAt  int64  `json:"createdAt"`
+	ReviewedBy int64  `json:"reviewedBy,omitempty"`
+	ReviewedAt int64  `json:"reviewedAt,omitempty"`
+}
+
+type NewSuggestion struct {
+	Kind SuggestionKind `json:"kind"`
+	// Diff is the word to add, or the changes to make to the word with the ID
+	// (only the ID is needed for deletes).
+	Diff    WordDiff `json:"diff"`
+	Comment string   `json:"comment,omitempty"`
+}
+
+// FieldChange is a change to one of a word's fields. Old is nil for adds and
+// New is nil for deletes.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old,omitempty"`
+	New   any    `json:"new,omitempty"`
+}
+
+// SuggestionDiff is a suggestion along with the word as it currently is (nil
+// for adds, or if the word has since been deleted) and the changes that would
+// be made to it.
+type SuggestionDiff struct {
+	Suggestion Suggestion    `json:"suggestion"`
+	Current    *Word         `json:"current,omitempty"`
+	Changes    []FieldChange `json:"changes"`
+}
+
+type RejectRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Returns the DB used for suggestions. Users can suggest changes to their own
+// languages and those shared with the community, so the DB is scoped to both
+// (and limited to the token's languages if the request used a restricted
+// token).
+func (s *Server) communityDb(c *jmux.Context) *DB {
+	return s.db.asUser(userScope(c)).withShared().withLangs(tokenLangIds(c))
+}
+
+// Returns the request's user if they are an admin, otherwise responds with
+// 403.
+func requireAdmin(c *jmux.Context) (User, bool) {
+	user, _ := userFromContext(c)
+	if !user.IsAdmin {
+		c.WriteError(http.StatusForbidden, errRespJson(ErrForbidden.Error()))
+		return user, false
+	}
+	return user, true
+}
+
+func (s *Server) newSuggestionHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	ns := NewSuggestion{}
+	if err := c.ReadBodyJSON(&ns); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+	user, _ := userFromContext(c)
+	sugg, err := s.communityDb(c).newSuggestion(lang, user.Id, ns, time.Now())
+	code, resp := http.StatusOK, Response[Suggestion]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error adding suggestion to lang %s: %v", lang, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = sugg
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Lists suggestions, optionally for a single language. Admins get everyone's
+// suggestions while other users only get their own and those to their
+// languages. The "status" query param filters by status ("pending" by
+// default, or "all").
+func (s *Server) getSuggestionsHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	if lang == "" {
+		lang = c.Query().Get("lang")
+	}
+	status := SuggestionStatus(c.Query().Get("status"))
+	if status == "" {
+		status = SuggestionPending
+	} else if status == "all" {
+		status = ""
+	} else if !status.IsValid() {
+		c.BadRequest(errRespJson("invalid value for 'status'"))
+		return
+	}
+	user, _ := userFromContext(c)
+	userId := user.Id
+	if user.IsAdmin {
+		userId = 0
+	}
+	suggs, err := s.communityDb(c).getSuggestions(lang, userId, status)
+	code, resp := http.StatusOK, Response[[]Suggestion]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Print("error getting suggestions: ", err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = suggs
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Gets the suggestion along with the changes it would make. Users can only get
+// their own suggestions and those they can review.
+func (s *Server) getSuggestionHandler(c *jmux.Context) {
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid suggestion ID"))
+		return
+	}
+	user, _ := userFromContext(c)
+	db := s.communityDb(c)
+	sd, err := db.getSuggestionDiff(id)
+	if err == nil && sd.Suggestion.UserId != user.Id {
+		if err = checkReviewer(db, sd.Suggestion, user); errors.Is(err, ErrForbidden) {
+			err = ErrNoSuggestionFound
+		}
+	}
+	code, resp := http.StatusOK, Response[SuggestionDiff]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error getting suggestion %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = sd
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Approves the suggestion. Only the language's owner and admins can review
+// suggestions; other users get 403 Forbidden.
+func (s *Server) approveSuggestionHandler(c *jmux.Context) {
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid suggestion ID"))
+		return
+	}
+	user, _ := userFromContext(c)
+	sugg, err := s.communityDb(c).approveSuggestion(id, user, time.Now())
+	code, resp := http.StatusOK, Response[Suggestion]{}
+	if err != nil {
+		if errors.Is(err, ErrForbidden) {
+			code, resp.Error = http.StatusForbidden, err.Error()
+		} else if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error approving suggestion %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = sugg
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Rejects the suggestion. Reviewers are checked like approveSuggestionHandler.
+func (s *Server) rejectSuggestionHandler(c *jmux.Context) {
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid suggestion ID"))
+		return
+	}
+	req := RejectRequest{}
+	if err := c.ReadBodyJSON(&req); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+	user, _ := userFromContext(c)
+	sugg, err := s.communityDb(c).rejectSuggestion(
+		id, user, req.Reason, time.Now(),
+	)
+	code, resp := http.StatusOK, Response[Suggestion]{}
+	if err != nil {
+		if errors.Is(err, ErrForbidden) {
+			code, resp.Error = http.StatusForbidden, err.Error()
+		} else if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error rejecting suggestion %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = sugg
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+const suggestionCols = `suggestions.id,suggestions.lang_id,
+suggestions.user_id,users.username,suggestions.kind,
+IFNULL(suggestions.word_id,0),suggestions.diff,suggestions.comment,
+suggestions.status,suggestions.reason,suggestions.created_at,
+IFNULL(suggestions.reviewed_by,0),IFNULL(suggestions.reviewed_at,0)`
+
+const suggestionsFrom = ` FROM suggestions
+JOIN users ON users.id=suggestions.user_id`
+
+func scanSuggestion(dbs DBScanner) (sugg Suggestion, err error) {
+	diff := ""
+	err = dbs.Scan(
+		&sugg.Id, &sugg.LangId, &sugg.UserId, &sugg.Username, &sugg.Kind,
+		&sugg.WordId, &diff, &sugg.Comment, &sugg.Status, &sugg.Reason,
+		&sugg.CreatedAt, &sugg.ReviewedBy, &sugg.ReviewedAt,
+	)
+	if err == nil {
+		err = json.Unmarshal([]byte(diff), &sugg.Diff)
+	}
+	return
+}
+
+// Adds a pending suggestion by the user to the language. The word being
+// edited or deleted must exist.
+func (db *DB) newSuggestion(
+	lang string,
+	userId int64,
+	ns NewSuggestion,
+	now time.Time,
+) (Suggestion, error) {
+	sugg := Suggestion{
+		UserId:    userId,
+		Kind:      ns.Kind,
+		Diff:      ns.Diff,
+		Comment:   normalizeText(ns.Comment),
+		Status:    SuggestionPending,
+		CreatedAt: now.Unix(),
+	}
+	if err := sugg.Diff.normalize(); err != nil {
+		return Suggestion{}, err
+	}
+	switch sugg.Kind {
+	case SuggestionAdd:
+		if sugg.Diff.Id != 0 || sugg.Diff.Word == nil {
+			return Suggestion{}, fmt.Errorf(
+				"%w: adds must have a word and no ID", ErrInvalidSuggestion,
+			)
+		}
+	case SuggestionEdit:
+		if sugg.Diff.Id == 0 || sugg.Diff.isEmpty() {
+			return Suggestion{}, fmt.Errorf(
+				"%w: edits must have an ID and changes", ErrInvalidSuggestion,
+			)
+		}
+	case SuggestionDelete:
+		if sugg.Diff.Id == 0 {
+			return Suggestion{}, fmt.Errorf(
+				"%w: deletes must have an ID", ErrInvalidSuggestion,
+			)
+		}
+		sugg.Diff = WordDiff{Id: sugg.Diff.Id}
+	default:
+		return Suggestion{}, fmt.Errorf(
+			"%w: invalid kind %q", ErrInvalidSuggestion, sugg.Kind,
+		)
+	}
+
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return Suggestion{}, err
+	}
+	sugg.LangId = langId
+	// Checked now so suggestions that can't be applied are never reviewed.
+	l, err := db.getLangById(langId)
+	if err != nil {
+		return Suggestion{}, err
+	} else if err := sugg.Diff.checkMeta(l.Genders); err != nil {
+		return Suggestion{}, err
+	}
+	if sugg.Kind != SuggestionAdd {
+		word, err := db.getWordById(strconv.FormatInt(langId, 10), sugg.Diff.Id)
+		if err != nil {
+			return Suggestion{}, err
+		}
+		sugg.WordId = word.Id
+	}
+
+	wordId := sql.NullInt64{Int64: sugg.WordId, Valid: sugg.WordId != 0}
+	err = db.QueryRow(
+		`INSERT INTO suggestions(lang_id,user_id,kind,word_id,diff,comment,status,
+      created_at)
+    VALUES (?,?,?,?,?,?,?,?)
+    RETURNING id,(SELECT username FROM users WHERE id=user_id)`,
+		sugg.LangId, sugg.UserId, sugg.Kind, wordId, jsonStr(sugg.Diff),
+		sugg.Comment, sugg.Status, sugg.CreatedAt,
+	).Scan(&sugg.Id, &sugg.Username)
+	return sugg, err
+}
+
+// Gets the suggestions, newest first. If lang is non-empty, only the
+// language's suggestions are returned; if userId is non-zero, only the user's
+// suggestions and those to the user's languages are; if status is non-empty,
+// only suggestions with the status are.
+func (db *DB) getSuggestions(
+	lang string,
+	userId int64,
+	status SuggestionStatus,
+) ([]Suggestion, error) {
+	cond, args := db.langIdCond("suggestions.lang_id")
+	if lang != "" {
+		langId, err := db.getLangId(lang)
+		if err != nil {
+			return nil, err
+		}
+		cond, args = cond+" AND suggestions.lang_id=?", append(args, langId)
+	}
+	if userId != 0 {
+		cond += ` AND (suggestions.user_id=? OR suggestions.lang_id IN (
+      SELECT id FROM languages WHERE owner_id=?
+    ))`
+		args = append(args, userId, userId)
+	}
+	if status != "" {
+		cond, args = cond+" AND suggestions.status=?", append(args, status)
+	}
+	rows, err := db.Query(
+		`SELECT `+suggestionCols+suggestionsFrom+` WHERE `+cond+`
+    ORDER BY suggestions.id DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggs := []Suggestion{}
+	for rows.Next() {
+		sugg, err := scanSuggestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		suggs = append(suggs, sugg)
+	}
+	return suggs, rows.Err()
+}
+
+func (db *DB) getSuggestion(id int64) (Suggestion, error) {
+	cond, args := db.langIdCond("suggestions.lang_id")
+	row := db.QueryRow(
+		`SELECT `+suggestionCols+suggestionsFrom+`
+    WHERE suggestions.id=? AND `+cond,
+		append([]any{id}, args...)...,
+	)
+	sugg, err := scanSuggestion(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNoSuggestionFound
+	}
+	return sugg, err
+}
+
+func (db *DB) getSuggestionDiff(id int64) (SuggestionDiff, error) {
+	sugg, err := db.getSuggestion(id)
+	if err != nil {
+		return SuggestionDiff{}, err
+	}
+	sd := SuggestionDiff{Suggestion: sugg}
+	if sugg.WordId != 0 {
+		word, err := db.getWordById(strconv.FormatInt(sugg.LangId, 10), sugg.WordId)
+		if err == nil {
+			sd.Current = &word
+		} else if !errors.Is(err, ErrNoWordFound) {
+			return SuggestionDiff{}, err
+		}
+	}
+	sd.Changes = suggestionChanges(sugg, sd.Current)
+	return sd, nil
+}
+
+// Approves the pending suggestion, applying it to the language. The status is
+// set and the changes made in a single transaction, so the suggestion is
+// applied exactly once, even with concurrent reviews.
+func (db *DB) approveSuggestion(
+	id int64,
+	reviewer User,
+	now time.Time,
+) (Suggestion, error) {
+	sugg, err := db.getSuggestion(id)
+	if err != nil {
+		return Suggestion{}, err
+	} else if err := checkReviewer(db, sugg, reviewer); err != nil {
+		return Suggestion{}, err
+	} else if sugg.Status != SuggestionPending {
+		return Suggestion{}, ErrSuggestionReviewed
+	}
+
+	// The changes are checked before the transaction like addWord and editWord.
+	lang := strconv.FormatInt(sugg.LangId, 10)
+	word, wd, tag := Word{}, WordDiff{}, language.Und
+	switch sugg.Kind {
+	case SuggestionAdd:
+		word, tag, err = db.checkNewWord(lang, sugg.Diff.toWord())
+	case SuggestionEdit:
+		wd = sugg.Diff
+		wd.Id = sugg.WordId
+		_, tag, err = db.checkWordDiff(lang, &wd)
+	}
+	if err != nil {
+		return Suggestion{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Suggestion{}, err
+	}
+	defer tx.Rollback()
+
+	err = reviewSuggestion(tx, &sugg, SuggestionApproved, reviewer.Id, "", now)
+	if err != nil {
+		return Suggestion{}, err
+	}
+	// The changes are recorded as being made by the reviewer.
+	editDb := db.actingAs(reviewer.Id)
+	switch sugg.Kind {
+	case SuggestionAdd:
+		if err = editDb.addWordTx(tx, &word, tag, now); err == nil {
+			sugg.WordId = word.Id
+			_, err = tx.Exec(
+				`UPDATE suggestions SET word_id=? WHERE id=?`, sugg.WordId, sugg.Id,
+			)
+		}
+	case SuggestionEdit:
+		_, err = editDb.editWordTx(tx, sugg.LangId, tag, &wd, 0, now)
+	case SuggestionDelete:
+		if word, err = getWordTx(tx, sugg.LangId, sugg.WordId); err == nil {
+			err = editDb.delWordTx(tx, word, now)
+		}
+	}
+	if err != nil {
+		return Suggestion{}, err
+	}
+	return sugg, tx.Commit()
+}
+
+// Rejects the pending suggestion. A reason is required.
+func (db *DB) rejectSuggestion(
+	id int64,
+	reviewer User,
+	reason string,
+	now time.Time,
+) (Suggestion, error) {
+	reason = normalizeText(reason)
+	if reason == "" {
+		return Suggestion{}, ErrMissingRejectReason
+	}
+	sugg, err := db.getSuggestion(id)
+	if err != nil {
+		return Suggestion{}, err
+	} else if err := checkReviewer(db, sugg, reviewer); err != nil {
+		return Suggestion{}, err
+	}
+	err = reviewSuggestion(db, &sugg, SuggestionRejected, reviewer.Id, reason, now)
+	return sugg, err
+}
+
+// Returns ErrForbidden unless the user can review the suggestion. Admins can
+// review any suggestion, and other users those to their own languages.
+func checkReviewer(q DBQuerier, sugg Suggestion, reviewer User) error {
+	if reviewer.IsAdmin {
+		return nil
+	}
+	var ownerId int64
+	err := q.QueryRow(
+		`SELECT IFNULL(owner_id,0) FROM languages WHERE id=?`, sugg.LangId,
+	).Scan(&ownerId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNoLangFound
+		}
+		return err
+	} else if ownerId != reviewer.Id {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Sets the pending suggestion's status, returning ErrSuggestionReviewed if it
+// has already been reviewed.
+func reviewSuggestion(
+	ex DBExecer,
+	sugg *Suggestion,
+	status SuggestionStatus,
+	reviewerId int64,
+	reason string,
+	now time.Time,
+) error {
+	res, err := ex.Exec(
+		`UPDATE suggestions SET status=?,reason=?,reviewed_by=?,reviewed_at=?
+    WHERE id=? AND status=?`,
+		status, reason, reviewerId, now.Unix(), sugg.Id, SuggestionPending,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSuggestionReviewed
+	}
+	sugg.Status, sugg.Reason = status, reason
+	sugg.ReviewedBy, sugg.ReviewedAt = reviewerId, now.Unix()
+	return nil
+}
+
+// Returns the changes the suggestion makes to the current word (which may be
+// nil).
+func suggestionChanges(sugg Suggestion, current *Word) []FieldChange {
+	changes := []FieldChange{}
+	add := func(field string, old, new any) {
+		changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+	}
+	if sugg.Kind == SuggestionDelete {
+		if current != nil {
+			add("word", current.Word, nil)
+			add("definition", current.Definition, nil)
+			add("aliases", current.Aliases, nil)
+			add("tags", current.Tags, nil)
+			add("notes", current.Notes, nil)
+			add("pos", current.Pos, nil)
+			add("gender", current.Gender, nil)
+			add("plural", current.Plural, nil)
+			add("register", current.Register, nil)
+			add("cefr", current.CEFR, nil)
+		}
+		return changes
+	}
+
+	// The old values are left nil for adds and words that no longer exist.
+	old := func(get func(*Word) any) any {
+		if current == nil || sugg.Kind == SuggestionAdd {
+			return nil
+		}
+		return get(current)
+	}
+	wd := sugg.Diff
+	if wd.Word != nil {
+		add("word", old(func(w *Word) any { return w.Word }), *wd.Word)
+	}
+	if wd.Definition != nil {
+		add("definition", old(func(w *Word) any { return w.Definition }), *wd.Definition)
+	}
+	if wd.Aliases != nil {
+		add("aliases", old(func(w *Word) any { return w.Aliases }), *wd.Aliases)
+	}
+	if wd.Tags != nil {
+		add("tags", old(func(w *Word) any { return w.Tags }), *wd.Tags)
+	}
+	if wd.Notes != nil {
+		add("notes", old(func(w *Word) any { return w.Notes }), *wd.Notes)
+	}
+	if wd.Pos != nil {
+		add("pos", old(func(w *Word) any { return w.Pos }), *wd.Pos)
+	}
+	if wd.Gender != nil {
+		add("gender", old(func(w *Word) any { return w.Gender }), *wd.Gender)
+	}
+	if wd.Plural != nil {
+		add("plural", old(func(w *Word) any { return w.Plural }), *wd.Plural)
+	}
+	if wd.Register != nil {
+		add("register", old(func(w *Word) any { return w.Register }), *wd.Register)
+	}
+	if wd.CEFR != nil {
+		add("cefr", old(func(w *Word) any { return w.CEFR }), *wd.CEFR)
+	}
+	return changes
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Creates an admin and the users alice and bob. Alice owns the private
+// language "spanish" and the shared language "french".
+func newSuggestionsTestDb(t *testing.T) (db *DB, admin, alice, bob User) {
+	t.Helper()
+	db = newTestDb(t)
+	now := time.Now()
+	users := []User{}
+	for _, name := range []string{"admin", "alice", "bob"} {
+		user, err := db.newUser(name, "password123", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	admin, alice, bob = users[0], users[1], users[2]
+	for _, lang := range []Lang{{Name: "spanish"}, {Name: "french", Shared: true}} {
+		if err := db.asUser(alice.Id).newLang(&lang, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+// Returns the DB used for the user's suggestions, like Server.communityDb.
+func communityDbFor(db *DB, user User) *DB {
+	return db.asUser(user.Id).withShared()
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestSuggestionScope(t *testing.T) {
+	db, _, alice, bob := newSuggestionsTestDb(t)
+	now := time.Now()
+	addTestWord(t, db.asUser(alice.Id), "spanish", "perro", "dog")
+	add := NewSuggestion{Kind: SuggestionAdd, Diff: WordDiff{Word: strPtr("chat")}}
+
+	bobDb := communityDbFor(db, bob)
+	if _, err := bobDb.newSuggestion("spanish", bob.Id, add, now); err != ErrNoLangFound {
+		t.Errorf("expected private language not to be found, got %v", err)
+	}
+	sugg, err := bobDb.newSuggestion("french", bob.Id, add, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	langs, err := bobDb.getLangs()
+	if err != nil || len(langs) != 1 || langs[0].Name != "french" {
+		t.Errorf("expected only the shared language, got %+v (%v)", langs, err)
+	}
+
+	// The user's own language is preferred over shared ones with its name.
+	bobFrench := Lang{Name: "french"}
+	if err := db.asUser(bob.Id).newLang(&bobFrench, now); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := bobDb.getLangId("french"); err != nil || id != bobFrench.Id {
+		t.Errorf("expected bob's language %d, got %d (%v)", bobFrench.Id, id, err)
+	}
+	if id, err := bobDb.getLangId(strconv.FormatInt(sugg.LangId, 10)); err != nil ||
+		id != sugg.LangId {
+		t.Errorf("expected alice's language by ID, got %d (%v)", id, err)
+	}
+	// Other users' shared languages with the same name are ambiguous.
+	carol, err := db.newUser("carol", "password123", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.asUser(carol.Id).newLang(&Lang{Name: "french", Shared: true}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := communityDbFor(db, carol).getLangId("french"); err != nil {
+		t.Errorf("expected carol's own language, got %v", err)
+	}
+	dave, err := db.newUser("dave", "password123", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := communityDbFor(db, dave).getLangId("french"); err != ErrAmbiguousLang {
+		t.Errorf("expected ErrAmbiguousLang, got %v", err)
+	}
+}
+
+func TestReviewSuggestions(t *testing.T) {
+	db, admin, alice, bob := newSuggestionsTestDb(t)
+	now := time.Now()
+	perro := addTestWord(t, db.asUser(alice.Id), "french", "perro", "dog")
+	gato := addTestWord(t, db.asUser(alice.Id), "french", "gato", "cat")
+	bobDb := communityDbFor(db, bob)
+	newSugg := func(ns NewSuggestion) Suggestion {
+		t.Helper()
+		sugg, err := bobDb.newSuggestion("french", bob.Id, ns, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sugg
+	}
+	add := newSugg(NewSuggestion{Kind: SuggestionAdd, Diff: WordDiff{Word: strPtr("chien")}})
+	edit := newSugg(NewSuggestion{
+		Kind: SuggestionEdit, Diff: WordDiff{Id: perro.Id, Definition: strPtr("a dog")},
+	})
+	del := newSugg(NewSuggestion{Kind: SuggestionDelete, Diff: WordDiff{Id: gato.Id}})
+	reject := newSugg(NewSuggestion{Kind: SuggestionDelete, Diff: WordDiff{Id: perro.Id}})
+
+	// Only the language's owner and admins can review suggestions.
+	if _, err := bobDb.approveSuggestion(add.Id, bob, now); err != ErrForbidden {
+		t.Errorf("expected ErrForbidden, got %v", err)
+	}
+	if _, err := bobDb.rejectSuggestion(reject.Id, bob, "no", now); err != ErrForbidden {
+		t.Errorf("expected ErrForbidden, got %v", err)
+	}
+
+	aliceDb := communityDbFor(db, alice)
+	approved, err := aliceDb.approveSuggestion(add.Id, alice, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Status != SuggestionApproved || approved.ReviewedBy != alice.Id ||
+		approved.WordId == 0 {
+		t.Errorf("unexpected approved suggestion: %+v", approved)
+	}
+	if _, err := aliceDb.approveSuggestion(add.Id, alice, now); err != ErrSuggestionReviewed {
+		t.Errorf("expected ErrSuggestionReviewed, got %v", err)
+	}
+	if _, err := aliceDb.approveSuggestion(edit.Id, alice, now); err != nil {
+		t.Fatal(err)
+	}
+	adminDb := communityDbFor(db, admin)
+	if _, err := adminDb.approveSuggestion(del.Id, admin, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aliceDb.rejectSuggestion(reject.Id, alice, " ", now); err != ErrMissingRejectReason {
+		t.Errorf("expected ErrMissingRejectReason, got %v", err)
+	}
+	rejected, err := aliceDb.rejectSuggestion(reject.Id, alice, "keep it", now)
+	if err != nil || rejected.Status != SuggestionRejected || rejected.Reason != "keep it" {
+		t.Errorf("unexpected rejected suggestion: %+v (%v)", rejected, err)
+	}
+
+	words, err := db.asUser(alice.Id).getAllWords("french")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defs := map[string]string{}
+	for _, word := range words {
+		defs[word.Word] = word.Definition
+	}
+	if len(defs) != 2 || defs["perro"] != "a dog" || defs["chien"] != "" {
+		t.Errorf("unexpected words after approvals: %v", defs)
+	}
+	// The changes are recorded as made by the reviewers.
+	history, err := db.asUser(alice.Id).getWordHistory("french", gato.Id)
+	if err != nil || len(history) != 2 || history[0].UserId != admin.Id {
+		t.Errorf("unexpected history: %+v (%v)", history, err)
+	}
+
+	// Alice sees suggestions to her languages, and bob his own.
+	for _, user := range []User{alice, bob} {
+		suggs, err := communityDbFor(db, user).getSuggestions("", user.Id, "")
+		if err != nil || len(suggs) != 4 {
+			t.Errorf("expected %s to see 4 suggestions, got %d (%v)", user.Username, len(suggs), err)
+		}
+	}
+}
+
+// A suggestion that can't be applied is left pending.
+func TestApproveSuggestionRollback(t *testing.T) {
+	db, _, alice, bob := newSuggestionsTestDb(t)
+	now := time.Now()
+	aliceDb := communityDbFor(db, alice)
+	perro := addTestWord(t, db.asUser(alice.Id), "french", "perro", "dog")
+	sugg, err := communityDbFor(db, bob).newSuggestion("french", bob.Id, NewSuggestion{
+		Kind: SuggestionEdit, Diff: WordDiff{Id: perro.Id, Definition: strPtr("a dog")},
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aliceDb.delWordById("french", perro.Id, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aliceDb.approveSuggestion(sugg.Id, alice, now); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound, got %v", err)
+	}
+	if got, err := aliceDb.getSuggestion(sugg.Id); err != nil || got.Status != SuggestionPending {
+		t.Errorf("expected suggestion to be pending, got %+v (%v)", got, err)
+	}
+}
+
+func TestApproveSuggestionConcurrent(t *testing.T) {
+	db, _, alice, bob := newSuggestionsTestDb(t)
+	now := time.Now()
+	sugg, err := communityDbFor(db, bob).newSuggestion("french", bob.Id, NewSuggestion{
+		Kind: SuggestionAdd, Diff: WordDiff{Word: strPtr("chien")},
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 16
+	aliceDb := communityDbFor(db, alice)
+	var wg sync.WaitGroup
+	start, errs := make(chan struct{}), make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := aliceDb.approveSuggestion(sugg.Id, alice, now)
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	approved := 0
+	for err := range errs {
+		if err == nil {
+			approved++
+		} else if err != ErrSuggestionReviewed {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	words, err := db.asUser(alice.Id).getAllWords("french")
+	if approved != 1 || err != nil || len(words) != 1 {
+		t.Errorf("expected 1 approval and word, got %d and %d (%v)", approved, len(words), err)
+	}
+}
+
+func TestSuggestionHandlers(t *testing.T) {
+	srvr := newTestServer(t, newTestDb(t))
+	admin, alice, bob := newTestClient(t, srvr), newTestClient(t, srvr), newTestClient(t, srvr)
+	admin.register("admin")
+	alice.register("alice")
+	bob.register("bob")
+	for _, lang := range []Lang{{Name: "spanish"}, {Name: "french", Shared: true}} {
+		if code := alice.do(http.MethodPost, "/langs", lang, nil); code != http.StatusOK {
+			t.Fatalf("error creating %s: %d", lang.Name, code)
+		}
+	}
+
+	langsResp := Response[[]Lang]{}
+	if code := bob.do(http.MethodGet, "/langs?shared=true", nil, &langsResp); code != http.StatusOK ||
+		len(langsResp.Content) != 1 || !langsResp.Content[0].Shared {
+		t.Errorf("expected the shared language, got %+v (%d)", langsResp.Content, code)
+	}
+	ns := NewSuggestion{Kind: SuggestionAdd, Diff: WordDiff{Word: strPtr("chien")}}
+	if code := bob.do(http.MethodPost, "/langs/spanish/suggestions", ns, nil); code != http.StatusBadRequest {
+		t.Errorf("expected suggesting to a private language to fail, got %d", code)
+	}
+	resp := Response[Suggestion]{}
+	if code := bob.do(http.MethodPost, "/langs/french/suggestions", ns, &resp); code != http.StatusOK {
+		t.Fatalf("error adding suggestion: %d %s", code, resp.Error)
+	}
+	path := "/suggestions/" + strconv.FormatInt(resp.Content.Id, 10)
+
+	carol := newTestClient(t, srvr)
+	carol.register("carol")
+	tests := []struct {
+		name   string
+		tc     *testClient
+		method string
+		path   string
+		body   any
+		code   int
+	}{
+		{"author gets", bob, http.MethodGet, path, nil, http.StatusOK},
+		{"owner gets", alice, http.MethodGet, path, nil, http.StatusOK},
+		{"other user gets", carol, http.MethodGet, path, nil, http.StatusBadRequest},
+		{"author approves", bob, http.MethodPost, path + "/approve", nil, http.StatusForbidden},
+		{"other user rejects", carol, http.MethodPost, path + "/reject", RejectRequest{"no"}, http.StatusForbidden},
+		{"owner approves", alice, http.MethodPost, path + "/approve", nil, http.StatusOK},
+		{"admin approves again", admin, http.MethodPost, path + "/approve", nil, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if code := test.tc.do(test.method, test.path, test.body, nil); code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, code)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeText trims the text and converts it to NFC so that composed and
+// decomposed forms of the same text are stored the same way.
+func normalizeText(s string) string {
+	return norm.NFC.String(strings.TrimSpace(s))
+}
+
+func normalizeTexts(ss []string) []string {
+	for i, s := range ss {
+		ss[i] = normalizeText(s)
+	}
+	return ss
+}
+
+// foldWord returns the key used for accent- and case-insensitive lookups. The
+// word is lowercased using the rules of the given language, case folded, then
+// has its diacritics stripped.
+func foldWord(word string, tag language.Tag) string {
+	t := transform.Chain(
+		cases.Lower(tag),
+		cases.Fold(),
+		norm.NFD,
+		runes.Remove(runes.In(unicode.Mn)),
+		norm.NFC,
+	)
+	folded, _, err := transform.String(t, strings.TrimSpace(word))
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(word))
+	}
+	return folded
+}
+
+// langTag guesses the BCP-47 tag of a language from its name and aliases
+// (e.g., a language named "spanish" with the alias "es"). Returns
+// language.Und if none are valid tags.
+func langTag(name string, aliases []string) language.Tag {
+	for _, s := range append([]string{name}, aliases...) {
+		if tag, err := language.Parse(s); err == nil {
+			return tag
+		}
+	}
+	return language.Und
+}
+
+// editDistance returns the optimal string alignment distance between the
+// strings (Levenshtein distance, also counting adjacent transpositions as a
+// single edit).
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// Only the last 3 rows are needed.
+	n := len(rb) + 1
+	prev2, prev, curr := make([]int, n), make([]int, n), make([]int, n)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = minInt(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
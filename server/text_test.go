@@ -0,0 +1,113 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"", ""},
+		{"  perro\t", "perro"},
+		// Decomposed forms are composed.
+		{"cafe\u0301", "café"},
+		{"café", "café"},
+		{"n\u0303ame", "ñame"},
+	}
+	for _, test := range tests {
+		if got := normalizeText(test.s); got != test.want {
+			t.Errorf("normalizeText(%q): expected %q, got %q", test.s, test.want, got)
+		}
+	}
+}
+
+func TestFoldWord(t *testing.T) {
+	tests := []struct {
+		word string
+		tag  language.Tag
+		want string
+	}{
+		{"Perro", language.Spanish, "perro"},
+		{" Árbol ", language.Spanish, "arbol"},
+		{"cafe\u0301", language.French, "cafe"},
+		{"Straße", language.German, "strasse"},
+		{"ÇA", language.French, "ca"},
+		// Turkish has a dotted and dotless I.
+		{"İstanbul", language.Turkish, "istanbul"},
+		{"Iğdır", language.Turkish, "ıgdır"},
+		{"Iğdır", language.Und, "igdır"},
+		{"ΣΟΦΌΣ", language.Greek, "σοφοσ"},
+	}
+	for _, test := range tests {
+		if got := foldWord(test.word, test.tag); got != test.want {
+			t.Errorf(
+				"foldWord(%q, %v): expected %q, got %q",
+				test.word, test.tag, test.want, got,
+			)
+		}
+	}
+}
+
+func TestLangTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases []string
+		want    language.Tag
+	}{
+		{"es", nil, language.Spanish},
+		{"spanish", []string{"es"}, language.Spanish},
+		{"spanish", []string{"nope", "pt-BR"}, language.BrazilianPortuguese},
+		{"spanish", nil, language.Und},
+	}
+	for _, test := range tests {
+		if got := langTag(test.name, test.aliases); got != test.want {
+			t.Errorf(
+				"langTag(%q, %v): expected %v, got %v",
+				test.name, test.aliases, test.want, got,
+			)
+		}
+	}
+}
+
+func TestGetWordFold(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish", "es")
+	arbol := Word{Word: "A\u0301rbol", Definition: "tree", Aliases: []string{"Ñandú"}}
+	if err := db.addWord("spanish", &arbol, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if arbol.Word != "Árbol" {
+		t.Errorf("expected the word to be composed, got %q", arbol.Word)
+	}
+
+	tests := []struct {
+		word       string
+		aliases    []string
+		like, fold bool
+		found      bool
+	}{
+		{"Árbol", nil, false, false, true},
+		{"A\u0301rbol", nil, false, false, true},
+		{"arbol", nil, false, false, false},
+		{"arbol", nil, false, true, true},
+		{"ARBOL", nil, false, true, true},
+		{"rbo", nil, true, true, true},
+		{"rbo", nil, false, true, false},
+		{"x", []string{"nandu"}, false, true, true},
+		{"x", []string{"nandu"}, false, false, false},
+	}
+	for _, test := range tests {
+		word, err := db.getWord(
+			"spanish", test.word, test.like, test.fold, test.aliases...,
+		)
+		if test.found && (err != nil || word.Id != arbol.Id) {
+			t.Errorf("expected to find %+v, got %d (%v)", test, word.Id, err)
+		} else if !test.found && err != ErrNoWordFound {
+			t.Errorf("expected not to find %+v, got %d (%v)", test, word.Id, err)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+	"github.com/spf13/cobra"
+)
+
+const (
+	tokenPrefix     = "ll_"
+	maxTokenNameLen = 64
+	// How often the last used time of a token is updated.
+	tokenUsedInterval = time.Minute
+)
+
+type TokenScope string
+
+const (
+	// TokenScopeRead only allows GET requests.
+	TokenScopeRead  TokenScope = "read"
+	TokenScopeWrite TokenScope = "write"
+)
+
+func (ts TokenScope) IsValid() bool {
+	return ts == TokenScopeRead || ts == TokenScopeWrite
+}
+
+// Allows returns whether a request with the given method is allowed.
+func (ts TokenScope) Allows(method string) bool {
+	if ts == TokenScopeWrite {
+		return true
+	}
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+type APIToken struct {
+	Id     int64      `json:"id"`
+	UserId int64      `json:"userId"`
+	Name   string     `json:"name"`
+	Scope  TokenScope `json:"scope"`
+	// LangIds are the languages the token is restricted to (nil for all of the
+	// user's languages).
+	LangIds    []int64 `json:"langIds,omitempty"`
+	CreatedAt  int64   `json:"createdAt"`
+	LastUsedAt int64   `json:"lastUsedAt,omitempty"`
+	// Token is the secret token, which is only set when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+type NewTokenRequest struct {
+	Name  string     `json:"name"`
+	Scope TokenScope `json:"scope"`
+	// Langs are the names or IDs of the languages to restrict the token to
+	// (all if empty).
+	Langs []string `json:"langs,omitempty"`
+}
+
+// Token management requires logging in with a session so that tokens can't
+// be used to create tokens with more access.
+func sessionOnly(c *jmux.Context) bool {
+	if _, ok := tokenFromContext(c); ok {
+		c.WriteError(
+			http.StatusForbidden,
+			errRespJson("tokens can't be managed using a token"),
+		)
+		return false
+	}
+	return true
+}
+
+func (s *Server) getTokensHandler(c *jmux.Context) {
+	if !sessionOnly(c) {
+		return
+	}
+	user, _ := userFromContext(c)
+	tokens, err := s.db.getTokens(user.Id)
+	code, resp := http.StatusOK, Response[[]APIToken]{}
+	if err != nil {
+		log.Printf("error getting tokens for user %d: %v", user.Id, err)
+		code, resp.Error = http.StatusInternalServerError, "internal server error"
+	} else {
+		resp.Content = tokens
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+func (s *Server) newTokenHandler(c *jmux.Context) {
+	if !sessionOnly(c) {
+		return
+	}
+	req := NewTokenRequest{}
+	if err := c.ReadBodyJSON(&req); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+	user, _ := userFromContext(c)
+	token, err := s.userDb(c).newToken(req, time.Now())
+	code, resp := http.StatusOK, Response[APIToken]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error creating token for user %d: %v", user.Id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = token
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+func (s *Server) revokeTokenHandler(c *jmux.Context) {
+	if !sessionOnly(c) {
+		return
+	}
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid token ID"))
+		return
+	}
+	user, _ := userFromContext(c)
+	token, err := s.db.revokeToken(user.Id, id)
+	code, resp := http.StatusOK, Response[APIToken]{}
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error revoking token %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = token
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Returns the token the request was authenticated with, if any.
+func tokenFromContext(c *jmux.Context) (APIToken, bool) {
+	token, ok := c.Context().Value(tokenCtxKey).(APIToken)
+	return token, ok
+}
+
+const tokenCols = `id,user_id,name,scope,lang_ids,created_at,last_used_at`
+
+func scanToken(dbs DBScanner) (token APIToken, err error) {
+	langIds, lastUsedAt := sql.NullString{}, sql.NullInt64{}
+	err = dbs.Scan(
+		&token.Id, &token.UserId, &token.Name, &token.Scope, &langIds,
+		&token.CreatedAt, &lastUsedAt,
+	)
+	if err != nil {
+		return
+	}
+	token.LastUsedAt = lastUsedAt.Int64
+	if langIds.Valid {
+		err = json.Unmarshal([]byte(langIds.String), &token.LangIds)
+	}
+	return
+}
+
+// Creates a token for the DB's user, returning it with the secret token set.
+func (db *DB) newToken(req NewTokenRequest, now time.Time) (APIToken, error) {
+	token := APIToken{
+		UserId:    db.userId,
+		Name:      normalizeText(req.Name),
+		Scope:     TokenScope(strings.ToLower(string(req.Scope))),
+		CreatedAt: now.Unix(),
+	}
+	if token.Name == "" || len([]rune(token.Name)) > maxTokenNameLen {
+		return APIToken{}, ErrInvalidTokenName
+	}
+	if !token.Scope.IsValid() {
+		return APIToken{}, ErrInvalidTokenScope
+	}
+	for _, lang := range cleanAliases(req.Langs) {
+		langId, err := db.getLangId(lang)
+		if err != nil {
+			return APIToken{}, fmt.Errorf("%w: %s", err, lang)
+		}
+		token.LangIds = append(token.LangIds, langId)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return APIToken{}, err
+	}
+	token.Token = tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	langIds := sql.NullString{}
+	if token.LangIds != nil {
+		langIds = sql.NullString{String: jsonStr(token.LangIds), Valid: true}
+	}
+	res, err := db.Exec(
+		`INSERT INTO api_tokens(user_id,name,token_hash,scope,lang_ids,created_at)
+    VALUES (?,?,?,?,?,?)`,
+		token.UserId, token.Name, hashToken(token.Token), token.Scope, langIds,
+		token.CreatedAt,
+	)
+	if err != nil {
+		return APIToken{}, err
+	}
+	token.Id, err = res.LastInsertId()
+	return token, err
+}
+
+func (db *DB) getTokens(userId int64) ([]APIToken, error) {
+	rows, err := db.Query(
+		`SELECT `+tokenCols+` FROM api_tokens WHERE user_id=? ORDER BY id`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (db *DB) revokeToken(userId, id int64) (APIToken, error) {
+	row := db.QueryRow(
+		`DELETE FROM api_tokens WHERE id=? AND user_id=? RETURNING `+tokenCols,
+		id, userId,
+	)
+	token, err := scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNoTokenFound
+	}
+	return token, err
+}
+
+// Gets the token and the user it belongs to, returning ErrUnauthorized if the
+// token doesn't exist. The token's last used time is updated.
+func (db *DB) getTokenUser(secret string, now time.Time) (User, APIToken, error) {
+	row := db.QueryRow(
+		`SELECT `+prefixCols("api_tokens", tokenCols)+`,`+
+			prefixCols("users", userCols)+` FROM api_tokens
+    JOIN users ON users.id=api_tokens.user_id
+    WHERE api_tokens.token_hash=?`,
+		hashToken(secret),
+	)
+	user := User{}
+	token, err := scanToken(scannerFunc(func(dest ...any) error {
+		return row.Scan(append(
+			dest, &user.Id, &user.Username, &user.IsAdmin, &user.CreatedAt,
+		)...)
+	}))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrUnauthorized
+		}
+		return User{}, APIToken{}, err
+	}
+	_, err = db.Exec(
+		`UPDATE api_tokens SET last_used_at=? WHERE id=? AND
+    IFNULL(last_used_at,0)<=?`,
+		now.Unix(), token.Id, now.Add(-tokenUsedInterval).Unix(),
+	)
+	return user, token, err
+}
+
+func MakeTokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "token",
+		Short:                 "Manage a user's API tokens",
+		DisableFlagsInUseLine: true,
+	}
+	cmd.PersistentFlags().String("db", "lively-langs.db", "Path to database")
+	cmd.PersistentFlags().String("user", "", "User whose tokens to manage")
+	cmd.MarkPersistentFlagRequired("user")
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a token, printing the secret token",
+		Args:  cobra.NoArgs,
+		Run:   runTokenCreate,
+	}
+	flags := createCmd.Flags()
+	flags.String("name", "", "Name of the token")
+	flags.String("scope", string(TokenScopeRead), "Scope of the token (read or write)")
+	flags.StringSlice(
+		"lang", nil,
+		"Language to restrict the token to (can be given multiple times)",
+	)
+	createCmd.MarkFlagRequired("name")
+	cmd.AddCommand(createCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List tokens",
+		Args:  cobra.NoArgs,
+		Run:   runTokenList,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "revoke ID",
+		Short: "Revoke a token",
+		Args:  cobra.ExactArgs(1),
+		Run:   runTokenRevoke,
+	})
+
+	return cmd
+}
+
+func runTokenCreate(cmd *cobra.Command, _ []string) {
+	log.SetFlags(0)
+
+	flags := cmd.Flags()
+	req := NewTokenRequest{
+		Name:  jtutils.First(flags.GetString("name")),
+		Scope: TokenScope(jtutils.First(flags.GetString("scope"))),
+		Langs: jtutils.First(flags.GetStringSlice("lang")),
+	}
+	db, err := openCmdDb(cmd)
+	if err != nil {
+		log.Fatal("error opening database: ", err)
+	}
+	defer db.Close()
+
+	token, err := db.newToken(req, time.Now())
+	if err != nil {
+		log.Fatal("error creating token: ", err)
+	}
+	fmt.Fprintf(os.Stderr, "created token %d (it won't be shown again):\n", token.Id)
+	fmt.Println(token.Token)
+}
+
+func runTokenList(cmd *cobra.Command, _ []string) {
+	log.SetFlags(0)
+
+	db, err := openCmdDb(cmd)
+	if err != nil {
+		log.Fatal("error opening database: ", err)
+	}
+	defer db.Close()
+
+	tokens, err := db.getTokens(db.userId)
+	if err != nil {
+		log.Fatal("error getting tokens: ", err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSCOPE\tLANGS\tCREATED\tLAST USED")
+	for _, token := range tokens {
+		langs := "all"
+		if token.LangIds != nil {
+			langs = strings.Trim(jsonStr(token.LangIds), "[]")
+		}
+		lastUsed := "never"
+		if token.LastUsedAt != 0 {
+			lastUsed = time.Unix(token.LastUsedAt, 0).Format(time.RFC3339)
+		}
+		fmt.Fprintf(
+			tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			token.Id, token.Name, token.Scope, langs,
+			time.Unix(token.CreatedAt, 0).Format(time.RFC3339), lastUsed,
+		)
+	}
+	tw.Flush()
+}
+
+func runTokenRevoke(cmd *cobra.Command, args []string) {
+	log.SetFlags(0)
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		log.Fatal("invalid token ID: ", args[0])
+	}
+	db, err := openCmdDb(cmd)
+	if err != nil {
+		log.Fatal("error opening database: ", err)
+	}
+	defer db.Close()
+
+	token, err := db.revokeToken(db.userId, id)
+	if err != nil {
+		log.Fatal("error revoking token: ", err)
+	}
+	fmt.Printf("revoked token %d (%s)\n", token.Id, token.Name)
+}
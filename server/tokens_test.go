@@ -0,0 +1,161 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenScopeAllows(t *testing.T) {
+	methods := []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete,
+	}
+	tests := []struct {
+		scope   TokenScope
+		allowed []string
+	}{
+		{TokenScopeRead, []string{http.MethodGet, http.MethodHead}},
+		{TokenScopeWrite, methods},
+		// Invalid scopes are treated as read-only.
+		{TokenScope("admin"), []string{http.MethodGet, http.MethodHead}},
+	}
+	for _, test := range tests {
+		for _, method := range methods {
+			want := contains(test.allowed, method)
+			if got := test.scope.Allows(method); got != want {
+				t.Errorf("%s.Allows(%s): expected %v, got %v", test.scope, method, want, got)
+			}
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	db := newTestDb(t)
+	now := time.Now()
+	alice, err := db.newUser("alice", "password123", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := db.newUser("bob", "password123", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceDb := db.asUser(alice.Id)
+	spanish := Lang{Name: "spanish"}
+	if err := aliceDb.newLang(&spanish, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.asUser(bob.Id).newLang(&Lang{Name: "french"}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		req  NewTokenRequest
+		want []int64
+		err  error
+	}{
+		{NewTokenRequest{Name: "all", Scope: "READ"}, nil, nil},
+		{NewTokenRequest{Name: "spanish", Scope: "write", Langs: []string{"spanish"}}, []int64{spanish.Id}, nil},
+		{NewTokenRequest{Name: " ", Scope: "read"}, nil, ErrInvalidTokenName},
+		{NewTokenRequest{Name: strings.Repeat("x", maxTokenNameLen+1), Scope: "read"}, nil, ErrInvalidTokenName},
+		{NewTokenRequest{Name: "admin", Scope: "admin"}, nil, ErrInvalidTokenScope},
+		// Tokens can't be restricted to other users' languages.
+		{NewTokenRequest{Name: "french", Scope: "read", Langs: []string{"french"}}, nil, ErrNoLangFound},
+	}
+	tokens := []APIToken{}
+	for _, test := range tests {
+		token, err := aliceDb.newToken(test.req, now)
+		if test.err != nil {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err.Error()) {
+				t.Errorf("newToken(%+v): expected %v, got %v", test.req, test.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(token.Token, tokenPrefix) ||
+			fmt.Sprint(token.LangIds) != fmt.Sprint(test.want) {
+			t.Errorf("unexpected token: %+v", token)
+		}
+		tokens = append(tokens, token)
+	}
+
+	user, token, err := db.getTokenUser(tokens[1].Token, now)
+	if err != nil || user.Id != alice.Id || token.Id != tokens[1].Id ||
+		token.Scope != TokenScopeWrite || token.Token != "" {
+		t.Errorf("unexpected token user: %+v %+v (%v)", user, token, err)
+	}
+	if _, _, err := db.getTokenUser("ll_nope", now); err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+	got, err := db.getTokens(alice.Id)
+	if err != nil || len(got) != 2 || got[1].LastUsedAt != now.Unix() {
+		t.Errorf("unexpected tokens: %+v (%v)", got, err)
+	}
+
+	if _, err := db.revokeToken(bob.Id, tokens[0].Id); err != ErrNoTokenFound {
+		t.Errorf("expected bob not to revoke alice's token, got %v", err)
+	}
+	if _, err := db.revokeToken(alice.Id, tokens[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.getTokenUser(tokens[0].Token, now); err != ErrUnauthorized {
+		t.Errorf("expected revoked token to be unauthorized, got %v", err)
+	}
+}
+
+func TestTokenHandlers(t *testing.T) {
+	srvr := newTestServer(t, newTestDb(t))
+	alice := newTestClient(t, srvr)
+	alice.register("alice")
+	for _, name := range []string{"spanish", "french"} {
+		if code := alice.do(http.MethodPost, "/langs", Lang{Name: name}, nil); code != http.StatusOK {
+			t.Fatalf("error creating %s: %d", name, code)
+		}
+	}
+	newToken := func(req NewTokenRequest) *testClient {
+		resp := Response[APIToken]{}
+		if code := alice.do(http.MethodPost, "/tokens", req, &resp); code != http.StatusOK {
+			t.Fatalf("error creating token: %d %s", code, resp.Error)
+		}
+		tc := newTestClient(t, srvr)
+		tc.token = resp.Content.Token
+		return tc
+	}
+	read := newToken(NewTokenRequest{Name: "read", Scope: TokenScopeRead})
+	restricted := newToken(NewTokenRequest{
+		Name: "spanish", Scope: TokenScopeWrite, Langs: []string{"spanish"},
+	})
+
+	tests := []struct {
+		name   string
+		tc     *testClient
+		method string
+		path   string
+		body   any
+		code   int
+	}{
+		{"read token gets", read, http.MethodGet, "/langs/french", nil, http.StatusOK},
+		{"read token writes", read, http.MethodPost, "/langs", Lang{Name: "german"}, http.StatusForbidden},
+		{"token manages tokens", read, http.MethodGet, "/tokens", nil, http.StatusForbidden},
+		{"restricted token gets", restricted, http.MethodGet, "/langs/spanish", nil, http.StatusOK},
+		{"restricted token writes", restricted, http.MethodPost, "/langs/spanish/words", Word{Word: "perro"}, http.StatusOK},
+		{"restricted token gets other", restricted, http.MethodGet, "/langs/french", nil, http.StatusBadRequest},
+		{"restricted token creates lang", restricted, http.MethodPost, "/langs", Lang{Name: "german"}, http.StatusForbidden},
+		{"invalid token", &testClient{t: t, url: srvr.URL, client: http.DefaultClient, token: "ll_nope"}, http.MethodGet, "/langs", nil, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		if code := test.tc.do(test.method, test.path, test.body, nil); code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, code)
+		}
+	}
+
+	resp := Response[[]Lang]{}
+	if code := restricted.do(http.MethodGet, "/langs", nil, &resp); code != http.StatusOK ||
+		len(resp.Content) != 1 || resp.Content[0].Name != "spanish" {
+		t.Errorf("expected only spanish, got %+v (%d)", resp.Content, code)
+	}
+}
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	jmux "github.com/johnietre/go-jmux"
+	jtutils "github.com/johnietre/utils/go"
+)
+
+// NewTranslation is the word to link another word to, given by its ID or by
+// its language and text.
+type NewTranslation struct {
+	Id   int64  `json:"id,omitempty"`
+	Lang string `json:"lang,omitempty"`
+	Word string `json:"word,omitempty"`
+}
+
+// Gets the words the word is directly linked to.
+func (s *Server) getTranslationsHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["word"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+
+	code, resp := http.StatusOK, Response[[]Word]{}
+	words, err := s.userDb(c).getTranslations(lang, id)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error getting translations of word %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = words
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Links the word to a word in another language, returning the words it's
+// directly linked to.
+func (s *Server) addTranslationHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	nt := NewTranslation{}
+	if err := c.ReadBodyJSON(&nt); err != nil {
+		if jtutils.IsUnmarshalError(err) {
+			c.BadRequest(errRespJson("invalid JSON"))
+		} else {
+			log.Print("error reading json: ", err)
+			c.InternalServerError(errRespJson("internal server error"))
+		}
+		return
+	}
+
+	code, resp := http.StatusOK, Response[[]Word]{}
+	words, err := s.userDb(c).addTranslation(lang, id, nt)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error adding translation to word %d: %v", id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = words
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Unlinks the words, returning the words the word is still directly linked
+// to.
+func (s *Server) delTranslationHandler(c *jmux.Context) {
+	lang := c.Params["lang"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+	otherId, err := strconv.ParseInt(c.Params["other"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid word ID"))
+		return
+	}
+
+	code, resp := http.StatusOK, Response[[]Word]{}
+	words, err := s.userDb(c).delTranslation(lang, id, otherId)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error deleting translation %d of word %d: %v", otherId, id, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = words
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Looks up the translations of the "word" query param from the "from"
+// language in the "to" language. Languages can be given by name, alias, ID,
+// or locale.
+func (s *Server) translateHandler(c *jmux.Context) {
+	query := c.Query()
+	from, to, word := query.Get("from"), query.Get("to"), query.Get("word")
+	if from == "" || to == "" || word == "" {
+		c.BadRequest(errRespJson("missing 'from', 'to', or 'word'"))
+		return
+	}
+
+	code, resp := http.StatusOK, Response[[]Word]{}
+	words, err := s.userDb(c).translate(from, to, word)
+	if err != nil {
+		if isUserError(err) {
+			code, resp.Error = http.StatusBadRequest, err.Error()
+		} else {
+			log.Printf("error translating %q from %q to %q: %v", word, from, to, err)
+			code, resp.Error = http.StatusInternalServerError, "internal server error"
+		}
+	} else {
+		resp.Content = words
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Gets the word with the ID from any of the DB's languages.
+func (db *DB) getWordByIdInAnyLang(id int64) (Word, error) {
+	cond, args := db.wordsCond()
+	word, err := scanWord(db.QueryRow(
+		`SELECT `+wordCols+` FROM words WHERE words.id=? AND `+cond,
+		append([]any{id}, args...)...,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNoWordFound
+	}
+	return word, err
+}
+
+// Gets the words directly linked to the word, ordered by language.
+func (db *DB) getTranslations(lang string, id int64) ([]Word, error) {
+	if _, err := db.getWordById(lang, id); err != nil {
+		return nil, err
+	}
+	cond, args := db.wordsCond()
+	rows, err := db.Query(
+		`SELECT `+wordCols+` FROM words WHERE words.id IN (
+      SELECT other_id FROM word_translations WHERE word_id=?
+      UNION
+      SELECT word_id FROM word_translations WHERE other_id=?
+    ) AND `+cond+` ORDER BY words.lang_id,words.id`,
+		append([]any{id, id}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanWords(rows)
+}
+
+// Links the word to the other word, which must be in a different language.
+// Linking words that are already linked does nothing.
+func (db *DB) addTranslation(
+	lang string,
+	id int64,
+	nt NewTranslation,
+) ([]Word, error) {
+	word, err := db.getWordById(lang, id)
+	if err != nil {
+		return nil, err
+	}
+	other := Word{}
+	if nt.Id != 0 {
+		other, err = db.getWordByIdInAnyLang(nt.Id)
+	} else if nt.Lang != "" && nt.Word != "" {
+		other, err = db.getWord(nt.Lang, nt.Word, false, true, nt.Word)
+	} else {
+		err = fmt.Errorf(
+			"%w: must have an ID or a language and word", ErrInvalidTranslation,
+		)
+	}
+	if err != nil {
+		return nil, err
+	} else if other.LangId == word.LangId {
+		return nil, fmt.Errorf(
+			"%w: words must be in different languages", ErrInvalidTranslation,
+		)
+	}
+
+	wordId, otherId := translationKey(word.Id, other.Id)
+	_, err = db.Exec(
+		`INSERT OR IGNORE INTO word_translations(word_id,other_id) VALUES (?,?)`,
+		wordId, otherId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return db.getTranslations(lang, id)
+}
+
+func (db *DB) delTranslation(lang string, id, otherId int64) ([]Word, error) {
+	if _, err := db.getWordById(lang, id); err != nil {
+		return nil, err
+	}
+	wordId, otherId := translationKey(id, otherId)
+	res, err := db.Exec(
+		`DELETE FROM word_translations WHERE word_id=? AND other_id=?`,
+		wordId, otherId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNoTranslationFound
+	}
+	return db.getTranslations(lang, id)
+}
+
+// Gets the words in the "to" language linked to the word in the "from"
+// language, following links transitively (only through words the DB can
+// access). The word is matched ignoring case and accents, falling back to its
+// aliases.
+func (db *DB) translate(from, to, wordStr string) ([]Word, error) {
+	fromId, err := db.getLangIdOrLocale(from)
+	if err != nil {
+		return nil, err
+	}
+	toId, err := db.getLangIdOrLocale(to)
+	if err != nil {
+		return nil, err
+	}
+	toTag, err := db.getLangTag(toId)
+	if err != nil {
+		return nil, err
+	}
+	word, err := db.getWord(
+		strconv.FormatInt(fromId, 10), wordStr, false, true, wordStr,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cond, args := db.wordsCond()
+	rows, err := db.Query(
+		`WITH RECURSIVE linked(id) AS (
+      SELECT ?
+      UNION
+      SELECT words.id FROM linked
+      JOIN word_translations AS t ON linked.id IN (t.word_id,t.other_id)
+      JOIN words ON words.id=IIF(t.word_id=linked.id,t.other_id,t.word_id)
+      WHERE `+cond+`
+    )
+    SELECT `+wordCols+` FROM words
+    WHERE words.id IN (SELECT id FROM linked) AND words.lang_id=?
+      AND words.id<>?
+    ORDER BY words.word`+collateClause(toTag)+`,words.id`,
+		append(append([]any{word.Id}, args...), toId, word.Id)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanWords(rows)
+}
+
+// Like getLangId, but the name can also be one of the language's aliases or
+// its locale.
+func (db *DB) getLangIdOrLocale(name string) (int64, error) {
+	langId, err := db.getLangId(name, name)
+	if !errors.Is(err, ErrNoLangFound) {
+		return langId, err
+	}
+	locale, e := normalizeLocale(name)
+	if e != nil || locale == "" {
+		return 0, err
+	}
+	cond, args := db.langsCond()
+	rows, err := db.Query(
+		`SELECT id FROM languages WHERE locale=? AND `+cond+` LIMIT 2`,
+		append([]any{locale}, args...)...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		if err := rows.Scan(&langId); err != nil {
+			return 0, err
+		}
+		ids = append(ids, langId)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	switch len(ids) {
+	case 0:
+		return 0, ErrNoLangFound
+	case 1:
+		return ids[0], nil
+	}
+	return 0, ErrAmbiguousLang
+}
+
+// Scans all of the rows as words.
+func scanWords(rows *sql.Rows) ([]Word, error) {
+	words := []Word{}
+	for rows.Next() {
+		word, err := scanWord(rows)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+	}
+	return words, rows.Err()
+}
+
+// Returns the IDs of linked words in the order they're stored in.
+func translationKey(id, otherId int64) (int64, int64) {
+	if id > otherId {
+		return otherId, id
+	}
+	return id, otherId
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTranslationKey(t *testing.T) {
+	for _, ids := range [][2]int64{{1, 2}, {2, 1}} {
+		if a, b := translationKey(ids[0], ids[1]); a != 1 || b != 2 {
+			t.Errorf("translationKey(%d, %d): expected 1, 2, got %d, %d", ids[0], ids[1], a, b)
+		}
+	}
+}
+
+func TestTranslations(t *testing.T) {
+	db := newTestDb(t)
+	now := time.Now()
+	for _, lang := range []Lang{
+		{Name: "spanish", Locale: "es"},
+		{Name: "portuguese", Locale: "pt"},
+		{Name: "english", Locale: "en"},
+	} {
+		if err := db.newLang(&lang, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	can := addTestWord(t, db, "spanish", "can", "dog")
+	cao := addTestWord(t, db, "portuguese", "c\u00e3o", "dog")
+	dog := addTestWord(t, db, "english", "dog", "")
+	hound := addTestWord(t, db, "english", "hound", "")
+
+	addTests := []struct {
+		lang string
+		id   int64
+		nt   NewTranslation
+		want []string
+		err  error
+	}{
+		{"spanish", perro.Id, NewTranslation{Id: cao.Id}, []string{"c\u00e3o"}, nil},
+		// Words can be given by language and text (ignoring case and accents).
+		{"portuguese", cao.Id, NewTranslation{Lang: "english", Word: "DOG"}, []string{"perro", "dog"}, nil},
+		{"spanish", can.Id, NewTranslation{Lang: "en", Word: "hound"}, nil, ErrNoLangFound},
+		{"spanish", can.Id, NewTranslation{Lang: "english", Word: "hound"}, []string{"hound"}, nil},
+		// Linking again does nothing.
+		{"portuguese", cao.Id, NewTranslation{Id: perro.Id}, []string{"perro", "dog"}, nil},
+		{"spanish", perro.Id, NewTranslation{Id: can.Id}, nil, ErrInvalidTranslation},
+		{"spanish", perro.Id, NewTranslation{Lang: "english"}, nil, ErrInvalidTranslation},
+		{"spanish", perro.Id, NewTranslation{Id: 999}, nil, ErrNoWordFound},
+		{"spanish", dog.Id, NewTranslation{Id: cao.Id}, nil, ErrNoWordFound},
+	}
+	for _, test := range addTests {
+		words, err := db.addTranslation(test.lang, test.id, test.nt)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("addTranslation(%d, %+v): expected %v, got %v", test.id, test.nt, test.err, err)
+			}
+		} else if err != nil || fmt.Sprint(wordNames(words)) != fmt.Sprint(test.want) {
+			t.Errorf(
+				"addTranslation(%d, %+v): expected %v, got %v (%v)",
+				test.id, test.nt, test.want, wordNames(words), err,
+			)
+		}
+	}
+
+	translateTests := []struct {
+		from, to, word string
+		want           []string
+		err            error
+	}{
+		// Links are followed transitively.
+		{"spanish", "english", "Perro", []string{"dog"}, nil},
+		{"es", "pt", "perro", []string{"c\u00e3o"}, nil},
+		{"en", "es", "dog", []string{"perro"}, nil},
+		{"es", "en", "can", []string{"hound"}, nil},
+		{"es", "es", "perro", []string{}, nil},
+		{"es", "en", "gato", nil, ErrNoWordFound},
+		{"es", "fr", "perro", nil, ErrNoLangFound},
+	}
+	for _, test := range translateTests {
+		words, err := db.translate(test.from, test.to, test.word)
+		if test.err != nil {
+			if err != test.err {
+				t.Errorf("translate(%s, %s, %s): expected %v, got %v", test.from, test.to, test.word, test.err, err)
+			}
+		} else if err != nil || fmt.Sprint(wordNames(words)) != fmt.Sprint(test.want) {
+			t.Errorf(
+				"translate(%s, %s, %s): expected %v, got %v (%v)",
+				test.from, test.to, test.word, test.want, wordNames(words), err,
+			)
+		}
+	}
+
+	// Links aren't followed through deleted words.
+	if _, err := db.delWordById("portuguese", cao.Id, now); err != nil {
+		t.Fatal(err)
+	}
+	if words, err := db.translate("es", "en", "perro"); err != nil || len(words) != 0 {
+		t.Errorf("expected no translations, got %v (%v)", wordNames(words), err)
+	}
+	if _, err := db.delTranslation("spanish", can.Id, hound.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.delTranslation("spanish", can.Id, hound.Id); err != ErrNoTranslationFound {
+		t.Errorf("expected ErrNoTranslationFound, got %v", err)
+	}
+}
+
+func TestTranslationHandlers(t *testing.T) {
+	srvr := newTestServer(t, newTestDb(t))
+	alice, bob := newTestClient(t, srvr), newTestClient(t, srvr)
+	alice.register("alice")
+	bob.register("bob")
+	ids := map[string]int64{}
+	for _, lw := range []struct{ lang, locale, word string }{
+		{"spanish", "es", "perro"},
+		{"portuguese", "pt", "c\u00e3o"},
+	} {
+		if code := alice.do(http.MethodPost, "/langs", Lang{Name: lw.lang, Locale: lw.locale}, nil); code != http.StatusOK {
+			t.Fatalf("error creating %s: %d", lw.lang, code)
+		}
+		resp := Response[Word]{}
+		if code := alice.do(http.MethodPost, "/langs/"+lw.lang+"/words", Word{Word: lw.word}, &resp); code != http.StatusOK {
+			t.Fatalf("error adding %s: %d", lw.word, code)
+		}
+		ids[lw.lang] = resp.Content.Id
+	}
+	path := "/langs/spanish/words/" + jsonStr(ids["spanish"]) + "/translations"
+	translate := "/translate?from=es&to=pt&word=" + url.QueryEscape("PERRO")
+
+	tests := []struct {
+		name   string
+		tc     *testClient
+		method string
+		path   string
+		body   any
+		code   int
+		want   string
+	}{
+		{"other user links", bob, http.MethodPost, path, NewTranslation{Id: ids["portuguese"]}, http.StatusBadRequest, ""},
+		{"link", alice, http.MethodPost, path, NewTranslation{Id: ids["portuguese"]}, http.StatusOK, "[c\u00e3o]"},
+		{"get", alice, http.MethodGet, path, nil, http.StatusOK, "[c\u00e3o]"},
+		{"translate", alice, http.MethodGet, translate, nil, http.StatusOK, "[c\u00e3o]"},
+		{"other user translates", bob, http.MethodGet, translate, nil, http.StatusBadRequest, ""},
+		{"translate missing word", alice, http.MethodGet, "/translate?from=es&to=pt", nil, http.StatusBadRequest, ""},
+		{"invalid other ID", alice, http.MethodDelete, path + "/x", nil, http.StatusBadRequest, ""},
+		{"unlink", alice, http.MethodDelete, path + "/" + jsonStr(ids["portuguese"]), nil, http.StatusOK, "[]"},
+		{"unlink again", alice, http.MethodDelete, path + "/" + jsonStr(ids["portuguese"]), nil, http.StatusBadRequest, ""},
+		{"translate unlinked", alice, http.MethodGet, translate, nil, http.StatusOK, "[]"},
+	}
+	for _, test := range tests {
+		resp := Response[[]Word]{}
+		code := test.tc.do(test.method, test.path, test.body, &resp)
+		if code != test.code {
+			t.Errorf("%s: expected %d, got %d (%s)", test.name, test.code, code, resp.Error)
+		} else if test.want != "" && fmt.Sprint(wordNames(resp.Content)) != test.want {
+			t.Errorf("%s: expected %s, got %v", test.name, test.want, wordNames(resp.Content))
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	jmux "github.com/johnietre/go-jmux"
+)
+
+const (
+	TrashKindLang = "lang"
+	TrashKindWord = "word"
+)
+
+// TrashItem is a deleted language or word. The words of deleted languages
+// aren't listed separately since they're restored with the language.
+type TrashItem struct {
+	Kind string `json:"kind"`
+	Id   int64  `json:"id"`
+	// LangId is the language's own ID for languages.
+	LangId int64 `json:"langId"`
+	// Name is the language's name or the word.
+	Name      string `json:"name"`
+	DeletedAt int64  `json:"deletedAt"`
+	// PurgeAt is when the item will be permanently deleted (0 if never).
+	PurgeAt int64 `json:"purgeAt,omitempty"`
+}
+
+// Gets the items in the trash, most recently deleted first.
+func (s *Server) getTrashHandler(c *jmux.Context) {
+	items, err := s.userDb(c).getTrash()
+	code, resp := http.StatusOK, Response[[]TrashItem]{}
+	if err != nil {
+		log.Print("error getting trash: ", err)
+		code, resp.Error = http.StatusInternalServerError, "internal server error"
+	} else {
+		if s.TrashDays > 0 {
+			for i := range items {
+				items[i].PurgeAt = items[i].DeletedAt + int64(s.TrashDays)*24*60*60
+			}
+		}
+		resp.Content = items
+	}
+	c.WriteHeader(code)
+	c.WriteJSON(resp)
+}
+
+// Restores the language or word, returning it.
+func (s *Server) restoreTrashHandler(c *jmux.Context) {
+	kind := c.Params["kind"]
+	id, err := strconv.ParseInt(c.Params["id"], 10, 64)
+	if err != nil {
+		c.BadRequest(errRespJson("invalid ID"))
+		return
+	}
+
+	db := s.userDb(c)
+	switch kind {
+	case TrashKindLang:
+		lang, err := db.restoreLang(id, time.Now())
+		code, resp := http.StatusOK, Response[Lang]{}
+		if err != nil {
+			if isUserError(err) {
+				code, resp.Error = http.StatusBadRequest, err.Error()
+			} else {
+				log.Printf("error restoring lang %d: %v", id, err)
+				code, resp.Error = http.StatusInternalServerError, "internal server error"
+			}
+		} else {
+			resp.Content = lang
+			c.RespHeader().Set("ETag", versionETag(lang.Version))
+		}
+		c.WriteHeader(code)
+		c.WriteJSON(resp)
+	case TrashKindWord:
+		word, err := db.restoreWord(id, time.Now())
+		code, resp := http.StatusOK, Response[Word]{}
+		if err != nil {
+			if isUserError(err) {
+				code, resp.Error = http.StatusBadRequest, err.Error()
+			} else {
+				log.Printf("error restoring word %d: %v", id, err)
+				code, resp.Error = http.StatusInternalServerError, "internal server error"
+			}
+		} else {
+			resp.Content = word
+			c.RespHeader().Set("ETag", versionETag(word.Version))
+		}
+		c.WriteHeader(code)
+		c.WriteJSON(resp)
+	default:
+		c.BadRequest(errRespJson(ErrInvalidTrashKind.Error()))
+	}
+}
+
+// Permanently deletes everything that has been in the trash for TrashDays,
+// checking every hour until the server is closed.
+func (s *Server) runPurges() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for now := time.Now(); ; now = <-ticker.C {
+		s.purgeTrash(now)
+	}
+}
+
+func (s *Server) purgeTrash(now time.Time) {
+	before := now.AddDate(0, 0, -s.TrashDays)
+	n, err := s.db.purgeTrash(before)
+	if err != nil {
+		log.Print("error purging trash: ", err)
+		return
+	} else if n != 0 {
+		log.Printf("purged %d items from the trash", n)
+		// Frees the media used by the purged words.
+		s.pruneMedia()
+	}
+}
+
+func (db *DB) getTrash() ([]TrashItem, error) {
+	scopeCond, scopeArgs := db.scopeCond()
+	wordsCond, wordsArgs := db.langIdCond("lang_id")
+	rows, err := db.Query(
+		`SELECT ?,id,id,name,deleted_at FROM languages
+    WHERE deleted_at IS NOT NULL AND `+scopeCond+`
+    UNION ALL
+    SELECT ?,id,lang_id,word,deleted_at FROM words
+    WHERE deleted_at IS NOT NULL AND `+wordsCond+`
+    ORDER BY 5 DESC,2 DESC`,
+		append(
+			append(append([]any{TrashKindLang}, scopeArgs...), TrashKindWord),
+			wordsArgs...,
+		)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []TrashItem{}
+	for rows.Next() {
+		item := TrashItem{}
+		err := rows.Scan(
+			&item.Kind, &item.Id, &item.LangId, &item.Name, &item.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Takes the language (and so its words) out of the trash. Returns
+// ErrLangExists if another language now has its name.
+func (db *DB) restoreLang(id int64, now time.Time) (Lang, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Lang{}, err
+	}
+	defer tx.Rollback()
+
+	cond, args := db.scopeCond()
+	res, err := tx.Exec(
+		`UPDATE languages SET deleted_at=NULL
+    WHERE id=? AND deleted_at IS NOT NULL AND `+cond,
+		append([]any{id}, args...)...,
+	)
+	if err != nil {
+		if isUniqueError(err) {
+			err = ErrLangExists
+		}
+		return Lang{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return Lang{}, err
+	} else if n == 0 {
+		return Lang{}, ErrNoLangFound
+	}
+	lang, err := scanLang(tx.QueryRow(
+		`SELECT `+langCols+` FROM languages WHERE id=?`, id,
+	))
+	if err != nil {
+		return Lang{}, err
+	}
+	err = db.recordRevision(tx, Revision{
+		Kind: RevisionLang, ItemId: id, LangId: id,
+		Action: RevisionRestore, CreatedAt: now.Unix(),
+	}, nil, lang)
+	if err != nil {
+		return Lang{}, err
+	}
+	return lang, tx.Commit()
+}
+
+// Takes the word out of the trash. The word's language can't be in the
+// trash.
+func (db *DB) restoreWord(id int64, now time.Time) (Word, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Word{}, err
+	}
+	defer tx.Rollback()
+
+	cond, args := db.langIdCond("lang_id")
+	res, err := tx.Exec(
+		`UPDATE words SET deleted_at=NULL
+    WHERE id=? AND deleted_at IS NOT NULL AND `+cond,
+		append([]any{id}, args...)...,
+	)
+	if err != nil {
+		return Word{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return Word{}, err
+	} else if n == 0 {
+		return Word{}, ErrNoWordFound
+	}
+	word, err := scanWord(tx.QueryRow(
+		`SELECT `+wordCols+` FROM words WHERE id=?`, id,
+	))
+	if err != nil {
+		return Word{}, err
+	}
+	err = db.recordRevision(tx, Revision{
+		Kind: RevisionWord, ItemId: id, LangId: word.LangId,
+		Action: RevisionRestore, CreatedAt: now.Unix(),
+	}, nil, word)
+	if err != nil {
+		return Word{}, err
+	}
+	return word, tx.Commit()
+}
+
+// Permanently deletes the languages and words that were put in the trash
+// before the time, across all users, returning how many were deleted. Their
+// revisions are deleted too (the languages' through cascading).
+func (db *DB) purgeTrash(before time.Time) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`DELETE FROM revisions WHERE kind=? AND item_id IN (
+      SELECT id FROM words WHERE deleted_at<?
+    )`,
+		RevisionWord, before.Unix(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	total := int64(0)
+	for _, stmt := range []string{
+		`DELETE FROM words WHERE deleted_at<?`,
+		`DELETE FROM languages WHERE deleted_at<?`,
+	} {
+		res, err := tx.Exec(stmt, before.Unix())
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, tx.Commit()
+}
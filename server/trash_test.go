@@ -0,0 +1,190 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Returns the trash items as "kind name" strings.
+func trashStrs(items []TrashItem) []string {
+	strs := []string{}
+	for _, item := range items {
+		strs = append(strs, item.Kind+" "+item.Name)
+	}
+	return strs
+}
+
+// Returns the actions of the revisions.
+func revisionActions(revs []Revision) []string {
+	actions := []string{}
+	for _, rev := range revs {
+		actions = append(actions, rev.Action)
+	}
+	return actions
+}
+
+func TestTrash(t *testing.T) {
+	db := newTestDb(t)
+	addTestLang(t, db, "spanish")
+	french := addTestLang(t, db, "french")
+	now := time.Now()
+	perro := addTestWord(t, db, "spanish", "perro", "dog")
+	gato := addTestWord(t, db, "spanish", "gato", "cat")
+	chien := addTestWord(t, db, "french", "chien", "dog")
+
+	if _, err := db.delWordById("spanish", perro.Id, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.delWordById("spanish", gato.Id, now.AddDate(0, 0, -40)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.delLang("french", now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// The words of deleted languages aren't listed.
+	items, err := db.getTrash()
+	if want := "[lang french word perro word gato]"; err != nil || fmt.Sprint(trashStrs(items)) != want {
+		t.Errorf("expected %s, got %v (%v)", want, trashStrs(items), err)
+	}
+	if items, err := db.asUser(999).getTrash(); err != nil || len(items) != 0 {
+		t.Errorf("expected other users' trash to be empty, got %v (%v)", trashStrs(items), err)
+	}
+	if _, err := db.getWordById("spanish", perro.Id); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound for deleted word, got %v", err)
+	}
+
+	// Another language now has the deleted one's name.
+	other := addTestLang(t, db, "french")
+	restoreTests := []struct {
+		name string
+		kind string
+		id   int64
+		err  error
+	}{
+		{"word of deleted language", TrashKindWord, chien.Id, ErrNoWordFound},
+		{"name taken", TrashKindLang, french.Id, ErrLangExists},
+		{"language not in trash", TrashKindLang, other.Id, ErrNoLangFound},
+		{"word not in trash", TrashKindWord, 999, ErrNoWordFound},
+	}
+	for _, test := range restoreTests {
+		var err error
+		if test.kind == TrashKindLang {
+			_, err = db.restoreLang(test.id, now)
+		} else {
+			_, err = db.restoreWord(test.id, now)
+		}
+		if err != test.err {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	if _, err := db.delLang(jsonStr(other.Id), now); err != nil {
+		t.Fatal(err)
+	}
+	if lang, err := db.restoreLang(french.Id, now); err != nil || lang.Name != "french" {
+		t.Fatalf("unexpected restored language: %+v (%v)", lang, err)
+	}
+	if word, err := db.getWordById("french", chien.Id); err != nil || word.Word != "chien" {
+		t.Errorf("expected word to be restored with its language, got %+v (%v)", word, err)
+	}
+	if _, err := db.asUser(999).restoreWord(perro.Id, now); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound restoring another user's word, got %v", err)
+	}
+	if word, err := db.restoreWord(perro.Id, now); err != nil || word.Word != "perro" {
+		t.Fatalf("unexpected restored word: %+v (%v)", word, err)
+	}
+	revs, err := db.getWordHistory("spanish", perro.Id)
+	if want := "[restore delete insert]"; err != nil || fmt.Sprint(revisionActions(revs)) != want {
+		t.Errorf("expected %s, got %v (%v)", want, revisionActions(revs), err)
+	}
+
+	// Only the items deleted before the time are purged, with their revisions.
+	n, err := db.purgeTrash(now.AddDate(0, 0, -30))
+	if err != nil || n != 1 {
+		t.Errorf("expected 1 item to be purged, got %d (%v)", n, err)
+	}
+	if revs, err := db.getRevisions(RevisionWord, gato.Id); err != nil || len(revs) != 0 {
+		t.Errorf("expected no revisions, got %v (%v)", revisionActions(revs), err)
+	}
+	if _, err := db.restoreWord(gato.Id, now); err != ErrNoWordFound {
+		t.Errorf("expected ErrNoWordFound for purged word, got %v", err)
+	}
+	items, err = db.getTrash()
+	if want := "[lang french]"; err != nil || fmt.Sprint(trashStrs(items)) != want {
+		t.Errorf("expected %s, got %v (%v)", want, trashStrs(items), err)
+	}
+}
+
+func TestTrashHandlers(t *testing.T) {
+	db := newTestDb(t)
+	s := &Server{
+		TrashDays: 30,
+		db:        db,
+		store:     db,
+		scheduler: SM2{},
+		media:     mediaStore{dir: t.TempDir()},
+	}
+	srvr := httptest.NewServer(s.createHandler())
+	t.Cleanup(srvr.Close)
+	alice, bob := newTestClient(t, srvr), newTestClient(t, srvr)
+	alice.register("alice")
+	bob.register("bob")
+	if code := alice.do(http.MethodPost, "/langs", Lang{Name: "spanish"}, nil); code != http.StatusOK {
+		t.Fatalf("error creating language: %d", code)
+	}
+	wordResp := Response[Word]{}
+	if code := alice.do(http.MethodPost, "/langs/spanish/words", Word{Word: "perro"}, &wordResp); code != http.StatusOK {
+		t.Fatalf("error adding word: %d", code)
+	}
+	id := jsonStr(wordResp.Content.Id)
+	if code := alice.do(http.MethodDelete, "/langs/spanish/words/"+id, nil, nil); code != http.StatusOK {
+		t.Fatalf("error deleting word: %d", code)
+	}
+
+	trashResp := Response[[]TrashItem]{}
+	if code := alice.do(http.MethodGet, "/trash", nil, &trashResp); code != http.StatusOK {
+		t.Fatalf("error getting trash: %d", code)
+	}
+	if items := trashResp.Content; len(items) != 1 || items[0].Name != "perro" ||
+		items[0].PurgeAt != items[0].DeletedAt+30*24*60*60 {
+		t.Errorf("unexpected trash: %+v", items)
+	}
+	trashResp = Response[[]TrashItem]{}
+	if code := bob.do(http.MethodGet, "/trash", nil, &trashResp); code != http.StatusOK || len(trashResp.Content) != 0 {
+		t.Errorf("expected bob's trash to be empty, got %d %+v", code, trashResp.Content)
+	}
+
+	tests := []struct {
+		name string
+		tc   *testClient
+		path string
+		code int
+	}{
+		{"invalid kind", alice, "/trash/list/" + id + "/restore", http.StatusBadRequest},
+		{"invalid ID", alice, "/trash/word/x/restore", http.StatusBadRequest},
+		{"other user", bob, "/trash/word/" + id + "/restore", http.StatusBadRequest},
+		{"restore", alice, "/trash/word/" + id + "/restore", http.StatusOK},
+		{"restore again", alice, "/trash/word/" + id + "/restore", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		resp := Response[any]{}
+		if code := test.tc.do(http.MethodPost, test.path, nil, &resp); code != test.code {
+			t.Errorf("%s: expected %d, got %d (%s)", test.name, test.code, code, resp.Error)
+		}
+	}
+	if code := alice.do(http.MethodGet, "/langs/spanish/words/perro", nil, nil); code != http.StatusOK {
+		t.Errorf("expected restored word, got %d", code)
+	}
+
+	// Purged words are gone for good.
+	if code := alice.do(http.MethodDelete, "/langs/spanish/words/"+id, nil, nil); code != http.StatusOK {
+		t.Fatalf("error deleting word: %d", code)
+	}
+	s.purgeTrash(time.Now().AddDate(0, 0, 31))
+	if code := alice.do(http.MethodPost, "/trash/word/"+id+"/restore", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("expected purged word to be gone, got %d", code)
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	jmux "github.com/johnietre/go-jmux"
+	"golang.org/x/text/language"
+)
+
+const (
+	defaultWordsLimit = 100
+	maxWordsLimit     = 1000
+)
+
+type WordSort string
+
+const (
+	// WordSortWord sorts by the word using the collation for the language's
+	// locale.
+	WordSortWord WordSort = "word"
+	// WordSortCreated sorts by when the word was added (words are created in
+	// ID order).
+	WordSortCreated WordSort = "created"
+	// WordSortDue sorts by when the word is next due for review. Words that
+	// haven't been reviewed come last.
+	WordSortDue WordSort = "due"
+)
+
+func (ws WordSort) IsValid() bool {
+	return ws == WordSortWord || ws == WordSortCreated || ws == WordSortDue
+}
+
+// The expression each sort orders by (before the word's ID, which breaks
+// ties), given the language's tag. Created has none since the ID alone gives
+// the order.
+func (ws WordSort) keyExpr(tag language.Tag) string {
+	switch ws {
+	case WordSortWord:
+		return "words.word" + collateClause(tag)
+	case WordSortDue:
+		return "IFNULL(review_states.due," + strconv.FormatInt(maxDue, 10) + ")"
+	}
+	return ""
+}
+
+// Stands in for the due time of words that haven't been reviewed.
+const maxDue = 1<<63 - 1
+
+// WordListOptions control which words are listed and in what order.
+type WordListOptions struct {
+	// Limit is the max number of words returned.
+	Limit int
+	// After is the cursor returned with the previous page (empty for the first
+	// page).
+	After string
+	Sort  WordSort
+	Desc  bool
+	// HasAliases, if set, only lists words with (or without) aliases.
+	HasAliases *bool
+	// Notes, if non-empty, only lists words whose notes contain it (ignoring
+	// case).
+	Notes string
+	// Pos, Gender, Register, and CEFR, if non-empty, only list words with the
+	// metadata.
+	Pos      string
+	Gender   string
+	Register string
+	CEFR     string
+	// Tags, if non-empty, only lists words with all of the tags.
+	Tags []string
+}
+
+// Parses the options from the query params "limit", "after", "sort", "order"
+// ("asc" or "desc"), "hasAliases", "notes", "pos", "gender", "register",
+// "cefr", and "tag" (which can be repeated).
+func wordListOptionsFromQuery(c *jmux.Context) (WordListOptions, error) {
+	query := c.Query()
+	opts := WordListOptions{
+		Limit: defaultWordsLimit,
+		After: query.Get("after"),
+		Sort:  WordSort(query.Get("sort")),
+		Notes: query.Get("notes"),
+
+		Pos:      normalizeMetaValue(query.Get("pos")),
+		Gender:   normalizeMetaValue(query.Get("gender")),
+		Register: normalizeMetaValue(query.Get("register")),
+		CEFR:     normalizeCEFR(query.Get("cefr")),
+		Tags:     normalizeTags(query["tag"]),
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			return opts, invalidQueryValue("limit")
+		}
+		if l > maxWordsLimit {
+			l = maxWordsLimit
+		}
+		opts.Limit = l
+	}
+	if opts.Sort == "" {
+		opts.Sort = WordSortWord
+	} else if !opts.Sort.IsValid() {
+		return opts, invalidQueryValue("sort")
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, invalidQueryValue("order")
+	}
+	if query.Get("hasAliases") != "" {
+		hasAliases, err := queryBool(c, "hasAliases")
+		if err != nil {
+			return opts, invalidQueryValue("hasAliases")
+		}
+		opts.HasAliases = &hasAliases
+	}
+	if checkMetaValue("pos", opts.Pos, PartsOfSpeech) != nil {
+		return opts, invalidQueryValue("pos")
+	} else if checkMetaValue("register", opts.Register, Registers) != nil {
+		return opts, invalidQueryValue("register")
+	} else if checkMetaValue("cefr", opts.CEFR, CEFRLevels) != nil {
+		return opts, invalidQueryValue("cefr")
+	}
+	return opts, nil
+}
+
+// wordCursor is the position of the last word in a page. Cursors are opaque
+// to clients and only valid for the sort they were made with.
+type wordCursor struct {
+	Sort WordSort `json:"s"`
+	Desc bool     `json:"d,omitempty"`
+	// The sort key of the word (only one is used, depending on the sort).
+	StrKey string `json:"k,omitempty"`
+	NumKey int64  `json:"n,omitempty"`
+	Id     int64  `json:"i"`
+}
+
+func (wc wordCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(jsonStr(wc)))
+}
+
+func decodeWordCursor(s string) (wordCursor, error) {
+	wc := wordCursor{}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &wc) != nil {
+		return wc, ErrInvalidCursor
+	}
+	return wc, nil
+}
+
+// Gets a page of the language's words, returning the cursor for the next page
+// (empty if there are no more words).
+func (db *DB) getWords(lang string, opts WordListOptions) ([]Word, string, error) {
+	langId, err := db.getLangId(lang)
+	if err != nil {
+		return nil, "", err
+	}
+	tag, err := db.getLangTag(langId)
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.Sort == "" {
+		opts.Sort = WordSortWord
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultWordsLimit
+	}
+
+	key := opts.Sort.keyExpr(tag)
+	cmp, dir := ">", "ASC"
+	if opts.Desc {
+		cmp, dir = "<", "DESC"
+	}
+	conds := []string{"words.lang_id=?", "words.deleted_at IS NULL"}
+	args := []any{langId}
+	if opts.HasAliases != nil {
+		cond := `EXISTS(SELECT 1 FROM word_aliases WHERE word_id=words.id)`
+		if !*opts.HasAliases {
+			cond = "NOT " + cond
+		}
+		conds = append(conds, cond)
+	}
+	if opts.Notes != "" {
+		conds = append(conds, `words.notes LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(normalizeText(opts.Notes))+"%")
+	}
+	for _, f := range []struct{ col, value string }{
+		{"pos", opts.Pos},
+		{"gender", opts.Gender},
+		{"register", opts.Register},
+		{"cefr", opts.CEFR},
+	} {
+		if f.value != "" {
+			conds = append(conds, "words."+f.col+"=?")
+			args = append(args, f.value)
+		}
+	}
+	for _, t := range opts.Tags {
+		conds = append(
+			conds,
+			`EXISTS(SELECT 1 FROM word_tags WHERE word_id=words.id AND tag=?)`,
+		)
+		args = append(args, t)
+	}
+	if opts.After != "" {
+		wc, err := decodeWordCursor(opts.After)
+		if err != nil {
+			return nil, "", err
+		} else if wc.Sort != opts.Sort || wc.Desc != opts.Desc {
+			return nil, "", ErrInvalidCursor
+		}
+		var keyArg any = wc.NumKey
+		if opts.Sort == WordSortWord {
+			keyArg = wc.StrKey
+		}
+		if key == "" {
+			conds = append(conds, "words.id"+cmp+"?")
+			args = append(args, wc.Id)
+		} else {
+			conds = append(
+				conds,
+				"("+key+cmp+"? OR ("+key+"=? AND words.id"+cmp+"?))",
+			)
+			args = append(args, keyArg, keyArg, wc.Id)
+		}
+	}
+
+	order := "words.id " + dir
+	selectKey := ",''"
+	if key != "" {
+		order = key + " " + dir + "," + order
+		selectKey = "," + key
+	}
+	rows, err := db.Query(
+		`SELECT `+wordCols+selectKey+` FROM words
+    LEFT JOIN review_states ON review_states.word_id=words.id
+    WHERE `+strings.Join(conds, " AND ")+`
+    ORDER BY `+order+` LIMIT ?`,
+		append(args, opts.Limit+1)...,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	words, last := []Word{}, wordCursor{Sort: opts.Sort, Desc: opts.Desc}
+	next := ""
+	for rows.Next() {
+		if len(words) == opts.Limit {
+			next = last.encode()
+			break
+		}
+		var rawKey any
+		word, err := scanWord(scannerFunc(func(dest ...any) error {
+			return rows.Scan(append(dest, &rawKey)...)
+		}))
+		if err != nil {
+			return nil, "", err
+		}
+		words = append(words, word)
+		last.Id = word.Id
+		switch k := rawKey.(type) {
+		case int64:
+			last.NumKey = k
+		case string:
+			last.StrKey = k
+		case []byte:
+			last.StrKey = string(k)
+		}
+	}
+	return words, next, rows.Err()
+}
+
+// Escapes the LIKE wildcards (and the escape character, '\') in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWordCursor(t *testing.T) {
+	wc := wordCursor{Sort: WordSortWord, Desc: true, StrKey: "perro", Id: 3}
+	got, err := decodeWordCursor(wc.encode())
+	if err != nil || got != wc {
+		t.Errorf("expected %+v, got %+v (%v)", wc, got, err)
+	}
+	for _, s := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := decodeWordCursor(s); err != ErrInvalidCursor {
+			t.Errorf("decodeWordCursor(%q): expected ErrInvalidCursor, got %v", s, err)
+		}
+	}
+}
+
+func TestWordListOptionsFromQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		ok    bool
+	}{
+		{"", "100 word false <nil> []", true},
+		{"limit=5&sort=due&order=desc", "5 due true <nil> []", true},
+		{"limit=5000&sort=created", "1000 created false <nil> []", true},
+		{"hasAliases=false&tag=Pets&tag=animals", "100 word false false [pets animals]", true},
+		{"limit=0", "", false},
+		{"limit=x", "", false},
+		{"sort=random", "", false},
+		{"order=up", "", false},
+		{"hasAliases=maybe", "", false},
+		{"pos=thing", "", false},
+		{"cefr=D1", "", false},
+	}
+	for _, test := range tests {
+		c := newTestContext(http.MethodGet, "")
+		c.Request.URL.RawQuery = test.query
+		opts, err := wordListOptionsFromQuery(c)
+		if !test.ok {
+			if err == nil || !isUserError(err) {
+				t.Errorf("query %q: expected user error, got %v", test.query, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("query %q: unexpected error: %v", test.query, err)
+			continue
+		}
+		hasAliases := "<nil>"
+		if opts.HasAliases != nil {
+			hasAliases = fmt.Sprint(*opts.HasAliases)
+		}
+		got := fmt.Sprintf("%d %s %v %s %v", opts.Limit, opts.Sort, opts.Desc, hasAliases, opts.Tags)
+		if got != test.want {
+			t.Errorf("query %q: expected %q, got %q", test.query, test.want, got)
+		}
+	}
+}
+
+// Adds words whose orders differ for each sort, returning them in the order
+// they were added.
+func addWordListTestWords(t *testing.T, db *DB) []Word {
+	t.Helper()
+	addTestLang(t, db, "spanish")
+	now := time.Now()
+	words := []Word{
+		{Word: "zorro", Definition: "fox", Notes: "A wild animal", Tags: []string{"animals"}},
+		{Word: "\u00e1rbol", Definition: "tree"},
+		{Word: "gato", Definition: "cat", Aliases: []string{"gata"}, Tags: []string{"animals", "pets"}},
+		{Word: "perro", Definition: "dog", Notes: "wild_card", Tags: []string{"animals", "pets"}},
+	}
+	for i := range words {
+		if err := db.addWord("spanish", &words[i], now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Gato is due before perro, and the others haven't been reviewed.
+	for i, word := range []Word{words[2], words[3]} {
+		at := now.Add(time.Duration(i) * time.Hour)
+		if _, err := db.reviewWord("spanish", word.Id, GradeGood, SM2{}, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return words
+}
+
+// Returns the words' names.
+func wordNames(words []Word) []string {
+	names := make([]string, len(words))
+	for i, word := range words {
+		names[i] = word.Word
+	}
+	return names
+}
+
+func TestGetWords(t *testing.T) {
+	db := newTestDb(t)
+	addWordListTestWords(t, db)
+	yes, no := true, false
+
+	tests := []struct {
+		name string
+		opts WordListOptions
+		want []string
+	}{
+		{"word", WordListOptions{}, []string{"\u00e1rbol", "gato", "perro", "zorro"}},
+		{"word desc", WordListOptions{Desc: true}, []string{"zorro", "perro", "gato", "\u00e1rbol"}},
+		{"created", WordListOptions{Sort: WordSortCreated}, []string{"zorro", "\u00e1rbol", "gato", "perro"}},
+		{"created desc", WordListOptions{Sort: WordSortCreated, Desc: true}, []string{"perro", "gato", "\u00e1rbol", "zorro"}},
+		// Words that haven't been reviewed come last, in ID order.
+		{"due", WordListOptions{Sort: WordSortDue}, []string{"gato", "perro", "zorro", "\u00e1rbol"}},
+		{"due desc", WordListOptions{Sort: WordSortDue, Desc: true}, []string{"\u00e1rbol", "zorro", "perro", "gato"}},
+		{"has aliases", WordListOptions{HasAliases: &yes}, []string{"gato"}},
+		{"no aliases", WordListOptions{HasAliases: &no}, []string{"\u00e1rbol", "perro", "zorro"}},
+		{"notes", WordListOptions{Notes: "WILD"}, []string{"perro", "zorro"}},
+		// LIKE wildcards in the filter are matched literally.
+		{"notes wildcard", WordListOptions{Notes: "d%c"}, []string{}},
+		{"notes underscore", WordListOptions{Notes: "d_c"}, []string{"perro"}},
+		{"tags", WordListOptions{Tags: []string{"animals", "pets"}}, []string{"gato", "perro"}},
+		{"tags and aliases", WordListOptions{Tags: []string{"pets"}, HasAliases: &no}, []string{"perro"}},
+	}
+	for _, test := range tests {
+		// Every page size gives the same words.
+		for limit := 1; limit <= len(test.want)+1; limit++ {
+			opts := test.opts
+			opts.Limit = limit
+			got, pages := []string{}, 0
+			for {
+				words, next, err := db.getWords("spanish", opts)
+				if err != nil {
+					t.Fatalf("%s (limit %d): %v", test.name, limit, err)
+				}
+				got, pages = append(got, wordNames(words)...), pages+1
+				if next == "" {
+					break
+				} else if len(words) != limit || pages > len(test.want) {
+					t.Fatalf("%s (limit %d): unexpected page %v", test.name, limit, wordNames(words))
+				}
+				opts.After = next
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("%s (limit %d): expected %q, got %q", test.name, limit, test.want, got)
+			}
+		}
+	}
+
+	// Cursors are only valid for the sort they were made with.
+	_, next, err := db.getWords("spanish", WordListOptions{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []WordListOptions{
+		{Limit: 1, After: next, Sort: WordSortDue},
+		{Limit: 1, After: next, Desc: true},
+		{Limit: 1, After: "nope"},
+	} {
+		if _, _, err := db.getWords("spanish", opts); err != ErrInvalidCursor {
+			t.Errorf("getWords(%+v): expected ErrInvalidCursor, got %v", opts, err)
+		}
+	}
+}
+
+func TestGetWordsHandler(t *testing.T) {
+	db := newTestDb(t)
+	srvr := newTestServer(t, db)
+	// The language is given to alice since she's the first user.
+	addWordListTestWords(t, db)
+	tc := newTestClient(t, srvr)
+	tc.register("alice")
+
+	got, path := []string{}, "/langs/spanish/words?limit=3&sort=created"
+	for pages := 0; ; pages++ {
+		resp := Response[[]Word]{}
+		if code := tc.do(http.MethodGet, path, nil, &resp); code != http.StatusOK {
+			t.Fatalf("error getting words: %d %s", code, resp.Error)
+		}
+		got = append(got, wordNames(resp.Content)...)
+		if resp.Next == "" {
+			break
+		} else if pages > 1 {
+			t.Fatalf("too many pages")
+		}
+		path = "/langs/spanish/words?limit=3&sort=created&after=" + url.QueryEscape(resp.Next)
+	}
+	if want := "[zorro \u00e1rbol gato perro]"; fmt.Sprint(got) != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+
+	for _, query := range []string{"sort=random", "limit=-1", "after=nope"} {
+		if code := tc.do(http.MethodGet, "/langs/spanish/words?"+query, nil, nil); code != http.StatusBadRequest {
+			t.Errorf("query %q: expected 400, got %d", query, code)
+		}
+	}
+}
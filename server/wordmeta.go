@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	jtutils "github.com/johnietre/utils/go"
+	"golang.org/x/text/language"
+)
+
+// PartsOfSpeech are the parts of speech words can have.
+var PartsOfSpeech = []string{
+	"noun", "verb", "adjective", "adverb", "pronoun", "preposition",
+	"conjunction", "interjection", "determiner", "numeral", "particle",
+	"phrase",
+}
+
+// Registers are the registers (levels of formality) words can have.
+var Registers = []string{"formal", "neutral", "informal", "slang"}
+
+// CEFRLevels are the CEFR levels words can have.
+var CEFRLevels = []string{"A1", "A2", "B1", "B2", "C1", "C2"}
+
+// The genders given to new languages that don't list any, by base language.
+// Languages without grammatical gender (or not listed) have none.
+var defaultGenders = map[string][]string{
+	"ar": {"m", "f"},
+	"ca": {"m", "f"},
+	"cs": {"m", "f", "n"},
+	"da": {"c", "n"},
+	"de": {"m", "f", "n"},
+	"el": {"m", "f", "n"},
+	"es": {"m", "f"},
+	"fr": {"m", "f"},
+	"he": {"m", "f"},
+	"hi": {"m", "f"},
+	"is": {"m", "f", "n"},
+	"it": {"m", "f"},
+	"la": {"m", "f", "n"},
+	"lt": {"m", "f"},
+	"lv": {"m", "f"},
+	"nl": {"c", "n"},
+	"no": {"m", "f", "n"},
+	"pl": {"m", "f", "n"},
+	"pt": {"m", "f"},
+	"ro": {"m", "f", "n"},
+	"ru": {"m", "f", "n"},
+	"sk": {"m", "f", "n"},
+	"sv": {"c", "n"},
+	"uk": {"m", "f", "n"},
+}
+
+// Returns the default genders for the tag's language (nil if none).
+func langDefaultGenders(tag language.Tag) []string {
+	base, conf := tag.Base()
+	if conf == language.No {
+		return nil
+	}
+	genders := defaultGenders[base.String()]
+	if genders == nil {
+		return nil
+	}
+	return append([]string{}, genders...)
+}
+
+// Lowercases and trims the genders, removing empty and duplicate ones.
+func normalizeGenders(genders []string) []string {
+	seen := map[string]bool{}
+	return jtutils.FilterMapSlice(
+		genders,
+		func(g string) (string, bool) {
+			g = normalizeMetaValue(g)
+			if g == "" || strings.Contains(g, "|") || seen[g] {
+				return "", false
+			}
+			seen[g] = true
+			return g, true
+		},
+	)
+}
+
+// Trims and lowercases a metadata value (other than the plural and CEFR
+// level).
+func normalizeMetaValue(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+func normalizeCEFR(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+// Returns ErrInvalidWordMeta if the value is non-empty and not one of valid.
+func checkMetaValue(name, value string, valid []string) error {
+	if value == "" {
+		return nil
+	}
+	for _, v := range valid {
+		if value == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: invalid %s %q", ErrInvalidWordMeta, name, value)
+}
+
+// Checks the word's (normalized) metadata, given the genders of its language.
+func (w Word) checkMeta(genders []string) error {
+	if err := checkMetaValue("part of speech", w.Pos, PartsOfSpeech); err != nil {
+		return err
+	}
+	if err := checkMetaValue("gender", w.Gender, genders); err != nil {
+		return err
+	}
+	if err := checkMetaValue("register", w.Register, Registers); err != nil {
+		return err
+	}
+	return checkMetaValue("CEFR level", w.CEFR, CEFRLevels)
+}
+
+// Checks the diff's set (and normalized) metadata fields, given the genders of
+// the word's language.
+func (wd WordDiff) checkMeta(genders []string) error {
+	word := wd.toWord()
+	if wd.Gender == nil {
+		// Keeps words with genders the language no longer has editable.
+		word.Gender = ""
+	}
+	return word.checkMeta(genders)
+}
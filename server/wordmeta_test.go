@@ -0,0 +1,156 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+func TestLangDefaultGenders(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   []string
+	}{
+		{"es", []string{"m", "f"}},
+		{"de-AT", []string{"m", "f", "n"}},
+		{"sv", []string{"c", "n"}},
+		{"en", nil},
+		{"", nil},
+	}
+	for _, test := range tests {
+		got := langDefaultGenders(Lang{Locale: test.locale}.tag())
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("langDefaultGenders(%q): expected %v, got %v", test.locale, test.want, got)
+		}
+	}
+	// The defaults are copies.
+	langDefaultGenders(language.Spanish)[0] = "x"
+	if defaultGenders["es"][0] != "m" {
+		t.Error("expected the default genders not to be modified")
+	}
+}
+
+func TestNormalizeGenders(t *testing.T) {
+	got := normalizeGenders([]string{" M ", "f", "m", "", "a|b", "Common"})
+	if want := "[m f common]"; fmt.Sprint(got) != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+}
+
+func TestWordMeta(t *testing.T) {
+	db := newTestDb(t)
+	now := time.Now()
+	spanish := Lang{Name: "spanish", Locale: "es"}
+	if err := db.newLang(&spanish, now); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(spanish.Genders) != "[m f]" {
+		t.Errorf("expected the default genders, got %v", spanish.Genders)
+	}
+
+	tests := []struct {
+		word Word
+		want string
+	}{
+		{
+			Word{Word: "casa", Pos: " Noun ", Gender: "F", Plural: " casas ", Register: "Neutral", CEFR: "a1"},
+			"noun|f|casas|neutral|A1",
+		},
+		{Word{Word: "correr", Pos: "verb", CEFR: "b2"}, "verb||||B2"},
+		{Word{Word: "x1", Pos: "thing"}, ""},
+		{Word{Word: "x2", Gender: "n"}, ""},
+		{Word{Word: "x3", Register: "rude"}, ""},
+		{Word{Word: "x4", CEFR: "D1"}, ""},
+	}
+	for _, test := range tests {
+		word := test.word
+		err := db.addWord("spanish", &word, now)
+		if test.want == "" {
+			if !errors.Is(err, ErrInvalidWordMeta) {
+				t.Errorf("addWord(%+v): expected ErrInvalidWordMeta, got %v", test.word, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got := fmt.Sprintf("%s|%s|%s|%s|%s", word.Pos, word.Gender, word.Plural, word.Register, word.CEFR)
+		if got != test.want {
+			t.Errorf("addWord(%+v): expected %q, got %q", test.word, test.want, got)
+		}
+	}
+
+	casa, err := db.getWord("spanish", "casa", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.editWord("spanish", &WordDiff{Id: casa.Id, Gender: strPtr("n")}, 0, now); !errors.Is(err, ErrInvalidWordMeta) {
+		t.Errorf("expected ErrInvalidWordMeta, got %v", err)
+	}
+	// Words keep genders their language no longer has, and can still be edited.
+	genders := []string{"m"}
+	if _, err := db.editLang("spanish", &LangDiff{Genders: &genders}, 0, now); err != nil {
+		t.Fatal(err)
+	}
+	casa, err = db.editWord("spanish", &WordDiff{Id: casa.Id, Plural: strPtr("")}, 0, now)
+	if err != nil || casa.Gender != "f" || casa.Plural != "" {
+		t.Errorf("unexpected word: %+v (%v)", casa, err)
+	}
+	if _, err := db.editWord("spanish", &WordDiff{Id: casa.Id, Gender: strPtr("f")}, 0, now); !errors.Is(err, ErrInvalidWordMeta) {
+		t.Errorf("expected ErrInvalidWordMeta setting a removed gender, got %v", err)
+	}
+}
+
+// All feminine nouns at A2 can be listed.
+func TestWordMetaFilters(t *testing.T) {
+	db := newTestDb(t)
+	srvr := newTestServer(t, db)
+	tc := newTestClient(t, srvr)
+	tc.register("alice")
+	if code := tc.do(http.MethodPost, "/langs", Lang{Name: "spanish", Locale: "es"}, nil); code != http.StatusOK {
+		t.Fatalf("error creating language: %d", code)
+	}
+	for _, word := range []Word{
+		{Word: "mesa", Pos: "noun", Gender: "f", CEFR: "A2"},
+		{Word: "libro", Pos: "noun", Gender: "m", CEFR: "A2"},
+		{Word: "silla", Pos: "noun", Gender: "f", CEFR: "A1"},
+		{Word: "roja", Pos: "adjective", Gender: "f", CEFR: "A2"},
+		{Word: "usted", Pos: "pronoun", Register: "formal"},
+	} {
+		if code := tc.do(http.MethodPost, "/langs/spanish/words", word, nil); code != http.StatusOK {
+			t.Fatalf("error adding %s: %d", word.Word, code)
+		}
+	}
+
+	tests := []struct {
+		query string
+		code  int
+		want  []string
+	}{
+		{"pos=noun&gender=f&cefr=a2", http.StatusOK, []string{"mesa"}},
+		{"pos=Noun", http.StatusOK, []string{"libro", "mesa", "silla"}},
+		{"gender=f", http.StatusOK, []string{"mesa", "roja", "silla"}},
+		{"register=formal", http.StatusOK, []string{"usted"}},
+		{"pos=thing", http.StatusBadRequest, nil},
+		{"register=rude", http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		resp := Response[[]Word]{}
+		code := tc.do(http.MethodGet, "/langs/spanish/words?"+test.query, nil, &resp)
+		if code != test.code {
+			t.Errorf("query %q: expected %d, got %d", test.query, test.code, code)
+		} else if got := wordNames(resp.Content); code == http.StatusOK &&
+			fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("query %q: expected %v, got %v", test.query, test.want, got)
+		}
+	}
+
+	// Invalid metadata is rejected.
+	word := Word{Word: "casa", Gender: "n"}
+	if code := tc.do(http.MethodPost, "/langs/spanish/words", word, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid gender, got %d", code)
+	}
+}
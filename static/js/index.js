@@ -60,26 +60,36 @@ const App = {
       }
     },
     async getAllWords() {
-      const url = new URL(`langs/${this.currLang.id}/words`, this.location.href);
-      const resp = await fetch(url.toString());
-      const jsStr = await resp.text();
-      let jsResp;
-      try {
-        jsResp = JSON.parse(jsStr);
-      } catch {
-        console.log(`error parsing words response JSON: ${jsStr}`);
-        alert(`Error loading all words`);
-        return;
-      }
-      if (!resp.ok) {
-        console.log(`error parsing words response JSON: ${errStr}`);
-        alert(`Error loading all words`);
-        return;
-      }
-      if (jsResp.content === undefined) {
-        jsResp.content = [];
-      }
-      this.words = jsResp.content;
+      // Words are paginated, so keep following the next cursor.
+      const words = [];
+      let next = "";
+      do {
+        const url = new URL(`langs/${this.currLang.id}/words`, this.location.href);
+        url.searchParams.set("limit", "1000");
+        if (next) {
+          url.searchParams.set("after", next);
+        }
+        const resp = await fetch(url.toString());
+        const jsStr = await resp.text();
+        let jsResp;
+        try {
+          jsResp = JSON.parse(jsStr);
+        } catch {
+          console.log(`error parsing words response JSON: ${jsStr}`);
+          alert(`Error loading all words`);
+          return;
+        }
+        if (!resp.ok) {
+          console.log(`error loading words: ${jsResp.error}`);
+          alert(`Error loading all words`);
+          return;
+        }
+        if (jsResp.content !== undefined) {
+          words.push(...jsResp.content);
+        }
+        next = jsResp.next;
+      } while (next);
+      this.words = words;
     },
 
     __blankMethod() {}